@@ -13,15 +13,7 @@ func main() {
 	ctx := context.Background()
 	opts := cli.Options{Verbose: isVerbose()}
 
-	root, err := cli.NewRootCmd(ctx, opts)
-	if err != nil {
-		_, err := fmt.Fprintln(os.Stderr, "error:", err)
-		if err != nil {
-			return
-		}
-		os.Exit(1)
-	}
-
+	root := cli.NewRootCmd(opts)
 	if err := root.ExecuteContext(ctx); err != nil {
 		_, err := fmt.Fprintln(os.Stderr, "error:", err)
 		if err != nil {
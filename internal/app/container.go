@@ -2,9 +2,11 @@ package app
 
 import (
 	"context"
+	"path/filepath"
 
 	"github.com/doeshing/shai-go/internal/infrastructure"
 	"github.com/doeshing/shai-go/internal/infrastructure/ai"
+	"github.com/doeshing/shai-go/internal/pkg/filesystem"
 	"github.com/doeshing/shai-go/internal/pkg/logger"
 	"github.com/doeshing/shai-go/internal/ports"
 	"github.com/doeshing/shai-go/internal/services"
@@ -12,16 +14,21 @@ import (
 
 // Container wires up application services with infrastructure adapters.
 type Container struct {
-	QueryService    *services.QueryService
-	ConfigProvider  ports.ConfigProvider
-	ConfigLoader    *infrastructure.FileLoader
-	ShellIntegrator ports.ShellIntegrator
-	HealthService   *services.HealthService
+	QueryService     *services.QueryService
+	ConfigProvider   ports.ConfigProvider
+	ConfigLoader     *infrastructure.FileLoader
+	ShellIntegrator  ports.ShellIntegrator
+	HealthService    *services.HealthService
+	ProviderFactory  ports.ProviderFactory
+	SecurityService  ports.SecurityService
+	ContextCollector ports.ContextCollector
+	Logger           *logger.StdLogger
 }
 
 // BuildContainer constructs the dependency graph.
-func BuildContainer(ctx context.Context, verbose bool) (*Container, error) {
-	cfgLoader := infrastructure.NewFileLoader("")
+// configPath overrides the config file location; empty uses SHAI_CONFIG or the default.
+func BuildContainer(ctx context.Context, verbose bool, configPath string) (*Container, error) {
+	cfgLoader := infrastructure.NewFileLoader(configPath)
 	cfg, err := cfgLoader.Load(ctx)
 	if err != nil {
 		return nil, err
@@ -39,13 +46,20 @@ func BuildContainer(ctx context.Context, verbose bool) (*Container, error) {
 	}
 
 	shellInstaller := infrastructure.NewInstaller(log)
+	executor := infrastructure.NewLocalExecutor(cfg.Execution.Shell)
+	factoryOptions := ai.DefaultFactoryOptions()
+	factoryOptions.Shell = executor.Shell()
+	factoryOptions.Logger = log
+	factoryOptions.KeyRotationPath = filepath.Join(filesystem.UserHomeDir(), ".shai", "key_rotation.json")
+	providerFactory := ai.NewFactoryWithOptions(factoryOptions)
 
 	queryService := &services.QueryService{
 		ConfigProvider:   cfgLoader,
 		ContextCollector: collector,
-		ProviderFactory:  ai.NewFactory(),
+		ProviderFactory:  providerFactory,
 		SecurityService:  guardrail,
-		Executor:         infrastructure.NewLocalExecutor(""),
+		SecurityProfiles: infrastructure.NewGuardrailProfiles(guardrail),
+		Executor:         executor,
 		Logger:           log,
 	}
 
@@ -57,10 +71,14 @@ func BuildContainer(ctx context.Context, verbose bool) (*Container, error) {
 	}
 
 	return &Container{
-		QueryService:    queryService,
-		ConfigProvider:  cfgLoader,
-		ConfigLoader:    cfgLoader,
-		ShellIntegrator: shellInstaller,
-		HealthService:   healthService,
+		QueryService:     queryService,
+		ConfigProvider:   cfgLoader,
+		ConfigLoader:     cfgLoader,
+		ShellIntegrator:  shellInstaller,
+		HealthService:    healthService,
+		ProviderFactory:  providerFactory,
+		SecurityService:  guardrail,
+		ContextCollector: collector,
+		Logger:           log,
 	}, nil
 }
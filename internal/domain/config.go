@@ -24,6 +24,43 @@ type Preferences struct {
 	Verbose         bool     `yaml:"verbose"`
 	TimeoutSeconds  int      `yaml:"timeout"`
 	FallbackModels  []string `yaml:"fallback_models"`
+	AlwaysCopy      bool     `yaml:"always_copy"`
+	// SystemPreamble is a templated system message sent before every model's prompt.
+	SystemPreamble string `yaml:"system_preamble"`
+	// DeniedCommands are commands the user never wants suggested, matched like
+	// guardrail whitelist entries. This is a preference, not a safety rule.
+	DeniedCommands []string `yaml:"denied_commands,omitempty"`
+	// OutputFilters run after the built-in filters on every generated command.
+	OutputFilters []OutputFilter `yaml:"output_filters,omitempty"`
+	// ConfirmTimeoutSeconds bounds how long a confirmation prompt waits for an
+	// answer before cancelling. Zero waits indefinitely.
+	ConfirmTimeoutSeconds int `yaml:"confirm_timeout,omitempty"`
+	// Routing picks a model by prompt before falling back to DefaultModel.
+	// Rules are checked in order and the first match wins.
+	Routing []RoutingRule `yaml:"routing,omitempty"`
+	// LogPrompts lets prompts and commands appear verbatim in logs. When off,
+	// logs carry only their length and a hash.
+	LogPrompts bool `yaml:"log_prompts,omitempty"`
+	// DefaultFlags are query flags applied to every query unless the same
+	// flag is given on the command line, e.g. ["--copy", "--no-k8s"].
+	DefaultFlags []string `yaml:"default_flags,omitempty"`
+	// NeverExecute lists regular expressions for commands that are only ever
+	// previewed, whatever their risk or --auto-execute; e.g. "kubectl delete".
+	NeverExecute []string `yaml:"never_execute,omitempty"`
+}
+
+// RoutingRule sends prompts matching Match, a case-insensitive regular
+// expression (a plain keyword works), to the model named Model.
+type RoutingRule struct {
+	Match string `yaml:"match"`
+	Model string `yaml:"model"`
+}
+
+// OutputFilter is a regular expression substitution applied to generated
+// commands before guardrail evaluation. Replace may use $1-style references.
+type OutputFilter struct {
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
 }
 
 // ContextSettings configures what environmental context is collected and sent to AI.
@@ -35,6 +72,10 @@ type ContextSettings struct {
 	IncludeGit   string `yaml:"include_git"`
 	IncludeK8s   string `yaml:"include_k8s"`
 	IncludeEnv   bool   `yaml:"include_env"`
+	// MaxPromptChars caps the context injected into prompts; 0 means unlimited.
+	MaxPromptChars int `yaml:"max_prompt_chars"`
+	// Sanitize filters prompt-injection-style text from collected context; nil means enabled.
+	Sanitize *bool `yaml:"sanitize,omitempty"`
 }
 
 // SecuritySettings defines security guardrail behavior to prevent dangerous commands.
@@ -42,6 +83,8 @@ type ContextSettings struct {
 type SecuritySettings struct {
 	Enabled   bool   `yaml:"enabled"`
 	RulesFile string `yaml:"rules_file"`
+	// Profiles maps guardrail profile names (e.g. relaxed, strict) to rules files.
+	Profiles map[string]string `yaml:"profiles,omitempty"`
 }
 
 // ExecutionSettings controls how generated commands are executed.
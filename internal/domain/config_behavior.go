@@ -1,6 +1,12 @@
 package domain
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Rich Domain Model: 將業務邏輯封裝在 Domain 實體中
 // 符合 Clean Code 原則 - 貧血模型 → 富領域模型
@@ -99,6 +105,31 @@ func (c *Config) removeFromFallbackModels(name string) {
 	c.Preferences.FallbackModels = updatedFallbacks
 }
 
+// MoveFallbackModel places name directly before (or with after, after) anchor
+// in the fallback list, adding it when it is not a fallback yet.
+// Returns an error if either model is unknown or anchor is not a fallback
+func (c *Config) MoveFallbackModel(name, anchor string, after bool) error {
+	if !c.HasModel(name) {
+		return fmt.Errorf("model %s not found", name)
+	}
+	if name == anchor {
+		return fmt.Errorf("cannot move model %s relative to itself", name)
+	}
+
+	fallbacks := slices.DeleteFunc(slices.Clone(c.Preferences.FallbackModels), func(fallback string) bool {
+		return fallback == name
+	})
+	index := slices.Index(fallbacks, anchor)
+	if index < 0 {
+		return fmt.Errorf("model %s is not in fallback_models", anchor)
+	}
+	if after {
+		index++
+	}
+	c.Preferences.FallbackModels = slices.Insert(fallbacks, index, name)
+	return nil
+}
+
 // SetDefaultModel changes the default model to the specified name
 // Returns an error if the model doesn't exist
 func (c *Config) SetDefaultModel(name string) error {
@@ -110,6 +141,17 @@ func (c *Config) SetDefaultModel(name string) error {
 	return nil
 }
 
+// ClearDefaultModel unsets the default model so queries fall back to the
+// first configured model unless --model is given
+// Returns false when there are no models, leaving the config unchanged
+func (c *Config) ClearDefaultModel() bool {
+	if len(c.Models) == 0 {
+		return false
+	}
+	c.Preferences.DefaultModel = ""
+	return true
+}
+
 // GetFallbackModels returns the list of fallback models that actually exist
 // Filters out any fallback models that are not in the configuration
 func (c *Config) GetFallbackModels() []ModelDefinition {
@@ -139,6 +181,80 @@ func (c *Config) ShouldConfirmBeforeExecution() bool {
 	return c.Execution.ConfirmBeforeExecute
 }
 
+// ShouldCopyToClipboard checks if generated commands should be copied for this request
+func (c *Config) ShouldCopyToClipboard(req QueryRequest) bool {
+	return req.CopyToClipboard || c.Preferences.AlwaysCopy
+}
+
+// DeniedBy returns the deny list entry matching command, if any. Each command
+// of a chain or pipeline is checked on its own, both as written and without
+// sudo, doas, env or VAR=value prefixes, so "sudo brew upgrade" and
+// "brew update && brew upgrade" are caught too. An entry matches a whole
+// command or its leading words (e.g. "brew upgrade" denies
+// "brew upgrade --greedy"); whitespace differences are ignored.
+func (c *Config) DeniedBy(command string) (string, bool) {
+	var forms []string
+	for _, segment := range commandSeparator.Split(command, -1) {
+		fields := strings.Fields(segment)
+		forms = append(forms, strings.Join(fields, " "), strings.Join(unwrapCommand(fields), " "))
+	}
+	for _, entry := range c.Preferences.DeniedCommands {
+		denied := strings.Join(strings.Fields(entry), " ")
+		if denied == "" {
+			continue
+		}
+		for _, form := range forms {
+			if form == denied || strings.HasPrefix(form, denied+" ") {
+				return entry, true
+			}
+		}
+	}
+	return "", false
+}
+
+// commandSeparator splits a command line into the commands it runs.
+var commandSeparator = regexp.MustCompile(`&&|\|\||[;|]`)
+
+// commandWrappers run the command that follows them, mapped to their options
+// that take a separate value.
+var commandWrappers = map[string][]string{
+	"sudo": {"-u", "-g"},
+	"doas": {"-u"},
+	"env":  {"-u", "-C"},
+}
+
+// envAssignment matches a VAR=value word placed before a command.
+var envAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// unwrapCommand drops wrappers and environment assignments from the front of
+// fields, leaving the command that actually runs.
+func unwrapCommand(fields []string) []string {
+	for len(fields) > 0 {
+		valueFlags, wrapper := commandWrappers[fields[0]]
+		switch {
+		case wrapper:
+			fields = fields[1:]
+			for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+				if slices.Contains(valueFlags, fields[0]) && len(fields) > 1 {
+					fields = fields[1:]
+				}
+				fields = fields[1:]
+			}
+		case envAssignment.MatchString(fields[0]):
+			fields = fields[1:]
+		default:
+			return fields
+		}
+	}
+	return fields
+}
+
+// ShouldSanitizeContext checks if collected context is screened for prompt injection.
+// Sanitizing stays on unless the config explicitly disables it.
+func (c *Config) ShouldSanitizeContext() bool {
+	return c.Context.Sanitize == nil || *c.Context.Sanitize
+}
+
 // ShouldAutoExecuteSafe checks if safe commands should be auto-executed
 func (c *Config) ShouldAutoExecuteSafe() bool {
 	return c.Preferences.AutoExecuteSafe
@@ -191,6 +307,15 @@ func (c *Config) GetTimeoutSeconds() int {
 	return c.Preferences.TimeoutSeconds
 }
 
+// GetConfirmTimeout returns how long confirmation prompts wait for an answer
+// Zero (the default) means no timeout
+func (c *Config) GetConfirmTimeout() time.Duration {
+	if c.Preferences.ConfirmTimeoutSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(c.Preferences.ConfirmTimeoutSeconds) * time.Second
+}
+
 // ValidateConsistency checks the internal consistency of the configuration
 // Returns an error if there are inconsistencies (e.g., default model doesn't exist)
 func (c *Config) ValidateConsistency() error {
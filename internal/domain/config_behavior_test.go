@@ -268,6 +268,41 @@ func TestConfig_SetDefaultModel(t *testing.T) {
 	}
 }
 
+// TestConfig_ClearDefaultModel tests unsetting the default model
+func TestConfig_ClearDefaultModel(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      domain.Config
+		wantCleared bool
+		wantDefault string
+	}{
+		{
+			name: "clears the default model",
+			config: domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "gpt4"},
+				Models:      []domain.ModelDefinition{{Name: "claude"}, {Name: "gpt4"}},
+			},
+			wantCleared: true,
+		},
+		{
+			name:        "no-op without models",
+			config:      domain.Config{Preferences: domain.Preferences{DefaultModel: "gpt4"}},
+			wantDefault: "gpt4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.ClearDefaultModel(); got != tt.wantCleared {
+				t.Errorf("ClearDefaultModel() = %v, want %v", got, tt.wantCleared)
+			}
+			if tt.config.Preferences.DefaultModel != tt.wantDefault {
+				t.Errorf("expected default model %q, got %q", tt.wantDefault, tt.config.Preferences.DefaultModel)
+			}
+		})
+	}
+}
+
 // TestConfig_ValidateConsistency tests configuration consistency validation
 func TestConfig_ValidateConsistency(t *testing.T) {
 	tests := []struct {
@@ -419,3 +454,43 @@ func TestConfig_ContextSettings(t *testing.T) {
 		})
 	}
 }
+
+// TestConfig_DeniedBy tests deny list matching
+func TestConfig_DeniedBy(t *testing.T) {
+	config := domain.Config{
+		Preferences: domain.Preferences{
+			DeniedCommands: []string{"brew upgrade", "  sudo   reboot "},
+		},
+	}
+
+	tests := []struct {
+		command    string
+		wantEntry  string
+		wantDenied bool
+	}{
+		{command: "brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "brew  upgrade --greedy", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "sudo reboot", wantEntry: "  sudo   reboot ", wantDenied: true},
+		{command: "sudo brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "sudo -u admin brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "env X=1 brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "HOMEBREW_NO_AUTO_UPDATE=1 brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "brew update && brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "brew update || brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "brew update;brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "yes | brew upgrade", wantEntry: "brew upgrade", wantDenied: true},
+		{command: "brew upgrade-all"},
+		{command: "brew update"},
+		{command: "echo brew upgrade"},
+		{command: "reboot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			entry, denied := config.DeniedBy(tt.command)
+			if denied != tt.wantDenied || entry != tt.wantEntry {
+				t.Errorf("DeniedBy(%q) = %q, %v; want %q, %v", tt.command, entry, denied, tt.wantEntry, tt.wantDenied)
+			}
+		})
+	}
+}
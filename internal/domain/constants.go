@@ -18,6 +18,12 @@ const (
 	DefaultCommandTimeout = 2 * time.Second
 	// DefaultHTTPClientTimeout is the timeout for HTTP client requests
 	DefaultHTTPClientTimeout = 60 * time.Second
+	// DefaultHTTPIdleConnTimeout is how long an idle provider connection is kept for reuse
+	DefaultHTTPIdleConnTimeout = 90 * time.Second
+	// DefaultAuthCommandTimeout bounds how long an auth_command may run
+	DefaultAuthCommandTimeout = 10 * time.Second
+	// DefaultFileLockTimeout bounds how long a config or guardrail write waits for the file lock
+	DefaultFileLockTimeout = 2 * time.Second
 )
 
 // Limit constants
@@ -26,6 +32,8 @@ const (
 	DefaultPreviewMaxFiles = 10
 	// MinPreviewMaxFiles is the minimum number of files to preview
 	MinPreviewMaxFiles = 1
+	// DefaultHTTPMaxIdleConnsPerHost is the number of idle connections kept per provider host
+	DefaultHTTPMaxIdleConnsPerHost = 8
 )
 
 // Model configuration constants
@@ -34,6 +42,10 @@ const (
 	DefaultMaxTokens = 1024
 	// DefaultModelTestTimeout is the default timeout for model testing
 	DefaultModelTestTimeout = 30 * time.Second
+	// DefaultModelBenchRuns is the default number of generations for models bench
+	DefaultModelBenchRuns = 5
+	// DefaultFixAttempts is how often --fix-on-failure asks for a corrected command
+	DefaultFixAttempts = 2
 )
 
 // Time formats
@@ -41,3 +53,6 @@ const (
 	// TimestampFormat is the standard timestamp format
 	TimestampFormat = time.RFC3339
 )
+
+// KnownShells are the shells --assume-shell may target.
+var KnownShells = []string{"sh", "bash", "zsh", "fish", "dash", "ksh", "tcsh", "csh", "pwsh", "nu"}
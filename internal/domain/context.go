@@ -9,24 +9,25 @@ package domain
 // This snapshot provides the AI with context about the user's current environment,
 // enabling more accurate and relevant command suggestions.
 type ContextSnapshot struct {
-	WorkingDir      string
-	Shell           string
-	OS              string
-	User            string
-	Files           []FileInfo
-	AvailableTools  []string
-	Git             *GitStatus
-	Kubernetes      *KubeStatus
-	EnvironmentVars map[string]string
-	Docker          *DockerStatus
-	Telemetry       TelemetryInfo
+	WorkingDir      string            `yaml:"working_dir,omitempty" json:"working_dir,omitempty"`
+	Shell           string            `yaml:"shell,omitempty" json:"shell,omitempty"`
+	OS              string            `yaml:"os,omitempty" json:"os,omitempty"`
+	Distro          string            `yaml:"distro,omitempty" json:"distro,omitempty"`
+	User            string            `yaml:"user,omitempty" json:"user,omitempty"`
+	Files           []FileInfo        `yaml:"files,omitempty" json:"files,omitempty"`
+	AvailableTools  []string          `yaml:"available_tools,omitempty" json:"available_tools,omitempty"`
+	Git             *GitStatus        `yaml:"git,omitempty" json:"git,omitempty"`
+	Kubernetes      *KubeStatus       `yaml:"kubernetes,omitempty" json:"kubernetes,omitempty"`
+	EnvironmentVars map[string]string `yaml:"environment,omitempty" json:"environment,omitempty"`
+	Docker          *DockerStatus     `yaml:"docker,omitempty" json:"docker,omitempty"`
+	Telemetry       TelemetryInfo     `yaml:"telemetry,omitempty" json:"telemetry,omitempty"`
 }
 
 // FileInfo is a minimal representation of discovered files.
 type FileInfo struct {
-	Path string
-	Size int64
-	Type FileType
+	Path string   `yaml:"path,omitempty" json:"path,omitempty"`
+	Size int64    `yaml:"size,omitempty" json:"size,omitempty"`
+	Type FileType `yaml:"type,omitempty" json:"type,omitempty"`
 }
 
 // FileType describes the type of file entry.
@@ -41,29 +42,40 @@ const (
 
 // GitStatus captures contextual Git data.
 type GitStatus struct {
-	Branch             string
-	ModifiedCount      int
-	UntrackedCount     int
-	HasUnpushedCommits bool
-	Summary            string
-	DiffStat           string
+	Branch             string `yaml:"branch,omitempty" json:"branch,omitempty"`
+	ModifiedCount      int    `yaml:"modified_count,omitempty" json:"modified_count,omitempty"`
+	UntrackedCount     int    `yaml:"untracked_count,omitempty" json:"untracked_count,omitempty"`
+	HasUnpushedCommits bool   `yaml:"has_unpushed_commits,omitempty" json:"has_unpushed_commits,omitempty"`
+	Summary            string `yaml:"summary,omitempty" json:"summary,omitempty"`
+	DiffStat           string `yaml:"diff_stat,omitempty" json:"diff_stat,omitempty"`
 }
 
 // KubeStatus captures contextual Kubernetes data.
 type KubeStatus struct {
-	Context        string
-	Namespace      string
-	Namespaces     []string
-	ClusterVersion string
+	Context        string   `yaml:"context,omitempty" json:"context,omitempty"`
+	Namespace      string   `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Namespaces     []string `yaml:"namespaces,omitempty" json:"namespaces,omitempty"`
+	ClusterVersion string   `yaml:"cluster_version,omitempty" json:"cluster_version,omitempty"`
 }
 
 // DockerStatus captures docker daemon state info.
 type DockerStatus struct {
-	Running bool
-	Info    string
+	Running bool   `yaml:"running" json:"running"`
+	Info    string `yaml:"info,omitempty" json:"info,omitempty"`
 }
 
 // TelemetryInfo captures data collection metadata.
 type TelemetryInfo struct {
-	ToolCacheExpires string
+	ToolCacheExpires string `yaml:"tool_cache_expires,omitempty" json:"tool_cache_expires,omitempty"`
+	// ProbeErrors maps a probe source (ProbeGit, ...) to why it produced no or
+	// partial data, such as a timeout, so empty context is not mistaken for
+	// "no repository".
+	ProbeErrors map[string]string `yaml:"probe_errors,omitempty" json:"probe_errors,omitempty"`
 }
+
+// Context probe sources, used as TelemetryInfo.ProbeErrors keys.
+const (
+	ProbeGit        = "git"
+	ProbeKubernetes = "kubernetes"
+	ProbeDocker     = "docker"
+)
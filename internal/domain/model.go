@@ -5,23 +5,62 @@
 // business logic and data structures.
 package domain
 
+import "strings"
+
 // ModelDefinition describes an AI provider configuration declared in the config file.
 // Each model represents a specific AI service endpoint with its authentication and
 // generation parameters.
 type ModelDefinition struct {
-	Name       string          `yaml:"name"`
-	Endpoint   string          `yaml:"endpoint"`
-	AuthEnvVar string          `yaml:"auth_env_var"`
-	OrgEnvVar  string          `yaml:"org_env_var"`
-	ModelID    string          `yaml:"model_id"`
-	MaxTokens  int             `yaml:"max_tokens"`
-	Prompt     []PromptMessage `yaml:"prompt"`
-	APIFormat  APIFormat       `yaml:"api_format,omitempty"`
+	Name             string          `yaml:"name"`
+	Endpoint         string          `yaml:"endpoint"`
+	AuthEnvVar       string          `yaml:"auth_env_var"`
+	AuthEnvVars      []string        `yaml:"auth_env_vars,omitempty"`
+	AuthCommand      string          `yaml:"auth_command,omitempty"`
+	OrgEnvVar        string          `yaml:"org_env_var"`
+	ModelID          string          `yaml:"model_id"`
+	MaxTokens        int             `yaml:"max_tokens"`
+	Prompt           []PromptMessage `yaml:"prompt"`
+	APIFormat        APIFormat       `yaml:"api_format,omitempty"`
+	GuardrailProfile string          `yaml:"guardrail_profile,omitempty"`
+	// Seed asks providers that support it for reproducible output; nil omits it.
+	Seed *int `yaml:"seed,omitempty"`
+	// AutoExecuteUpTo skips low/medium confirmations for this model's commands
+	// at or below the level (safe, low or medium); empty always asks.
+	AutoExecuteUpTo RiskLevel `yaml:"auto_execute_up_to,omitempty"`
+}
+
+// AuthEnvVarNames returns every environment variable that may hold an API key for this model.
+// AuthEnvVar may itself be a comma-separated list; AuthEnvVars entries follow in order.
+// Duplicates and blank names are dropped. AuthCommand is not consulted here;
+// the HTTP provider runs it through the execution shell only when none of these
+// variables is set, once per process.
+func (m ModelDefinition) AuthEnvVarNames() []string {
+	candidates := append(strings.Split(m.AuthEnvVar, ","), m.AuthEnvVars...)
+	names := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, name := range candidates {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
 }
 
 // APIFormat defines how to construct requests and parse responses for different AI APIs.
 // All fields are optional with sensible defaults (OpenAI-compatible format).
 type APIFormat struct {
+	// Provider names a provider registered with the factory, overriding the
+	// endpoint scheme. Default: chosen by endpoint scheme, else the HTTP provider.
+	Provider string `yaml:"provider,omitempty"`
+
+	// Protocol selects the request/response shape.
+	// Values: "openai" (default) - chat completions built from the fields below
+	//         "ollama-native" - Ollama's /api/chat or /api/generate, including NDJSON replies
+	Protocol string `yaml:"protocol,omitempty"`
+
 	// AuthHeaderName specifies the HTTP header name for authentication.
 	// Default: "Authorization"
 	AuthHeaderName string `yaml:"auth_header_name,omitempty"`
@@ -46,9 +85,28 @@ type APIFormat struct {
 	// Example: "content[0].text" (Anthropic format)
 	ResponseJSONPath string `yaml:"response_json_path,omitempty"`
 
+	// BaseURLEnvVar names an environment variable holding a base URL (e.g. "OPENAI_BASE_URL").
+	// When the variable is set, its scheme and host replace those of the model endpoint;
+	// the endpoint path is kept, so any path in the variable is ignored.
+	// Example: "http://localhost:4000" + "/v1/chat/completions"
+	BaseURLEnvVar string `yaml:"base_url_env_var,omitempty"`
+
 	// ExtraHeaders contains additional HTTP headers to send with each request.
 	// Example: {"anthropic-version": "2023-06-01"}
 	ExtraHeaders map[string]string `yaml:"extra_headers,omitempty"`
+
+	// QueryParams are added to the endpoint's query string, replacing keys of
+	// the same name. Values expand ${ENV_VAR} references.
+	// Example: {"api-version": "2024-06-01", "key": "${GEMINI_API_KEY}"}
+	QueryParams map[string]string `yaml:"query_params,omitempty"`
+
+	// RequestTemplate is a Go text/template rendered as the request body,
+	// bypassing the built-in builder and the fields above that shape it.
+	// The output must be valid JSON; use {{json .X}} to quote values.
+	// Variables: .Model, .MaxTokens, .System, .Prompt (last user message),
+	// .Messages (non-system) and .AllMessages (each with .Role and .Content)
+	// Example: {"input": {"text": {{json .Prompt}}}, "model": {{json .Model}}}
+	RequestTemplate string `yaml:"request_template,omitempty"`
 }
 
 // PromptMessage follows the role/content pair required by most chat APIs.
@@ -59,6 +117,10 @@ type PromptMessage struct {
 
 // API Format Constants define standard values for APIFormat fields.
 const (
+	// Protocols
+	ProtocolOpenAI       = "openai"        // Default: OpenAI-compatible chat completions
+	ProtocolOllamaNative = "ollama-native" // Ollama /api/chat and /api/generate
+
 	// Auth header defaults
 	DefaultAuthHeaderName   = "Authorization"
 	DefaultAuthHeaderPrefix = "Bearer "
@@ -127,6 +189,17 @@ func (f APIFormat) IsSystemMessageSeparate() bool {
 	return f.GetSystemMessageMode() == SystemMessageModeSeparate
 }
 
+// IsOllamaNative returns true if requests use Ollama's native API instead of the OpenAI shape.
+func (f APIFormat) IsOllamaNative() bool {
+	return strings.EqualFold(f.Protocol, ProtocolOllamaNative)
+}
+
+// AcceptsSeed returns true if the built-in request body may carry a seed.
+// Anthropic-style APIs (separate system field or wrapped content) have no seed parameter.
+func (f APIFormat) AcceptsSeed() bool {
+	return !f.IsSystemMessageSeparate() && !f.IsContentWrapped()
+}
+
 // IsContentWrapped returns true if content should be wrapped in Anthropic's array format.
 func (f APIFormat) IsContentWrapped() bool {
 	return f.GetContentWrapper() == ContentWrapperAnthropic
@@ -1,20 +1,37 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 // QueryRequest captures user intent originating from CLI or shell integration.
 type QueryRequest struct {
 	Context         context.Context
 	Prompt          string
 	ModelOverride   string
+	WorkDir         string
+	Env             map[string]string // added to the command's environment (--env)
+	AssumeShell     string            // shell the model writes for; a command for another shell than the executor's is only previewed
 	AutoExecute     bool
+	AssumeYes       bool
+	ExplainRisk     bool
+	PreviewOnly     bool // never prompt or execute; guardrail blocks still fail the query
 	CopyToClipboard bool
 	WithGitStatus   bool
 	WithEnv         bool
 	WithK8sInfo     bool
+	NoContext       bool
+	NoGit           bool
+	NoK8s           bool
+	NoEnv           bool
 	Debug           bool
 	Stream          bool
+	Seed            *int // overrides the model's seed when set
+	FixAttempts     int  // times to ask for a corrected command after a non-zero exit
 	StreamWriter    StreamWriter
+	Observer        QueryObserver // optional; notified as each stage completes
 }
 
 // QueryResponse is the canonical response propagated back to the CLI.
@@ -23,10 +40,44 @@ type QueryResponse struct {
 	NaturalLanguage    string
 	Reasoning          string
 	RiskAssessment     RiskAssessment
+	RiskExplanation    string
 	ExecutionPlanned   bool
+	AutoConfirmed      bool
 	ExecutionResult    *ExecutionResult
 	ContextInformation ContextSnapshot
 	ModelUsed          string
+	Copied             bool
+	ClipboardNotice    string
+	// ShellNotice explains why a command written for QueryRequest.AssumeShell
+	// is not run by an executor using another shell.
+	ShellNotice string
+	// Timings lists how long each completed stage took, in order.
+	Timings []StageTiming
+	// FailedAttempts are the commands that exited non-zero before Command,
+	// the model's correction, was run (see QueryRequest.FixAttempts).
+	FailedAttempts []FailedAttempt
+}
+
+// FailedAttempt is an executed command that failed and was sent back to the
+// model for a fix.
+type FailedAttempt struct {
+	Command string
+	Result  ExecutionResult
+}
+
+// Query stages reported in QueryResponse.Timings.
+const (
+	StageLoadConfig     = "load_config"
+	StageCollectContext = "collect_context"
+	StageGenerate       = "generate"
+	StageEvaluate       = "evaluate"
+	StageExecute        = "execute"
+)
+
+// StageTiming is how long one stage of a query took.
+type StageTiming struct {
+	Stage    string
+	Duration time.Duration
 }
 
 // ExecutionResult wraps details from the command executor.
@@ -38,6 +89,33 @@ type ExecutionResult struct {
 	DurationMS  int64
 	Err         error
 	DryRunNotes string
+	// Signal names the signal that terminated the command, e.g. "SIGTERM";
+	// ExitCode is -1 when it is set.
+	Signal string
+	// TimedOut is set when the execution timeout killed the command.
+	TimedOut bool
+}
+
+// Status summarises how the command ended: "timeout", "killed(SIGTERM)" or
+// "exit 2".
+func (r ExecutionResult) Status() string {
+	switch {
+	case r.TimedOut:
+		return "timeout"
+	case r.Signal != "":
+		return "killed(" + r.Signal + ")"
+	}
+	return fmt.Sprintf("exit %d", r.ExitCode)
+}
+
+// ModelComparison is one model's answer to a prompt asked of several models.
+// Err is set when that model failed; the other models' results still apply.
+type ModelComparison struct {
+	Model          string
+	Command        string
+	Reasoning      string
+	RiskAssessment RiskAssessment
+	Err            error
 }
 
 // QueryService exposes the use-case boundary for handling a query.
@@ -50,3 +128,16 @@ type StreamWriter interface {
 	WriteChunk(text string)
 	Done()
 }
+
+// QueryObserver is notified as each stage of a query completes, so callers
+// such as editor integrations can report progress before the query returns.
+type QueryObserver interface {
+	ContextCollected(ContextSnapshot)
+	CommandGenerated(command, model string)
+	RiskAssessed(RiskAssessment)
+	// Confirmed reports the answer given when the user was asked to confirm.
+	Confirmed(risk RiskAssessment, choice ExecutionChoice)
+	// Skipped reports that the command will not run, and why.
+	Skipped(reason string)
+	Executed(ExecutionResult)
+}
@@ -23,6 +23,17 @@ const (
 	ActionBlock           GuardrailAction = "block"
 )
 
+// ExecutionChoice is the user's answer to a confirmation that offers more
+// than yes or no.
+type ExecutionChoice string
+
+const (
+	ChoiceRun   ExecutionChoice = "run"
+	ChoiceEdit  ExecutionChoice = "edit" // revise the command, then confirm again
+	ChoiceCopy  ExecutionChoice = "copy" // copy to the clipboard instead of running
+	ChoiceAbort ExecutionChoice = "abort"
+)
+
 // RiskAssessment aggregates security evaluation data.
 type RiskAssessment struct {
 	Level          RiskLevel
@@ -33,6 +44,8 @@ type RiskAssessment struct {
 	PreviewEntries []string
 	DryRunCommand  string
 	UndoHints      []string
+	// NeedsNetwork is set when the command appears to reach the network.
+	NeedsNetwork bool
 }
 
 // GuardrailRules is the in-memory representation of YAML guardrail configuration.
@@ -25,7 +25,19 @@ type ShellStatus struct {
 	ScriptPath   string
 	RCFile       string
 	ScriptExists bool
-	LinePresent  bool
-	Error        string
-	Warnings     []string
+	// ScriptCurrent reports whether the on-disk hook matches the embedded one.
+	ScriptCurrent bool
+	LinePresent   bool
+	Error         string
+	Warnings      []string
+}
+
+// BinaryStatus compares the installed ~/.shai/bin/shai copy with the running binary.
+type BinaryStatus struct {
+	Path             string
+	Exists           bool
+	SameBinary       bool
+	InstalledVersion string
+	RunningVersion   string
+	Error            string
 }
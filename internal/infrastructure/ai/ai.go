@@ -2,7 +2,9 @@
 //
 // This package implements a unified, configuration-driven approach to AI providers:
 //   - Factory: Creates provider instances based on model definitions
+//   - Registry: Maps endpoint schemes or api_format.provider to provider constructors
 //   - HTTP Provider: Generic HTTP client supporting any AI service via YAML config
+//   - Heuristic Provider: Offline keyword rules selected by a heuristic:// endpoint
 //   - Prompt Templates: Renders user prompts with context using Go templates
 //
 // All provider-specific behavior is controlled through the model's APIFormat configuration,
@@ -12,15 +14,26 @@ package ai
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/redact"
 	"github.com/doeshing/shai-go/internal/ports"
 )
 
@@ -37,23 +50,114 @@ const (
 // It maintains a single HTTP client shared across all providers.
 type Factory struct {
 	httpClient *http.Client
+	debugLog   ports.Logger
+	keys       *keyRotation
+	shell      string
+	registry   map[string]ProviderConstructor
+}
+
+// FactoryOptions tunes the HTTP client shared by every provider of a Factory.
+type FactoryOptions struct {
+	// Timeout bounds each request, including reading the response body.
+	Timeout time.Duration
+	// MaxIdleConnsPerHost is how many idle connections to one provider are
+	// kept for reuse, so repeated queries skip the TLS handshake.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes connections that stay idle this long.
+	IdleConnTimeout time.Duration
+	// HTTP2 lets the transport negotiate HTTP/2 with endpoints that offer it.
+	HTTP2 bool
+	// Shell runs auth_command, normally the one commands are executed with.
+	// Empty uses /bin/sh.
+	Shell string
+	// Logger receives request/response dumps at debug level for requests with
+	// Debug set. Nil drops them.
+	Logger ports.Logger
+	// KeyRotationPath stores each model's next API key index so round-robin
+	// continues across runs. Empty keeps the position for this process only.
+	KeyRotationPath string
+}
+
+// DefaultFactoryOptions returns the options used by NewFactory.
+func DefaultFactoryOptions() FactoryOptions {
+	return FactoryOptions{
+		Timeout:             httpClientTimeout,
+		MaxIdleConnsPerHost: domain.DefaultHTTPMaxIdleConnsPerHost,
+		IdleConnTimeout:     domain.DefaultHTTPIdleConnTimeout,
+		HTTP2:               true,
+	}
 }
 
 // NewFactory creates a new provider factory with a configured HTTP client.
+// The heuristic provider is registered for the heuristic:// scheme and the
+// generic HTTP provider as "http"; every other model uses the provider
+// registered as "http" unless another one is registered for it.
 func NewFactory() *Factory {
-	return &Factory{
-		httpClient: &http.Client{Timeout: httpClientTimeout},
+	return NewFactoryWithOptions(DefaultFactoryOptions())
+}
+
+// NewFactoryWithOptions is NewFactory with a custom HTTP client configuration.
+func NewFactoryWithOptions(opts FactoryOptions) *Factory {
+	f := &Factory{
+		httpClient: &http.Client{Timeout: opts.Timeout, Transport: newTransport(opts)},
+		debugLog:   opts.Logger,
+		keys:       newKeyRotation(opts.KeyRotationPath),
+		shell:      opts.Shell,
+		registry:   map[string]ProviderConstructor{},
 	}
+	f.Register(heuristicProviderName, func(model domain.ModelDefinition) (ports.Provider, error) {
+		return newHeuristicProvider(model), nil
+	})
+	f.Register(providerName, f.newHTTPProvider)
+	return f
 }
 
-// ForModel creates a generic HTTP provider for any model definition.
-// All provider-specific behavior is controlled through the model's APIFormat configuration.
+// ForModel creates the provider selected by the model's api_format.provider or,
+// when unset, by its endpoint scheme. Models matching no registered provider get
+// the provider registered as "http", by default the generic HTTP provider, whose
+// behavior is controlled through APIFormat.
 func (f *Factory) ForModel(model domain.ModelDefinition) (ports.Provider, error) {
-	return newHTTPProvider(model, f.httpClient), nil
+	if selector := providerSelector(model.APIFormat.Provider); selector != "" {
+		constructor, ok := f.registry[selector]
+		if !ok {
+			return nil, fmt.Errorf("model %s: unknown provider %q", model.Name, model.APIFormat.Provider)
+		}
+		return constructor(model)
+	}
+	if constructor, ok := f.registry[endpointScheme(model.Endpoint)]; ok {
+		return constructor(model)
+	}
+	return f.registry[providerName](model)
+}
+
+// newHTTPProvider builds the generic HTTP provider with the factory's shared
+// client, debug output, key rotation and auth shell.
+func (f *Factory) newHTTPProvider(model domain.ModelDefinition) (ports.Provider, error) {
+	provider := newHTTPProvider(model, f.httpClient, f.debugLog, f.keys).(*httpProvider)
+	provider.shell = f.shell
+	return provider, nil
+}
+
+// newTransport clones the default transport, keeping its proxy and dial
+// settings, and applies the connection reuse options.
+func newTransport(opts FactoryOptions) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = opts.IdleConnTimeout
+	transport.ForceAttemptHTTP2 = opts.HTTP2
+	if !opts.HTTP2 {
+		// A non-nil empty map is how net/http is told not to upgrade to HTTP/2.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
 }
 
 var _ ports.ProviderFactory = (*Factory)(nil)
 
+// ErrResponseParse marks a provider reply that arrived but did not match the
+// model's APIFormat, as opposed to a connectivity or HTTP failure.
+var ErrResponseParse = errors.New("response did not match api_format")
+
 // ====================================================================================
 // HTTP Provider
 // ====================================================================================
@@ -63,13 +167,23 @@ var _ ports.ProviderFactory = (*Factory)(nil)
 type httpProvider struct {
 	model      domain.ModelDefinition
 	httpClient *http.Client
+	debugLog   ports.Logger
+	keys       *keyRotation
+	// shell runs auth_command; empty uses /bin/sh.
+	shell      string
+	commandKey string
 }
 
 // newHTTPProvider creates a new HTTP-based AI provider.
-func newHTTPProvider(model domain.ModelDefinition, client *http.Client) ports.Provider {
+// debugLog receives request/response dumps at debug level when a request has
+// Debug set; keys is shared across
+// providers so rotation spans every request of the process.
+func newHTTPProvider(model domain.ModelDefinition, client *http.Client, debugLog ports.Logger, keys *keyRotation) ports.Provider {
 	return &httpProvider{
 		model:      model,
 		httpClient: client,
+		debugLog:   debugLog,
+		keys:       keys,
 	}
 }
 
@@ -82,9 +196,17 @@ func (p *httpProvider) Model() domain.ModelDefinition {
 }
 
 func (p *httpProvider) Generate(ctx context.Context, req ports.ProviderRequest) (ports.ProviderResponse, error) {
-	messages, err := renderPromptMessages(p.model, req.Prompt, req.Context)
-	if err != nil {
-		return ports.ProviderResponse{}, fmt.Errorf("render prompt: %w", err)
+	messages := req.Messages
+	if len(messages) == 0 {
+		rendered, err := renderPromptMessages(p.model, req.Prompt, req.Context, renderOptions{
+			budget:   req.ContextBudget,
+			sanitize: req.SanitizeContext,
+			preamble: req.SystemPreamble,
+		})
+		if err != nil {
+			return ports.ProviderResponse{}, fmt.Errorf("render prompt: %w", err)
+		}
+		messages = rendered
 	}
 
 	requestBody, err := p.buildRequestBody(messages)
@@ -92,35 +214,45 @@ func (p *httpProvider) Generate(ctx context.Context, req ports.ProviderRequest)
 		return ports.ProviderResponse{}, fmt.Errorf("build request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.model.Endpoint, bytes.NewReader(requestBody))
+	endpoint, err := resolveEndpoint(p.model)
 	if err != nil {
-		return ports.ProviderResponse{}, fmt.Errorf("create HTTP request: %w", err)
+		return ports.ProviderResponse{}, fmt.Errorf("resolve endpoint: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	if err := p.setAuthHeaders(httpReq); err != nil {
+	apiKeys, err := p.apiKeys(ctx)
+	if err != nil {
 		return ports.ProviderResponse{}, fmt.Errorf("set auth headers: %w", err)
 	}
-	p.setExtraHeaders(httpReq)
 
-	resp, err := p.httpClient.Do(httpReq)
-	if err != nil {
-		return ports.ProviderResponse{}, fmt.Errorf("HTTP request failed: %w", err)
+	// Each attempt uses the next key so a rate-limited or revoked key fails over
+	// to the others before the request is reported as failed.
+	attempts := max(len(apiKeys), 1)
+	start := p.keys.next(p.model.Name, len(apiKeys))
+	var (
+		resp         *http.Response
+		responseBody []byte
+	)
+	for attempt := 0; attempt < attempts; attempt++ {
+		apiKey := ""
+		if len(apiKeys) > 0 {
+			apiKey = apiKeys[(start+attempt)%len(apiKeys)]
+		}
+		resp, responseBody, err = p.send(ctx, endpoint, requestBody, apiKey, req.Debug)
+		if err != nil {
+			return ports.ProviderResponse{}, err
+		}
+		if !isKeyRejected(resp.StatusCode) {
+			break
+		}
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		return ports.ProviderResponse{}, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
 	}
 
-	var responseBody bytes.Buffer
-	if _, err := responseBody.ReadFrom(resp.Body); err != nil {
-		return ports.ProviderResponse{}, fmt.Errorf("read response body: %w", err)
-	}
-
-	content, err := p.parseResponse(responseBody.Bytes())
+	content, err := p.parseResponse(responseBody)
 	if err != nil {
-		return ports.ProviderResponse{}, fmt.Errorf("parse response: %w", err)
+		return ports.ProviderResponse{}, fmt.Errorf("parse response: %w: %w", ErrResponseParse, err)
 	}
 
 	command := extractCommand(content)
@@ -131,9 +263,111 @@ func (p *httpProvider) Generate(ctx context.Context, req ports.ProviderRequest)
 	}, nil
 }
 
+// send performs a single HTTP round trip and returns the response with its body fully read.
+func (p *httpProvider) send(ctx context.Context, endpoint string, body []byte, apiKey string, debug bool) (*http.Response, []byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("create HTTP request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.setAuthHeaders(httpReq, apiKey)
+	p.setExtraHeaders(httpReq, debug)
+
+	if debug {
+		p.dumpRequest(httpReq, body)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		// The error quotes the URL, which may carry a key from query_params.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = p.redactEndpoint(urlErr.URL)
+		}
+		return nil, nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var responseBody bytes.Buffer
+	if _, err := responseBody.ReadFrom(resp.Body); err != nil {
+		return nil, nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	if debug {
+		p.dumpResponse(resp, responseBody.Bytes())
+	}
+	return resp, responseBody.Bytes(), nil
+}
+
+// isKeyRejected reports statuses that another API key might not hit.
+func isKeyRejected(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusTooManyRequests
+}
+
+// RequestPreview is the exact request a model would receive, built without any network access.
+type RequestPreview struct {
+	Messages []domain.PromptMessage
+	Endpoint string
+	Headers  http.Header
+	Body     []byte
+}
+
+// PreviewRequest renders the prompt messages and request body exactly as Generate
+// would for model under cfg, but never sends them. Authentication values are redacted.
+func PreviewRequest(cfg domain.Config, model domain.ModelDefinition, prompt string, snapshot domain.ContextSnapshot) (RequestPreview, error) {
+	p := &httpProvider{model: model}
+
+	messages, err := renderPromptMessages(model, prompt, snapshot, renderOptions{
+		budget:   cfg.Context.MaxPromptChars,
+		sanitize: cfg.ShouldSanitizeContext(),
+		preamble: cfg.Preferences.SystemPreamble,
+	})
+	if err != nil {
+		return RequestPreview{}, fmt.Errorf("render prompt: %w", err)
+	}
+	body, err := p.buildRequestBody(messages)
+	if err != nil {
+		return RequestPreview{}, fmt.Errorf("build request: %w", err)
+	}
+	endpoint, err := resolveEndpoint(model)
+	if err != nil {
+		return RequestPreview{}, fmt.Errorf("resolve endpoint: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return RequestPreview{}, fmt.Errorf("create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(model.AuthEnvVarNames()) > 0 || model.AuthCommand != "" {
+		p.setAuthHeaders(req, redact.Marker)
+	}
+	p.setExtraHeaders(req, false)
+
+	headers := make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		for _, value := range values {
+			headers.Add(name, p.redact(value))
+		}
+	}
+	return RequestPreview{
+		Messages: messages,
+		Endpoint: p.redactEndpoint(endpoint),
+		Headers:  headers,
+		Body:     []byte(p.redact(string(body))),
+	}, nil
+}
+
 // buildRequestBody constructs the JSON request body based on the model's APIFormat configuration.
 func (p *httpProvider) buildRequestBody(messages []domain.PromptMessage) ([]byte, error) {
 	format := p.model.APIFormat
+	if format.RequestTemplate != "" {
+		return p.buildTemplateRequestBody(messages)
+	}
+	if format.IsOllamaNative() {
+		return p.buildOllamaRequestBody(messages)
+	}
 
 	request := map[string]interface{}{
 		"model": p.model.ModelID,
@@ -142,6 +376,9 @@ func (p *httpProvider) buildRequestBody(messages []domain.PromptMessage) ([]byte
 	if p.model.MaxTokens > 0 {
 		request["max_tokens"] = p.model.MaxTokens
 	}
+	if p.model.Seed != nil && format.AcceptsSeed() {
+		request["seed"] = *p.model.Seed
+	}
 
 	// Handle system messages based on configuration
 	if format.IsSystemMessageSeparate() {
@@ -203,20 +440,91 @@ func formatMessage(msg domain.PromptMessage, format domain.APIFormat) map[string
 	return message
 }
 
-// setAuthHeaders configures authentication headers based on the model's APIFormat.
-func (p *httpProvider) setAuthHeaders(req *http.Request) error {
-	// Skip authentication if no auth_env_var is configured (e.g., local Ollama)
-	if p.model.AuthEnvVar == "" {
-		return nil
+// apiKeys returns the non-empty API keys available for the model.
+// Environment variables take precedence; auth_command is only run when none is set.
+// It errors only when authentication is configured but no key can be resolved.
+func (p *httpProvider) apiKeys(ctx context.Context) ([]string, error) {
+	names := p.model.AuthEnvVarNames()
+	// Skip authentication if neither auth_env_var nor auth_command is configured (e.g., local Ollama)
+	if len(names) == 0 && p.model.AuthCommand == "" {
+		return nil, nil
+	}
+	if keys := getAPIKeys(p.model); len(keys) > 0 {
+		return keys, nil
 	}
+	if p.model.AuthCommand != "" {
+		key, err := authCommandKeys.resolve(ctx, p.shell, p.model.AuthCommand)
+		if err != nil {
+			return nil, err
+		}
+		p.commandKey = key
+		return []string{key}, nil
+	}
+	return nil, fmt.Errorf("missing API key: set %s environment variable", strings.Join(names, " or "))
+}
 
-	format := p.model.APIFormat
-	apiKey := getAPIKey(p.model)
+// authKeyCache remembers the key each auth_command printed, so a password
+// manager is asked once per process rather than once per request.
+type authKeyCache struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
 
+// authCommandKeys is shared by every provider of the process.
+var authCommandKeys = &authKeyCache{keys: map[string]string{}}
+
+// resolve returns the cached key for command under shell, running it on first
+// use. The lock is held while it runs, so concurrent requests do not prompt
+// twice; failures are not cached.
+func (c *authKeyCache) resolve(ctx context.Context, shell, command string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cacheKey := shell + "\x00" + command
+	if key, ok := c.keys[cacheKey]; ok {
+		return key, nil
+	}
+	key, err := runAuthCommand(ctx, shell, command)
+	if err != nil {
+		return "", err
+	}
+	c.keys[cacheKey] = key
+	return key, nil
+}
+
+// runAuthCommand executes command through shell (/bin/sh when empty) and
+// returns its trimmed stdout.
+func runAuthCommand(ctx context.Context, shell, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, domain.DefaultAuthCommandTimeout)
+	defer cancel()
+
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, shell, "-c", command)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("failed to resolve API key via command: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("failed to resolve API key via command: %w", err)
+	}
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", errors.New("failed to resolve API key via command: empty output")
+	}
+	return key, nil
+}
+
+// setAuthHeaders configures authentication headers based on the model's APIFormat.
+// An empty apiKey means the model needs no authentication.
+func (p *httpProvider) setAuthHeaders(req *http.Request, apiKey string) {
 	if apiKey == "" {
-		return fmt.Errorf("missing API key: set %s environment variable", p.model.AuthEnvVar)
+		return
 	}
 
+	format := p.model.APIFormat
 	headerName := format.GetAuthHeaderName()
 	headerPrefix := format.GetAuthHeaderPrefix()
 	headerValue := headerPrefix + apiKey
@@ -229,19 +537,123 @@ func (p *httpProvider) setAuthHeaders(req *http.Request) error {
 			req.Header.Set("OpenAI-Organization", orgID)
 		}
 	}
+}
 
-	return nil
+// resolveEndpoint applies the APIFormat base URL override and query params to
+// the model endpoint.
+func resolveEndpoint(model domain.ModelDefinition) (string, error) {
+	endpoint, err := applyBaseURL(model)
+	if err != nil {
+		return "", err
+	}
+	return applyQueryParams(endpoint, model.APIFormat.QueryParams)
+}
+
+// applyBaseURL applies the APIFormat base URL override to the model endpoint.
+// Without an override in the environment the configured endpoint is returned unchanged.
+func applyBaseURL(model domain.ModelDefinition) (string, error) {
+	envVar := model.APIFormat.BaseURLEnvVar
+	if envVar == "" {
+		return model.Endpoint, nil
+	}
+	rawBase := os.Getenv(envVar)
+	if rawBase == "" {
+		return model.Endpoint, nil
+	}
+
+	base, err := url.Parse(rawBase)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return "", fmt.Errorf("invalid base URL in %s: %q", envVar, rawBase)
+	}
+	endpoint, err := url.Parse(model.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", model.Endpoint, err)
+	}
+
+	endpoint.Scheme = base.Scheme
+	endpoint.Host = base.Host
+	endpoint.User = base.User
+	return endpoint.String(), nil
+}
+
+// applyQueryParams merges params into the endpoint's query string, expanding
+// ${ENV_VAR} references in the values. Params override existing keys of the
+// same name; other existing keys are kept. A referenced variable that is unset
+// is an error rather than an empty value the provider would reject.
+func applyQueryParams(endpoint string, params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return endpoint, nil
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	query := parsed.Query()
+	for key, raw := range params {
+		value, missing := expandEnv(raw)
+		if len(missing) > 0 {
+			return "", fmt.Errorf("query param %s: environment variable %s is not set", key, strings.Join(missing, ", "))
+		}
+		query.Set(key, value)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// expandEnv expands $VAR and ${VAR} references in raw and returns the names
+// of referenced variables that are unset or empty.
+func expandEnv(raw string) (string, []string) {
+	var missing []string
+	value := os.Expand(raw, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	return value, missing
+}
+
+// expandedEnvSecrets returns the environment values expanded into query params
+// or extra headers, since keys passed there need masking as much as auth
+// headers do.
+func expandedEnvSecrets(format domain.APIFormat) []string {
+	var secrets []string
+	for _, values := range []map[string]string{format.QueryParams, format.ExtraHeaders} {
+		for _, raw := range values {
+			os.Expand(raw, func(name string) string {
+				if value := os.Getenv(name); value != "" {
+					secrets = append(secrets, value)
+				}
+				return ""
+			})
+		}
+	}
+	return secrets
 }
 
 // setExtraHeaders adds any additional headers defined in the APIFormat configuration.
-func (p *httpProvider) setExtraHeaders(req *http.Request) {
-	for key, value := range p.model.APIFormat.ExtraHeaders {
+// Values may reference environment variables; a header whose variable is unset
+// is dropped rather than sent with a literal ${...}, noted in debug output.
+func (p *httpProvider) setExtraHeaders(req *http.Request, debug bool) {
+	for key, raw := range p.model.APIFormat.ExtraHeaders {
+		value, missing := expandEnv(raw)
+		if len(missing) > 0 {
+			if debug && p.debugLog != nil {
+				p.debugLog.Debug(fmt.Sprintf("dropping header %s: environment variable %s is not set", key, strings.Join(missing, ", ")), nil)
+			}
+			continue
+		}
 		req.Header.Set(key, value)
 	}
 }
 
 // parseResponse extracts the generated text from the JSON response using the configured JSON path.
 func (p *httpProvider) parseResponse(body []byte) (string, error) {
+	if p.model.APIFormat.IsOllamaNative() {
+		return parseOllamaResponse(body)
+	}
+
 	var response map[string]interface{}
 	if err := json.Unmarshal(body, &response); err != nil {
 		return "", fmt.Errorf("unmarshal JSON: %w", err)
@@ -257,28 +669,36 @@ func (p *httpProvider) parseResponse(body []byte) (string, error) {
 }
 
 // extractJSONPath extracts a string value from a nested JSON structure using a simple path notation.
-// Supported paths: "field", "field.nested", "field[0]", "field[0].nested.field"
+// Supported paths: "field", "field.nested", "field[0]", "field[0].nested.field", "field[*].nested"
+//
+// A "[*]" wildcard applies the rest of the path to every array element. When it is the
+// last wildcard in the path, all string matches are concatenated (multi-block replies);
+// an earlier wildcard returns the first element yielding a non-empty match.
 func extractJSONPath(data map[string]interface{}, path string) (string, error) {
-	parts := parseJSONPath(path)
-	var current interface{} = data
+	return resolveJSONPath(data, parseJSONPath(path))
+}
 
-	for _, part := range parts {
+func resolveJSONPath(current interface{}, parts []pathPart) (string, error) {
+	for i, part := range parts {
 		switch part.kind {
 		case "field":
 			obj, ok := current.(map[string]interface{})
 			if !ok {
-				return "", fmt.Errorf("expected object at '%s'", part.value)
+				return "", fmt.Errorf("expected object at '%s', got %s", part.value, describeJSON(current))
 			}
 			var found bool
 			current, found = obj[part.value]
 			if !found {
-				return "", fmt.Errorf("field '%s' not found", part.value)
+				return "", fmt.Errorf("field '%s' not found; available keys: %s", part.value, formatKeys(obj))
 			}
 
 		case "index":
 			arr, ok := current.([]interface{})
 			if !ok {
-				return "", fmt.Errorf("expected array at index %s", part.value)
+				return "", fmt.Errorf("expected array at index %s, got %s", part.value, describeJSON(current))
+			}
+			if part.value == "*" {
+				return resolveWildcard(arr, parts[i+1:])
 			}
 			var idx int
 			fmt.Sscanf(part.value, "%d", &idx)
@@ -294,7 +714,79 @@ func extractJSONPath(data map[string]interface{}, path string) (string, error) {
 		return str, nil
 	}
 
-	return "", fmt.Errorf("final value is not a string: %T", current)
+	return "", fmt.Errorf("final value is not a string: %s", describeJSON(current))
+}
+
+// maxReportedKeys bounds how many object keys appear in path errors so a large
+// response never ends up dumped into the error message.
+const maxReportedKeys = 20
+
+// describeJSON summarizes a decoded JSON value's shape for error messages.
+func describeJSON(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "object with keys " + formatKeys(v)
+	case []interface{}:
+		return fmt.Sprintf("array (len=%d)", len(v))
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// formatKeys lists an object's keys in sorted order, truncated to maxReportedKeys.
+func formatKeys(obj map[string]interface{}) string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > maxReportedKeys {
+		keys = append(keys[:maxReportedKeys], "...")
+	}
+	return "[" + strings.Join(keys, " ") + "]"
+}
+
+// resolveWildcard applies rest to each element of arr.
+// Elements that don't match (e.g. non-text content blocks) are skipped.
+func resolveWildcard(arr []interface{}, rest []pathPart) (string, error) {
+	terminal := !hasWildcard(rest)
+	var matches []string
+	var lastErr error
+	for _, elem := range arr {
+		value, err := resolveJSONPath(elem, rest)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !terminal && value != "" {
+			return value, nil
+		}
+		matches = append(matches, value)
+	}
+	if len(matches) == 0 {
+		if lastErr != nil {
+			return "", fmt.Errorf("no element matched wildcard: %w", lastErr)
+		}
+		return "", fmt.Errorf("no element matched wildcard (len=%d)", len(arr))
+	}
+	return strings.Join(matches, ""), nil
+}
+
+func hasWildcard(parts []pathPart) bool {
+	for _, part := range parts {
+		if part.kind == "index" && part.value == "*" {
+			return true
+		}
+	}
+	return false
 }
 
 type pathPart struct {
@@ -306,6 +798,7 @@ type pathPart struct {
 // Examples:
 //   - "content[0].text" → [{field, "content"}, {index, "0"}, {field, "text"}]
 //   - "choices[0].message.content" → [{field, "choices"}, {index, "0"}, {field, "message"}, {field, "content"}]
+//   - "content[*].text" → [{field, "content"}, {index, "*"}, {field, "text"}]
 func parseJSONPath(path string) []pathPart {
 	var parts []pathPart
 	current := ""
@@ -345,7 +838,8 @@ func parseJSONPath(path string) []pathPart {
 }
 
 // extractCommand attempts to extract a shell command from the AI response.
-// It tries multiple extraction strategies: code blocks, command prefix, raw text.
+// It tries multiple extraction strategies: code blocks, command prefix, and the
+// last line that looks like a command. It returns "" when the reply is only prose.
 func extractCommand(content string) string {
 	if code := extractCodeBlock(content); code != "" {
 		return code
@@ -353,7 +847,110 @@ func extractCommand(content string) string {
 	if cmd := extractCommandLine(content); cmd != "" {
 		return cmd
 	}
-	return strings.TrimSpace(content)
+	return extractLikelyCommand(content)
+}
+
+// knownCommands are binaries that mark a bare reply line as a shell command.
+var knownCommands = map[string]bool{
+	"awk": true, "brew": true, "cat": true, "cd": true, "chmod": true, "chown": true,
+	"cp": true, "curl": true, "df": true, "docker": true, "du": true, "echo": true,
+	"export": true, "find": true, "git": true, "go": true, "grep": true, "head": true,
+	"helm": true, "kill": true, "kubectl": true, "ln": true, "ls": true, "make": true,
+	"mkdir": true, "mv": true, "npm": true, "ps": true, "pwd": true, "python": true,
+	"python3": true, "rm": true, "rsync": true, "scp": true, "sed": true, "sort": true,
+	"ssh": true, "sudo": true, "systemctl": true, "tail": true, "tar": true,
+	"touch": true, "wc": true, "wget": true, "xargs": true, "zip": true, "unzip": true,
+}
+
+// proseEnding matches a line ending like a sentence ("... directory.") rather
+// than a command argument such as "ls -la .".
+var proseEnding = regexp.MustCompile(`[A-Za-z)][.!?:,]$`)
+
+// heredocStart matches a heredoc operator ("<<EOF", "<<-'EOF'") and captures
+// its delimiter; "<<<" here-strings do not match.
+var heredocStart = regexp.MustCompile(`(?:^|[^<])<<-?[ \t]*['"]?([A-Za-z_][A-Za-z0-9_]*)['"]?`)
+
+// replyCommand is one command of an unfenced reply: text keeps its physical
+// lines (backslash continuations and heredoc body included) and line is the
+// logical line that is checked with looksLikeCommand.
+type replyCommand struct {
+	text string
+	line string
+}
+
+// extractLikelyCommand returns the whole reply when every line of it is a
+// command, so continued and heredoc commands survive intact. Replies mixing in
+// prose yield their last command-like line instead of a multi-line "command".
+func extractLikelyCommand(content string) string {
+	commands := splitReplyCommands(content)
+	if len(commands) == 0 {
+		return ""
+	}
+	texts := make([]string, 0, len(commands))
+	for _, command := range commands {
+		if !looksLikeCommand(command.line) {
+			texts = nil
+			break
+		}
+		texts = append(texts, command.text)
+	}
+	if texts != nil {
+		return strings.Join(texts, "\n")
+	}
+	for i := len(commands) - 1; i >= 0; i-- {
+		if looksLikeCommand(commands[i].line) {
+			return commands[i].text
+		}
+	}
+	return ""
+}
+
+// splitReplyCommands groups the non-blank lines of content into commands,
+// joining backslash continuations and attaching heredoc bodies to the line
+// that opens them. Inline backticks and "$ " prompt markers are stripped.
+func splitReplyCommands(content string) []replyCommand {
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(content), "\r\n", "\n"), "\n")
+	var commands []replyCommand
+	for i := 0; i < len(lines); {
+		first := strings.TrimSpace(strings.TrimPrefix(strings.Trim(strings.TrimSpace(lines[i]), "`"), "$ "))
+		if first == "" {
+			i++
+			continue
+		}
+		physical := []string{first}
+		logical := first
+		i++
+		for strings.HasSuffix(logical, "\\") && i < len(lines) {
+			physical = append(physical, lines[i])
+			logical = strings.TrimSuffix(logical, "\\") + " " + strings.TrimSpace(lines[i])
+			i++
+		}
+		if match := heredocStart.FindStringSubmatch(logical); match != nil {
+			for i < len(lines) {
+				physical = append(physical, lines[i])
+				i++
+				if strings.TrimSpace(lines[i-1]) == match[1] {
+					break
+				}
+			}
+		}
+		commands = append(commands, replyCommand{text: strings.Join(physical, "\n"), line: logical})
+	}
+	return commands
+}
+
+func looksLikeCommand(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || proseEnding.MatchString(line) {
+		return false
+	}
+	binary := fields[0]
+	if knownCommands[binary] || strings.HasPrefix(binary, "./") || strings.HasPrefix(binary, "/") {
+		return true
+	}
+	// Unknown binaries still count when the line carries shell syntax.
+	first, _ := utf8.DecodeRuneInString(line)
+	return !unicode.IsUpper(first) && strings.ContainsAny(line, "-|/=$<>&")
 }
 
 // extractCodeBlock finds and extracts the first markdown code block (```...```).
@@ -392,20 +989,172 @@ func extractCommandLine(content string) string {
 	return ""
 }
 
-// getAPIKey retrieves the API key from environment variables.
-func getAPIKey(model domain.ModelDefinition) string {
-	if model.AuthEnvVar != "" {
-		if key := os.Getenv(model.AuthEnvVar); key != "" {
-			return key
+// getAPIKeys retrieves the model's API keys from environment variables, skipping unset ones.
+func getAPIKeys(model domain.ModelDefinition) []string {
+	names := model.AuthEnvVarNames()
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		if key := os.Getenv(name); key != "" {
+			keys = append(keys, key)
 		}
 	}
-	return ""
+	return keys
+}
+
+// keyRotation tracks the round-robin position of each model's API keys.
+// With a path the positions are kept in that file so the next shai run picks
+// up where this one stopped.
+type keyRotation struct {
+	mu      sync.Mutex
+	counter map[string]int
+	path    string
+}
+
+func newKeyRotation(path string) *keyRotation {
+	return &keyRotation{counter: map[string]int{}, path: path}
+}
+
+// next returns the key index a new request for model should start with.
+// A nil rotation always starts at the first key.
+func (r *keyRotation) next(model string, keyCount int) int {
+	if r == nil || keyCount == 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A single key has nothing to rotate, so it never touches the state file.
+	persist := r.path != "" && keyCount > 1
+	if persist {
+		r.load()
+	}
+	idx := r.counter[model] % keyCount
+	r.counter[model] = idx + 1
+	if persist {
+		r.save()
+	}
+	return idx
+}
+
+// load merges the positions stored at r.path into the counter. A missing or
+// unreadable file keeps the in-memory positions.
+func (r *keyRotation) load() {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return
+	}
+	var stored map[string]int
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return
+	}
+	for model, idx := range stored {
+		r.counter[model] = idx
+	}
+}
+
+// save writes the counter to r.path through a rename so a concurrent run never
+// reads a half-written file. Rotation is best effort: two runs racing may both
+// start on the same key, and a failed write only loses the position.
+func (r *keyRotation) save() {
+	data, err := json.Marshal(r.counter)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// ====================================================================================
+// Debug Dumping
+// ====================================================================================
+
+func (p *httpProvider) dumpRequest(req *http.Request, body []byte) {
+	if p.debugLog == nil {
+		return
+	}
+	authHeader := p.model.APIFormat.GetAuthHeaderName()
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p.debugLog.Debug(req.Method+" "+p.redactEndpoint(req.URL.String()), nil)
+	for _, name := range names {
+		value := strings.Join(req.Header.Values(name), ", ")
+		if strings.EqualFold(name, authHeader) {
+			value = redact.Marker
+		}
+		p.debugLog.Debug(fmt.Sprintf("> %s: %s", name, p.redact(value)), nil)
+	}
+	p.debugLog.Debug("request body: "+p.redact(string(body)), nil)
+}
+
+func (p *httpProvider) dumpResponse(resp *http.Response, body []byte) {
+	if p.debugLog == nil {
+		return
+	}
+	p.debugLog.Debug("response status: "+resp.Status, nil)
+	p.debugLog.Debug("response body: "+p.redact(string(body)), nil)
+}
+
+// redact masks the model's API key and any secret-looking environment values.
+// Values are matched literally, so a key echoed back by the provider is masked too.
+func (p *httpProvider) redact(text string) string {
+	secrets := append(getAPIKeys(p.model), expandedEnvSecrets(p.model.APIFormat)...)
+	if p.commandKey != "" {
+		secrets = append(secrets, p.commandKey)
+	}
+	secrets = append(secrets, redact.EnvSecrets(os.Environ())...)
+	return redact.Secrets(text, secrets)
+}
+
+// redactEndpoint is redact for a URL. Query values are matched decoded, so a
+// key that needed escaping in the query string is still masked.
+func (p *httpProvider) redactEndpoint(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.RawQuery == "" {
+		return p.redact(endpoint)
+	}
+	pairs := strings.Split(parsed.RawQuery, "&")
+	for i, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		decoded, err := url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+		if masked := p.redact(decoded); masked != decoded {
+			pairs[i] = key + "=" + masked
+		}
+	}
+	parsed.RawQuery = strings.Join(pairs, "&")
+	return p.redact(parsed.String())
 }
 
 // ====================================================================================
 // Prompt Template Rendering
 // ====================================================================================
 
+// renderOptions controls how collected context is prepared before templating.
+type renderOptions struct {
+	budget   int
+	sanitize bool
+	preamble string
+}
+
 // renderPromptMessages expands model prompt templates with context data and ensures a user message exists.
 // If the model has no custom prompt template, it uses a sensible default system prompt.
 //
@@ -420,14 +1169,33 @@ func getAPIKey(model domain.ModelDefinition) string {
 //   - {{.K8sContext}}: Kubernetes context name
 //   - {{.K8sNamespace}}: Kubernetes namespace
 //   - {{.Environment}}: Environment variables as key=value pairs
-func renderPromptMessages(model domain.ModelDefinition, userPrompt string, ctx domain.ContextSnapshot) ([]domain.PromptMessage, error) {
-	data := buildTemplateData(userPrompt, ctx)
+//   - {{.GitDiff}}: git diff --stat summary
+//   - {{.CommandStyle}}: BSD/GNU tooling hint for the OS and distro
+//
+// Context is sanitized and trimmed to the budget configured in opts first;
+// the user's prompt itself is never altered. A non-empty opts.preamble is
+// rendered with the same data and sent as the first system message.
+func renderPromptMessages(model domain.ModelDefinition, userPrompt string, ctx domain.ContextSnapshot, opts renderOptions) ([]domain.PromptMessage, error) {
+	if opts.sanitize {
+		ctx = sanitizeSnapshot(ctx)
+	}
+	data := buildTemplateData(userPrompt, ctx, opts.budget)
 	messages := model.Prompt
 	if len(messages) == 0 {
 		messages = defaultTemplateMessages()
 	}
 
-	rendered := make([]domain.PromptMessage, 0, len(messages))
+	rendered := make([]domain.PromptMessage, 0, len(messages)+1)
+	if strings.TrimSpace(opts.preamble) != "" {
+		preamble, err := executeTemplate(opts.preamble, data)
+		if err != nil {
+			return nil, fmt.Errorf("system preamble: %w", err)
+		}
+		rendered = append(rendered, domain.PromptMessage{
+			Role:    "system",
+			Content: strings.TrimSpace(preamble),
+		})
+	}
 	for _, msg := range messages {
 		content, err := executeTemplate(msg.Content, data)
 		if err != nil {
@@ -465,25 +1233,110 @@ type templateData struct {
 	K8sContext     string
 	K8sNamespace   string
 	Environment    string
+	GitDiff        string
+	CommandStyle   string
 }
 
-func buildTemplateData(prompt string, ctx domain.ContextSnapshot) templateData {
+// buildTemplateData assembles template variables, trimming context to fit budget.
+// The user's prompt itself is never truncated.
+func buildTemplateData(prompt string, ctx domain.ContextSnapshot, budget int) templateData {
+	sections := contextSections{
+		files:   filesSummary(ctx.Files),
+		env:     envSummary(ctx.EnvironmentVars),
+		gitDiff: gitDiff(ctx.Git),
+	}
+	sections.fit(ctx, budget)
+
 	return templateData{
-		Prompt:         fmt.Sprintf("%s\n\n%s", strings.TrimSpace(prompt), contextSnippet(ctx)),
+		Prompt:         fmt.Sprintf("%s\n\n%s", strings.TrimSpace(prompt), contextSnippet(ctx, sections.files)),
 		WorkingDir:     ctx.WorkingDir,
 		Shell:          ctx.Shell,
 		OS:             ctx.OS,
 		User:           ctx.User,
-		Files:          filesSummary(ctx.Files),
+		Files:          sections.files,
 		AvailableTools: strings.Join(ctx.AvailableTools, ", "),
 		GitStatus:      gitSummary(ctx.Git),
 		K8sContext:     kubeContext(ctx.Kubernetes),
 		K8sNamespace:   kubeNamespace(ctx.Kubernetes),
-		Environment:    envSummary(ctx.EnvironmentVars),
+		Environment:    sections.env,
+		GitDiff:        sections.gitDiff,
+		CommandStyle:   commandStyle(ctx.OS, ctx.Distro),
+	}
+}
+
+// commandStyle returns a short tooling hint for goos and, on Linux, the distro
+// ID, so prompts can steer models away from non-portable flags. Unknown
+// platforms yield an empty hint.
+func commandStyle(goos, distro string) string {
+	switch goos {
+	case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+		return "BSD userland: sed -i '' (needs an argument), stat -f, date -v; avoid GNU-only long options"
+	case "windows":
+		return "Windows: prefer PowerShell cmdlets"
+	case "linux":
+	default:
+		return ""
+	}
+
+	switch distro {
+	case "alpine":
+		return "BusyBox userland: limited GNU options; packages via apk"
+	case "debian", "ubuntu":
+		return "GNU coreutils: sed -i, stat -c, date -d; packages via apt"
+	case "fedora", "rhel", "centos", "rocky", "almalinux":
+		return "GNU coreutils: sed -i, stat -c, date -d; packages via dnf"
+	case "arch", "manjaro":
+		return "GNU coreutils: sed -i, stat -c, date -d; packages via pacman"
+	default:
+		return "GNU coreutils: sed -i, stat -c, date -d"
+	}
+}
+
+// truncatedMarker ends any context section shortened to fit the budget.
+const truncatedMarker = "…(truncated)"
+
+// contextSections holds the context parts that may be truncated, least important first.
+type contextSections struct {
+	files   string
+	env     string
+	gitDiff string
+}
+
+// fit truncates files, then env, then git diff until the assembled context fits
+// within budget characters. A budget of zero or less disables truncation.
+func (s *contextSections) fit(ctx domain.ContextSnapshot, budget int) {
+	if budget <= 0 {
+		return
 	}
+	for _, section := range []*string{&s.files, &s.env, &s.gitDiff} {
+		over := s.size(ctx) - budget
+		if over <= 0 {
+			return
+		}
+		*section = truncateSection(*section, utf8.RuneCountInString(*section)-over)
+	}
+}
+
+func (s *contextSections) size(ctx domain.ContextSnapshot) int {
+	return utf8.RuneCountInString(contextSnippet(ctx, s.files)) +
+		utf8.RuneCountInString(s.env) +
+		utf8.RuneCountInString(s.gitDiff)
 }
 
-func contextSnippet(ctx domain.ContextSnapshot) string {
+// truncateSection keeps at most keep characters of text, including the marker.
+func truncateSection(text string, keep int) string {
+	runes := []rune(text)
+	if len(runes) == 0 || len(runes) <= keep {
+		return text
+	}
+	markerLen := utf8.RuneCountInString(truncatedMarker)
+	if keep <= markerLen {
+		return truncatedMarker
+	}
+	return string(runes[:keep-markerLen]) + truncatedMarker
+}
+
+func contextSnippet(ctx domain.ContextSnapshot, files string) string {
 	var lines []string
 	lines = append(lines, fmt.Sprintf("Directory: %s", ctx.WorkingDir))
 	if ctx.Shell != "" {
@@ -501,7 +1354,7 @@ func contextSnippet(ctx domain.ContextSnapshot) string {
 	if ns := kubeNamespace(ctx.Kubernetes); ns != "" {
 		lines = append(lines, fmt.Sprintf("Kubernetes: %s (%s)", ns, kubeContext(ctx.Kubernetes)))
 	}
-	if files := filesSummary(ctx.Files); files != "" {
+	if files != "" {
 		lines = append(lines, fmt.Sprintf("Files: %s", files))
 	}
 	return strings.Join(lines, "\n")
@@ -525,6 +1378,13 @@ func gitSummary(status *domain.GitStatus) string {
 	return fmt.Sprintf("branch %s, modified %d, untracked %d", status.Branch, status.ModifiedCount, status.UntrackedCount)
 }
 
+func gitDiff(status *domain.GitStatus) string {
+	if status == nil {
+		return ""
+	}
+	return status.DiffStat
+}
+
 func kubeNamespace(kube *domain.KubeStatus) string {
 	if kube == nil {
 		return ""
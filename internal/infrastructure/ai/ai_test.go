@@ -0,0 +1,803 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/logger"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+func TestResolveEndpoint(t *testing.T) {
+	const endpoint = "https://api.openai.com/v1/chat/completions"
+
+	tests := []struct {
+		name    string
+		envVar  string
+		envVal  string
+		want    string
+		wantErr bool
+	}{
+		{name: "no override configured", want: endpoint},
+		{name: "override env unset", envVar: "SHAI_TEST_BASE_URL", want: endpoint},
+		{
+			name:   "override replaces scheme and host",
+			envVar: "SHAI_TEST_BASE_URL",
+			envVal: "http://localhost:4000",
+			want:   "http://localhost:4000/v1/chat/completions",
+		},
+		{
+			name:   "override path is ignored",
+			envVar: "SHAI_TEST_BASE_URL",
+			envVal: "https://gateway.example.com/v1",
+			want:   "https://gateway.example.com/v1/chat/completions",
+		},
+		{
+			name:    "invalid override",
+			envVar:  "SHAI_TEST_BASE_URL",
+			envVal:  "not-a-url",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SHAI_TEST_BASE_URL", tt.envVal)
+			model := domain.ModelDefinition{
+				Endpoint:  endpoint,
+				APIFormat: domain.APIFormat{BaseURLEnvVar: tt.envVar},
+			}
+
+			got, err := resolveEndpoint(model)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveEndpoint error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveEndpoint() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateDebugDumpRedactsKey(t *testing.T) {
+	const apiKey = "sk-test-super-secret"
+	t.Setenv("SHAI_TEST_API_KEY", apiKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"echo":%q,"choices":[{"message":{"content":"ls -la"}}]}`, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	model := domain.ModelDefinition{
+		Name:       "test",
+		Endpoint:   server.URL + "/v1/chat/completions",
+		AuthEnvVar: "SHAI_TEST_API_KEY",
+		ModelID:    "test-model",
+	}
+	var debug bytes.Buffer
+	provider := newHTTPProvider(model, server.Client(), logger.New(&debug, true), nil)
+
+	resp, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list files", Debug: true})
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Fatalf("unexpected command %q", resp.Command)
+	}
+
+	out := debug.String()
+	if strings.Contains(out, apiKey) {
+		t.Fatalf("debug output leaked API key:\n%s", out)
+	}
+	for _, want := range []string{server.URL, "Authorization: ***", "200 OK", "test-model", "choices"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("debug output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGenerateWithoutDebugWritesNothing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ls"}}]}`)
+	}))
+	defer server.Close()
+
+	var debug bytes.Buffer
+	model := domain.ModelDefinition{Name: "test", Endpoint: server.URL}
+	provider := newHTTPProvider(model, server.Client(), logger.New(&debug, true), nil)
+	if _, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list"}); err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if debug.Len() != 0 {
+		t.Fatalf("expected no debug output, got:\n%s", debug.String())
+	}
+}
+
+func TestFactoryDumpsThroughOptionsLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ls"}}]}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		verbose  bool
+		wantDump bool
+	}{
+		{name: "debug logging on", verbose: true, wantDump: true},
+		{name: "debug logging off", verbose: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := DefaultFactoryOptions()
+			opts.Logger = logger.New(&out, tt.verbose)
+			model := domain.ModelDefinition{Name: "test", Endpoint: server.URL}
+			provider, err := NewFactoryWithOptions(opts).ForModel(model)
+			if err != nil {
+				t.Fatalf("ForModel error: %v", err)
+			}
+			if _, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list", Debug: true}); err != nil {
+				t.Fatalf("Generate error: %v", err)
+			}
+			if got := strings.Contains(out.String(), "[DEBUG] response status: 200 OK"); got != tt.wantDump {
+				t.Errorf("dumped = %v, want %v; output:\n%s", got, tt.wantDump, out.String())
+			}
+		})
+	}
+}
+
+func TestGenerateAppliesQueryParams(t *testing.T) {
+	const apiKey = "gm-test-query-secret"
+	t.Setenv("SHAI_TEST_QUERY_KEY", apiKey)
+
+	var gotQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ls"}}]}`)
+	}))
+	defer server.Close()
+
+	model := domain.ModelDefinition{
+		Name:     "gemini",
+		Endpoint: server.URL + "/v1/models/gemini:generateContent?alt=json&key=stale",
+		APIFormat: domain.APIFormat{QueryParams: map[string]string{
+			"key":         "${SHAI_TEST_QUERY_KEY}",
+			"api-version": "2024-06-01",
+		}},
+	}
+	var debug bytes.Buffer
+	provider := newHTTPProvider(model, server.Client(), logger.New(&debug, true), nil)
+	if _, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list", Debug: true}); err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	for key, want := range map[string]string{"key": apiKey, "api-version": "2024-06-01", "alt": "json"} {
+		if got := gotQuery.Get(key); got != want {
+			t.Errorf("query %s = %q, want %q (query %v)", key, got, want, gotQuery)
+		}
+	}
+	if strings.Contains(debug.String(), apiKey) {
+		t.Errorf("debug output leaked the query param key:\n%s", debug.String())
+	}
+
+	model.APIFormat.QueryParams = map[string]string{"key": "${SHAI_TEST_QUERY_MISSING}"}
+	if _, err := resolveEndpoint(model); err == nil || !strings.Contains(err.Error(), "SHAI_TEST_QUERY_MISSING") {
+		t.Errorf("resolveEndpoint error = %v, want unset variable error", err)
+	}
+}
+
+func TestGenerateErrorRedactsQueryParams(t *testing.T) {
+	const apiKey = "gm-test-unreachable-secret"
+	t.Setenv("SHAI_TEST_QUERY_KEY", apiKey)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	endpoint := server.URL
+	server.Close()
+
+	model := domain.ModelDefinition{
+		Name:      "gemini",
+		Endpoint:  endpoint,
+		APIFormat: domain.APIFormat{QueryParams: map[string]string{"key": "${SHAI_TEST_QUERY_KEY}"}},
+	}
+	provider := newHTTPProvider(model, http.DefaultClient, nil, nil)
+	_, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list"})
+	if err == nil {
+		t.Fatal("Generate succeeded against a closed server")
+	}
+	if strings.Contains(err.Error(), apiKey) {
+		t.Errorf("error leaked the query param key: %v", err)
+	}
+	if !strings.Contains(err.Error(), "key=***") {
+		t.Errorf("error = %v, want the redacted URL", err)
+	}
+}
+
+func TestGenerateExpandsExtraHeaders(t *testing.T) {
+	t.Setenv("SHAI_TEST_TENANT", "tenant-42")
+
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ls"}}]}`)
+	}))
+	defer server.Close()
+
+	model := domain.ModelDefinition{
+		Name:     "gateway",
+		Endpoint: server.URL,
+		APIFormat: domain.APIFormat{ExtraHeaders: map[string]string{
+			"X-Tenant-Id": "${SHAI_TEST_TENANT}",
+			"X-Region":    "eu-${SHAI_TEST_REGION_MISSING}",
+			"X-Version":   "2024-06-01",
+		}},
+	}
+	var debug bytes.Buffer
+	provider := newHTTPProvider(model, server.Client(), logger.New(&debug, true), nil)
+	if _, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list", Debug: true}); err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	for name, want := range map[string]string{"X-Tenant-Id": "tenant-42", "X-Version": "2024-06-01"} {
+		if got := gotHeader.Get(name); got != want {
+			t.Errorf("header %s = %q, want %q", name, got, want)
+		}
+	}
+	if values, ok := gotHeader["X-Region"]; ok {
+		t.Errorf("header with unset variable was sent: %q", values)
+	}
+	if !strings.Contains(debug.String(), "dropping header X-Region: environment variable SHAI_TEST_REGION_MISSING is not set") {
+		t.Errorf("debug output does not explain the dropped header:\n%s", debug.String())
+	}
+}
+
+func TestPreviewRequestRedactsSecrets(t *testing.T) {
+	const (
+		headerSecret = "gw-test-header-secret"
+		querySecret  = "gm-test/query+secret"
+	)
+	t.Setenv("SHAI_TEST_GATEWAY", headerSecret)
+	t.Setenv("SHAI_TEST_QUERY", querySecret)
+
+	model := domain.ModelDefinition{
+		Name:     "gateway",
+		Endpoint: "https://gateway.example.com/v1/chat/completions",
+		ModelID:  "test-model",
+		APIFormat: domain.APIFormat{
+			QueryParams:  map[string]string{"key": "${SHAI_TEST_QUERY}", "alt": "json"},
+			ExtraHeaders: map[string]string{"X-Gateway-Auth": "Bearer ${SHAI_TEST_GATEWAY}", "X-Version": "2024-06-01"},
+		},
+	}
+	preview, err := PreviewRequest(domain.Config{}, model, "list files", domain.ContextSnapshot{})
+	if err != nil {
+		t.Fatalf("PreviewRequest error: %v", err)
+	}
+
+	out := fmt.Sprintf("%s %v %s", preview.Endpoint, preview.Headers, preview.Body)
+	for _, secret := range []string{headerSecret, querySecret, url.QueryEscape(querySecret)} {
+		if strings.Contains(out, secret) {
+			t.Errorf("preview leaked %q:\n%s", secret, out)
+		}
+	}
+	if got := preview.Headers.Get("X-Gateway-Auth"); got != "Bearer ***" {
+		t.Errorf("X-Gateway-Auth = %q, want %q", got, "Bearer ***")
+	}
+	if got := preview.Headers.Get("X-Version"); got != "2024-06-01" {
+		t.Errorf("X-Version = %q, want it unmasked", got)
+	}
+	if !strings.Contains(preview.Endpoint, "key=***") || !strings.Contains(preview.Endpoint, "alt=json") {
+		t.Errorf("endpoint = %s, want key=*** and alt=json", preview.Endpoint)
+	}
+}
+
+func TestExtractJSONPath(t *testing.T) {
+	multiBlock := map[string]interface{}{
+		"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "ls "},
+			map[string]interface{}{"type": "tool_use", "id": "call_1"},
+			map[string]interface{}{"type": "text", "text": "-la"},
+		},
+	}
+	nested := map[string]interface{}{
+		"candidates": []interface{}{
+			map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": ""}}},
+			map[string]interface{}{"parts": []interface{}{
+				map[string]interface{}{"text": "df "},
+				map[string]interface{}{"text": "-h"},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		give    string
+		want    string
+		wantErr bool
+	}{
+		{name: "numeric index", data: multiBlock, give: "content[0].text", want: "ls "},
+		{name: "terminal wildcard joins", data: multiBlock, give: "content[*].text", want: "ls -la"},
+		{name: "wildcard without matches", data: multiBlock, give: "content[*].missing", wantErr: true},
+		{name: "mid-path wildcard takes first non-empty", data: nested, give: "candidates[*].parts[*].text", want: "df -h"},
+		{name: "index out of bounds", data: multiBlock, give: "content[5].text", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractJSONPath(tt.data, tt.give)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractJSONPath error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("extractJSONPath(%s) = %q, want %q", tt.give, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractJSONPathErrorsDescribeResponse(t *testing.T) {
+	response := map[string]interface{}{
+		"id":    "msg_1",
+		"model": "claude",
+		"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "ls"},
+		},
+	}
+
+	tests := []struct {
+		give string
+		want string
+	}{
+		{"choices[0].message.content", "available keys: [content id model]"},
+		{"content[0].message", "available keys: [text type]"},
+		{"id[0]", "got string"},
+		{"content.text", "got array (len=1)"},
+		{"content[3].text", "len=1"},
+	}
+	for _, tt := range tests {
+		_, err := extractJSONPath(response, tt.give)
+		if err == nil {
+			t.Fatalf("extractJSONPath(%s) expected error", tt.give)
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("extractJSONPath(%s) error = %q, want containing %q", tt.give, err, tt.want)
+		}
+	}
+}
+
+func TestGenerateRotatesAndFailsOverKeys(t *testing.T) {
+	t.Setenv("SHAI_TEST_KEY_A", "key-a")
+	t.Setenv("SHAI_TEST_KEY_B", "key-b")
+
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		seen = append(seen, auth)
+		if auth == "Bearer key-a" && len(seen) > 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ls"}}]}`)
+	}))
+	defer server.Close()
+
+	model := domain.ModelDefinition{
+		Name:        "multi",
+		Endpoint:    server.URL,
+		AuthEnvVar:  "SHAI_TEST_KEY_A",
+		AuthEnvVars: []string{"SHAI_TEST_KEY_B"},
+	}
+	provider := newHTTPProvider(model, server.Client(), logger.New(io.Discard, true), newKeyRotation(""))
+
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list", Model: model}); err != nil {
+			t.Fatalf("Generate #%d error: %v", i, err)
+		}
+	}
+
+	// Requests alternate keys; the third starts on key-a, is rate limited and fails over to key-b.
+	want := []string{"Bearer key-a", "Bearer key-b", "Bearer key-a", "Bearer key-b"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("keys used = %v, want %v", seen, want)
+	}
+}
+
+func TestKeyRotationPersistsAcrossRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key_rotation.json")
+
+	var got []int
+	for run := 0; run < 3; run++ {
+		// Each run gets a fresh rotation, as a new shai process would.
+		got = append(got, newKeyRotation(path).next("multi", 2))
+	}
+	if want := []int{0, 1, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("start keys = %v, want %v", got, want)
+	}
+
+	if idx := newKeyRotation(path).next("single", 1); idx != 0 {
+		t.Errorf("single key start = %d, want 0", idx)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	if strings.Contains(string(data), "single") {
+		t.Errorf("state = %s, want no entry for a single-key model", data)
+	}
+}
+
+func TestGenerateReportsMissingKeys(t *testing.T) {
+	model := domain.ModelDefinition{Endpoint: "http://127.0.0.1:0", AuthEnvVar: "SHAI_TEST_UNSET_A, SHAI_TEST_UNSET_B"}
+	provider := newHTTPProvider(model, http.DefaultClient, logger.New(io.Discard, true), nil)
+
+	_, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list", Model: model})
+	if err == nil || !strings.Contains(err.Error(), "SHAI_TEST_UNSET_A or SHAI_TEST_UNSET_B") {
+		t.Errorf("Generate error = %v, want missing key listing both variables", err)
+	}
+}
+
+func TestBuildTemplateDataContextBudget(t *testing.T) {
+	prompt := strings.Repeat("keep every word of this prompt ", 10)
+	snapshot := domain.ContextSnapshot{
+		WorkingDir:      "/repo",
+		Files:           []domain.FileInfo{{Path: strings.Repeat("f", 200)}},
+		EnvironmentVars: map[string]string{"HOME": strings.Repeat("e", 200)},
+		Git:             &domain.GitStatus{Branch: "main", DiffStat: strings.Repeat("d", 200)},
+	}
+	unlimited := buildTemplateData(prompt, snapshot, 0)
+	baseSize := utf8.RuneCountInString(contextSnippet(snapshot, ""))
+
+	tests := []struct {
+		name          string
+		budget        int
+		wantFiles     bool
+		wantEnv       bool
+		wantGitDiff   bool
+		wantTruncated bool
+	}{
+		{name: "unlimited", budget: 0, wantFiles: true, wantEnv: true, wantGitDiff: true},
+		{name: "files trimmed first", budget: baseSize + 500, wantEnv: true, wantGitDiff: true, wantTruncated: true},
+		{name: "then env", budget: baseSize + 250, wantGitDiff: true, wantTruncated: true},
+		{name: "git diff last", budget: baseSize + 60, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildTemplateData(prompt, snapshot, tt.budget)
+
+			if !strings.HasPrefix(data.Prompt, strings.TrimSpace(prompt)) {
+				t.Fatalf("prompt was truncated: %q", data.Prompt)
+			}
+			if (data.Files == unlimited.Files) != tt.wantFiles {
+				t.Errorf("files intact = %v, want %v (%q)", data.Files == unlimited.Files, tt.wantFiles, data.Files)
+			}
+			if (data.Environment == unlimited.Environment) != tt.wantEnv {
+				t.Errorf("env intact = %v, want %v (%q)", data.Environment == unlimited.Environment, tt.wantEnv, data.Environment)
+			}
+			if (data.GitDiff == unlimited.GitDiff) != tt.wantGitDiff {
+				t.Errorf("git diff intact = %v, want %v (%q)", data.GitDiff == unlimited.GitDiff, tt.wantGitDiff, data.GitDiff)
+			}
+			if got := strings.Contains(data.Files, truncatedMarker); got != tt.wantTruncated {
+				t.Errorf("files truncation marker = %v, want %v", got, tt.wantTruncated)
+			}
+			if tt.budget > 0 {
+				sections := contextSections{files: data.Files, env: data.Environment, gitDiff: data.GitDiff}
+				if size := sections.size(snapshot); size > tt.budget {
+					t.Errorf("context size %d exceeds budget %d", size, tt.budget)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderPromptMessagesSystemPreamble(t *testing.T) {
+	snapshot := domain.ContextSnapshot{OS: "linux", WorkingDir: "/repo"}
+	custom := domain.ModelDefinition{Prompt: []domain.PromptMessage{
+		{Role: "system", Content: "You are a model-specific assistant."},
+		{Role: "user", Content: "{{.Prompt}}"},
+	}}
+
+	tests := []struct {
+		name      string
+		model     domain.ModelDefinition
+		preamble  string
+		wantFirst string
+		wantCount int
+	}{
+		{name: "custom prompt", model: custom, preamble: "Never use sudo on {{.OS}}.", wantFirst: "Never use sudo on linux.", wantCount: 3},
+		{name: "default prompt", model: domain.ModelDefinition{}, preamble: "Prefer ripgrep.", wantFirst: "Prefer ripgrep.", wantCount: len(defaultTemplateMessages()) + 1},
+		{name: "empty preamble", model: custom, preamble: "  ", wantFirst: "You are a model-specific assistant.", wantCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := renderPromptMessages(tt.model, "list files", snapshot, renderOptions{preamble: tt.preamble})
+			if err != nil {
+				t.Fatalf("renderPromptMessages error: %v", err)
+			}
+			if len(messages) != tt.wantCount {
+				t.Fatalf("got %d messages, want %d: %+v", len(messages), tt.wantCount, messages)
+			}
+			if messages[0].Role != "system" || messages[0].Content != tt.wantFirst {
+				t.Errorf("first message = %+v, want system %q", messages[0], tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestCommandStyle(t *testing.T) {
+	tests := []struct {
+		goos   string
+		distro string
+		want   string
+	}{
+		{goos: "darwin", want: "BSD userland"},
+		{goos: "freebsd", want: "BSD userland"},
+		{goos: "linux", distro: "ubuntu", want: "packages via apt"},
+		{goos: "linux", distro: "fedora", want: "packages via dnf"},
+		{goos: "linux", distro: "alpine", want: "BusyBox"},
+		{goos: "linux", want: "GNU coreutils"},
+		{goos: "windows", want: "PowerShell"},
+		{goos: "plan9", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos+"/"+tt.distro, func(t *testing.T) {
+			got := commandStyle(tt.goos, tt.distro)
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("commandStyle() = %q, want empty", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("commandStyle() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+
+	data := buildTemplateData("list files", domain.ContextSnapshot{OS: "darwin"}, 0)
+	if !strings.Contains(data.CommandStyle, "BSD") {
+		t.Errorf("CommandStyle = %q, want BSD hint for darwin", data.CommandStyle)
+	}
+}
+
+func TestBuildTemplateDataShell(t *testing.T) {
+	data := buildTemplateData("list files", domain.ContextSnapshot{Shell: "fish"}, 0)
+	rendered, err := executeTemplate("Write a {{.Shell}} command.", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != "Write a fish command." {
+		t.Errorf("rendered = %q, want the snapshot's shell", rendered)
+	}
+}
+
+func TestGenerateResolvesKeyViaAuthCommand(t *testing.T) {
+	t.Setenv("SHAI_TEST_CMD_KEY", "")
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ls"}}]}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		envKey   string
+		command  string
+		wantAuth string
+		wantErr  string
+	}{
+		{name: "command output used", command: "echo '  sk-from-command  '", wantAuth: "Bearer sk-from-command"},
+		{name: "env var wins", envKey: "sk-from-env", command: "echo sk-from-command", wantAuth: "Bearer sk-from-env"},
+		{name: "command fails", command: "echo locked >&2; exit 3", wantErr: "failed to resolve API key via command"},
+		{name: "empty output", command: "true", wantErr: "empty output"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SHAI_TEST_CMD_KEY", tt.envKey)
+			gotAuth = ""
+			model := domain.ModelDefinition{
+				Endpoint:    server.URL,
+				AuthEnvVar:  "SHAI_TEST_CMD_KEY",
+				AuthCommand: tt.command,
+			}
+			provider := newHTTPProvider(model, server.Client(), logger.New(io.Discard, true), nil)
+
+			_, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list", Model: model})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Generate error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate error: %v", err)
+			}
+			if gotAuth != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", gotAuth, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestAuthCommandRunsOnceThroughShell(t *testing.T) {
+	t.Setenv("SHAI_TEST_CMD_KEY", "")
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	shell := filepath.Join(dir, "shell")
+	script := "#!/bin/sh\necho run >> " + runs + "\nexec /bin/sh \"$@\"\n"
+	if err := os.WriteFile(shell, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotAuth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ls"}}]}`)
+	}))
+	defer server.Close()
+
+	opts := DefaultFactoryOptions()
+	opts.Shell = shell
+	factory := NewFactoryWithOptions(opts)
+	model := domain.ModelDefinition{
+		Endpoint:    server.URL,
+		AuthEnvVar:  "SHAI_TEST_CMD_KEY",
+		AuthCommand: "echo sk-cached-" + filepath.Base(dir),
+	}
+	for range 2 {
+		provider, err := factory.ForModel(model)
+		if err != nil {
+			t.Fatalf("ForModel error: %v", err)
+		}
+		if _, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list", Model: model}); err != nil {
+			t.Fatalf("Generate error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatalf("auth command did not run through the configured shell: %v", err)
+	}
+	if got := strings.Count(string(data), "run"); got != 1 {
+		t.Errorf("auth command ran %d times, want 1", got)
+	}
+	want := "Bearer sk-cached-" + filepath.Base(dir)
+	for i, auth := range gotAuth {
+		if auth != want {
+			t.Errorf("request %d Authorization = %q, want %q", i, auth, want)
+		}
+	}
+}
+
+func TestExtractCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		give string
+		want string
+	}{
+		{name: "code fence", give: "Try this:\n```bash\nls -la\n```", want: "ls -la"},
+		{name: "command prefix", give: "Command: df -h\nShows free space.", want: "df -h"},
+		{name: "bare command", give: "pwd", want: "pwd"},
+		{
+			name: "verbose reply with trailing command",
+			give: "Sure! To see disk usage per folder you can use du.\nIt summarizes each entry.\n\ndu -sh *",
+			want: "du -sh *",
+		},
+		{
+			name: "command then explanation",
+			give: "find . -name '*.log' -mtime +7\nThis finds logs older than a week.",
+			want: "find . -name '*.log' -mtime +7",
+		},
+		{name: "shell prompt marker", give: "Run:\n$ ./deploy.sh --dry-run", want: "./deploy.sh --dry-run"},
+		{name: "trailing dot argument", give: "List it with\nls -la .", want: "ls -la ."},
+		{name: "prose only", give: "I'm not sure what you mean.\nCould you clarify the request?", want: ""},
+		{
+			name: "continued command",
+			give: "find . \\\n  -name '*.go' -delete",
+			want: "find . \\\n  -name '*.go' -delete",
+		},
+		{
+			name: "continued command after prose",
+			give: "This removes Go files:\nfind . \\\n  -name '*.go' -delete",
+			want: "find . \\\n  -name '*.go' -delete",
+		},
+		{
+			name: "unfenced heredoc",
+			give: "cat <<EOF > f\nhello world.\nEOF",
+			want: "cat <<EOF > f\nhello world.\nEOF",
+		},
+		{
+			name: "quoted heredoc after prose",
+			give: "Write the file with:\ncat <<-'END' > notes.txt\n\tDone.\n\tEND",
+			want: "cat <<-'END' > notes.txt\n\tDone.\n\tEND",
+		},
+		{name: "several commands", give: "mkdir -p out\ncp build/* out/", want: "mkdir -p out\ncp build/* out/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractCommand(tt.give); got != tt.want {
+				t.Errorf("extractCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRequestBodySeed(t *testing.T) {
+	seed := 42
+	anthropic := domain.APIFormat{SystemMessageMode: domain.SystemMessageModeSeparate, ContentWrapper: domain.ContentWrapperAnthropic}
+	native := domain.APIFormat{Protocol: domain.ProtocolOllamaNative}
+
+	tests := []struct {
+		name   string
+		seed   *int
+		format domain.APIFormat
+		want   interface{} // seed value in the body, nil when absent
+		seedOf func(map[string]interface{}) interface{}
+	}{
+		{name: "unset", format: domain.APIFormat{}},
+		{name: "openai", seed: &seed, format: domain.APIFormat{}, want: float64(42)},
+		{name: "anthropic has no seed", seed: &seed, format: anthropic},
+		{name: "ollama options", seed: &seed, format: native, want: float64(42), seedOf: func(body map[string]interface{}) interface{} {
+			options, _ := body["options"].(map[string]interface{})
+			return options["seed"]
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &httpProvider{model: domain.ModelDefinition{
+				ModelID:   "m",
+				Endpoint:  "http://localhost/api/chat",
+				Seed:      tt.seed,
+				APIFormat: tt.format,
+			}}
+			data, err := p.buildRequestBody([]domain.PromptMessage{{Role: "user", Content: "hi"}})
+			if err != nil {
+				t.Fatalf("buildRequestBody error: %v", err)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			got := body["seed"]
+			if tt.seedOf != nil {
+				got = tt.seedOf(body)
+			}
+			if got != tt.want {
+				t.Errorf("seed = %v, want %v in %s", got, tt.want, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+const (
+	// HeuristicScheme selects the offline keyword-based provider when used as a
+	// model endpoint prefix (e.g. "heuristic://local"). It is registered with
+	// every Factory under heuristicProviderName.
+	HeuristicScheme = "heuristic://"
+
+	heuristicProviderName = "heuristic"
+	heuristicFallback     = "ls -la"
+)
+
+// heuristicRule maps prompts containing every keyword as a word to a command.
+// darwin replaces command on macOS when the Linux tool does not exist there.
+type heuristicRule struct {
+	keywords []string
+	command  string
+	darwin   string
+}
+
+// heuristicRules are checked in order; more specific phrases come first.
+var heuristicRules = []heuristicRule{
+	{keywords: []string{"disk", "usage"}, command: "du -sh *"},
+	{keywords: []string{"disk", "space"}, command: "df -h"},
+	{keywords: []string{"hidden", "file"}, command: "ls -la"},
+	{keywords: []string{"list", "file"}, command: "ls -la"},
+	{keywords: []string{"large", "file"}, command: "find . -type f -size +100M"},
+	{keywords: []string{"git", "status"}, command: "git status"},
+	{keywords: []string{"git", "log"}, command: "git log --oneline -n 20"},
+	{keywords: []string{"current", "directory"}, command: "pwd"},
+	{keywords: []string{"process"}, command: "ps aux"},
+	{keywords: []string{"memory"}, command: "free -h", darwin: "vm_stat"},
+	{keywords: []string{"port"}, command: "lsof -i -P -n"},
+	{keywords: []string{"ip", "address"}, command: "ip addr", darwin: "ifconfig"},
+}
+
+// heuristicProvider generates best-effort commands from keyword rules.
+// It never touches the network, making it suitable for smoke tests and demos
+// before any API keys are configured.
+type heuristicProvider struct {
+	model domain.ModelDefinition
+}
+
+func newHeuristicProvider(model domain.ModelDefinition) ports.Provider {
+	return &heuristicProvider{model: model}
+}
+
+func (p *heuristicProvider) Name() string {
+	return heuristicProviderName
+}
+
+func (p *heuristicProvider) Model() domain.ModelDefinition {
+	return p.model
+}
+
+func (p *heuristicProvider) Generate(ctx context.Context, req ports.ProviderRequest) (ports.ProviderResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return ports.ProviderResponse{}, err
+	}
+	command := heuristicCommand(req.Prompt, runtime.GOOS)
+	return ports.ProviderResponse{
+		Command: command,
+		Reply:   fmt.Sprintf("Offline heuristic suggestion for %q: %s", req.Prompt, command),
+	}, nil
+}
+
+// RuleBased implements ports.RuleBasedProvider.
+func (p *heuristicProvider) RuleBased() {}
+
+// heuristicCommand returns the command of the first rule whose keywords all
+// appear in prompt, as it is spelled on goos, falling back to a harmless
+// directory listing.
+func heuristicCommand(prompt, goos string) string {
+	words := promptWords(prompt)
+	for _, rule := range heuristicRules {
+		if !containsAll(words, rule.keywords) {
+			continue
+		}
+		if goos == "darwin" && rule.darwin != "" {
+			return rule.darwin
+		}
+		return rule.command
+	}
+	return heuristicFallback
+}
+
+// promptWords splits prompt into lowercase words so keywords only match whole
+// words ("git" is not found in "digit").
+func promptWords(prompt string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+// containsAll reports whether every keyword is one of words, on its own or
+// with a plural "s"/"es" suffix.
+func containsAll(words map[string]bool, keywords []string) bool {
+	for _, keyword := range keywords {
+		if !words[keyword] && !words[keyword+"s"] && !words[keyword+"es"] {
+			return false
+		}
+	}
+	return true
+}
+
+var _ ports.RuleBasedProvider = (*heuristicProvider)(nil)
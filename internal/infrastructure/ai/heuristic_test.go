@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+func TestHeuristicCommand(t *testing.T) {
+	tests := []struct {
+		give string
+		goos string
+		want string
+	}{
+		{give: "list files", goos: "linux", want: "ls -la"},
+		{give: "list files", goos: "darwin", want: "ls -la"},
+		{give: "show disk usage of this folder", goos: "linux", want: "du -sh *"},
+		{give: "how much Disk Space is left", goos: "darwin", want: "df -h"},
+		{give: "what is the git status", goos: "linux", want: "git status"},
+		{give: "show running processes", goos: "linux", want: "ps aux"},
+		{give: "which ports are open?", goos: "linux", want: "lsof -i -P -n"},
+		{give: "how much memory is free", goos: "linux", want: "free -h"},
+		{give: "how much memory is free", goos: "darwin", want: "vm_stat"},
+		{give: "show my ip address", goos: "linux", want: "ip addr"},
+		{give: "show my ip address", goos: "darwin", want: "ifconfig"},
+		{give: "something entirely unrelated", goos: "linux", want: heuristicFallback},
+		{give: "count each digit in the status line", goos: "linux", want: heuristicFallback},
+		{give: "file a support report", goos: "linux", want: heuristicFallback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos+"/"+tt.give, func(t *testing.T) {
+			if got := heuristicCommand(tt.give, tt.goos); got != tt.want {
+				t.Errorf("heuristicCommand(%q, %q) = %q, want %q", tt.give, tt.goos, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFactorySelectsHeuristicProvider(t *testing.T) {
+	model := domain.ModelDefinition{Name: "offline", Endpoint: "heuristic://local"}
+
+	provider, err := NewFactory().ForModel(model)
+	if err != nil {
+		t.Fatalf("ForModel error: %v", err)
+	}
+	if provider.Name() != heuristicProviderName {
+		t.Fatalf("provider = %s, want %s", provider.Name(), heuristicProviderName)
+	}
+
+	resp, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "disk usage", Model: model})
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if resp.Command != "du -sh *" {
+		t.Errorf("Command = %q, want %q", resp.Command, "du -sh *")
+	}
+}
@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// ollamaGeneratePath is the native completion endpoint; any other path uses /api/chat.
+const ollamaGeneratePath = "/api/generate"
+
+// ollamaChunk is one JSON object of an Ollama reply. Non-streamed replies are a
+// single chunk; streamed replies are NDJSON, one chunk per line, ending with done.
+type ollamaChunk struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error"`
+}
+
+// isOllamaGenerate reports whether endpoint targets /api/generate rather than /api/chat.
+func isOllamaGenerate(endpoint string) bool {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimRight(parsed.Path, "/"), ollamaGeneratePath)
+}
+
+// buildOllamaRequestBody builds a native Ollama request. /api/chat takes the
+// messages as-is; /api/generate takes the joined system messages and the
+// remaining messages as a single prompt.
+func (p *httpProvider) buildOllamaRequestBody(messages []domain.PromptMessage) ([]byte, error) {
+	request := map[string]interface{}{
+		"model":  p.model.ModelID,
+		"stream": false,
+	}
+	options := map[string]interface{}{}
+	if p.model.MaxTokens > 0 {
+		options["num_predict"] = p.model.MaxTokens
+	}
+	if p.model.Seed != nil {
+		options["seed"] = *p.model.Seed
+	}
+	if len(options) > 0 {
+		request["options"] = options
+	}
+
+	if !isOllamaGenerate(p.model.Endpoint) {
+		request["messages"] = formatMessagesInline(messages, domain.APIFormat{})
+		return json.Marshal(request)
+	}
+
+	var system, prompt []string
+	for _, msg := range messages {
+		if strings.EqualFold(msg.Role, "system") {
+			system = append(system, msg.Content)
+			continue
+		}
+		prompt = append(prompt, msg.Content)
+	}
+	if len(system) > 0 {
+		request["system"] = strings.Join(system, "\n")
+	}
+	request["prompt"] = strings.Join(prompt, "\n\n")
+	return json.Marshal(request)
+}
+
+// parseOllamaResponse assembles the reply text from one or more NDJSON chunks,
+// stopping at the chunk marked done.
+func parseOllamaResponse(body []byte) (string, error) {
+	var content strings.Builder
+	chunks := 0
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return "", fmt.Errorf("unmarshal NDJSON line %d: %w", chunks+1, err)
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("ollama error: %s", chunk.Error)
+		}
+		chunks++
+		content.WriteString(chunk.Message.Content)
+		content.WriteString(chunk.Response)
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read NDJSON: %w", err)
+	}
+	if chunks == 0 {
+		return "", errors.New("empty response")
+	}
+	return strings.TrimSpace(content.String()), nil
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/logger"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+func TestBuildOllamaRequestBody(t *testing.T) {
+	messages := []domain.PromptMessage{
+		{Role: "system", Content: "Be terse."},
+		{Role: "user", Content: "list files"},
+	}
+	native := domain.APIFormat{Protocol: domain.ProtocolOllamaNative}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "chat",
+			endpoint: "http://localhost:11434/api/chat",
+			want: map[string]interface{}{
+				"model":  "llama3",
+				"stream": false,
+				"messages": []interface{}{
+					map[string]interface{}{"role": "system", "content": "Be terse."},
+					map[string]interface{}{"role": "user", "content": "list files"},
+				},
+				"options": map[string]interface{}{"num_predict": float64(256)},
+			},
+		},
+		{
+			name:     "generate",
+			endpoint: "http://localhost:11434/api/generate",
+			want: map[string]interface{}{
+				"model":   "llama3",
+				"stream":  false,
+				"system":  "Be terse.",
+				"prompt":  "list files",
+				"options": map[string]interface{}{"num_predict": float64(256)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &httpProvider{model: domain.ModelDefinition{
+				ModelID:   "llama3",
+				Endpoint:  tt.endpoint,
+				MaxTokens: 256,
+				APIFormat: native,
+			}}
+			body, err := p.buildRequestBody(messages)
+			if err != nil {
+				t.Fatalf("buildRequestBody error: %v", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("body = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOllamaResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "single chat object",
+			body: `{"message":{"role":"assistant","content":"ls -la"},"done":true}`,
+			want: "ls -la",
+		},
+		{
+			name: "chat NDJSON",
+			body: "{\"message\":{\"content\":\"ls\"},\"done\":false}\n\n{\"message\":{\"content\":\" -la\"},\"done\":false}\n{\"message\":{\"content\":\"\"},\"done\":true}\n",
+			want: "ls -la",
+		},
+		{
+			name: "generate NDJSON stops at done",
+			body: "{\"response\":\"df\",\"done\":false}\n{\"response\":\" -h\",\"done\":true}\n{\"response\":\"ignored\"}\n",
+			want: "df -h",
+		},
+		{name: "error chunk", body: `{"error":"model 'llama9' not found"}`, wantErr: true},
+		{name: "empty", body: "\n", wantErr: true},
+		{name: "malformed", body: "{\"response\":\"ls\"}\nnot json\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOllamaResponse([]byte(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOllamaResponse error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseOllamaResponse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateOllamaNative(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"message":{"content":"`+"```sh\\n"+`"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"content":"docker ps\n`+"```"+`"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"content":""},"done":true}`)
+	}))
+	defer server.Close()
+
+	model := domain.ModelDefinition{
+		Name:      "ollama",
+		ModelID:   "llama3",
+		Endpoint:  server.URL + "/api/chat",
+		APIFormat: domain.APIFormat{Protocol: domain.ProtocolOllamaNative},
+	}
+	provider := newHTTPProvider(model, server.Client(), logger.New(io.Discard, true), newKeyRotation(""))
+	resp, err := provider.Generate(context.Background(), ports.ProviderRequest{Prompt: "list containers", Model: model})
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if resp.Command != "docker ps" {
+		t.Errorf("Command = %q, want docker ps", resp.Command)
+	}
+}
@@ -0,0 +1,35 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+// ProviderConstructor builds a provider for a model definition.
+type ProviderConstructor func(model domain.ModelDefinition) (ports.Provider, error)
+
+// Register maps selector to constructor. Models whose api_format.provider or
+// endpoint scheme (e.g. "mock" for mock://local) equals selector are built by
+// constructor instead of the HTTP provider. Registering a selector again
+// replaces the earlier constructor. Register is not safe for concurrent use
+// with ForModel and is meant to be called while wiring the application.
+func (f *Factory) Register(selector string, constructor ProviderConstructor) {
+	f.registry[providerSelector(selector)] = constructor
+}
+
+// providerSelector normalizes a selector for registry lookups.
+func providerSelector(selector string) string {
+	return strings.ToLower(strings.TrimSpace(selector))
+}
+
+// endpointScheme returns the lowercased scheme of an endpoint such as
+// "heuristic://local", or "" when the endpoint has none.
+func endpointScheme(endpoint string) string {
+	scheme, _, found := strings.Cut(strings.TrimSpace(endpoint), "://")
+	if !found {
+		return ""
+	}
+	return providerSelector(scheme)
+}
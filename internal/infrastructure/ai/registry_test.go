@@ -0,0 +1,139 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+type fakeProvider struct {
+	model domain.ModelDefinition
+}
+
+func (p *fakeProvider) Name() string                  { return "fake" }
+func (p *fakeProvider) Model() domain.ModelDefinition { return p.model }
+func (p *fakeProvider) Generate(context.Context, ports.ProviderRequest) (ports.ProviderResponse, error) {
+	return ports.ProviderResponse{Command: "echo fake"}, nil
+}
+
+func TestFactoryRegisteredProviders(t *testing.T) {
+	factory := NewFactory()
+	factory.Register("mock", func(model domain.ModelDefinition) (ports.Provider, error) {
+		return &fakeProvider{model: model}, nil
+	})
+
+	tests := []struct {
+		name  string
+		model domain.ModelDefinition
+		want  string
+	}{
+		{
+			name:  "custom scheme",
+			model: domain.ModelDefinition{Name: "m", Endpoint: "mock://local"},
+			want:  "fake",
+		},
+		{
+			name:  "scheme is case insensitive",
+			model: domain.ModelDefinition{Name: "m", Endpoint: " MOCK://local"},
+			want:  "fake",
+		},
+		{
+			name: "api_format provider overrides scheme",
+			model: domain.ModelDefinition{
+				Name:      "m",
+				Endpoint:  "https://api.example.com/v1/chat/completions",
+				APIFormat: domain.APIFormat{Provider: "Mock"},
+			},
+			want: "fake",
+		},
+		{
+			name:  "heuristic registered by default",
+			model: domain.ModelDefinition{Name: "m", Endpoint: "heuristic://local"},
+			want:  heuristicProviderName,
+		},
+		{
+			name: "http selectable by name",
+			model: domain.ModelDefinition{
+				Name:      "m",
+				Endpoint:  "mock://local",
+				APIFormat: domain.APIFormat{Provider: "http"},
+			},
+			want: providerName,
+		},
+		{
+			name:  "http is the default",
+			model: domain.ModelDefinition{Name: "m", Endpoint: "https://api.example.com/v1/chat/completions"},
+			want:  providerName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := factory.ForModel(tt.model)
+			if err != nil {
+				t.Fatalf("ForModel error: %v", err)
+			}
+			if provider.Name() != tt.want {
+				t.Errorf("provider = %s, want %s", provider.Name(), tt.want)
+			}
+			if provider.Model().Name != tt.model.Name {
+				t.Errorf("provider model = %q, want %q", provider.Model().Name, tt.model.Name)
+			}
+		})
+	}
+}
+
+func TestFactoryUnknownProvider(t *testing.T) {
+	model := domain.ModelDefinition{Name: "m", Endpoint: "https://api.example.com", APIFormat: domain.APIFormat{Provider: "bedrock"}}
+	if _, err := NewFactory().ForModel(model); err == nil {
+		t.Fatal("expected error for unregistered provider")
+	}
+}
+
+func TestFactoryTransportOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts FactoryOptions
+	}{
+		{name: "defaults", opts: DefaultFactoryOptions()},
+		{name: "custom without HTTP/2", opts: FactoryOptions{
+			Timeout:             5 * time.Second,
+			MaxIdleConnsPerHost: 3,
+			IdleConnTimeout:     time.Second,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewFactoryWithOptions(tt.opts).httpClient
+			if client.Timeout != tt.opts.Timeout {
+				t.Errorf("Timeout = %s, want %s", client.Timeout, tt.opts.Timeout)
+			}
+			transport, ok := client.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("Transport = %T, want *http.Transport", client.Transport)
+			}
+			if transport.MaxIdleConnsPerHost != tt.opts.MaxIdleConnsPerHost {
+				t.Errorf("MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConnsPerHost, tt.opts.MaxIdleConnsPerHost)
+			}
+			if transport.IdleConnTimeout != tt.opts.IdleConnTimeout {
+				t.Errorf("IdleConnTimeout = %s, want %s", transport.IdleConnTimeout, tt.opts.IdleConnTimeout)
+			}
+			if transport.ForceAttemptHTTP2 != tt.opts.HTTP2 {
+				t.Errorf("ForceAttemptHTTP2 = %v, want %v", transport.ForceAttemptHTTP2, tt.opts.HTTP2)
+			}
+			if !tt.opts.HTTP2 && (transport.TLSNextProto == nil || len(transport.TLSNextProto) > 0) {
+				t.Errorf("TLSNextProto = %v, want an empty map to disable HTTP/2", transport.TLSNextProto)
+			}
+			if transport.Proxy == nil {
+				t.Error("proxy settings from the default transport were dropped")
+			}
+		})
+	}
+	if opts := DefaultFactoryOptions(); opts.MaxIdleConnsPerHost <= http.DefaultMaxIdleConnsPerHost {
+		t.Errorf("default MaxIdleConnsPerHost = %d, want more than net/http's %d", opts.MaxIdleConnsPerHost, http.DefaultMaxIdleConnsPerHost)
+	}
+}
@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// requestTemplateName names the parsed template in errors.
+const requestTemplateName = "request_template"
+
+// requestTemplateData holds the variables available to APIFormat.RequestTemplate.
+type requestTemplateData struct {
+	Model       string
+	MaxTokens   int
+	System      string
+	Prompt      string
+	Messages    []domain.PromptMessage
+	AllMessages []domain.PromptMessage
+}
+
+// requestTemplateFuncs lets templates emit values as JSON literals, so
+// prompts containing quotes or newlines cannot break the body.
+var requestTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// buildTemplateRequestBody renders the model's request_template as the body
+// and rejects output that is not valid JSON.
+func (p *httpProvider) buildTemplateRequestBody(messages []domain.PromptMessage) ([]byte, error) {
+	tmpl, err := template.New(requestTemplateName).Funcs(requestTemplateFuncs).Option("missingkey=error").
+		Parse(p.model.APIFormat.RequestTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parse request_template: %w", err)
+	}
+
+	data := requestTemplateData{
+		Model:       p.model.ModelID,
+		MaxTokens:   p.model.MaxTokens,
+		AllMessages: messages,
+	}
+	var system []string
+	for _, msg := range messages {
+		if strings.EqualFold(msg.Role, "system") {
+			system = append(system, msg.Content)
+			continue
+		}
+		data.Messages = append(data.Messages, msg)
+		if strings.EqualFold(msg.Role, "user") {
+			data.Prompt = msg.Content
+		}
+	}
+	data.System = strings.TrimSpace(strings.Join(system, "\n"))
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render request_template: %w", err)
+	}
+	// The rendered body holds the prompt and possibly secrets, so the error
+	// only points at where the JSON broke.
+	var value interface{}
+	if err := json.Unmarshal(buf.Bytes(), &value); err != nil {
+		offset := int64(buf.Len())
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+		}
+		line, column := textPosition(buf.Bytes(), offset)
+		return nil, fmt.Errorf("%s did not render valid JSON: rendered line %d, column %d", requestTemplateName, line, column)
+	}
+	return buf.Bytes(), nil
+}
+
+// textPosition converts a json.SyntaxError offset, which counts the bytes read
+// including the offending one, into a 1-based line and column.
+func textPosition(data []byte, offset int64) (int, int) {
+	prefix := data[:max(min(offset, int64(len(data)))-1, 0)]
+	line := bytes.Count(prefix, []byte("\n")) + 1
+	column := len(prefix) - bytes.LastIndexByte(prefix, '\n')
+	return line, column
+}
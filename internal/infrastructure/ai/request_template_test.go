@@ -0,0 +1,84 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+func TestBuildTemplateRequestBody(t *testing.T) {
+	messages := []domain.PromptMessage{
+		{Role: "system", Content: "Be terse."},
+		{Role: "user", Content: `list "large" files` + "\nplease"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     map[string]interface{}
+		wantErr  string
+	}{
+		{
+			name: "nested params",
+			template: `{"model_name": {{json .Model}}, "params": {"limit": {{.MaxTokens}}},
+"instructions": {{json .System}}, "input": {"text": {{json .Prompt}}}}`,
+			want: map[string]interface{}{
+				"model_name":   "custom-1",
+				"params":       map[string]interface{}{"limit": float64(128)},
+				"instructions": "Be terse.",
+				"input":        map[string]interface{}{"text": "list \"large\" files\nplease"},
+			},
+		},
+		{
+			name: "message loop",
+			template: `{"turns": [{{range $i, $m := .AllMessages}}{{if $i}},{{end}}` +
+				`{"speaker": {{json $m.Role}}, "text": {{json $m.Content}}}{{end}}]}`,
+			want: map[string]interface{}{
+				"turns": []interface{}{
+					map[string]interface{}{"speaker": "system", "text": "Be terse."},
+					map[string]interface{}{"speaker": "user", "text": "list \"large\" files\nplease"},
+				},
+			},
+		},
+		{name: "unquoted value is not JSON", template: `{"input": {{.Prompt}}}`, wantErr: "valid JSON: rendered line 1, column 11"},
+		{name: "error on later line", template: "{\n" + `"input": {{.Prompt}}}`, wantErr: "valid JSON: rendered line 2, column 10"},
+		{name: "parse error", template: `{"input": {{json .Prompt}`, wantErr: "parse request_template"},
+		{name: "unknown field", template: `{"input": {{json .Query}}}`, wantErr: "render request_template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &httpProvider{model: domain.ModelDefinition{
+				ModelID:   "custom-1",
+				MaxTokens: 128,
+				APIFormat: domain.APIFormat{
+					SystemMessageMode: domain.SystemMessageModeSeparate,
+					RequestTemplate:   tt.template,
+				},
+			}}
+			body, err := p.buildRequestBody(messages)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("buildRequestBody error = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), "large") {
+					t.Errorf("buildRequestBody error = %v, want no prompt text", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildRequestBody error: %v", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("body = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// filteredMarker replaces context items that look like instructions aimed at the model.
+const filteredMarker = "[filtered: possible prompt injection]"
+
+// injectionPatterns match imperative phrases that address the model instead of
+// describing the environment. They are screened in file names, git metadata,
+// Kubernetes names and environment values, never in the user's own prompt.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,30}\b(instructions?|prompts?|rules?|guardrails?)\b`),
+	regexp.MustCompile(`(?i)\byou are now\b`),
+	regexp.MustCompile(`(?i)\b(new|updated|real) (system )?instructions?\b`),
+	regexp.MustCompile(`(?i)\bsystem prompt\b`),
+	regexp.MustCompile(`(?i)\b(run|execute|output)\b.{0,30}\b(rm\s+-rf|mkfs|dd\s+if=|curl\b.*\|\s*(ba|z)?sh)`),
+}
+
+// looksLikeInjection reports whether text contains an instruction-like phrase.
+func looksLikeInjection(text string) bool {
+	for _, pattern := range injectionPatterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func sanitizeValue(text string) string {
+	if looksLikeInjection(text) {
+		return filteredMarker
+	}
+	return text
+}
+
+// sanitizeLines filters each line independently so one crafted entry does not
+// hide the rest of a multi-line value such as a diff stat.
+func sanitizeLines(text string) string {
+	if !looksLikeInjection(text) {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = sanitizeValue(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sanitizeSnapshot returns a copy of ctx with instruction-like context items
+// replaced by filteredMarker. The original snapshot is left untouched.
+func sanitizeSnapshot(ctx domain.ContextSnapshot) domain.ContextSnapshot {
+	if len(ctx.Files) > 0 {
+		files := make([]domain.FileInfo, len(ctx.Files))
+		for i, file := range ctx.Files {
+			file.Path = sanitizeValue(file.Path)
+			files[i] = file
+		}
+		ctx.Files = files
+	}
+
+	if len(ctx.EnvironmentVars) > 0 {
+		env := maps.Clone(ctx.EnvironmentVars)
+		for key, value := range env {
+			env[key] = sanitizeValue(value)
+		}
+		ctx.EnvironmentVars = env
+	}
+
+	if ctx.Git != nil {
+		git := *ctx.Git
+		git.Branch = sanitizeValue(git.Branch)
+		git.Summary = sanitizeLines(git.Summary)
+		git.DiffStat = sanitizeLines(git.DiffStat)
+		ctx.Git = &git
+	}
+
+	if ctx.Kubernetes != nil {
+		kube := *ctx.Kubernetes
+		kube.Context = sanitizeValue(kube.Context)
+		kube.Namespace = sanitizeValue(kube.Namespace)
+		ctx.Kubernetes = &kube
+	}
+
+	return ctx
+}
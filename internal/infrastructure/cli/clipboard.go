@@ -2,50 +2,128 @@ package cli
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 
 	"github.com/doeshing/shai-go/internal/ports"
 )
 
+// clipboardBackend is a clipboard tool and the arguments that make it read stdin.
+type clipboardBackend struct {
+	name string
+	args []string
+}
+
+var (
+	pbcopyBackend  = clipboardBackend{name: "pbcopy"}
+	clipExeBackend = clipboardBackend{name: "clip.exe"}
+	clipBackend    = clipboardBackend{name: "clip"}
+	wlCopyBackend  = clipboardBackend{name: "wl-copy"}
+	xclipBackend   = clipboardBackend{name: "xclip", args: []string{"-selection", "clipboard"}}
+	xselBackend    = clipboardBackend{name: "xsel", args: []string{"--clipboard", "--input"}}
+)
+
+// clipboardEnv describes the parts of the environment that decide the backend.
+type clipboardEnv struct {
+	goos    string
+	wsl     bool // Linux under Windows Subsystem for Linux
+	wayland bool // a Wayland session (WAYLAND_DISPLAY set)
+}
+
+// clipboardRunner runs a backend with text on stdin.
+type clipboardRunner func(backend clipboardBackend, text string) error
+
 // Clipboard implements ports.Clipboard using platform-specific tools.
-type Clipboard struct{}
+// The backend is chosen once, when the clipboard is built.
+type Clipboard struct {
+	backend *clipboardBackend
+	reason  string
+	run     clipboardRunner
+}
 
-// NewClipboard builds the clipboard helper.
+// NewClipboard builds the clipboard helper for the current system.
 func NewClipboard() *Clipboard {
-	return &Clipboard{}
+	env := clipboardEnv{
+		goos:    runtime.GOOS,
+		wsl:     isWSL(),
+		wayland: os.Getenv("WAYLAND_DISPLAY") != "",
+	}
+	return newClipboard(env, exec.LookPath, runClipboardBackend)
 }
 
-func (c *Clipboard) Enabled() bool {
-	switch runtime.GOOS {
-	case "darwin", "linux":
-		return true
-	default:
-		return false
+func newClipboard(env clipboardEnv, lookPath func(string) (string, error), run clipboardRunner) *Clipboard {
+	candidates := clipboardCandidates(env)
+	if len(candidates) == 0 {
+		return &Clipboard{reason: fmt.Sprintf("clipboard not supported on %s", env.goos), run: run}
+	}
+	for _, candidate := range candidates {
+		if _, err := lookPath(candidate.name); err == nil {
+			return &Clipboard{backend: &candidate, run: run}
+		}
 	}
+	names := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		names[i] = candidate.name
+	}
+	return &Clipboard{reason: fmt.Sprintf("clipboard utilities not found (install %s)", strings.Join(names, " or ")), run: run}
 }
 
-// Copy copies text to the system clipboard.
-func (c *Clipboard) Copy(text string) error {
-	if !c.Enabled() {
-		return fmt.Errorf("clipboard not supported on %s", runtime.GOOS)
-	}
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
+// clipboardCandidates lists backends in order of preference. Under WSL the
+// Windows clipboard is preferred because an X or Wayland server is often
+// absent; in a Wayland session wl-copy comes before the X11 tools.
+func clipboardCandidates(env clipboardEnv) []clipboardBackend {
+	switch env.goos {
 	case "darwin":
-		cmd = exec.Command("pbcopy")
-	default: // linux
-		if _, err := exec.LookPath("xclip"); err == nil {
-			cmd = exec.Command("xclip", "-selection", "clipboard")
-		} else if _, err := exec.LookPath("wl-copy"); err == nil {
-			cmd = exec.Command("wl-copy")
-		} else {
-			return fmt.Errorf("clipboard utilities not found")
+		return []clipboardBackend{pbcopyBackend}
+	case "windows":
+		return []clipboardBackend{clipBackend}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		var candidates []clipboardBackend
+		if env.wsl {
+			candidates = append(candidates, clipExeBackend)
 		}
+		if env.wayland {
+			return append(candidates, wlCopyBackend, xclipBackend, xselBackend)
+		}
+		return append(candidates, xclipBackend, xselBackend, wlCopyBackend)
+	default:
+		return nil
 	}
+}
+
+// isWSL reports whether the process runs under Windows Subsystem for Linux.
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
+
+func runClipboardBackend(backend clipboardBackend, text string) error {
+	cmd := exec.Command(backend.name, backend.args...)
 	cmd.Stdin = bytes.NewBufferString(text)
 	return cmd.Run()
 }
 
+// Enabled reports whether a clipboard backend is installed on this system.
+func (c *Clipboard) Enabled() bool {
+	return c.backend != nil
+}
+
+// Copy copies text to the system clipboard.
+func (c *Clipboard) Copy(text string) error {
+	if c.backend == nil {
+		return errors.New(c.reason)
+	}
+	if err := c.run(*c.backend, text); err != nil {
+		return fmt.Errorf("%s: %w", c.backend.name, err)
+	}
+	return nil
+}
+
 var _ ports.Clipboard = (*Clipboard)(nil)
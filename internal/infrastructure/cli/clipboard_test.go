@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClipboardSelectsBackend(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       clipboardEnv
+		installed []string
+		want      string
+		wantArgs  []string
+	}{
+		{name: "macOS", env: clipboardEnv{goos: "darwin"}, installed: []string{"pbcopy"}, want: "pbcopy"},
+		{name: "WSL prefers clip.exe", env: clipboardEnv{goos: "linux", wsl: true}, installed: []string{"xclip", "clip.exe"}, want: "clip.exe"},
+		{name: "WSL without clip.exe", env: clipboardEnv{goos: "linux", wsl: true}, installed: []string{"xsel"}, want: "xsel", wantArgs: []string{"--clipboard", "--input"}},
+		{name: "Wayland prefers wl-copy", env: clipboardEnv{goos: "linux", wayland: true}, installed: []string{"xclip", "wl-copy"}, want: "wl-copy"},
+		{name: "X11 prefers xclip", env: clipboardEnv{goos: "linux"}, installed: []string{"wl-copy", "xclip"}, want: "xclip", wantArgs: []string{"-selection", "clipboard"}},
+		{name: "X11 falls back to xsel", env: clipboardEnv{goos: "linux"}, installed: []string{"xsel"}, want: "xsel", wantArgs: []string{"--clipboard", "--input"}},
+		{name: "Linux without tools", env: clipboardEnv{goos: "linux"}},
+		{name: "unsupported OS", env: clipboardEnv{goos: "plan9"}, installed: []string{"xclip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookPath := func(name string) (string, error) {
+				if slices.Contains(tt.installed, name) {
+					return "/usr/bin/" + name, nil
+				}
+				return "", exec.ErrNotFound
+			}
+			var ran clipboardBackend
+			var input string
+			run := func(backend clipboardBackend, text string) error {
+				ran, input = backend, text
+				return nil
+			}
+
+			clipboard := newClipboard(tt.env, lookPath, run)
+			if clipboard.Enabled() != (tt.want != "") {
+				t.Fatalf("Enabled() = %v, want %v", clipboard.Enabled(), tt.want != "")
+			}
+			err := clipboard.Copy("ls -la")
+			if tt.want == "" {
+				if err == nil {
+					t.Fatal("expected error without a backend")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Copy error: %v", err)
+			}
+			if ran.name != tt.want || !slices.Equal(ran.args, tt.wantArgs) || input != "ls -la" {
+				t.Errorf("ran %s %q with %q, want %s %q", ran.name, ran.args, input, tt.want, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestClipboardCopyReportsBackendFailure(t *testing.T) {
+	lookPath := func(string) (string, error) { return "/usr/bin/xclip", nil }
+	run := func(clipboardBackend, string) error { return errors.New("Can't open display") }
+
+	err := newClipboard(clipboardEnv{goos: "linux"}, lookPath, run).Copy("ls")
+	if err == nil || !strings.Contains(err.Error(), "xclip: Can't open display") {
+		t.Errorf("Copy error = %v, want backend failure", err)
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+const colorReset = "\033[0m"
+
+// riskColors are the ANSI colors for each risk level, from green for safe
+// commands to bold red for critical ones.
+var riskColors = map[domain.RiskLevel]string{
+	domain.RiskSafe:     "\033[32m",
+	domain.RiskLow:      "\033[36m",
+	domain.RiskMedium:   "\033[33m",
+	domain.RiskHigh:     "\033[31m",
+	domain.RiskCritical: "\033[1;31m",
+}
+
+// colorizer highlights risk information when writing to a color terminal.
+type colorizer struct {
+	enabled bool
+}
+
+// newColorizer enables color when out is a terminal and the environment
+// allows it.
+func newColorizer(out io.Writer) colorizer {
+	return colorizer{enabled: colorSupported(isTerminal(out))}
+}
+
+// colorSupported reports whether color should be used on a terminal (tty)
+// given NO_COLOR (https://no-color.org) and TERM=dumb.
+func colorSupported(tty bool) bool {
+	return tty && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// risk wraps text in the color of level.
+func (c colorizer) risk(level domain.RiskLevel, text string) string {
+	color, ok := riskColors[level]
+	if !c.enabled || !ok {
+		return text
+	}
+	return color + text + colorReset
+}
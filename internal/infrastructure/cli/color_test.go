@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+func TestColorSupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		tty     bool
+		noColor string
+		term    string
+		want    bool
+	}{
+		{name: "terminal", tty: true, term: "xterm-256color", want: true},
+		{name: "pipe", tty: false, term: "xterm-256color"},
+		{name: "NO_COLOR", tty: true, noColor: "1", term: "xterm-256color"},
+		{name: "dumb terminal", tty: true, term: "dumb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("TERM", tt.term)
+			if got := colorSupported(tt.tty); got != tt.want {
+				t.Errorf("colorSupported(%v) = %v, want %v", tt.tty, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrompterColorsRiskLevel(t *testing.T) {
+	t.Setenv("TERM", "xterm")
+	for _, noColor := range []string{"", "1"} {
+		t.Setenv("NO_COLOR", noColor)
+		var out bytes.Buffer
+		prompter := NewPrompter(strings.NewReader("n\n"), &out)
+		prompter.colors = colorizer{enabled: colorSupported(true)}
+		if _, err := prompter.Confirm(domain.ActionConfirm, domain.RiskCritical, "rm -rf /", nil); err != nil {
+			t.Fatal(err)
+		}
+		colored := strings.Contains(out.String(), riskColors[domain.RiskCritical]+"CRITICAL risk detected (confirm)"+colorReset)
+		if want := noColor == ""; colored != want {
+			t.Errorf("NO_COLOR=%q: colored = %v, want %v:\n%q", noColor, colored, want, out.String())
+		}
+		if noColor != "" && strings.Contains(out.String(), "\033[") {
+			t.Errorf("NO_COLOR set but escape codes written:\n%q", out.String())
+		}
+	}
+}
+
+func TestRiskLabelPlainOffTerminal(t *testing.T) {
+	risk := domain.RiskAssessment{Level: domain.RiskMedium, Action: domain.ActionConfirm}
+	if got := riskLabel(newColorizer(&bytes.Buffer{}), risk); got != "MEDIUM (confirm)" {
+		t.Errorf("riskLabel = %q, want plain text for a non-terminal writer", got)
+	}
+	if got := riskLabel(colorizer{enabled: true}, risk); got != "\033[33mMEDIUM (confirm)"+colorReset {
+		t.Errorf("riskLabel = %q, want yellow for medium", got)
+	}
+}
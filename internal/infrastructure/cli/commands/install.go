@@ -32,7 +32,10 @@ const (
 
 // NewInstallCommand creates the installation command for shell integration
 func NewInstallCommand() *cobra.Command {
-	var shellFlag string
+	var (
+		shellFlag string
+		force     bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "install",
@@ -45,21 +48,26 @@ This command will:
 3. Add source line to your shell RC file (~/.zshrc or ~/.bashrc)
 4. Create backup of original RC file
 
+Use --force after upgrading to refresh the binary and script when the
+integration is already present in your RC file.
+
 Example:
   shai install              # Auto-detect shell
   shai install --shell zsh  # Install for zsh
-  shai install --shell bash # Install for bash`,
+  shai install --shell bash # Install for bash
+  shai install --force      # Refresh after an upgrade`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runInstall(cmd.OutOrStdout(), cmd.ErrOrStderr(), shellFlag)
+			return runInstall(cmd.OutOrStdout(), cmd.ErrOrStderr(), shellFlag, force)
 		},
 	}
 
 	cmd.Flags().StringVar(&shellFlag, "shell", "", "Shell type (zsh, bash). Auto-detected if not specified")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Refresh binary and script even if already installed")
 
 	return cmd
 }
 
-func runInstall(out, errOut io.Writer, shellFlag string) error {
+func runInstall(out, errOut io.Writer, shellFlag string, force bool) error {
 	// Detect shell
 	shell, err := detectShell(shellFlag)
 	if err != nil {
@@ -129,6 +137,11 @@ func runInstall(out, errOut io.Writer, shellFlag string) error {
 		return fmt.Errorf("check installation: %w", err)
 	}
 
+	if installed && force {
+		fmt.Fprintf(out, "\n✓ Refreshed binary and shell script; %s already sources SHAI\n", rcFile)
+		fmt.Fprintf(out, "\nTo activate, run:\n  source %s\n", rcFile)
+		return nil
+	}
 	if installed {
 		fmt.Fprintf(out, "\n⚠️  SHAI integration already installed in %s\n", rcFile)
 		fmt.Fprintf(out, "\nTo reinstall, first run:\n  shai uninstall\n")
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/doeshing/shai-go/internal/app"
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// newCompareCommand creates the compare command for asking several models at once.
+func newCompareCommand(container *app.Container) *cobra.Command {
+	var (
+		models  []string
+		workDir string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "compare --models a,b <prompt...>",
+		Short: "Compare the commands several models generate for one prompt",
+		Long: `Send the same prompt and context to each model concurrently and print the
+generated commands with their guardrail assessments side by side. Fallback
+models are not used, and a failing model is reported without hiding the
+others.
+
+Nothing is executed.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(models) < 2 {
+				return errors.New("--models needs at least two model names")
+			}
+			dir, err := resolveWorkDir(workDir)
+			if err != nil {
+				return err
+			}
+			results, err := container.QueryService.Compare(domain.QueryRequest{
+				Context: cmd.Context(),
+				Prompt:  strings.Join(args, " "),
+				WorkDir: dir,
+			}, models)
+			if err != nil {
+				return err
+			}
+			return renderComparison(cmd.OutOrStdout(), results)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&models, "models", nil, "Comma-separated model names to compare")
+	cmd.Flags().StringVar(&workDir, "dir", "", "Directory to collect context from (default: current)")
+	_ = cmd.MarkFlagRequired("models")
+
+	return cmd
+}
+
+// renderComparison prints one row per model followed by each model's
+// guardrail reasons. It returns an error only when every model failed.
+func renderComparison(out io.Writer, results []domain.ModelComparison) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tRISK\tACTION\tCOMMAND")
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(tw, "%s\t-\t-\terror: %v\n", result.Model, result.Err)
+			continue
+		}
+		risk := result.RiskAssessment
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Model, strings.ToUpper(string(risk.Level)), risk.Action, result.Command)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Err != nil || len(result.RiskAssessment.Reasons) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", result.Model)
+		for _, reason := range result.RiskAssessment.Reasons {
+			fmt.Fprintf(out, " - %s\n", reason)
+		}
+	}
+
+	if failed > 0 && failed == len(results) {
+		return errors.New("every model failed")
+	}
+	return nil
+}
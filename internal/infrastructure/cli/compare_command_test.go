@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+func TestRenderComparison(t *testing.T) {
+	results := []domain.ModelComparison{
+		{Model: "gpt4", Command: "find . -size +100M", RiskAssessment: domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}},
+		{Model: "claude", Command: "rm -rf build", RiskAssessment: domain.RiskAssessment{
+			Level: domain.RiskHigh, Action: domain.ActionExplicitConfirm, Reasons: []string{"Recursive delete"},
+		}},
+		{Model: "broken", Err: errors.New("rate limited")},
+	}
+
+	var out bytes.Buffer
+	if err := renderComparison(&out, results); err != nil {
+		t.Fatalf("renderComparison error: %v", err)
+	}
+	for _, want := range []string{
+		"MODEL", "gpt4", "SAFE", "find . -size +100M",
+		"HIGH", "explicit_confirm", "rm -rf build",
+		"claude:\n - Recursive delete",
+		"broken", "error: rate limited",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := renderComparison(&bytes.Buffer{}, results[2:]); err == nil {
+		t.Error("expected error when every model failed")
+	}
+}
@@ -0,0 +1,487 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/doeshing/shai-go/internal/app"
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+	"github.com/doeshing/shai-go/internal/services"
+)
+
+const (
+	// defaultEditor is used when neither VISUAL nor EDITOR is set.
+	defaultEditor = "vi"
+	// bundleFormatVersion identifies the config export layout.
+	bundleFormatVersion = "1"
+)
+
+// newConfigCommand creates the config command group for managing ~/.shai/config.yaml.
+func newConfigCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage SHAI configuration",
+	}
+	cmd.AddCommand(newConfigGetCommand(container))
+	cmd.AddCommand(newConfigEditCommand())
+	cmd.AddCommand(newConfigExportCommand(container))
+	cmd.AddCommand(newConfigImportCommand(container))
+	return cmd
+}
+
+// ============================================================================
+// Config Get
+// ============================================================================
+
+func newConfigGetCommand(container *app.Container) *cobra.Command {
+	var (
+		key     string
+		allKeys bool
+		prefix  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Print configuration values by dotted key path",
+		Long: `Print the value at a dotted key path such as preferences.default_model or
+models.0.endpoint. Use --all-keys to list every leaf key with its current
+value, optionally filtered with --prefix (e.g. --prefix context).`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			tree, err := configTree(cfg)
+			if err != nil {
+				return err
+			}
+			switch {
+			case allKeys:
+				return listConfigKeys(cmd.OutOrStdout(), tree, prefix)
+			case key != "":
+				return printConfigKey(cmd.OutOrStdout(), tree, key)
+			default:
+				return errors.New("specify --key <path> or --all-keys")
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&key, "key", "k", "", "Dotted key path to print")
+	cmd.Flags().BoolVar(&allKeys, "all-keys", false, "List every leaf key path with its value")
+	cmd.Flags().StringVar(&prefix, "prefix", "", "Only list keys under this dotted prefix (with --all-keys)")
+
+	return cmd
+}
+
+// configTree converts cfg to the generic map form of its YAML representation,
+// so key paths match the keys written in config.yaml.
+func configTree(cfg domain.Config) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal configuration: %w", err)
+	}
+	tree := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("convert configuration: %w", err)
+	}
+	return tree, nil
+}
+
+// lookupConfigKey walks a dotted path through maps and list indexes.
+func lookupConfigKey(tree map[string]interface{}, key string) (interface{}, bool) {
+	var node interface{} = tree
+	for _, part := range strings.Split(key, ".") {
+		switch typed := node.(type) {
+		case map[string]interface{}:
+			next, ok := typed[part]
+			if !ok {
+				return nil, false
+			}
+			node = next
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil, false
+			}
+			node = typed[index]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func printConfigKey(out io.Writer, tree map[string]interface{}, key string) error {
+	value, ok := lookupConfigKey(tree, key)
+	if !ok {
+		return fmt.Errorf("unknown config key %q (see config get --all-keys)", key)
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("marshal %s: %w", key, err)
+		}
+		_, err = out.Write(data)
+		return err
+	default:
+		fmt.Fprintln(out, formatConfigValue(value))
+		return nil
+	}
+}
+
+// flattenConfigKeys collects every leaf under node keyed by its dotted path.
+// Empty maps and lists are leaves so settable-but-unset keys still appear.
+func flattenConfigKeys(path string, node interface{}, leaves map[string]interface{}) {
+	join := func(part string) string {
+		if path == "" {
+			return part
+		}
+		return path + "." + part
+	}
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if len(typed) == 0 && path != "" {
+			leaves[path] = typed
+		}
+		for key, child := range typed {
+			flattenConfigKeys(join(key), child, leaves)
+		}
+	case []interface{}:
+		if len(typed) == 0 {
+			leaves[path] = typed
+		}
+		for i, child := range typed {
+			flattenConfigKeys(join(strconv.Itoa(i)), child, leaves)
+		}
+	default:
+		leaves[path] = typed
+	}
+}
+
+func listConfigKeys(out io.Writer, tree map[string]interface{}, prefix string) error {
+	leaves := map[string]interface{}{}
+	flattenConfigKeys("", tree, leaves)
+
+	prefix = strings.TrimSuffix(prefix, ".")
+	keys := make([]string, 0, len(leaves))
+	for key := range leaves {
+		if prefix == "" || key == prefix || strings.HasPrefix(key, prefix+".") {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no config keys under %q", prefix)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", key, strings.ReplaceAll(formatConfigValue(leaves[key]), "\n", "\\n"))
+	}
+	return tw.Flush()
+}
+
+func formatConfigValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		return "[]"
+	case map[string]interface{}:
+		return "{}"
+	default:
+		return fmt.Sprint(typed)
+	}
+}
+
+// ============================================================================
+// Config Edit
+// ============================================================================
+
+func newConfigEditCommand() *cobra.Command {
+	var noRestore bool
+
+	cmd := &cobra.Command{
+		Use:   "edit",
+		Short: "Open the configuration file in $EDITOR",
+		Long: `Open the configuration file in $VISUAL or $EDITOR.
+
+After the editor exits the file is validated. If it is invalid you can edit it
+again; otherwise the broken file is kept as config.yaml.invalid and the
+previous version is restored. A config that no longer loads can still be
+edited.`,
+		// The container loads the config, which fails for exactly the files
+		// this command exists to fix, so it is not built here.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, err := cmd.Flags().GetString("config")
+			if err != nil {
+				return err
+			}
+			var in io.Reader
+			if isTerminal(os.Stdin) {
+				in = os.Stdin
+			}
+			path := infrastructure.NewFileLoader(configPath).Path()
+			return editConfigurationInEditor(cmd.Context(), in, cmd.OutOrStdout(), path, resolveEditor(), noRestore)
+		},
+	}
+
+	cmd.Flags().BoolVar(&noRestore, "no-restore", false, "Keep the edited file even if it fails validation")
+
+	return cmd
+}
+
+// editConfigurationInEditor opens path in editor and validates the result.
+// The file is snapshotted as raw bytes rather than loaded, so a config that
+// is already invalid can be fixed. After an invalid edit the user is asked on
+// in whether to edit again; a nil in, as without a terminal, restores at once.
+func editConfigurationInEditor(ctx context.Context, in io.Reader, out io.Writer, path string, editor string, noRestore bool) error {
+	snapshot, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Loading writes the default config for the editor to open.
+		if _, err := infrastructure.NewFileLoader(path).Load(ctx); err != nil {
+			return fmt.Errorf("create configuration: %w", err)
+		}
+		snapshot, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot configuration: %w", err)
+	}
+
+	var answers *bufio.Reader
+	if in != nil {
+		answers = bufio.NewReader(in)
+	}
+	for {
+		if err := runEditor(ctx, editor, path); err != nil {
+			return err
+		}
+
+		validationErr := validateConfigFile(ctx, path)
+		if validationErr == nil {
+			fmt.Fprintf(out, "Configuration saved: %s\n", path)
+			return nil
+		}
+
+		fmt.Fprintf(out, "Configuration is invalid: %v\n", validationErr)
+		if noRestore {
+			return fmt.Errorf("invalid configuration left in place: %w", validationErr)
+		}
+		if !askEditAgain(answers, out) {
+			return restoreConfiguration(out, path, snapshot, validationErr)
+		}
+	}
+}
+
+// askEditAgain asks whether to reopen the editor; no answer means no.
+func askEditAgain(answers *bufio.Reader, out io.Writer) bool {
+	if answers == nil {
+		return false
+	}
+	fmt.Fprint(out, "Edit again? [y/N] (no restores the previous version): ")
+	line, _ := answers.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// restoreConfiguration keeps the invalid edit next to path and writes snapshot back.
+func restoreConfiguration(out io.Writer, path string, snapshot []byte, validationErr error) error {
+	invalidPath := path + ".invalid"
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read edited configuration: %w", err)
+	}
+	if err := os.WriteFile(invalidPath, edited, domain.SecureFilePermissions); err != nil {
+		return fmt.Errorf("keep invalid configuration: %w", err)
+	}
+	if err := os.WriteFile(path, snapshot, domain.SecureFilePermissions); err != nil {
+		return fmt.Errorf("restore configuration: %w", err)
+	}
+
+	fmt.Fprintf(out, "Invalid file kept at: %s\n", invalidPath)
+	fmt.Fprintf(out, "Previous configuration restored: %s\n", path)
+	return fmt.Errorf("configuration restored after invalid edit: %w", validationErr)
+}
+
+func validateConfigFile(ctx context.Context, path string) error {
+	cfg, err := infrastructure.NewFileLoader(path).Load(ctx)
+	if err != nil {
+		return err
+	}
+	return services.Validate(cfg)
+}
+
+// runEditor launches the editor attached to the terminal.
+// The editor value may carry arguments (e.g. "code --wait").
+func runEditor(ctx context.Context, editor string, path string) error {
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		return errors.New("no editor configured")
+	}
+	c := exec.CommandContext(ctx, fields[0], append(fields[1:], path)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("run editor %s: %w", fields[0], err)
+	}
+	return nil
+}
+
+func resolveEditor() string {
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	return defaultEditor
+}
+
+// ============================================================================
+// Config Export / Import
+// ============================================================================
+
+// configBundle is a portable snapshot of a SHAI setup.
+// API keys are never included because they live in environment variables.
+type configBundle struct {
+	BundleVersion string                        `yaml:"bundle_version"`
+	Config        domain.Config                 `yaml:"config"`
+	Guardrail     infrastructure.PolicyDocument `yaml:"guardrail"`
+}
+
+func newConfigExportCommand(container *app.Container) *cobra.Command {
+	return &cobra.Command{
+		Use:   "export <file>",
+		Short: "Bundle config and guardrail policy into one YAML file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportConfiguration(cmd.Context(), cmd.OutOrStdout(), container.ConfigLoader, args[0])
+		},
+	}
+}
+
+func newConfigImportCommand(container *app.Container) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <file>",
+		Short: "Validate and install config and guardrail policy from an export",
+		Long: `Validate and install config and guardrail policy from a file written by
+config export. Existing files are backed up before being replaced. The policy
+is written to the local security.rules_file; the bundle's rules_file is ignored.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importConfiguration(cmd.Context(), cmd.OutOrStdout(), container.ConfigLoader, args[0])
+		},
+	}
+}
+
+func exportConfiguration(ctx context.Context, out io.Writer, loader *infrastructure.FileLoader, path string) error {
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	policy, err := infrastructure.LoadPolicyDocument(cfg.Security.RulesFile)
+	if err != nil {
+		return fmt.Errorf("load guardrail policy: %w", err)
+	}
+
+	data, err := yaml.Marshal(configBundle{
+		BundleVersion: bundleFormatVersion,
+		Config:        cfg,
+		Guardrail:     policy,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal bundle: %w", err)
+	}
+	if err := os.WriteFile(path, data, domain.SecureFilePermissions); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+
+	fmt.Fprintf(out, "Exported configuration and guardrail policy to %s\n", path)
+	return nil
+}
+
+func importConfiguration(ctx context.Context, out io.Writer, loader *infrastructure.FileLoader, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read bundle: %w", err)
+	}
+	var bundle configBundle
+	if err := yaml.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("parse bundle: %w", err)
+	}
+	if bundle.BundleVersion != bundleFormatVersion {
+		return fmt.Errorf("unsupported bundle_version %q (want %s)", bundle.BundleVersion, bundleFormatVersion)
+	}
+	if err := services.Validate(bundle.Config); err != nil {
+		return fmt.Errorf("invalid configuration in bundle: %w", err)
+	}
+	if err := infrastructure.ValidatePolicyDocument(bundle.Guardrail); err != nil {
+		return fmt.Errorf("invalid guardrail policy in bundle: %w", err)
+	}
+
+	// The bundle's rules_file names a path on the exporting machine, so the
+	// policy goes where this machine keeps it and the local setting stays.
+	rulesFile, err := localRulesFile(ctx, loader)
+	if err != nil {
+		return err
+	}
+	bundle.Config.Security.RulesFile = rulesFile
+
+	if backup, err := loader.Backup(); err == nil {
+		fmt.Fprintf(out, "Backed up configuration to %s\n", backup)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("backup configuration: %w", err)
+	}
+	if backup, err := infrastructure.BackupPolicyDocument(rulesFile); err == nil {
+		fmt.Fprintf(out, "Backed up guardrail policy to %s\n", backup)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("backup guardrail policy: %w", err)
+	}
+
+	if err := loader.Save(bundle.Config); err != nil {
+		return fmt.Errorf("write configuration: %w", err)
+	}
+	if err := infrastructure.SavePolicyDocument(rulesFile, bundle.Guardrail); err != nil {
+		return fmt.Errorf("write guardrail policy: %w", err)
+	}
+
+	fmt.Fprintf(out, "Imported configuration to %s\n", loader.Path())
+	fmt.Fprintf(out, "Imported guardrail policy to %s\n", infrastructure.ResolveRulesPath(rulesFile))
+	return nil
+}
+
+// localRulesFile returns the rules_file of the existing configuration, or ""
+// (the default policy path) when there is none yet.
+func localRulesFile(ctx context.Context, loader *infrastructure.FileLoader) (string, error) {
+	if _, err := os.Stat(loader.Path()); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		return "", fmt.Errorf("load configuration: %w", err)
+	}
+	return cfg.Security.RulesFile, nil
+}
@@ -0,0 +1,362 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+)
+
+const validConfigYAML = `config_format_version: "1"
+preferences:
+  default_model: local
+models:
+  - name: local
+    endpoint: http://localhost:11434/v1/chat/completions
+    model_id: codellama:7b
+context:
+  max_files: 5
+security:
+  enabled: true
+  rules_file: ~/.shai/guardrail.yaml
+`
+
+func TestEditConfigurationRestoresInvalidEdit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("models: [unclosed\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := editConfigurationInEditor(context.Background(), nil, &out, path, "cp "+invalid, false)
+	if err == nil {
+		t.Fatal("expected error for invalid edit")
+	}
+
+	restored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) != validConfigYAML {
+		t.Fatalf("config not restored, got:\n%s", restored)
+	}
+	kept, err := os.ReadFile(path + ".invalid")
+	if err != nil {
+		t.Fatalf("invalid file not kept: %v", err)
+	}
+	if string(kept) != "models: [unclosed\n" {
+		t.Fatalf("unexpected invalid file contents: %s", kept)
+	}
+}
+
+func TestEditConfigurationKeepsValidEdit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	edited := validConfigYAML + "execution:\n  shell: bash\n"
+	source := filepath.Join(dir, "edited.yaml")
+	if err := os.WriteFile(source, []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := editConfigurationInEditor(context.Background(), nil, &out, path, "cp "+source, false); err != nil {
+		t.Fatalf("editConfigurationInEditor error: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != edited {
+		t.Fatalf("valid edit not kept, got:\n%s", got)
+	}
+	if _, err := os.Stat(path + ".invalid"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected invalid file: %v", err)
+	}
+}
+
+func TestEditConfigurationFixesBrokenConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("models: [unclosed\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "fixed.yaml")
+	if err := os.WriteFile(source, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := editConfigurationInEditor(context.Background(), nil, &out, path, "cp "+source, false); err != nil {
+		t.Fatalf("editConfigurationInEditor error: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != validConfigYAML {
+		t.Fatalf("fixed config not kept, got:\n%s", got)
+	}
+}
+
+func TestEditConfigurationOffersEditAgain(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("models: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := editConfigurationInEditor(context.Background(), strings.NewReader("y\nn\n"), &out, path, "cp "+invalid, false)
+	if err == nil {
+		t.Fatal("expected error for invalid edit")
+	}
+	if got := strings.Count(out.String(), "Edit again?"); got != 2 {
+		t.Errorf("asked %d times, want 2:\n%s", got, out.String())
+	}
+	restored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) != validConfigYAML {
+		t.Fatalf("config not restored, got:\n%s", restored)
+	}
+}
+
+func TestEditConfigurationNoRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("models: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := editConfigurationInEditor(context.Background(), nil, &out, path, "cp "+invalid, true); err == nil {
+		t.Fatal("expected validation error")
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "models: []\n" {
+		t.Fatalf("edited file should be left in place, got:\n%s", got)
+	}
+}
+
+func TestExportImportConfigurationRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	t.Setenv("HOME", source)
+	sourceConfig := filepath.Join(source, "config.yaml")
+	if err := os.WriteFile(sourceConfig, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := infrastructure.PolicyDocument{}
+	policy.Rules.DangerPatterns = []domain.DangerPattern{{Pattern: `\bterraform destroy\b`, Level: "critical", Action: "block"}}
+	if err := infrastructure.SavePolicyDocument("~/.shai/guardrail.yaml", policy); err != nil {
+		t.Fatal(err)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "shai-export.yaml")
+	var out bytes.Buffer
+	if err := exportConfiguration(context.Background(), &out, infrastructure.NewFileLoader(sourceConfig), bundlePath); err != nil {
+		t.Fatalf("export error: %v", err)
+	}
+
+	// Import on a "new machine" that already has a config, which must be backed up.
+	target := t.TempDir()
+	t.Setenv("HOME", target)
+	targetConfig := filepath.Join(target, ".shai", "config.yaml")
+	targetLoader := infrastructure.NewFileLoader(targetConfig)
+	if _, err := targetLoader.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := importConfiguration(context.Background(), &out, targetLoader, bundlePath); err != nil {
+		t.Fatalf("import error: %v\n%s", err, out.String())
+	}
+
+	cfg, err := targetLoader.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Preferences.DefaultModel != "local" {
+		t.Errorf("default model = %s, want local", cfg.Preferences.DefaultModel)
+	}
+	imported, err := infrastructure.LoadPolicyDocument("~/.shai/guardrail.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Rules.DangerPatterns) != 1 || imported.Rules.DangerPatterns[0].Pattern != `\bterraform destroy\b` {
+		t.Errorf("guardrail patterns = %+v", imported.Rules.DangerPatterns)
+	}
+	backups, _ := filepath.Glob(targetConfig + ".*.bak")
+	if len(backups) != 1 {
+		t.Errorf("expected one config backup, got %v", backups)
+	}
+}
+
+func TestImportConfigurationIgnoresBundleRulesFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	evil := filepath.Join(t.TempDir(), "x", "evil.yaml")
+	bundle := "bundle_version: \"1\"\nconfig:\n" +
+		indent(strings.Replace(validConfigYAML, "~/.shai/guardrail.yaml", evil, 1)) +
+		"guardrail:\n  rules:\n    danger_patterns:\n      - pattern: '\\bterraform destroy\\b'\n        level: critical\n        action: block\n"
+	bundlePath := filepath.Join(t.TempDir(), "bundle.yaml")
+	if err := os.WriteFile(bundlePath, []byte(bundle), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		local     string
+		wantRules string
+	}{
+		{name: "no local config", wantRules: filepath.Join(home, ".shai", "guardrail.yaml")},
+		{name: "local rules_file kept", local: "~/.shai/team.yaml", wantRules: filepath.Join(home, ".shai", "team.yaml")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.local != "" {
+				local := strings.Replace(validConfigYAML, "~/.shai/guardrail.yaml", tt.local, 1)
+				if err := os.WriteFile(configPath, []byte(local), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			loader := infrastructure.NewFileLoader(configPath)
+
+			var out bytes.Buffer
+			if err := importConfiguration(context.Background(), &out, loader, bundlePath); err != nil {
+				t.Fatalf("import error: %v\n%s", err, out.String())
+			}
+			if _, err := os.Stat(evil); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("stat %s = %v, want nothing written there", evil, err)
+			}
+			imported, err := infrastructure.LoadPolicyDocument(tt.wantRules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(imported.Rules.DangerPatterns) != 1 {
+				t.Errorf("guardrail patterns at %s = %+v", tt.wantRules, imported.Rules.DangerPatterns)
+			}
+			cfg, err := loader.Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := infrastructure.ResolveRulesPath(cfg.Security.RulesFile); got != tt.wantRules {
+				t.Errorf("rules_file = %s, want %s", got, tt.wantRules)
+			}
+		})
+	}
+}
+
+// indent nests a YAML document one level deeper.
+func indent(doc string) string {
+	return "  " + strings.ReplaceAll(strings.TrimSuffix(doc, "\n"), "\n", "\n  ") + "\n"
+}
+
+func TestImportConfigurationRejectsInvalidBundle(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(dir, "bundle.yaml")
+	bundle := "bundle_version: \"1\"\nconfig:\n  models: []\n"
+	if err := os.WriteFile(bundlePath, []byte(bundle), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := importConfiguration(context.Background(), &out, infrastructure.NewFileLoader(configPath), bundlePath)
+	if err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Fatalf("import error = %v, want invalid configuration", err)
+	}
+	unchanged, _ := os.ReadFile(configPath)
+	if string(unchanged) != validConfigYAML {
+		t.Errorf("config modified despite invalid bundle:\n%s", unchanged)
+	}
+}
+
+func TestConfigGetKeys(t *testing.T) {
+	cfg := domain.Config{
+		ConfigFormatVersion: "1",
+		Preferences:         domain.Preferences{DefaultModel: "local", TimeoutSeconds: 30},
+		Models:              []domain.ModelDefinition{{Name: "local", Endpoint: "http://localhost:11434"}},
+		Context:             domain.ContextSettings{MaxFiles: 20, IncludeGit: "auto"},
+	}
+	tree, err := configTree(cfg)
+	if err != nil {
+		t.Fatalf("configTree error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		prefix      string
+		wantOutput  []string
+		wantMissing []string
+	}{
+		{
+			name:       "all keys",
+			wantOutput: []string{"preferences.timeout", "preferences.default_model", "models.0.endpoint", "context.max_files"},
+		},
+		{
+			name:        "prefix",
+			prefix:      "context.",
+			wantOutput:  []string{"context.include_git", "context.max_files"},
+			wantMissing: []string{"preferences.", "models."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := listConfigKeys(&out, tree, tt.prefix); err != nil {
+				t.Fatalf("listConfigKeys error: %v", err)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, unwanted := range tt.wantMissing {
+				if strings.Contains(out.String(), unwanted) {
+					t.Errorf("output unexpectedly contains %q:\n%s", unwanted, out.String())
+				}
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := printConfigKey(&out, tree, "models.0.endpoint"); err != nil {
+		t.Fatalf("printConfigKey error: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "http://localhost:11434" {
+		t.Errorf("printConfigKey = %q, want endpoint", got)
+	}
+	if err := printConfigKey(&out, tree, "preferences.missing"); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/doeshing/shai-go/internal/app"
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+// newContextCommand creates the context command group for inspecting collected context.
+func newContextCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: "Inspect the environment context sent to models",
+	}
+	cmd.AddCommand(newContextShowCommand(container))
+	return cmd
+}
+
+// ============================================================================
+// Context Show
+// ============================================================================
+
+func newContextShowCommand(container *app.Container) *cobra.Command {
+	var (
+		workDir string
+		output  string
+		req     domain.QueryRequest
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the context snapshot a query would collect",
+		Long: `Run the context collector with the current configuration and print the
+snapshot: directory, shell, detected tools, git, Kubernetes, Docker, files,
+environment variables and telemetry. The per-query toggles (--no-git,
+--with-env, ...) behave as they do for shai query.
+
+No request is sent to the model.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := container.ConfigProvider.Load(ctx)
+			if err != nil {
+				return err
+			}
+			dir, err := resolveWorkDir(workDir)
+			if err != nil {
+				return err
+			}
+			req.Context = ctx
+			req.WorkDir = dir
+			return showContext(ctx, cmd.OutOrStdout(), container.ContextCollector, cfg, req, output)
+		},
+	}
+
+	cmd.Flags().StringVar(&workDir, "dir", "", "Collect context in this directory")
+	cmd.Flags().StringVarP(&output, "output", "o", outputYAML, "Output format: yaml or json")
+	cmd.Flags().BoolVar(&req.WithGitStatus, "with-git-status", false, "Force include git status")
+	cmd.Flags().BoolVar(&req.WithEnv, "with-env", false, "Include select environment variables")
+	cmd.Flags().BoolVar(&req.WithK8sInfo, "with-k8s-info", false, "Include Kubernetes context")
+	cmd.Flags().BoolVar(&req.NoContext, "no-context", false, "Skip context collection except directory, shell, and OS")
+	cmd.Flags().BoolVar(&req.NoGit, "no-git", false, "Skip git status")
+	cmd.Flags().BoolVar(&req.NoK8s, "no-k8s", false, "Skip Kubernetes context")
+	cmd.Flags().BoolVar(&req.NoEnv, "no-env", false, "Skip environment variables")
+
+	return cmd
+}
+
+// showContext collects a snapshot for req and writes it to out as YAML or JSON.
+func showContext(
+	ctx context.Context,
+	out io.Writer,
+	collector ports.ContextCollector,
+	cfg domain.Config,
+	req domain.QueryRequest,
+	output string,
+) error {
+	if output != outputYAML && output != outputJSON && output != "" {
+		return fmt.Errorf("unsupported output format %q (use %s or %s)", output, outputYAML, outputJSON)
+	}
+	snapshot, err := collector.Collect(ctx, cfg, req)
+	if err != nil {
+		return fmt.Errorf("collect context: %w", err)
+	}
+
+	if output == outputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	}
+	data, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshal context: %w", err)
+	}
+	_, err = out.Write(data)
+	return err
+}
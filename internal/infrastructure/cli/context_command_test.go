@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+type recordingCollector struct {
+	snapshot domain.ContextSnapshot
+	req      domain.QueryRequest
+}
+
+func (c *recordingCollector) Collect(_ context.Context, _ domain.Config, req domain.QueryRequest) (domain.ContextSnapshot, error) {
+	c.req = req
+	return c.snapshot, nil
+}
+
+func TestShowContext(t *testing.T) {
+	collector := &recordingCollector{snapshot: domain.ContextSnapshot{
+		WorkingDir:     "/srv/app",
+		AvailableTools: []string{"git", "docker"},
+		Docker:         &domain.DockerStatus{Running: false},
+	}}
+
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{output: outputYAML, want: []string{"working_dir: /srv/app", "- git", "- docker", "running: false"}},
+		{output: outputJSON, want: []string{`"working_dir": "/srv/app"`, `"git"`, `"docker"`, `"running": false`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			var out bytes.Buffer
+			req := domain.QueryRequest{NoGit: true, WithEnv: true}
+			if err := showContext(context.Background(), &out, collector, domain.Config{}, req, tt.output); err != nil {
+				t.Fatalf("showContext error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+			if !collector.req.NoGit || !collector.req.WithEnv {
+				t.Errorf("context toggles not passed to collector: %+v", collector.req)
+			}
+		})
+	}
+
+	if err := showContext(context.Background(), &bytes.Buffer{}, collector, domain.Config{}, domain.QueryRequest{}, "xml"); err == nil {
+		t.Error("expected error for unsupported output format")
+	}
+}
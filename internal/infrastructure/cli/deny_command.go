@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/doeshing/shai-go/internal/app"
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+)
+
+// newDenyCommand creates the deny command group for commands the user never wants suggested.
+func newDenyCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deny",
+		Short: "Manage commands that should never be suggested",
+		Long: `Manage commands that should never be suggested.
+
+When a generated command matches an entry (the whole command or its leading
+words), the model is asked once for an alternative and the command is refused
+if it is suggested again. This is a preference list, separate from the
+guardrail whitelist and danger patterns.`,
+	}
+	cmd.AddCommand(newDenyAddCommand(container))
+	cmd.AddCommand(newDenyListCommand(container))
+	cmd.AddCommand(newDenyRemoveCommand(container))
+	return cmd
+}
+
+func newDenyAddCommand(container *app.Container) *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <command...>",
+		Short: "Add a command to the deny list",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return addDeniedCommand(cmd.Context(), cmd.OutOrStdout(), container.ConfigLoader, strings.Join(args, " "))
+		},
+	}
+}
+
+func newDenyListCommand(container *app.Container) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List denied commands",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listDeniedCommands(cmd.Context(), cmd.OutOrStdout(), container.ConfigLoader)
+		},
+	}
+}
+
+func newDenyRemoveCommand(container *app.Container) *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <command...>",
+		Short: "Remove a command from the deny list",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return removeDeniedCommand(cmd.Context(), cmd.OutOrStdout(), container.ConfigLoader, strings.Join(args, " "))
+		},
+	}
+}
+
+func addDeniedCommand(ctx context.Context, out io.Writer, loader *infrastructure.FileLoader, entry string) error {
+	entry = strings.Join(strings.Fields(entry), " ")
+	denied := false
+	err := loader.Update(ctx, func(cfg *domain.Config) error {
+		denied = slices.Contains(cfg.Preferences.DeniedCommands, entry)
+		if !denied {
+			cfg.Preferences.DeniedCommands = append(cfg.Preferences.DeniedCommands, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("update configuration: %w", err)
+	}
+	if denied {
+		fmt.Fprintf(out, "%q is already denied\n", entry)
+		return nil
+	}
+	fmt.Fprintf(out, "Denied %q\n", entry)
+	return nil
+}
+
+func listDeniedCommands(ctx context.Context, out io.Writer, loader *infrastructure.FileLoader) error {
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	if len(cfg.Preferences.DeniedCommands) == 0 {
+		fmt.Fprintln(out, "No denied commands")
+		return nil
+	}
+	for _, entry := range cfg.Preferences.DeniedCommands {
+		fmt.Fprintln(out, entry)
+	}
+	return nil
+}
+
+func removeDeniedCommand(ctx context.Context, out io.Writer, loader *infrastructure.FileLoader, entry string) error {
+	entry = strings.Join(strings.Fields(entry), " ")
+	err := loader.Update(ctx, func(cfg *domain.Config) error {
+		index := slices.Index(cfg.Preferences.DeniedCommands, entry)
+		if index < 0 {
+			return fmt.Errorf("%q is not on the deny list", entry)
+		}
+		cfg.Preferences.DeniedCommands = slices.Delete(cfg.Preferences.DeniedCommands, index, index+1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Removed %q\n", entry)
+	return nil
+}
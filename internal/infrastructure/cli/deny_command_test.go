@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/infrastructure"
+)
+
+func TestDenyAddListRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loader := infrastructure.NewFileLoader(path)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	if err := addDeniedCommand(ctx, &out, loader, "brew   upgrade"); err != nil {
+		t.Fatalf("add error: %v", err)
+	}
+	if err := addDeniedCommand(ctx, &out, loader, "brew upgrade"); err != nil {
+		t.Fatalf("duplicate add error: %v", err)
+	}
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Preferences.DeniedCommands; len(got) != 1 || got[0] != "brew upgrade" {
+		t.Fatalf("DeniedCommands = %q, want [brew upgrade]", got)
+	}
+
+	out.Reset()
+	if err := listDeniedCommands(ctx, &out, loader); err != nil {
+		t.Fatalf("list error: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "brew upgrade" {
+		t.Errorf("list output = %q", out.String())
+	}
+
+	if err := removeDeniedCommand(ctx, &out, loader, "brew upgrade"); err != nil {
+		t.Fatalf("remove error: %v", err)
+	}
+	if err := removeDeniedCommand(ctx, &out, loader, "brew upgrade"); err == nil {
+		t.Error("expected error removing an entry that is not denied")
+	}
+	cfg, err = loader.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Preferences.DeniedCommands) != 0 {
+		t.Errorf("DeniedCommands = %q, want empty", cfg.Preferences.DeniedCommands)
+	}
+}
@@ -0,0 +1,771 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/doeshing/shai-go/internal/app"
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+	"github.com/doeshing/shai-go/internal/services"
+)
+
+// newGuardrailCommand creates the guardrail command group for managing guardrail policies.
+func newGuardrailCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "guardrail",
+		Short: "Manage guardrail policies",
+	}
+	cmd.AddCommand(newGuardrailExportDefaultsCommand())
+	cmd.AddCommand(newGuardrailWhitelistCommand(container))
+	cmd.AddCommand(newGuardrailConfirmCommand(container))
+	cmd.AddCommand(newGuardrailPatternCommand(container))
+	cmd.AddCommand(newGuardrailDiffCommand(container))
+	cmd.AddCommand(newGuardrailLintCommand(container))
+	return cmd
+}
+
+// ============================================================================
+// Guardrail Export Defaults
+// ============================================================================
+
+func newGuardrailExportDefaultsCommand() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "export-defaults [path]",
+		Short: "Write the built-in guardrail policy as a starting point",
+		Long: `Write the built-in danger patterns, protected paths, confirmation levels,
+and whitelist as a guardrail YAML document. Without a path the policy is
+printed to stdout. Existing files are only replaced with --force.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return exportDefaultPolicy(cmd.OutOrStdout(), "", false)
+			}
+			return exportDefaultPolicy(cmd.OutOrStdout(), args[0], force)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing file")
+
+	return cmd
+}
+
+// exportDefaultPolicy writes the default policy to path, or to out when path is empty.
+func exportDefaultPolicy(out io.Writer, path string, force bool) error {
+	doc := infrastructure.DefaultPolicyDocument()
+	if path == "" {
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("marshal policy: %w", err)
+		}
+		_, err = out.Write(data)
+		return err
+	}
+
+	path = infrastructure.ResolveRulesPath(path)
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := infrastructure.SavePolicyDocument(path, doc); err != nil {
+		return fmt.Errorf("write policy: %w", err)
+	}
+	fmt.Fprintf(out, "Default guardrail policy written to %s\n", path)
+	return nil
+}
+
+// ============================================================================
+// Guardrail Whitelist
+// ============================================================================
+
+func newGuardrailWhitelistCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "whitelist",
+		Short: "Manage commands that skip guardrail checks",
+	}
+	cmd.AddCommand(newGuardrailWhitelistImportCommand(container))
+	return cmd
+}
+
+func newGuardrailWhitelistImportCommand(container *app.Container) *cobra.Command {
+	var replace bool
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Add whitelist entries from a file",
+		Long: `Read whitelist entries from a file with one command per line or a YAML list,
+and merge them into the guardrail whitelist. Duplicates are skipped and blank
+lines are ignored. Use --replace to overwrite the whitelist instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return importWhitelist(cmd.OutOrStdout(), cfg.Security.RulesFile, args[0], replace)
+		},
+	}
+
+	cmd.Flags().BoolVar(&replace, "replace", false, "Replace the whitelist instead of merging")
+
+	return cmd
+}
+
+// importWhitelist merges (or with replace, overwrites) the whitelist in the
+// guardrail policy at rulesFile with the entries listed in path.
+func importWhitelist(out io.Writer, rulesFile, path string, replace bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read whitelist file: %w", err)
+	}
+	entries, err := parseWhitelistEntries(data)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	var whitelist []string
+	added := 0
+	err = infrastructure.UpdatePolicyDocument(rulesFile, func(doc *infrastructure.PolicyDocument) error {
+		if !replace {
+			whitelist = doc.Rules.Whitelist
+		}
+		for _, entry := range entries {
+			if slices.Contains(whitelist, entry) {
+				continue
+			}
+			whitelist = append(whitelist, entry)
+			added++
+		}
+		doc.Rules.Whitelist = whitelist
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("update guardrail policy: %w", err)
+	}
+	if replace {
+		fmt.Fprintf(out, "Replaced whitelist with %d entries in %s\n", len(whitelist), infrastructure.ResolveRulesPath(rulesFile))
+		return nil
+	}
+	fmt.Fprintf(out, "Added %d whitelist entries (%d already present) to %s\n",
+		added, len(entries)-added, infrastructure.ResolveRulesPath(rulesFile))
+	return nil
+}
+
+// parseWhitelistEntries reads a YAML list of commands, or one command per line
+// when the file is not a YAML list. Blank lines are skipped, but an empty YAML
+// list item is rejected.
+func parseWhitelistEntries(data []byte) ([]string, error) {
+	var entries []string
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err == nil && len(node.Content) == 1 && node.Content[0].Kind == yaml.SequenceNode {
+		for i, item := range node.Content[0].Content {
+			entry := strings.TrimSpace(item.Value)
+			if item.Kind != yaml.ScalarNode || entry == "" {
+				return nil, fmt.Errorf("entry %d is empty or not a command", i+1)
+			}
+			entries = append(entries, entry)
+		}
+	} else {
+		for _, line := range strings.Split(string(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				entries = append(entries, line)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no whitelist entries found")
+	}
+	return entries, nil
+}
+
+// ============================================================================
+// Guardrail Confirm
+// ============================================================================
+
+// confirmationLevelOrder lists the configurable risk levels, most severe first.
+var confirmationLevelOrder = []string{"critical", "high", "medium", "low"}
+
+func newGuardrailConfirmCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "confirm",
+		Short: "Inspect and reset the confirmation required per risk level",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Print the action and message for each risk level",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return listConfirmationLevels(cmd.OutOrStdout(), cfg.Security.RulesFile)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "unset <level>",
+		Short: "Remove a level's override so the built-in default applies",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return unsetConfirmationLevel(cmd.OutOrStdout(), cfg.Security.RulesFile, args[0])
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "preview <level> [command]",
+		Short: "Show the confirmation prompt for a risk level without running a query",
+		Long: `Render the confirmation the prompter would show for level, using the message
+and action from the guardrail policy. When a sample command is given, the
+reasons the guardrail finds for it are listed as well. Nothing is executed.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			command := ""
+			if len(args) > 1 {
+				command = args[1]
+			}
+			return previewConfirmation(cmd.OutOrStdout(), cfg.Security.RulesFile, args[0], command)
+		},
+	})
+	return cmd
+}
+
+// listConfirmationLevels prints the effective mapping in rulesFile; levels the
+// policy leaves out, or sets to the built-in value, are marked default.
+func listConfirmationLevels(out io.Writer, rulesFile string) error {
+	doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		return fmt.Errorf("load guardrail policy: %w", err)
+	}
+	defaults := infrastructure.BuiltinConfirmationLevels()
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LEVEL\tACTION\tSOURCE\tMESSAGE")
+	for _, level := range confirmationLevelOrder {
+		setting, ok := doc.Rules.Confirmation[level]
+		source := "custom"
+		if !ok || setting == defaults[level] {
+			setting, source = defaults[level], "default"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", level, setting.Action, source, setting.Message)
+	}
+	return tw.Flush()
+}
+
+// previewCommand stands in for the command when preview is given none.
+const previewCommand = "<command>"
+
+// previewConfirmation writes what a confirmation at level looks like under the
+// policy at rulesFile. The reasons come from evaluating command, with the
+// confirmation message of its own level swapped for the one previewed.
+func previewConfirmation(out io.Writer, rulesFile, level, command string) error {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if !slices.Contains(confirmationLevelOrder, level) {
+		return fmt.Errorf("unknown risk level %q (use %s)", level, strings.Join(confirmationLevelOrder, ", "))
+	}
+	doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		return fmt.Errorf("load guardrail policy: %w", err)
+	}
+	setting := effectiveConfirmation(doc, level)
+	risk := domain.RiskAssessment{Level: domain.RiskLevel(level), Action: domain.GuardrailAction(setting.Action)}
+	if risk.Action == "" {
+		risk.Action = domain.ActionConfirm
+	}
+
+	if command == "" {
+		command = previewCommand
+	} else {
+		guardrail, err := infrastructure.NewGuardrail(rulesFile)
+		if err != nil {
+			return fmt.Errorf("load guardrail policy: %w", err)
+		}
+		assessed, err := guardrail.Evaluate(command)
+		if err != nil {
+			return err
+		}
+		if assessed.Level != risk.Level {
+			fmt.Fprintf(out, "Note: the guardrail rates this command %s; previewing %s.\n", assessed.Level, level)
+		}
+		own := effectiveConfirmation(doc, string(assessed.Level)).Message
+		risk.Reasons = slices.DeleteFunc(assessed.Reasons, func(reason string) bool { return reason == own })
+		risk.MatchedRules = assessed.MatchedRules
+	}
+	if setting.Message != "" {
+		risk.Reasons = append(risk.Reasons, setting.Message)
+	}
+
+	if risk.Action == domain.ActionBlock {
+		renderBlocked(out, &services.BlockedError{Command: command, Risk: risk})
+		return nil
+	}
+	prompter := NewPrompter(strings.NewReader(""), out)
+	prompter.menu = isTerminal(out)
+	prompter.Preview(risk.Action, risk.Level, command, risk.Reasons)
+	if risk.Action == domain.ActionPreviewOnly {
+		fmt.Fprintln(out, "(shown as a preview; never executed)")
+	}
+	return nil
+}
+
+// effectiveConfirmation returns the action and message the guardrail applies
+// at level: the policy's override, or the built-in mapping.
+func effectiveConfirmation(doc infrastructure.PolicyDocument, level string) domain.ConfirmationLevel {
+	if setting, ok := doc.Rules.Confirmation[level]; ok {
+		return setting
+	}
+	return infrastructure.BuiltinConfirmationLevels()[level]
+}
+
+// unsetConfirmationLevel deletes level from the confirmation mapping in
+// rulesFile. It errors when the level is unknown or has no entry to remove.
+func unsetConfirmationLevel(out io.Writer, rulesFile, level string) error {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if !slices.Contains(confirmationLevelOrder, level) {
+		return fmt.Errorf("unknown risk level %q (use %s)", level, strings.Join(confirmationLevelOrder, ", "))
+	}
+
+	err := infrastructure.UpdatePolicyDocument(rulesFile, func(doc *infrastructure.PolicyDocument) error {
+		if _, ok := doc.Rules.Confirmation[level]; !ok {
+			return fmt.Errorf("no confirmation override for %s in %s", level, infrastructure.ResolveRulesPath(rulesFile))
+		}
+		delete(doc.Rules.Confirmation, level)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Removed the %s confirmation override; the built-in default applies\n", level)
+	return nil
+}
+
+// ============================================================================
+// Guardrail Pattern
+// ============================================================================
+
+// patternActions are the actions a danger pattern may request.
+var patternActions = []string{
+	string(domain.ActionPreviewOnly),
+	string(domain.ActionSimpleConfirm),
+	string(domain.ActionConfirm),
+	string(domain.ActionExplicitConfirm),
+	string(domain.ActionBlock),
+}
+
+func newGuardrailPatternCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pattern",
+		Short: "Manage the danger patterns that flag risky commands",
+	}
+
+	var pattern domain.DangerPattern
+	add := &cobra.Command{
+		Use:   "add",
+		Short: "Add a danger pattern",
+		Long: `Add a regular expression to rules.danger_patterns. Commands matching it are
+raised to --level and handled with --action; --message is shown as the reason.
+The expression must compile and must not already be in the policy.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return addDangerPattern(cmd.OutOrStdout(), cfg.Security.RulesFile, pattern)
+		},
+	}
+	add.Flags().StringVar(&pattern.Pattern, "regex", "", "Regular expression matched against each command")
+	add.Flags().StringVar(&pattern.Level, "level", "", "Risk level: "+strings.Join(confirmationLevelOrder, ", "))
+	add.Flags().StringVar(&pattern.Action, "action", string(domain.ActionConfirm), "Action: "+strings.Join(patternActions, ", "))
+	add.Flags().StringVar(&pattern.Message, "message", "", "Reason shown when the pattern matches")
+	_ = add.MarkFlagRequired("regex")
+	_ = add.MarkFlagRequired("level")
+	_ = add.MarkFlagRequired("message")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Print the danger patterns in the guardrail policy",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return listDangerPatterns(cmd.OutOrStdout(), cfg.Security.RulesFile)
+		},
+	})
+
+	var regex string
+	remove := &cobra.Command{
+		Use:   "remove",
+		Short: "Remove a danger pattern",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return removeDangerPattern(cmd.OutOrStdout(), cfg.Security.RulesFile, regex)
+		},
+	}
+	remove.Flags().StringVar(&regex, "regex", "", "Exact expression of the pattern to remove")
+	_ = remove.MarkFlagRequired("regex")
+	cmd.AddCommand(remove)
+
+	return cmd
+}
+
+// addDangerPattern appends pattern to the policy at rulesFile after checking
+// its level, action and expression.
+func addDangerPattern(out io.Writer, rulesFile string, pattern domain.DangerPattern) error {
+	pattern.Level = strings.ToLower(strings.TrimSpace(pattern.Level))
+	pattern.Action = strings.ToLower(strings.TrimSpace(pattern.Action))
+	pattern.Message = strings.TrimSpace(pattern.Message)
+	switch {
+	case pattern.Pattern == "":
+		return errors.New("pattern regex is empty")
+	case !slices.Contains(confirmationLevelOrder, pattern.Level):
+		return fmt.Errorf("unknown risk level %q (use %s)", pattern.Level, strings.Join(confirmationLevelOrder, ", "))
+	case !slices.Contains(patternActions, pattern.Action):
+		return fmt.Errorf("unknown action %q (use %s)", pattern.Action, strings.Join(patternActions, ", "))
+	case pattern.Message == "":
+		return errors.New("pattern message is empty")
+	}
+
+	err := infrastructure.UpdatePolicyDocument(rulesFile, func(doc *infrastructure.PolicyDocument) error {
+		if slices.ContainsFunc(doc.Rules.DangerPatterns, func(existing domain.DangerPattern) bool {
+			return existing.Pattern == pattern.Pattern
+		}) {
+			return fmt.Errorf("danger pattern %q already exists in %s", pattern.Pattern, infrastructure.ResolveRulesPath(rulesFile))
+		}
+		doc.Rules.DangerPatterns = append(doc.Rules.DangerPatterns, pattern)
+		return infrastructure.ValidatePolicyDocument(*doc)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Added danger pattern %q (%s, %s) to %s\n",
+		pattern.Pattern, pattern.Level, pattern.Action, infrastructure.ResolveRulesPath(rulesFile))
+	return nil
+}
+
+// listDangerPatterns prints the danger patterns of the policy at rulesFile.
+func listDangerPatterns(out io.Writer, rulesFile string) error {
+	doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		return fmt.Errorf("load guardrail policy: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATTERN\tLEVEL\tACTION\tMESSAGE")
+	for _, pattern := range doc.Rules.DangerPatterns {
+		action := pattern.Action
+		if action == "" {
+			action = string(domain.ActionConfirm)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", pattern.Pattern, pattern.Level, action, pattern.Message)
+	}
+	return tw.Flush()
+}
+
+// removeDangerPattern deletes the pattern whose expression is exactly regex.
+func removeDangerPattern(out io.Writer, rulesFile, regex string) error {
+	err := infrastructure.UpdatePolicyDocument(rulesFile, func(doc *infrastructure.PolicyDocument) error {
+		patterns := slices.DeleteFunc(slices.Clone(doc.Rules.DangerPatterns), func(pattern domain.DangerPattern) bool {
+			return pattern.Pattern == regex
+		})
+		if len(patterns) == len(doc.Rules.DangerPatterns) {
+			return fmt.Errorf("no danger pattern %q in %s", regex, infrastructure.ResolveRulesPath(rulesFile))
+		}
+		doc.Rules.DangerPatterns = patterns
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Removed danger pattern %q\n", regex)
+	return nil
+}
+
+// ============================================================================
+// Guardrail Diff
+// ============================================================================
+
+func newGuardrailDiffCommand(container *app.Container) *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show how the guardrail policy differs from the built-in defaults",
+		Long: `Compare the loaded guardrail policy with the policy shipped with shai and list
+added, removed and changed danger patterns, protected paths, whitelist entries,
+confirmation levels and settings. Message text is ignored; only changes that
+affect what is blocked or confirmed are reported.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return diffPolicy(cmd.OutOrStdout(), cfg.Security.RulesFile, asJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the differences as JSON")
+
+	return cmd
+}
+
+// policyDiff groups the differences between a policy and the built-in one.
+type policyDiff struct {
+	DangerPatterns     policyChanges `json:"danger_patterns"`
+	ProtectedPaths     policyChanges `json:"protected_paths"`
+	Whitelist          policyChanges `json:"whitelist"`
+	ConfirmationLevels policyChanges `json:"confirmation_levels"`
+	Settings           policyChanges `json:"settings"`
+}
+
+// policyChanges lists the entries of one policy section that differ, by key.
+type policyChanges struct {
+	Added   []policyEntry  `json:"added,omitempty"`
+	Removed []policyEntry  `json:"removed,omitempty"`
+	Changed []policyChange `json:"changed,omitempty"`
+}
+
+// policyEntry is a section entry such as a danger pattern and its level/action.
+type policyEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// policyChange is an entry present in both policies with a different value.
+type policyChange struct {
+	Key  string `json:"key"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (c policyChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// policySection is one titled section of a policyDiff.
+type policySection struct {
+	title   string
+	changes policyChanges
+}
+
+// sections pairs each section with its heading, in display order.
+func (d policyDiff) sections() []policySection {
+	return []policySection{
+		{"Danger patterns", d.DangerPatterns},
+		{"Protected paths", d.ProtectedPaths},
+		{"Whitelist", d.Whitelist},
+		{"Confirmation levels", d.ConfirmationLevels},
+		{"Settings", d.Settings},
+	}
+}
+
+// diffPolicy prints how the guardrail policy at rulesFile differs from the
+// built-in policy, as text or with asJSON as a JSON document.
+func diffPolicy(out io.Writer, rulesFile string, asJSON bool) error {
+	doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		return fmt.Errorf("load guardrail policy: %w", err)
+	}
+	diff := comparePolicies(infrastructure.BuiltinPolicyDocument(), doc)
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			return fmt.Errorf("encode policy diff: %w", err)
+		}
+		return nil
+	}
+	renderPolicyDiff(out, infrastructure.ResolveRulesPath(rulesFile), diff)
+	return nil
+}
+
+// comparePolicies reports what doc adds, removes or changes relative to base.
+func comparePolicies(base, doc infrastructure.PolicyDocument) policyDiff {
+	return policyDiff{
+		DangerPatterns:     compareEntries(dangerPatternEntries(base), dangerPatternEntries(doc)),
+		ProtectedPaths:     compareEntries(protectedPathEntries(base), protectedPathEntries(doc)),
+		Whitelist:          compareEntries(whitelistEntries(base), whitelistEntries(doc)),
+		ConfirmationLevels: compareEntries(confirmationEntries(base, base), confirmationEntries(doc, base)),
+		Settings:           compareEntries(policySettings(base), policySettings(doc)),
+	}
+}
+
+// compareEntries diffs two key/value views of a section, sorted by key.
+func compareEntries(base, current map[string]string) policyChanges {
+	var changes policyChanges
+	for _, key := range slices.Sorted(maps.Keys(current)) {
+		value := current[key]
+		old, ok := base[key]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, policyEntry{Key: key, Value: value})
+		case old != value:
+			changes.Changed = append(changes.Changed, policyChange{Key: key, From: old, To: value})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(base)) {
+		if _, ok := current[key]; !ok {
+			changes.Removed = append(changes.Removed, policyEntry{Key: key, Value: base[key]})
+		}
+	}
+	return changes
+}
+
+func dangerPatternEntries(doc infrastructure.PolicyDocument) map[string]string {
+	entries := map[string]string{}
+	for _, pattern := range doc.Rules.DangerPatterns {
+		entries[pattern.Pattern] = pattern.Level + "/" + pattern.Action
+	}
+	return entries
+}
+
+func protectedPathEntries(doc infrastructure.PolicyDocument) map[string]string {
+	entries := map[string]string{}
+	for _, rule := range doc.Rules.ProtectedPaths {
+		entries[rule.Path] = fmt.Sprintf("%s/%s on %s", rule.Level, rule.Action, strings.Join(rule.Operations, ", "))
+	}
+	return entries
+}
+
+func whitelistEntries(doc infrastructure.PolicyDocument) map[string]string {
+	entries := map[string]string{}
+	for _, entry := range doc.Rules.Whitelist {
+		entries[entry] = ""
+	}
+	return entries
+}
+
+// confirmationEntries maps each risk level to its action in doc, using
+// fallback for levels doc leaves out, as the guardrail does at load time.
+func confirmationEntries(doc, fallback infrastructure.PolicyDocument) map[string]string {
+	entries := map[string]string{}
+	for _, level := range confirmationLevelOrder {
+		if setting, ok := doc.Rules.Confirmation[level]; ok {
+			entries[level] = setting.Action
+		} else if setting, ok := fallback.Rules.Confirmation[level]; ok {
+			entries[level] = setting.Action
+		}
+	}
+	return entries
+}
+
+// policySettings lists the scalar rules with the defaults the guardrail applies.
+func policySettings(doc infrastructure.PolicyDocument) map[string]string {
+	maxFiles := doc.Rules.Preview.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = domain.DefaultPreviewMaxFiles
+	}
+	return map[string]string{
+		"sudo_escalation":   strconv.FormatBool(doc.Rules.SudoEscalation == nil || *doc.Rules.SudoEscalation),
+		"network_check":     strconv.FormatBool(doc.Rules.NetworkCheck),
+		"preview.max_files": strconv.Itoa(maxFiles),
+	}
+}
+
+func renderPolicyDiff(out io.Writer, path string, diff policyDiff) {
+	differs := false
+	for _, section := range diff.sections() {
+		differs = differs || !section.changes.empty()
+	}
+	if !differs {
+		fmt.Fprintf(out, "Guardrail policy %s matches the built-in defaults\n", path)
+		return
+	}
+
+	fmt.Fprintf(out, "Guardrail policy %s differs from the built-in defaults:\n", path)
+	for _, section := range diff.sections() {
+		if section.changes.empty() {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", section.title)
+		for _, entry := range section.changes.Added {
+			fmt.Fprintf(out, "  + %s\n", formatPolicyEntry(entry))
+		}
+		for _, entry := range section.changes.Removed {
+			fmt.Fprintf(out, "  - %s\n", formatPolicyEntry(entry))
+		}
+		for _, change := range section.changes.Changed {
+			fmt.Fprintf(out, "  ~ %s: %s -> %s\n", change.Key, change.From, change.To)
+		}
+	}
+}
+
+func formatPolicyEntry(entry policyEntry) string {
+	if entry.Value == "" {
+		return entry.Key
+	}
+	return fmt.Sprintf("%s (%s)", entry.Key, entry.Value)
+}
+
+// ============================================================================
+// Guardrail Lint
+// ============================================================================
+
+func newGuardrailLintCommand(container *app.Container) *cobra.Command {
+	return &cobra.Command{
+		Use:   "lint",
+		Short: "Warn about weak, redundant or contradictory guardrail rules",
+		Long: `Check the loaded guardrail policy for danger patterns that do not compile or
+match every command, duplicate entries, whitelist entries that a danger pattern
+would flag (the whitelist wins, so the pattern is skipped) and protected paths
+without operations, which never match. Exits non-zero when anything is found.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return lintPolicy(cmd.OutOrStdout(), cfg.Security.RulesFile)
+		},
+	}
+}
+
+// lintPolicy prints one line per lint warning for the policy at rulesFile and
+// errors when there are any.
+func lintPolicy(out io.Writer, rulesFile string) error {
+	doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		return fmt.Errorf("load guardrail policy: %w", err)
+	}
+	path := infrastructure.ResolveRulesPath(rulesFile)
+	warnings := infrastructure.LintPolicyDocument(doc)
+	if len(warnings) == 0 {
+		fmt.Fprintf(out, "No issues found in %s\n", path)
+		return nil
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
+	return fmt.Errorf("%s: %d guardrail lint warning(s)", path, len(warnings))
+}
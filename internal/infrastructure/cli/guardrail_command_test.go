@@ -0,0 +1,399 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+)
+
+func TestExportDefaultPolicyReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guardrail.yaml")
+
+	var out bytes.Buffer
+	if err := exportDefaultPolicy(&out, path, false); err != nil {
+		t.Fatalf("exportDefaultPolicy error: %v", err)
+	}
+
+	guardrail, err := infrastructure.NewGuardrail(path)
+	if err != nil {
+		t.Fatalf("NewGuardrail on exported policy: %v", err)
+	}
+	risk, err := guardrail.Evaluate("rm -rf /")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if risk.Action != domain.ActionBlock {
+		t.Errorf("exported defaults action for rm -rf / = %s, want block", risk.Action)
+	}
+
+	if err := exportDefaultPolicy(&out, path, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected refusal to overwrite, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportDefaultPolicy(&out, path, true); err != nil {
+		t.Fatalf("exportDefaultPolicy --force error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "danger_patterns") {
+		t.Errorf("forced export did not rewrite the policy:\n%s", data)
+	}
+}
+
+func TestImportWhitelist(t *testing.T) {
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "guardrail.yaml")
+	doc := infrastructure.DefaultPolicyDocument()
+	doc.Rules.Whitelist = []string{"ls", "pwd"}
+	if err := infrastructure.SavePolicyDocument(rulesFile, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := filepath.Join(dir, "team.txt")
+	if err := os.WriteFile(lines, []byte("pwd\n\n  git status  \r\nmake test\ngit status\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := importWhitelist(&out, rulesFile, lines, false); err != nil {
+		t.Fatalf("importWhitelist error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Added 2 whitelist entries (2 already present)") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	assertWhitelist(t, rulesFile, []string{"ls", "pwd", "git status", "make test"})
+
+	list := filepath.Join(dir, "team.yaml")
+	if err := os.WriteFile(list, []byte("- docker ps\n- make test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := importWhitelist(&out, rulesFile, list, true); err != nil {
+		t.Fatalf("importWhitelist --replace error: %v", err)
+	}
+	assertWhitelist(t, rulesFile, []string{"docker ps", "make test"})
+}
+
+func TestParseWhitelistEntriesRejectsEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "blank file", data: "\n  \n"},
+		{name: "empty yaml item", data: "- ls\n- \"\"\n"},
+		{name: "null yaml item", data: "- ls\n-\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if entries, err := parseWhitelistEntries([]byte(tt.data)); err == nil {
+				t.Fatalf("expected error, got %q", entries)
+			}
+		})
+	}
+}
+
+func assertWhitelist(t *testing.T, rulesFile string, want []string) {
+	t.Helper()
+	doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(doc.Rules.Whitelist, "|") != strings.Join(want, "|") {
+		t.Errorf("whitelist = %q, want %q", doc.Rules.Whitelist, want)
+	}
+}
+
+func TestGuardrailConfirmListUnset(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "guardrail.yaml")
+	doc := infrastructure.DefaultPolicyDocument()
+	doc.Rules.Confirmation = infrastructure.BuiltinConfirmationLevels()
+	doc.Rules.Confirmation["high"] = domain.ConfirmationLevel{Action: "confirm", Message: "Ask twice."}
+	delete(doc.Rules.Confirmation, "low")
+	if err := infrastructure.SavePolicyDocument(rulesFile, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := listConfirmationLevels(&out, rulesFile); err != nil {
+		t.Fatalf("listConfirmationLevels error: %v", err)
+	}
+	assertConfirmRow(t, out.String(), "critical", "block", "default")
+	assertConfirmRow(t, out.String(), "high", "confirm", "custom")
+	assertConfirmRow(t, out.String(), "medium", "confirm", "default")
+	assertConfirmRow(t, out.String(), "low", "simple_confirm", "default")
+	if !strings.Contains(out.String(), "Ask twice.") {
+		t.Errorf("custom message missing:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := unsetConfirmationLevel(&out, rulesFile, "High"); err != nil {
+		t.Fatalf("unsetConfirmationLevel error: %v", err)
+	}
+	saved, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.Rules.Confirmation["high"]; ok {
+		t.Errorf("high override still present: %+v", saved.Rules.Confirmation)
+	}
+	if _, ok := saved.Rules.Confirmation["medium"]; !ok {
+		t.Errorf("other levels must be kept: %+v", saved.Rules.Confirmation)
+	}
+
+	out.Reset()
+	if err := listConfirmationLevels(&out, rulesFile); err != nil {
+		t.Fatal(err)
+	}
+	assertConfirmRow(t, out.String(), "high", "explicit_confirm", "default")
+
+	for _, level := range []string{"high", "low", "extreme"} {
+		if err := unsetConfirmationLevel(&out, rulesFile, level); err == nil {
+			t.Errorf("unset %s: expected error", level)
+		}
+	}
+}
+
+// assertConfirmRow checks the action and source columns of level's row.
+func assertConfirmRow(t *testing.T, output, level, action, source string) {
+	t.Helper()
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == level {
+			if fields[1] != action || fields[2] != source {
+				t.Errorf("%s row = %q, want action %s source %s", level, line, action, source)
+			}
+			return
+		}
+	}
+	t.Errorf("no row for %s:\n%s", level, output)
+}
+
+func TestGuardrailPatternAddListRemove(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "guardrail.yaml")
+	if err := infrastructure.SavePolicyDocument(rulesFile, infrastructure.DefaultPolicyDocument()); err != nil {
+		t.Fatal(err)
+	}
+	pattern := domain.DangerPattern{Pattern: `terraform\s+destroy`, Level: "High", Action: "block", Message: "Destroys infrastructure"}
+
+	var out bytes.Buffer
+	if err := addDangerPattern(&out, rulesFile, pattern); err != nil {
+		t.Fatalf("addDangerPattern error: %v", err)
+	}
+	guardrail, err := infrastructure.NewGuardrail(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	risk, err := guardrail.Evaluate("terraform destroy -auto-approve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if risk.Level != domain.RiskHigh || !slices.Contains(risk.MatchedRules, pattern.Pattern) {
+		t.Errorf("risk = %s matching %q, want high from the added pattern", risk.Level, risk.MatchedRules)
+	}
+	if err := addDangerPattern(&out, rulesFile, pattern); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("duplicate add error = %v, want already exists", err)
+	}
+
+	out.Reset()
+	if err := listDangerPatterns(&out, rulesFile); err != nil {
+		t.Fatalf("listDangerPatterns error: %v", err)
+	}
+	if !strings.Contains(out.String(), `terraform\s+destroy`) || !strings.Contains(out.String(), "Destroys infrastructure") {
+		t.Errorf("list missing added pattern:\n%s", out.String())
+	}
+
+	if err := removeDangerPattern(&out, rulesFile, pattern.Pattern); err != nil {
+		t.Fatalf("removeDangerPattern error: %v", err)
+	}
+	doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Rules.DangerPatterns) != len(infrastructure.DefaultPolicyDocument().Rules.DangerPatterns) {
+		t.Errorf("remove changed other patterns: %d left", len(doc.Rules.DangerPatterns))
+	}
+	if err := removeDangerPattern(&out, rulesFile, pattern.Pattern); err == nil {
+		t.Error("removing a missing pattern: expected error")
+	}
+}
+
+func TestAddDangerPatternRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern domain.DangerPattern
+		want    string
+	}{
+		{"bad regex", domain.DangerPattern{Pattern: `rm (-rf`, Level: "high", Action: "confirm", Message: "m"}, "compile pattern"},
+		{"bad level", domain.DangerPattern{Pattern: `rm`, Level: "extreme", Action: "confirm", Message: "m"}, "unknown risk level"},
+		{"bad action", domain.DangerPattern{Pattern: `rm`, Level: "high", Action: "deny", Message: "m"}, "unknown action"},
+		{"no message", domain.DangerPattern{Pattern: `rm`, Level: "high", Action: "confirm"}, "message is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rulesFile := filepath.Join(t.TempDir(), "guardrail.yaml")
+			defaults := infrastructure.DefaultPolicyDocument()
+			if err := infrastructure.SavePolicyDocument(rulesFile, defaults); err != nil {
+				t.Fatal(err)
+			}
+			err := addDangerPattern(io.Discard, rulesFile, tt.pattern)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("addDangerPattern error = %v, want %q", err, tt.want)
+			}
+			doc, err := infrastructure.LoadPolicyDocument(rulesFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.Rules.DangerPatterns) != len(defaults.Rules.DangerPatterns) {
+				t.Errorf("policy changed despite the error: %d patterns", len(doc.Rules.DangerPatterns))
+			}
+		})
+	}
+}
+
+func TestGuardrailDiff(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "guardrail.yaml")
+	doc := infrastructure.BuiltinPolicyDocument()
+	doc.Rules.DangerPatterns = append(doc.Rules.DangerPatterns,
+		domain.DangerPattern{Pattern: `terraform\s+destroy`, Level: "high", Action: "confirm", Message: "Destroys infrastructure"})
+	doc.Rules.Whitelist = slices.DeleteFunc(doc.Rules.Whitelist, func(entry string) bool { return entry == "pwd" })
+	doc.Rules.Confirmation["high"] = domain.ConfirmationLevel{Action: "simple_confirm"}
+	if err := infrastructure.SavePolicyDocument(rulesFile, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := diffPolicy(&out, rulesFile, true); err != nil {
+		t.Fatalf("diffPolicy --json error: %v", err)
+	}
+	var diff policyDiff
+	if err := json.Unmarshal(out.Bytes(), &diff); err != nil {
+		t.Fatalf("decode diff: %v\n%s", err, out.String())
+	}
+	want := policyDiff{
+		DangerPatterns:     policyChanges{Added: []policyEntry{{Key: `terraform\s+destroy`, Value: "high/confirm"}}},
+		Whitelist:          policyChanges{Removed: []policyEntry{{Key: "pwd"}}},
+		ConfirmationLevels: policyChanges{Changed: []policyChange{{Key: "high", From: "explicit_confirm", To: "simple_confirm"}}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %+v, want %+v", diff, want)
+	}
+
+	out.Reset()
+	if err := diffPolicy(&out, rulesFile, false); err != nil {
+		t.Fatalf("diffPolicy error: %v", err)
+	}
+	for _, line := range []string{`  + terraform\s+destroy (high/confirm)`, "  - pwd", "  ~ high: explicit_confirm -> simple_confirm"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("output missing %q:\n%s", line, out.String())
+		}
+	}
+
+	if err := infrastructure.SavePolicyDocument(rulesFile, infrastructure.BuiltinPolicyDocument()); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := diffPolicy(&out, rulesFile, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "matches the built-in defaults") {
+		t.Errorf("unchanged policy reported differences:\n%s", out.String())
+	}
+}
+
+func TestGuardrailLint(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "guardrail.yaml")
+	doc := infrastructure.BuiltinPolicyDocument()
+	if err := infrastructure.SavePolicyDocument(rulesFile, doc); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := lintPolicy(&out, rulesFile); err != nil || !strings.Contains(out.String(), "No issues found") {
+		t.Fatalf("lintPolicy() on the built-in policy = %v, output %q", err, out.String())
+	}
+
+	doc.Rules.ProtectedPaths = append(doc.Rules.ProtectedPaths, domain.ProtectedPath{Path: "/srv/data", Level: "high"})
+	if err := infrastructure.SavePolicyDocument(rulesFile, doc); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	err := lintPolicy(&out, rulesFile)
+	if err == nil || !strings.Contains(err.Error(), "1 guardrail lint warning") {
+		t.Errorf("lintPolicy() error = %v, want one warning", err)
+	}
+	if !strings.Contains(out.String(), `Warning: protected_paths: "/srv/data": has no operations`) {
+		t.Errorf("output = %q, want the protected path warning", out.String())
+	}
+}
+
+func TestPreviewConfirmation(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "guardrail.yaml")
+	doc := infrastructure.BuiltinPolicyDocument()
+	doc.Rules.Confirmation["medium"] = domain.ConfirmationLevel{Action: "confirm", Message: "Check the target twice."}
+	if err := infrastructure.SavePolicyDocument(rulesFile, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		level   string
+		command string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "configured message and input",
+			level: "Medium",
+			want:  []string{"MEDIUM risk detected (confirm)", " - Check the target twice.", "<command>", "Continue? [y/N]:"},
+		},
+		{
+			name:    "sample command reasons",
+			level:   "medium",
+			command: "chmod -R 777 /srv/www",
+			want:    []string{" - Recursively setting overly permissive permissions", " - Check the target twice.", "chmod -R 777 /srv/www"},
+			notWant: []string{"blocked by security policy"},
+		},
+		{
+			name:    "explicit confirmation",
+			level:   "high",
+			command: "ls",
+			want:    []string{"Note: the guardrail rates this command safe; previewing high.", "HIGH risk detected (explicit_confirm)", "Type 'yes' to confirm"},
+			notWant: []string{"[y/N]"},
+		},
+		{
+			name:  "block",
+			level: "critical",
+			want:  []string{"Blocked by guardrail: <command>", "This action is blocked by security policy."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := previewConfirmation(&out, rulesFile, tt.level, tt.command); err != nil {
+				t.Fatalf("previewConfirmation error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("missing %q in:\n%s", want, out.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("unexpected %q in:\n%s", notWant, out.String())
+				}
+			}
+		})
+	}
+
+	if err := previewConfirmation(io.Discard, rulesFile, "extreme", ""); err == nil {
+		t.Error("unknown level: expected error")
+	}
+}
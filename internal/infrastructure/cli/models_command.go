@@ -0,0 +1,608 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/doeshing/shai-go/internal/app"
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+	"github.com/doeshing/shai-go/internal/infrastructure/ai"
+	"github.com/doeshing/shai-go/internal/ports"
+	"github.com/doeshing/shai-go/internal/services"
+)
+
+const (
+	defaultModelTestPrompt = "list files in the current directory"
+	replySnippetLength     = 200
+)
+
+// newModelsCommand creates the models command group for inspecting configured models.
+func newModelsCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "models",
+		Short: "Inspect and test configured AI models",
+	}
+	cmd.AddCommand(newModelsListCommand(container))
+	cmd.AddCommand(newModelsTestCommand(container))
+	cmd.AddCommand(newModelsBenchCommand(container))
+	cmd.AddCommand(newModelsReorderCommand(container))
+	cmd.AddCommand(newModelsDefaultCommand(container))
+	return cmd
+}
+
+// ============================================================================
+// Models List
+// ============================================================================
+
+// Supported values for --output (models list, context show).
+const (
+	outputTable = "table"
+	outputYAML  = "yaml"
+	outputJSON  = "json"
+)
+
+// listOptions controls how much model detail listModels prints.
+type listOptions struct {
+	Wide       bool
+	ShowPrompt bool
+	Output     string
+	Order      bool
+}
+
+func newModelsListCommand(container *app.Container) *cobra.Command {
+	var opts listOptions
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List configured models",
+		Long: `List configured models as a compact table.
+
+Use --wide for max tokens, auth variables, and API format columns,
+--show-prompt to include each model's prompt messages, or -o yaml to
+dump the full model definitions. --order prints the models a query with
+the default model tries, in fallback order.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if opts.Order {
+				primary, err := services.DefaultModel(cfg)
+				if err != nil {
+					return err
+				}
+				return listCandidateOrder(cmd.OutOrStdout(), cfg, container.QueryService.CandidateModels(cfg, primary))
+			}
+			return listModels(cmd.OutOrStdout(), cfg, opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Wide, "wide", "w", false, "Show max tokens, auth env and API format columns")
+	cmd.Flags().BoolVar(&opts.ShowPrompt, "show-prompt", false, "Print each model's prompt messages")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", outputTable, "Output format: table or yaml")
+	cmd.Flags().BoolVar(&opts.Order, "order", false, "Show the default model's fallback chain in the order it is tried")
+
+	return cmd
+}
+
+func listModels(out io.Writer, cfg domain.Config, opts listOptions) error {
+	switch opts.Output {
+	case outputYAML:
+		data, err := yaml.Marshal(cfg.Models)
+		if err != nil {
+			return fmt.Errorf("marshal models: %w", err)
+		}
+		_, err = out.Write(data)
+		return err
+	case outputTable, "":
+	default:
+		return fmt.Errorf("unsupported output format %q (use %s or %s)", opts.Output, outputTable, outputYAML)
+	}
+
+	if len(cfg.Models) == 0 {
+		fmt.Fprintln(out, "No models configured")
+		return nil
+	}
+
+	primary, _ := services.DefaultModel(cfg)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "NAME\tMODEL ID\tENDPOINT\tDEFAULT"
+	if opts.Wide {
+		header += "\tMAX TOKENS\tAUTH ENV\tRESPONSE PATH\tSYSTEM MODE"
+	}
+	fmt.Fprintln(tw, header)
+	for _, model := range cfg.Models {
+		isDefault := ""
+		if model.Name == primary.Name {
+			isDefault = "*"
+		}
+		row := fmt.Sprintf("%s\t%s\t%s\t%s", model.Name, model.ModelID, model.Endpoint, isDefault)
+		if opts.Wide {
+			authEnv := strings.Join(model.AuthEnvVarNames(), ",")
+			switch {
+			case model.AuthCommand != "" && authEnv != "":
+				authEnv += ",(command)"
+			case model.AuthCommand != "":
+				authEnv = "(command)"
+			case authEnv == "":
+				authEnv = "-"
+			}
+			row += fmt.Sprintf("\t%d\t%s\t%s\t%s",
+				model.MaxTokens, authEnv, model.APIFormat.GetResponseJSONPath(), model.APIFormat.GetSystemMessageMode())
+		}
+		fmt.Fprintln(tw, row)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if opts.ShowPrompt {
+		for _, model := range cfg.Models {
+			fmt.Fprintf(out, "\n%s prompt:\n", model.Name)
+			if len(model.Prompt) == 0 {
+				fmt.Fprintln(out, "  (built-in default prompt)")
+				continue
+			}
+			for _, msg := range model.Prompt {
+				fmt.Fprintf(out, "  [%s] %s\n", msg.Role, strings.ReplaceAll(strings.TrimSpace(msg.Content), "\n", "\n    "))
+			}
+		}
+	}
+	return nil
+}
+
+// listCandidateOrder prints candidates, the default model followed by its
+// fallbacks, and notes fallback entries that are skipped.
+func listCandidateOrder(out io.Writer, cfg domain.Config, candidates []domain.ModelDefinition) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORDER\tNAME\tMODEL ID\tROLE")
+	// pending holds the fallbacks still to be matched against the configured
+	// list, so duplicates and the default model itself are reported as skipped.
+	pending := map[string]bool{}
+	for i, model := range candidates {
+		role := "default"
+		if i > 0 {
+			role = "fallback"
+			pending[model.Name] = true
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, model.Name, model.ModelID, role)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, name := range cfg.Preferences.FallbackModels {
+		switch {
+		case !cfg.HasModel(name):
+			fmt.Fprintf(out, "Skipped fallback %s: no such model\n", name)
+		case !pending[name]:
+			fmt.Fprintf(out, "Skipped fallback %s: already tried earlier\n", name)
+		}
+		pending[name] = false
+	}
+	return nil
+}
+
+// ============================================================================
+// Models Test
+// ============================================================================
+
+func newModelsTestCommand(container *app.Container) *cobra.Command {
+	var (
+		prompt  string
+		timeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test [name]",
+		Short: "Send a prompt to a model and show the extracted command",
+		Long: `Send a prompt to a model and show the extracted command, a snippet of the
+raw reply, and the guardrail assessment. The command is never executed.
+
+The default model is used when no name is given.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			cfg, err := container.ConfigProvider.Load(ctx)
+			if err != nil {
+				return err
+			}
+			model, err := resolveModelArg(cfg, args)
+			if err != nil {
+				return err
+			}
+			return testModel(ctx, cmd.OutOrStdout(), container.ProviderFactory, container.SecurityService, model, prompt)
+		},
+	}
+
+	cmd.Flags().StringVarP(&prompt, "prompt", "p", defaultModelTestPrompt, "Natural language prompt to send")
+	cmd.Flags().DurationVar(&timeout, "timeout", domain.DefaultModelTestTimeout, "Maximum time to wait for the model")
+
+	return cmd
+}
+
+// resolveModelArg returns the named model, or the default model when no name is given.
+func resolveModelArg(cfg domain.Config, args []string) (domain.ModelDefinition, error) {
+	if len(args) == 0 {
+		return services.DefaultModel(cfg)
+	}
+	model, ok := cfg.FindModelByName(args[0])
+	if !ok {
+		return domain.ModelDefinition{}, fmt.Errorf("model %s not found", args[0])
+	}
+	return model, nil
+}
+
+func testModel(
+	ctx context.Context,
+	out io.Writer,
+	factory ports.ProviderFactory,
+	security ports.SecurityService,
+	model domain.ModelDefinition,
+	prompt string,
+) error {
+	provider, err := factory.ForModel(model)
+	if err != nil {
+		return fmt.Errorf("provider init: %w", err)
+	}
+
+	fmt.Fprintf(out, "Testing model %s (%s) at %s\n", model.Name, model.ModelID, model.Endpoint)
+	fmt.Fprintf(out, "Prompt: %s\n\n", prompt)
+
+	start := time.Now()
+	resp, err := provider.Generate(ctx, ports.ProviderRequest{Prompt: prompt, Model: model})
+	elapsed := time.Since(start).Round(time.Millisecond)
+	switch {
+	case errors.Is(err, ai.ErrResponseParse):
+		fmt.Fprintf(out, "✗ Model responded in %s but the reply did not match api_format\n", elapsed)
+		return fmt.Errorf("extraction failed: %w", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Fprintf(out, "✗ No response within %s\n", elapsed)
+		return fmt.Errorf("connectivity failed: %w", err)
+	case err != nil:
+		fmt.Fprintf(out, "✗ Request failed after %s\n", elapsed)
+		return fmt.Errorf("connectivity failed: %w", err)
+	}
+
+	fmt.Fprintf(out, "✓ Model responded in %s\n", elapsed)
+	fmt.Fprintf(out, "Reply:   %s\n", replySnippet(resp.Reply))
+
+	command := strings.TrimSpace(resp.Command)
+	if command == "" {
+		fmt.Fprintln(out, "✗ No command could be extracted from the reply")
+		return errors.New("extraction failed: empty command")
+	}
+	fmt.Fprintf(out, "Command: %s\n", command)
+
+	if security == nil {
+		return nil
+	}
+	risk, err := security.Evaluate(command)
+	if err != nil {
+		return fmt.Errorf("security evaluate: %w", err)
+	}
+	fmt.Fprintf(out, "Risk:    %s (%s)\n", strings.ToUpper(string(risk.Level)), risk.Action)
+	for _, reason := range risk.Reasons {
+		fmt.Fprintf(out, " - %s\n", reason)
+	}
+	return nil
+}
+
+// ============================================================================
+// Models Bench
+// ============================================================================
+
+// benchOptions controls how many generations models bench runs.
+type benchOptions struct {
+	Prompt  string
+	Runs    int
+	Timeout time.Duration
+	JSON    bool
+}
+
+// benchResult summarizes latency across successful runs.
+type benchResult struct {
+	Model       string   `json:"model"`
+	Runs        int      `json:"runs"`
+	Successes   int      `json:"successes"`
+	SuccessRate float64  `json:"success_rate"`
+	MinMS       int64    `json:"min_ms"`
+	MedianMS    int64    `json:"median_ms"`
+	MaxMS       int64    `json:"max_ms"`
+	Errors      []string `json:"errors,omitempty"`
+	Interrupted bool     `json:"interrupted,omitempty"`
+}
+
+func newModelsBenchCommand(container *app.Container) *cobra.Command {
+	opts := benchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "bench [name]",
+		Short: "Run a prompt several times and report latency",
+		Long: `Send the same prompt to a model several times and report min/median/max
+latency and success rate. Each run has its own --timeout; ctrl-c stops the
+benchmark and reports the runs completed so far. Commands are never executed.
+
+The default model is used when no name is given.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			cfg, err := container.ConfigProvider.Load(ctx)
+			if err != nil {
+				return err
+			}
+			model, err := resolveModelArg(cfg, args)
+			if err != nil {
+				return err
+			}
+			return benchModel(ctx, cmd.OutOrStdout(), container.ProviderFactory, model, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Prompt, "prompt", "p", defaultModelTestPrompt, "Natural language prompt to send")
+	cmd.Flags().IntVarP(&opts.Runs, "runs", "n", domain.DefaultModelBenchRuns, "Number of generations to run")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", domain.DefaultModelTestTimeout, "Maximum time to wait for each run")
+	cmd.Flags().BoolVar(&opts.JSON, "json", false, "Print results as JSON")
+
+	return cmd
+}
+
+func benchModel(
+	ctx context.Context,
+	out io.Writer,
+	factory ports.ProviderFactory,
+	model domain.ModelDefinition,
+	opts benchOptions,
+) error {
+	if opts.Runs < 1 {
+		return fmt.Errorf("--runs must be at least 1, got %d", opts.Runs)
+	}
+	provider, err := factory.ForModel(model)
+	if err != nil {
+		return fmt.Errorf("provider init: %w", err)
+	}
+
+	result := benchResult{Model: model.Name}
+	var latencies []time.Duration
+	for i := 0; i < opts.Runs; i++ {
+		if ctx.Err() != nil {
+			result.Interrupted = true
+			break
+		}
+		latency, err := benchRun(ctx, provider, model, opts)
+		if ctx.Err() != nil {
+			result.Interrupted = true
+			break
+		}
+		result.Runs++
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("run %d: %v", i+1, err))
+			continue
+		}
+		latencies = append(latencies, latency)
+	}
+	result.summarize(latencies)
+
+	if opts.JSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("encode results: %w", err)
+		}
+	} else {
+		printBenchResult(out, result)
+	}
+
+	if result.Interrupted {
+		return errors.New("benchmark interrupted")
+	}
+	if result.Successes == 0 {
+		return errors.New("all runs failed")
+	}
+	return nil
+}
+
+// benchRun times one generation under its own timeout. A reply without a
+// command counts as a failure, matching models test.
+func benchRun(ctx context.Context, provider ports.Provider, model domain.ModelDefinition, opts benchOptions) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := provider.Generate(ctx, ports.ProviderRequest{Prompt: opts.Prompt, Model: model})
+	elapsed := time.Since(start)
+	if err != nil {
+		return elapsed, err
+	}
+	if strings.TrimSpace(resp.Command) == "" {
+		return elapsed, errors.New("empty command")
+	}
+	return elapsed, nil
+}
+
+func (r *benchResult) summarize(latencies []time.Duration) {
+	r.Successes = len(latencies)
+	if r.Runs > 0 {
+		r.SuccessRate = float64(r.Successes) / float64(r.Runs)
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	slices.Sort(latencies)
+	r.MinMS = latencies[0].Milliseconds()
+	r.MaxMS = latencies[len(latencies)-1].Milliseconds()
+	mid := len(latencies) / 2
+	median := latencies[mid]
+	if len(latencies)%2 == 0 {
+		median = (latencies[mid-1] + latencies[mid]) / 2
+	}
+	r.MedianMS = median.Milliseconds()
+}
+
+func printBenchResult(out io.Writer, r benchResult) {
+	fmt.Fprintf(out, "Model:    %s\n", r.Model)
+	fmt.Fprintf(out, "Runs:     %d (%d ok, %.0f%% success)\n", r.Runs, r.Successes, r.SuccessRate*100)
+	if r.Successes > 0 {
+		fmt.Fprintf(out, "Latency:  min %dms / median %dms / max %dms\n", r.MinMS, r.MedianMS, r.MaxMS)
+	}
+	for _, msg := range r.Errors {
+		fmt.Fprintf(out, " - %s\n", msg)
+	}
+	if r.Interrupted {
+		fmt.Fprintln(out, "Interrupted before all runs completed")
+	}
+}
+
+// replySnippet flattens a reply onto one line and caps it at
+// replySnippetLength runes for display, so multi-byte text is never split.
+func replySnippet(reply string) string {
+	flat := []rune(strings.Join(strings.Fields(reply), " "))
+	if len(flat) <= replySnippetLength {
+		return string(flat)
+	}
+	return string(flat[:replySnippetLength]) + "..."
+}
+
+// ============================================================================
+// Models Reorder
+// ============================================================================
+
+func newModelsReorderCommand(container *app.Container) *cobra.Command {
+	var before, after string
+
+	cmd := &cobra.Command{
+		Use:   "reorder <name>",
+		Short: "Move a model within the fallback order",
+		Long: `Place a model directly before or after another entry in
+preferences.fallback_models. A configured model that is not a fallback yet is
+added at that position. Use models list --order to review the result.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return reorderFallback(cmd.Context(), cmd.OutOrStdout(), container.ConfigLoader, args[0], before, after)
+		},
+	}
+
+	cmd.Flags().StringVar(&before, "before", "", "Place the model before this fallback")
+	cmd.Flags().StringVar(&after, "after", "", "Place the model after this fallback")
+
+	return cmd
+}
+
+// reorderFallback moves name next to the fallback named by exactly one of
+// before or after and prints the new fallback order.
+func reorderFallback(ctx context.Context, out io.Writer, loader *infrastructure.FileLoader, name, before, after string) error {
+	if (before == "") == (after == "") {
+		return errors.New("specify exactly one of --before or --after")
+	}
+	anchor := before
+	if after != "" {
+		anchor = after
+	}
+
+	var order []string
+	err := loader.Update(ctx, func(cfg *domain.Config) error {
+		if err := cfg.MoveFallbackModel(name, anchor, after != ""); err != nil {
+			return err
+		}
+		order = cfg.Preferences.FallbackModels
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Fallback order: %s\n", strings.Join(order, ", "))
+	return nil
+}
+
+// ============================================================================
+// Models Default
+// ============================================================================
+
+func newModelsDefaultCommand(container *app.Container) *cobra.Command {
+	var clearDefault bool
+
+	cmd := &cobra.Command{
+		Use:   "default [name]",
+		Short: "Show, set or clear the default model",
+		Long: `Print preferences.default_model, or set it to name. With --clear the setting
+is removed, so queries use the first configured model unless --model is given.
+Clearing does nothing when no models are configured.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			return setDefaultModel(cmd.Context(), cmd.OutOrStdout(), container.ConfigLoader, name, clearDefault)
+		},
+	}
+
+	cmd.Flags().BoolVar(&clearDefault, "clear", false, "Unset the default model")
+
+	return cmd
+}
+
+// errNoModels stops a clear without writing the config.
+var errNoModels = errors.New("no models configured")
+
+// setDefaultModel makes name the default model, or with clearDefault unsets
+// it. With neither it prints the current default.
+func setDefaultModel(ctx context.Context, out io.Writer, loader *infrastructure.FileLoader, name string, clearDefault bool) error {
+	switch {
+	case clearDefault && name != "":
+		return errors.New("specify a model name or --clear, not both")
+	case name == "" && !clearDefault:
+		cfg, err := loader.Load(ctx)
+		if err != nil {
+			return err
+		}
+		if cfg.Preferences.DefaultModel == "" {
+			fmt.Fprintln(out, "none (first model is used)")
+			return nil
+		}
+		fmt.Fprintln(out, cfg.Preferences.DefaultModel)
+		return nil
+	case name != "":
+		if err := loader.Update(ctx, func(cfg *domain.Config) error { return cfg.SetDefaultModel(name) }); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Default model: %s\n", name)
+		return nil
+	}
+
+	var first string
+	err := loader.Update(ctx, func(cfg *domain.Config) error {
+		if !cfg.ClearDefaultModel() {
+			return errNoModels
+		}
+		first = cfg.Models[0].Name
+		return nil
+	})
+	if errors.Is(err, errNoModels) {
+		fmt.Fprintln(out, "No models configured; nothing to clear")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Default model cleared; queries use %s (the first model) unless --model is given\n", first)
+	return nil
+}
@@ -0,0 +1,415 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+	"github.com/doeshing/shai-go/internal/infrastructure/ai"
+	"github.com/doeshing/shai-go/internal/ports"
+	"github.com/doeshing/shai-go/internal/services"
+)
+
+func TestTestModel(t *testing.T) {
+	model := domain.ModelDefinition{Name: "mock", ModelID: "mock-1", Endpoint: "mock://local"}
+
+	tests := []struct {
+		name       string
+		give       mockProvider
+		wantErr    string
+		wantOutput []string
+	}{
+		{
+			name: "clean response",
+			give: mockProvider{resp: ports.ProviderResponse{
+				Command: "ls -la",
+				Reply:   "```sh\nls -la\n```",
+			}},
+			wantOutput: []string{"Command: ls -la", "Reply:", "Risk:    SAFE (allow)", "Prompt: list files"},
+		},
+		{
+			name:       "prose without command",
+			give:       mockProvider{resp: ports.ProviderResponse{Reply: "I am not sure what you mean."}},
+			wantErr:    "extraction failed",
+			wantOutput: []string{"I am not sure what you mean.", "No command could be extracted"},
+		},
+		{
+			name:       "unparseable response",
+			give:       mockProvider{err: fmt.Errorf("parse response: %w", ai.ErrResponseParse)},
+			wantErr:    "extraction failed",
+			wantOutput: []string{"did not match api_format"},
+		},
+		{
+			name:       "connectivity failure",
+			give:       mockProvider{err: errors.New("dial tcp: connection refused")},
+			wantErr:    "connectivity failed",
+			wantOutput: []string{"Request failed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			security := staticSecurity{risk: domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}}
+			err := testModel(context.Background(), &out, mockFactory{provider: tt.give}, security, model, "list files")
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("testModel error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("testModel error = %v, want containing %q", err, tt.wantErr)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+type mockFactory struct {
+	provider ports.Provider
+}
+
+func (f mockFactory) ForModel(domain.ModelDefinition) (ports.Provider, error) {
+	return f.provider, nil
+}
+
+type mockProvider struct {
+	resp ports.ProviderResponse
+	err  error
+}
+
+func (mockProvider) Name() string                  { return "mock" }
+func (mockProvider) Model() domain.ModelDefinition { return domain.ModelDefinition{} }
+func (p mockProvider) Generate(context.Context, ports.ProviderRequest) (ports.ProviderResponse, error) {
+	return p.resp, p.err
+}
+
+type staticSecurity struct {
+	risk domain.RiskAssessment
+}
+
+func (s staticSecurity) Evaluate(string) (domain.RiskAssessment, error) {
+	return s.risk, nil
+}
+
+func TestReplySnippet(t *testing.T) {
+	tests := []struct {
+		name string
+		give string
+		want string
+	}{
+		{name: "short", give: "  ls\n  -la ", want: "ls -la"},
+		{name: "ascii", give: strings.Repeat("a", replySnippetLength+1), want: strings.Repeat("a", replySnippetLength) + "..."},
+		{name: "multibyte", give: strings.Repeat("列", replySnippetLength+1), want: strings.Repeat("列", replySnippetLength) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := replySnippet(tt.give)
+			if got != tt.want {
+				t.Errorf("replySnippet() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("replySnippet() = %q, want valid UTF-8", got)
+			}
+		})
+	}
+}
+
+func TestListModels(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "claude"},
+		Models: []domain.ModelDefinition{{
+			Name:       "claude",
+			ModelID:    "claude-3",
+			Endpoint:   "https://api.anthropic.com/v1/messages",
+			AuthEnvVar: "ANTHROPIC_API_KEY",
+			MaxTokens:  1024,
+			APIFormat:  domain.APIFormat{ResponseJSONPath: "content[0].text"},
+			Prompt:     []domain.PromptMessage{{Role: "system", Content: "Be terse."}},
+		}},
+	}
+
+	tests := []struct {
+		name        string
+		give        listOptions
+		wantOutput  []string
+		wantMissing []string
+	}{
+		{
+			name:        "compact",
+			wantOutput:  []string{"NAME", "claude-3", "*"},
+			wantMissing: []string{"1024", "content[0].text", "Be terse."},
+		},
+		{
+			name:       "wide with prompt",
+			give:       listOptions{Wide: true, ShowPrompt: true},
+			wantOutput: []string{"MAX TOKENS", "1024", "ANTHROPIC_API_KEY", "content[0].text", "[system] Be terse."},
+		},
+		{
+			name:       "yaml",
+			give:       listOptions{Output: outputYAML},
+			wantOutput: []string{"max_tokens: 1024", "response_json_path: content[0].text"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := listModels(&out, cfg, tt.give); err != nil {
+				t.Fatalf("listModels error: %v", err)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, unwanted := range tt.wantMissing {
+				if strings.Contains(out.String(), unwanted) {
+					t.Errorf("output unexpectedly contains %q:\n%s", unwanted, out.String())
+				}
+			}
+		})
+	}
+}
+
+// delayProvider returns a command after the next configured delay, honouring
+// context cancellation like a real HTTP provider.
+type delayProvider struct {
+	delays   []time.Duration
+	calls    int
+	cancelAt int
+	cancel   context.CancelFunc
+}
+
+func (*delayProvider) Name() string                  { return "delay" }
+func (*delayProvider) Model() domain.ModelDefinition { return domain.ModelDefinition{} }
+func (p *delayProvider) Generate(ctx context.Context, _ ports.ProviderRequest) (ports.ProviderResponse, error) {
+	delay := p.delays[p.calls%len(p.delays)]
+	p.calls++
+	if p.cancel != nil && p.calls == p.cancelAt {
+		p.cancel()
+	}
+	select {
+	case <-time.After(delay):
+		return ports.ProviderResponse{Command: "ls"}, nil
+	case <-ctx.Done():
+		return ports.ProviderResponse{}, ctx.Err()
+	}
+}
+
+func TestBenchModel(t *testing.T) {
+	model := domain.ModelDefinition{Name: "mock"}
+
+	t.Run("reports latency spread", func(t *testing.T) {
+		provider := &delayProvider{delays: []time.Duration{10 * time.Millisecond, 40 * time.Millisecond, 20 * time.Millisecond}}
+		var out bytes.Buffer
+		opts := benchOptions{Prompt: "list files", Runs: 3, Timeout: time.Second, JSON: true}
+		if err := benchModel(context.Background(), &out, mockFactory{provider: provider}, model, opts); err != nil {
+			t.Fatalf("benchModel error: %v", err)
+		}
+		var result benchResult
+		if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+			t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+		}
+		if result.Runs != 3 || result.Successes != 3 || result.SuccessRate != 1 {
+			t.Fatalf("unexpected counts: %+v", result)
+		}
+		if result.MinMS < 10 || result.MedianMS < 20 || result.MaxMS < 40 {
+			t.Errorf("latencies too small: %+v", result)
+		}
+		if !(result.MinMS <= result.MedianMS && result.MedianMS <= result.MaxMS) {
+			t.Errorf("latencies out of order: %+v", result)
+		}
+	})
+
+	t.Run("per-run timeout counts as failure", func(t *testing.T) {
+		provider := &delayProvider{delays: []time.Duration{time.Millisecond, time.Second}}
+		var out bytes.Buffer
+		opts := benchOptions{Prompt: "list files", Runs: 2, Timeout: 50 * time.Millisecond}
+		if err := benchModel(context.Background(), &out, mockFactory{provider: provider}, model, opts); err != nil {
+			t.Fatalf("benchModel error: %v", err)
+		}
+		for _, want := range []string{"Runs:     2 (1 ok, 50% success)", "run 2: context deadline exceeded"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output missing %q:\n%s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("interrupt stops early", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		provider := &delayProvider{delays: []time.Duration{time.Millisecond, time.Second}, cancelAt: 2, cancel: cancel}
+		var out bytes.Buffer
+		opts := benchOptions{Prompt: "list files", Runs: 5, Timeout: 5 * time.Second}
+		err := benchModel(ctx, &out, mockFactory{provider: provider}, model, opts)
+		if err == nil || !strings.Contains(err.Error(), "interrupted") {
+			t.Fatalf("benchModel error = %v, want interrupted", err)
+		}
+		if provider.calls != 2 {
+			t.Errorf("provider called %d times, want 2", provider.calls)
+		}
+		if !strings.Contains(out.String(), "Runs:     1 (1 ok") {
+			t.Errorf("expected partial results:\n%s", out.String())
+		}
+	})
+}
+
+func TestReorderFallbackAndListOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `config_format_version: "1"
+preferences:
+  default_model: claude
+  fallback_models: [gpt4, local, ghost]
+models:
+  - name: claude
+    endpoint: heuristic://local
+    model_id: claude-x
+  - name: gpt4
+    endpoint: heuristic://local
+    model_id: gpt-4
+  - name: local
+    endpoint: heuristic://local
+    model_id: codellama
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loader := infrastructure.NewFileLoader(path)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	if err := reorderFallback(ctx, &out, loader, "local", "gpt4", ""); err != nil {
+		t.Fatalf("reorderFallback error: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "Fallback order: local, gpt4, ghost" {
+		t.Errorf("output = %q", got)
+	}
+	for _, flags := range [][2]string{{"", ""}, {"gpt4", "ghost"}} {
+		if err := reorderFallback(ctx, &out, loader, "local", flags[0], flags[1]); err == nil {
+			t.Errorf("reorderFallback --before %q --after %q: expected error", flags[0], flags[1])
+		}
+	}
+
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary, err := cfg.GetDefaultModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates := (&services.QueryService{}).CandidateModels(cfg, primary)
+	out.Reset()
+	if err := listCandidateOrder(&out, cfg, candidates); err != nil {
+		t.Fatalf("listCandidateOrder error: %v", err)
+	}
+	var rows []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		rows = append(rows, strings.Join(strings.Fields(line), " "))
+	}
+	want := []string{
+		"1 claude claude-x default",
+		"2 local codellama fallback",
+		"3 gpt4 gpt-4 fallback",
+		"Skipped fallback ghost: no such model",
+	}
+	if strings.Join(rows, "|") != strings.Join(want, "|") {
+		t.Errorf("order rows = %q, want %q", rows, want)
+	}
+}
+
+func TestSetDefaultModel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `config_format_version: "1"
+preferences:
+  default_model: claude
+models:
+  - name: claude
+    endpoint: heuristic://local
+    model_id: claude-x
+  - name: gpt4
+    endpoint: heuristic://local
+    model_id: gpt-4
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loader := infrastructure.NewFileLoader(path)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	if err := setDefaultModel(ctx, &out, loader, "gpt4", false); err != nil {
+		t.Fatalf("setDefaultModel error: %v", err)
+	}
+	out.Reset()
+	if err := setDefaultModel(ctx, &out, loader, "", false); err != nil || strings.TrimSpace(out.String()) != "gpt4" {
+		t.Fatalf("show default = %q, %v; want gpt4", out.String(), err)
+	}
+	if err := setDefaultModel(ctx, &out, loader, "ghost", false); err == nil {
+		t.Error("setting an unknown model: expected error")
+	}
+	if err := setDefaultModel(ctx, &out, loader, "gpt4", true); err == nil {
+		t.Error("name with --clear: expected error")
+	}
+
+	out.Reset()
+	if err := setDefaultModel(ctx, &out, loader, "", true); err != nil {
+		t.Fatalf("clear error: %v", err)
+	}
+	if !strings.Contains(out.String(), "queries use claude") {
+		t.Errorf("clear output = %q", out.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `default_model: ""`) {
+		t.Errorf("default_model not cleared in file:\n%s", data)
+	}
+
+	// An unrelated write must not bring the old default back.
+	if err := loader.Update(ctx, func(cfg *domain.Config) error { return nil }); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	out.Reset()
+	if err := setDefaultModel(ctx, &out, loader, "", false); err != nil || strings.TrimSpace(out.String()) != "none (first model is used)" {
+		t.Fatalf("show default after clear = %q, %v; want none", out.String(), err)
+	}
+}
+
+func TestSetDefaultModelClearWithoutModels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("config_format_version: \"1\"\nmodels: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := setDefaultModel(context.Background(), &out, infrastructure.NewFileLoader(path), "", true); err != nil {
+		t.Fatalf("clear error: %v", err)
+	}
+	if !strings.Contains(out.String(), "nothing to clear") {
+		t.Errorf("output = %q", out.String())
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Errorf("config rewritten:\n%s", after)
+	}
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// outputNDJSON selects one JSON event per line on the query command.
+const outputNDJSON = "ndjson"
+
+// ndjsonEmitter writes query progress as newline-delimited JSON events for
+// editor integrations. It observes the query stages and, with --stream, the
+// reasoning chunks, flushing after every line.
+type ndjsonEmitter struct {
+	out io.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONEmitter(out io.Writer) *ndjsonEmitter {
+	return &ndjsonEmitter{out: out, enc: json.NewEncoder(out)}
+}
+
+type contextEvent struct {
+	Event   string                 `json:"event"`
+	Context domain.ContextSnapshot `json:"context"`
+}
+
+type reasoningEvent struct {
+	Event string `json:"event"`
+	Text  string `json:"text"`
+}
+
+type commandEvent struct {
+	Event   string `json:"event"`
+	Command string `json:"command"`
+	Model   string `json:"model,omitempty"`
+}
+
+type riskEvent struct {
+	Event   string                 `json:"event"`
+	Level   domain.RiskLevel       `json:"level"`
+	Action  domain.GuardrailAction `json:"action"`
+	Reasons []string               `json:"reasons,omitempty"`
+}
+
+type confirmEvent struct {
+	Event  string                 `json:"event"`
+	Level  domain.RiskLevel       `json:"level"`
+	Action domain.GuardrailAction `json:"action"`
+	Choice domain.ExecutionChoice `json:"choice"`
+}
+
+type skippedEvent struct {
+	Event  string `json:"event"`
+	Reason string `json:"reason"`
+}
+
+type execEvent struct {
+	Event      string `json:"event"`
+	Ran        bool   `json:"ran"`
+	ExitCode   int    `json:"exit_code"`
+	Signal     string `json:"signal,omitempty"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type errorEvent struct {
+	Event string `json:"event"`
+	Error string `json:"error"`
+}
+
+func (e *ndjsonEmitter) ContextCollected(snapshot domain.ContextSnapshot) {
+	e.emit(contextEvent{Event: "context", Context: snapshot})
+}
+
+func (e *ndjsonEmitter) CommandGenerated(command, model string) {
+	e.emit(commandEvent{Event: "command", Command: command, Model: model})
+}
+
+func (e *ndjsonEmitter) RiskAssessed(risk domain.RiskAssessment) {
+	e.emit(riskEvent{Event: "risk", Level: risk.Level, Action: risk.Action, Reasons: risk.Reasons})
+}
+
+func (e *ndjsonEmitter) Confirmed(risk domain.RiskAssessment, choice domain.ExecutionChoice) {
+	e.emit(confirmEvent{Event: "confirm", Level: risk.Level, Action: risk.Action, Choice: choice})
+}
+
+func (e *ndjsonEmitter) Skipped(reason string) {
+	e.emit(skippedEvent{Event: "skipped", Reason: reason})
+}
+
+func (e *ndjsonEmitter) Executed(result domain.ExecutionResult) {
+	event := execEvent{
+		Event:      "exec",
+		Ran:        result.Ran,
+		ExitCode:   result.ExitCode,
+		Signal:     result.Signal,
+		TimedOut:   result.TimedOut,
+		DurationMS: result.DurationMS,
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+	}
+	if result.Err != nil {
+		event.Error = result.Err.Error()
+	}
+	e.emit(event)
+}
+
+// WriteChunk implements domain.StreamWriter so streamed reasoning stays NDJSON.
+func (e *ndjsonEmitter) WriteChunk(text string) {
+	if text != "" {
+		e.emit(reasoningEvent{Event: "reasoning", Text: text})
+	}
+}
+
+func (e *ndjsonEmitter) Done() {}
+
+// Failed reports the error that ended the query.
+func (e *ndjsonEmitter) Failed(err error) {
+	e.emit(errorEvent{Event: "error", Error: err.Error()})
+}
+
+func (e *ndjsonEmitter) emit(event interface{}) {
+	// Encode writes the object and its trailing newline in one call.
+	_ = e.enc.Encode(event)
+	if flusher, ok := e.out.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+}
+
+var (
+	_ domain.QueryObserver = (*ndjsonEmitter)(nil)
+	_ domain.StreamWriter  = (*ndjsonEmitter)(nil)
+)
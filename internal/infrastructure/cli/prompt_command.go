@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/doeshing/shai-go/internal/app"
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure/ai"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+// promptPlaceholder stands in for the user prompt when none is given.
+const promptPlaceholder = "<your request>"
+
+// newPromptCommand creates the prompt command group for inspecting rendered prompts.
+func newPromptCommand(container *app.Container) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prompt",
+		Short: "Inspect the prompts sent to AI models",
+	}
+	cmd.AddCommand(newPromptShowCommand(container))
+	return cmd
+}
+
+// ============================================================================
+// Prompt Show
+// ============================================================================
+
+func newPromptShowCommand(container *app.Container) *cobra.Command {
+	var (
+		model    string
+		showBody bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show [prompt...]",
+		Short: "Render the exact messages sent to a model",
+		Long: `Collect context, expand the model's prompt templates, and print the final
+role/content messages that would be sent. Use --body to also print the
+provider request body and headers with authentication redacted.
+
+No request is sent to the model.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := container.ConfigProvider.Load(ctx)
+			if err != nil {
+				return err
+			}
+
+			modelArgs := []string{}
+			if model != "" {
+				modelArgs = append(modelArgs, model)
+			}
+			modelDef, err := resolveModelArg(cfg, modelArgs)
+			if err != nil {
+				return err
+			}
+
+			prompt := strings.Join(args, " ")
+			if prompt == "" {
+				prompt = promptPlaceholder
+			}
+			return showPrompt(ctx, cmd.OutOrStdout(), container.ContextCollector, cfg, modelDef, prompt, showBody)
+		},
+	}
+
+	cmd.Flags().StringVarP(&model, "model", "m", "", "Model name (default from config)")
+	cmd.Flags().BoolVar(&showBody, "body", false, "Also print the provider request headers and JSON body")
+
+	return cmd
+}
+
+func showPrompt(
+	ctx context.Context,
+	out io.Writer,
+	collector ports.ContextCollector,
+	cfg domain.Config,
+	model domain.ModelDefinition,
+	prompt string,
+	showBody bool,
+) error {
+	snapshot, err := collector.Collect(ctx, cfg, domain.QueryRequest{Context: ctx, Prompt: prompt})
+	if err != nil {
+		return fmt.Errorf("collect context: %w", err)
+	}
+	preview, err := ai.PreviewRequest(cfg, model, prompt, snapshot)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Model: %s (%s)\n", model.Name, model.ModelID)
+	for i, msg := range preview.Messages {
+		fmt.Fprintf(out, "\n--- [%d] %s (%d chars) ---\n", i+1, msg.Role, len(msg.Content))
+		fmt.Fprintln(out, msg.Content)
+	}
+
+	if !showBody {
+		return nil
+	}
+
+	fmt.Fprintf(out, "\n--- request ---\nPOST %s\n", preview.Endpoint)
+	names := make([]string, 0, len(preview.Headers))
+	for name := range preview.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "%s: %s\n", name, strings.Join(preview.Headers.Values(name), ", "))
+	}
+
+	var body bytes.Buffer
+	if err := json.Indent(&body, preview.Body, "", "  "); err != nil {
+		return fmt.Errorf("format request body: %w", err)
+	}
+	fmt.Fprintf(out, "\n%s\n", body.String())
+	return nil
+}
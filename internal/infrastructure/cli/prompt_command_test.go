@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+)
+
+const customPromptConfigYAML = `config_format_version: "1"
+preferences:
+  default_model: custom
+models:
+  - name: custom
+    endpoint: https://api.example.com/v1/chat
+    auth_env_var: SHAI_TEST_PROMPT_KEY
+    model_id: custom-1
+    api_format:
+      system_message_mode: separate
+    prompt:
+      - role: system
+        content: "You run in {{.WorkingDir}}."
+      - role: user
+        content: "Request: {{.Prompt}}"
+`
+
+func TestShowPromptRendersCustomPrompt(t *testing.T) {
+	t.Setenv("SHAI_TEST_PROMPT_KEY", "sk-never-printed")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(customPromptConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := infrastructure.NewFileLoader(path).Load(context.Background())
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	model, err := cfg.GetDefaultModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := staticCollector{snapshot: domain.ContextSnapshot{WorkingDir: "/srv/app"}}
+
+	var out bytes.Buffer
+	if err := showPrompt(context.Background(), &out, collector, cfg, model, "list files", true); err != nil {
+		t.Fatalf("showPrompt error: %v", err)
+	}
+
+	for _, want := range []string{
+		"You run in /srv/app.",
+		"Request: list files",
+		`"system": "You run in /srv/app."`,
+		"Authorization: Bearer ***",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "sk-never-printed") {
+		t.Errorf("output leaked API key:\n%s", out.String())
+	}
+}
+
+type staticCollector struct {
+	snapshot domain.ContextSnapshot
+}
+
+func (c staticCollector) Collect(context.Context, domain.Config, domain.QueryRequest) (domain.ContextSnapshot, error) {
+	return c.snapshot, nil
+}
@@ -2,19 +2,57 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
 	"github.com/doeshing/shai-go/internal/ports"
 )
 
-// Prompter implements ConfirmationPrompter using stdin/stdout.
+// Prompter implements ChoicePrompter using stdin/stdout.
 type Prompter struct {
-	in  *bufio.Reader
-	out io.Writer
+	in      *bufio.Reader
+	out     io.Writer
+	colors  colorizer
+	timeout time.Duration
+	// menu offers run/edit/copy/abort; without a terminal on both ends
+	// (piped input, scripts) Choose falls back to yes/no.
+	menu bool
+	// editor opens a file for Edit; nil uses $VISUAL/$EDITOR.
+	editor func(path string) error
+	// requests asks the reader goroutine, started by the first prompt with a
+	// timeout, for one line, which it delivers on lines. Reading only on
+	// request leaves stdin to the commands that run between prompts.
+	requests chan struct{}
+	lines    chan readResult
+	// reading is set while a requested line has not been received, so a
+	// prompt after a timeout gets the late answer instead of asking again.
+	reading bool
+	// readErr ended the reader goroutine and is returned to later prompts.
+	readErr   error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Answer prompts shown after a confirmation's details.
+const (
+	yesNoPrompt    = "Continue? [y/N]: "
+	explicitPrompt = "Type 'yes' to confirm (or anything else to cancel): "
+	menuPrompt     = "[r]un / [e]dit / [c]opy / [a]bort (default abort): "
+)
+
+// errPrompterClosed answers prompts made after Close.
+var errPrompterClosed = errors.New("prompter closed")
+
+type readResult struct {
+	line string
+	err  error
 }
 
 // NewPrompter constructs a prompter referencing stdio.
@@ -25,12 +63,27 @@ func NewPrompter(in io.Reader, out io.Writer) *Prompter {
 	if out == nil {
 		out = os.Stdout
 	}
+	inFile, ok := in.(*os.File)
 	return &Prompter{
-		in:  bufio.NewReader(in),
-		out: out,
+		in:     bufio.NewReader(in),
+		out:    out,
+		colors: newColorizer(out),
+		menu:   ok && isTerminal(inFile) && isTerminal(out),
+		done:   make(chan struct{}),
 	}
 }
 
+// Close stops the reader goroutine. A read already waiting on the input ends
+// with the next line or EOF, which is then dropped.
+func (p *Prompter) Close() {
+	p.closeOnce.Do(func() { close(p.done) })
+}
+
+// SetTimeout bounds how long each prompt waits for an answer; zero waits indefinitely.
+func (p *Prompter) SetTimeout(timeout time.Duration) {
+	p.timeout = timeout
+}
+
 // Enabled indicates the prompter is interactive.
 func (p *Prompter) Enabled() bool {
 	return true
@@ -38,15 +91,10 @@ func (p *Prompter) Enabled() bool {
 
 // Confirm asks the user for confirmation based on guardrail action.
 func (p *Prompter) Confirm(action domain.GuardrailAction, level domain.RiskLevel, command string, reasons []string) (bool, error) {
-	fmt.Fprintf(p.out, "\n⚠️  %s risk detected (%s)\n", strings.ToUpper(string(level)), action)
-	for _, reason := range reasons {
-		fmt.Fprintf(p.out, " - %s\n", reason)
-	}
-	fmt.Fprintf(p.out, "Command:\n  %s\n", command)
-
+	p.describe(action, level, command, reasons)
 	switch action {
 	case domain.ActionSimpleConfirm, domain.ActionConfirm:
-		return p.ask("[y/N]: ")
+		return p.ask()
 	case domain.ActionExplicitConfirm:
 		return p.askExplicit()
 	default:
@@ -54,9 +102,114 @@ func (p *Prompter) Confirm(action domain.GuardrailAction, level domain.RiskLevel
 	}
 }
 
-func (p *Prompter) ask(prompt string) (bool, error) {
-	fmt.Fprint(p.out, "Continue? ", prompt)
-	line, err := p.in.ReadString('\n')
+// choiceKeys are the menu answers Choose accepts, by the first letter or any
+// longer prefix of the name.
+var choiceKeys = []domain.ExecutionChoice{domain.ChoiceRun, domain.ChoiceEdit, domain.ChoiceCopy, domain.ChoiceAbort}
+
+// Choose offers to run, edit, copy or abort the command. Running an explicit
+// confirmation still needs a typed 'yes'. Without a terminal it asks yes/no
+// like Confirm.
+func (p *Prompter) Choose(action domain.GuardrailAction, level domain.RiskLevel, command string, reasons []string) (domain.ExecutionChoice, error) {
+	if !p.menu {
+		ok, err := p.Confirm(action, level, command, reasons)
+		if !ok {
+			return domain.ChoiceAbort, err
+		}
+		return domain.ChoiceRun, err
+	}
+
+	p.describe(action, level, command, reasons)
+	fmt.Fprint(p.out, menuPrompt)
+	line, err := p.readLine()
+	if err != nil {
+		return domain.ChoiceAbort, err
+	}
+	choice := parseChoice(line)
+	if choice == domain.ChoiceRun && action == domain.ActionExplicitConfirm {
+		ok, err := p.askExplicit()
+		if !ok {
+			return domain.ChoiceAbort, err
+		}
+	}
+	return choice, nil
+}
+
+// parseChoice maps a menu answer to a choice; empty or unknown answers abort.
+func parseChoice(answer string) domain.ExecutionChoice {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "" {
+		return domain.ChoiceAbort
+	}
+	for _, choice := range choiceKeys {
+		if strings.HasPrefix(string(choice), answer) {
+			return choice
+		}
+	}
+	return domain.ChoiceAbort
+}
+
+// Edit opens command in the editor and returns the saved text.
+func (p *Prompter) Edit(command string) (string, error) {
+	file, err := os.CreateTemp("", "shai-command-*.sh")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	_, err = file.WriteString(command + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	open := p.editor
+	if open == nil {
+		open = func(path string) error { return runEditor(context.Background(), resolveEditor(), path) }
+	}
+	if err := open(path); err != nil {
+		return "", err
+	}
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(edited)), nil
+}
+
+// describe prints the risk header, the reasons and the command.
+func (p *Prompter) describe(action domain.GuardrailAction, level domain.RiskLevel, command string, reasons []string) {
+	header := fmt.Sprintf("%s risk detected (%s)", strings.ToUpper(string(level)), action)
+	fmt.Fprintf(p.out, "\n⚠️  %s\n", p.colors.risk(level, header))
+	for _, reason := range reasons {
+		fmt.Fprintf(p.out, " - %s\n", reason)
+	}
+	fmt.Fprintf(p.out, "Command:\n  %s\n", command)
+}
+
+// Preview writes what Choose would show for the command, ending with the
+// answer prompt(s), without waiting for input.
+func (p *Prompter) Preview(action domain.GuardrailAction, level domain.RiskLevel, command string, reasons []string) {
+	p.describe(action, level, command, reasons)
+	switch {
+	case action != domain.ActionSimpleConfirm && action != domain.ActionConfirm && action != domain.ActionExplicitConfirm:
+		return
+	case p.menu:
+		fmt.Fprintln(p.out, menuPrompt)
+		if action == domain.ActionExplicitConfirm {
+			fmt.Fprintln(p.out, "then, to run:", explicitPrompt)
+		}
+	case action == domain.ActionExplicitConfirm:
+		fmt.Fprintln(p.out, explicitPrompt)
+	default:
+		fmt.Fprintln(p.out, yesNoPrompt)
+	}
+}
+
+func (p *Prompter) ask() (bool, error) {
+	fmt.Fprint(p.out, yesNoPrompt)
+	line, err := p.readLine()
 	if err != nil {
 		return false, err
 	}
@@ -65,12 +218,75 @@ func (p *Prompter) ask(prompt string) (bool, error) {
 }
 
 func (p *Prompter) askExplicit() (bool, error) {
-	fmt.Fprint(p.out, "Type 'yes' to confirm (or anything else to cancel): ")
-	line, err := p.in.ReadString('\n')
+	fmt.Fprint(p.out, explicitPrompt)
+	line, err := p.readLine()
 	if err != nil {
 		return false, err
 	}
 	return strings.TrimSpace(line) == "yes", nil
 }
 
-var _ ports.ConfirmationPrompter = (*Prompter)(nil)
+// readLine reads one answer, giving up after the configured timeout with
+// ports.ErrConfirmationTimeout.
+func (p *Prompter) readLine() (string, error) {
+	if p.readErr != nil {
+		return "", p.readErr
+	}
+	if p.timeout <= 0 && p.lines == nil {
+		return p.in.ReadString('\n')
+	}
+	if p.lines == nil {
+		p.requests = make(chan struct{})
+		p.lines = make(chan readResult)
+		go p.readLines()
+	}
+	if !p.reading {
+		select {
+		case p.requests <- struct{}{}:
+			p.reading = true
+		case <-p.done:
+			return "", errPrompterClosed
+		}
+	}
+
+	var deadline <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	select {
+	case result := <-p.lines:
+		p.reading = false
+		p.readErr = result.err
+		return result.line, result.err
+	case <-p.done:
+		return "", errPrompterClosed
+	case <-deadline:
+		fmt.Fprintf(p.out, "\nNo answer within %s, cancelled.\n", p.timeout)
+		return "", ports.ErrConfirmationTimeout
+	}
+}
+
+// readLines reads one line per request until the input ends or the prompter
+// is closed.
+func (p *Prompter) readLines() {
+	for {
+		select {
+		case <-p.requests:
+		case <-p.done:
+			return
+		}
+		line, err := p.in.ReadString('\n')
+		select {
+		case p.lines <- readResult{line: line, err: err}:
+		case <-p.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+var _ ports.ChoicePrompter = (*Prompter)(nil)
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+func TestPrompterTimeoutDenies(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	var out bytes.Buffer
+	prompter := NewPrompter(reader, &out)
+	prompter.SetTimeout(20 * time.Millisecond)
+
+	ok, err := prompter.Confirm(domain.ActionExplicitConfirm, domain.RiskHigh, "rm -rf build", nil)
+	if ok || !errors.Is(err, ports.ErrConfirmationTimeout) {
+		t.Fatalf("Confirm = %v, %v; want false, ErrConfirmationTimeout", ok, err)
+	}
+	if !strings.Contains(out.String(), "No answer within 20ms") {
+		t.Errorf("timeout not reported:\n%s", out.String())
+	}
+
+	// A late answer goes to the next prompt rather than being lost.
+	go writer.Write([]byte("yes\n"))
+	prompter.SetTimeout(time.Second)
+	ok, err = prompter.Confirm(domain.ActionExplicitConfirm, domain.RiskHigh, "rm -rf build", nil)
+	if err != nil || !ok {
+		t.Fatalf("Confirm after late answer = %v, %v; want true, nil", ok, err)
+	}
+}
+
+func TestPrompterCloseStopsReader(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	prompter := NewPrompter(reader, io.Discard)
+	prompter.SetTimeout(20 * time.Millisecond)
+	if _, err := prompter.Confirm(domain.ActionConfirm, domain.RiskMedium, "chmod 777 x", nil); !errors.Is(err, ports.ErrConfirmationTimeout) {
+		t.Fatalf("Confirm error = %v, want ErrConfirmationTimeout", err)
+	}
+	prompter.Close()
+
+	// The read in flight takes this line and the reader then stops, so a
+	// second line is never read.
+	if _, err := writer.Write([]byte("y\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	written := make(chan error, 1)
+	go func() {
+		_, err := writer.Write([]byte("y\n"))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		t.Fatalf("second line read after Close (write error %v)", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	writer.Close()
+	<-written
+
+	if _, err := prompter.Confirm(domain.ActionConfirm, domain.RiskMedium, "chmod 777 x", nil); !errors.Is(err, errPrompterClosed) {
+		t.Errorf("Confirm after Close error = %v, want errPrompterClosed", err)
+	}
+}
+
+func TestPrompterWithoutTimeout(t *testing.T) {
+	prompter := NewPrompter(strings.NewReader("y\n"), io.Discard)
+	ok, err := prompter.Confirm(domain.ActionConfirm, domain.RiskMedium, "chmod 777 x", nil)
+	if err != nil || !ok {
+		t.Fatalf("Confirm = %v, %v; want true, nil", ok, err)
+	}
+}
+
+func TestPrompterChoose(t *testing.T) {
+	tests := []struct {
+		name   string
+		menu   bool
+		action domain.GuardrailAction
+		input  string
+		want   domain.ExecutionChoice
+	}{
+		{name: "run", menu: true, action: domain.ActionConfirm, input: "r\n", want: domain.ChoiceRun},
+		{name: "edit by prefix", menu: true, action: domain.ActionConfirm, input: "ed\n", want: domain.ChoiceEdit},
+		{name: "copy", menu: true, action: domain.ActionConfirm, input: "Copy\n", want: domain.ChoiceCopy},
+		{name: "default aborts", menu: true, action: domain.ActionConfirm, input: "\n", want: domain.ChoiceAbort},
+		{name: "unknown aborts", menu: true, action: domain.ActionConfirm, input: "x\n", want: domain.ChoiceAbort},
+		{name: "explicit run needs yes", menu: true, action: domain.ActionExplicitConfirm, input: "r\nyes\n", want: domain.ChoiceRun},
+		{name: "explicit run declined", menu: true, action: domain.ActionExplicitConfirm, input: "r\ny\n", want: domain.ChoiceAbort},
+		{name: "no terminal asks yes/no", action: domain.ActionConfirm, input: "y\n", want: domain.ChoiceRun},
+		{name: "no terminal declined", action: domain.ActionConfirm, input: "e\n", want: domain.ChoiceAbort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			prompter := NewPrompter(strings.NewReader(tt.input), &out)
+			prompter.menu = tt.menu
+
+			got, err := prompter.Choose(tt.action, domain.RiskHigh, "rm -r build", nil)
+			if err != nil {
+				t.Fatalf("Choose error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Choose() = %q, want %q", got, tt.want)
+			}
+			if hasMenu := strings.Contains(out.String(), "[r]un / [e]dit"); hasMenu != tt.menu {
+				t.Errorf("menu shown = %v, want %v:\n%s", hasMenu, tt.menu, out.String())
+			}
+		})
+	}
+}
+
+func TestPrompterEdit(t *testing.T) {
+	prompter := NewPrompter(strings.NewReader(""), io.Discard)
+	prompter.editor = func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, bytes.Replace(data, []byte("build"), []byte("build/tmp"), 1), 0o600)
+	}
+
+	got, err := prompter.Edit("rm -r build")
+	if err != nil || got != "rm -r build/tmp" {
+		t.Fatalf("Edit() = %q, %v; want the edited command", got, err)
+	}
+}
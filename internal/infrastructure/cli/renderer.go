@@ -1,10 +1,18 @@
 package cli
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+	"github.com/doeshing/shai-go/internal/services"
 )
 
 // stripMarkdownFormatting removes markdown code block backticks from command output.
@@ -16,6 +24,33 @@ func stripMarkdownFormatting(cmd string) string {
 	return cleaned
 }
 
+// renderCommandOnly writes exactly the command and a newline to out for
+// --output-command-only. Risk and errors go to errOut so command substitution
+// captures nothing else, and a missing command is an error.
+func renderCommandOnly(out, errOut io.Writer, resp domain.QueryResponse, queryErr error) error {
+	if queryErr != nil {
+		var blocked *services.BlockedError
+		if errors.As(queryErr, &blocked) {
+			renderBlocked(errOut, blocked)
+		}
+		return queryErr
+	}
+	if resp.Command == "" {
+		return errors.New("no command produced")
+	}
+	if resp.ClipboardNotice != "" {
+		fmt.Fprintln(errOut, resp.ClipboardNotice)
+	}
+	if resp.ShellNotice != "" {
+		fmt.Fprintln(errOut, resp.ShellNotice)
+	}
+	if resp.RiskAssessment.Level != "" && resp.RiskAssessment.Level != domain.RiskSafe {
+		fmt.Fprintf(errOut, "Risk: %s (%s)\n", strings.ToUpper(string(resp.RiskAssessment.Level)), resp.RiskAssessment.Action)
+	}
+	_, err := fmt.Fprintln(out, resp.Command)
+	return err
+}
+
 // RenderResponse prints the response in a friendly, ASCII-only format.
 // If verbose is false, only outputs the command (for shell integration).
 // If verbose is true, shows detailed context information.
@@ -24,6 +59,14 @@ func RenderResponse(resp domain.QueryResponse, verbose bool) {
 	// Check if command was blocked by guardrail
 	isBlocked := resp.RiskAssessment.Action == "block"
 
+	// Clipboard notices go to stderr so shell integration only captures the command
+	if resp.ClipboardNotice != "" {
+		fmt.Fprintln(os.Stderr, resp.ClipboardNotice)
+	}
+	if resp.ShellNotice != "" {
+		fmt.Fprintln(os.Stderr, resp.ShellNotice)
+	}
+
 	// If not verbose and not blocked, only output the command
 	if !verbose && !isBlocked {
 		// Strip markdown code block formatting (backticks)
@@ -43,28 +86,30 @@ func RenderResponse(resp domain.QueryResponse, verbose bool) {
 		fmt.Println()
 	}
 
-	fmt.Println("Generated Command:")
-	fmt.Printf("  %s\n", resp.Command)
-
-	fmt.Printf("\nRisk: %s (%s)\n", strings.ToUpper(string(resp.RiskAssessment.Level)), resp.RiskAssessment.Action)
-	for _, reason := range resp.RiskAssessment.Reasons {
-		fmt.Printf(" - %s\n", reason)
+	for i, attempt := range resp.FailedAttempts {
+		fmt.Printf("Attempt %d failed (%s): %s\n", i+1, attempt.Result.Status(), attempt.Command)
 	}
-	if resp.RiskAssessment.DryRunCommand != "" {
-		fmt.Printf("Dry-run suggestion: %s\n", resp.RiskAssessment.DryRunCommand)
+	if len(resp.FailedAttempts) > 0 {
+		fmt.Println()
 	}
-	if len(resp.RiskAssessment.UndoHints) > 0 {
-		fmt.Println("Undo hints:")
-		for _, hint := range resp.RiskAssessment.UndoHints {
-			fmt.Printf(" * %s\n", hint)
-		}
+
+	fmt.Println("Generated Command:")
+	fmt.Printf("  %s\n", resp.Command)
+	if resp.Copied {
+		fmt.Println("(copied to clipboard)")
 	}
 
+	fmt.Printf("\nRisk: %s\n", riskLabel(newColorizer(os.Stdout), resp.RiskAssessment))
+	writeRiskDetails(os.Stdout, resp.RiskAssessment, resp.RiskExplanation)
+
 	if resp.ExecutionResult != nil {
+		if resp.AutoConfirmed {
+			fmt.Println("\nConfirmation auto-accepted (--yes).")
+		}
 		if resp.ExecutionResult.Ran {
 			fmt.Println("\nCommand executed successfully.")
 		} else if resp.ExecutionResult.Err != nil {
-			fmt.Printf("\nCommand failed: %v\n", resp.ExecutionResult.Err)
+			fmt.Printf("\nCommand failed (%s): %v\n", resp.ExecutionResult.Status(), resp.ExecutionResult.Err)
 		}
 		if resp.ExecutionResult.Stdout != "" {
 			fmt.Println("\nstdout:")
@@ -78,3 +123,95 @@ func RenderResponse(resp domain.QueryResponse, verbose bool) {
 		fmt.Println("\nCommand was not executed (preview mode or confirmation pending).")
 	}
 }
+
+// renderBlocked explains a guardrail block: the matched rules, the reasons and
+// any safer dry-run or undo hints, so the user knows what to try instead.
+func renderBlocked(w io.Writer, blocked *services.BlockedError) {
+	fmt.Fprintf(w, "Blocked by guardrail: %s\n", blocked.Command)
+	fmt.Fprintf(w, "Risk: %s\n", riskLabel(newColorizer(w), blocked.Risk))
+	writeRiskDetails(w, blocked.Risk, "")
+}
+
+// riskLabel formats the level and action of risk, e.g. "HIGH (explicit_confirm)".
+func riskLabel(colors colorizer, risk domain.RiskAssessment) string {
+	return colors.risk(risk.Level, fmt.Sprintf("%s (%s)", strings.ToUpper(string(risk.Level)), risk.Action))
+}
+
+// writeRiskDetails prints the reasons, matched rules and suggestions of risk.
+func writeRiskDetails(w io.Writer, risk domain.RiskAssessment, explanation string) {
+	for _, reason := range risk.Reasons {
+		fmt.Fprintf(w, " - %s\n", reason)
+	}
+	if len(risk.MatchedRules) > 0 {
+		fmt.Fprintf(w, "Matched rules: %s\n", strings.Join(risk.MatchedRules, ", "))
+	}
+	if explanation != "" {
+		fmt.Fprintf(w, "Model risk note: %s\n", explanation)
+	}
+	if risk.DryRunCommand != "" {
+		fmt.Fprintf(w, "Dry-run suggestion: %s\n", risk.DryRunCommand)
+	}
+	if len(risk.UndoHints) > 0 {
+		fmt.Fprintln(w, "Undo hints:")
+		for _, hint := range risk.UndoHints {
+			fmt.Fprintf(w, " * %s\n", hint)
+		}
+	}
+}
+
+// Supported values for --profile-timings.
+const (
+	timingsText = "text"
+	timingsJSON = "json"
+)
+
+// writeTimings prints per-stage durations in format, or nothing when format
+// is empty. Text is an aligned table; JSON is a single object.
+func writeTimings(w io.Writer, format string, timings []domain.StageTiming) error {
+	if format == "" {
+		return nil
+	}
+	var total time.Duration
+	for _, timing := range timings {
+		total += timing.Duration
+	}
+
+	if format == timingsJSON {
+		type stage struct {
+			Stage      string  `json:"stage"`
+			DurationMS float64 `json:"duration_ms"`
+		}
+		report := struct {
+			Stages  []stage `json:"stages"`
+			TotalMS float64 `json:"total_ms"`
+		}{Stages: []stage{}, TotalMS: milliseconds(total)}
+		for _, timing := range timings {
+			report.Stages = append(report.Stages, stage{Stage: timing.Stage, DurationMS: milliseconds(timing.Duration)})
+		}
+		return json.NewEncoder(w).Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Timings:")
+	for _, timing := range timings {
+		fmt.Fprintf(tw, "  %s\t%s\n", timing.Stage, timing.Duration.Round(time.Microsecond))
+	}
+	fmt.Fprintf(tw, "  total\t%s\n", total.Round(time.Microsecond))
+	return tw.Flush()
+}
+
+// writeContextExplanation prints one line per kind of context saying whether
+// it was sent to the model and which setting or probe decided it.
+func writeContextExplanation(w io.Writer, decisions []infrastructure.ContextDecision) error {
+	var b strings.Builder
+	b.WriteString("Context:\n")
+	for _, decision := range decisions {
+		fmt.Fprintf(&b, "  %s\n", decision)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
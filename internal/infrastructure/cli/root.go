@@ -2,7 +2,12 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,6 +15,7 @@ import (
 
 	"github.com/doeshing/shai-go/internal/app"
 	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
 	"github.com/doeshing/shai-go/internal/infrastructure/cli/commands"
 )
 
@@ -19,13 +25,12 @@ type Options struct {
 }
 
 // NewRootCmd wires the cobra root command.
-func NewRootCmd(ctx context.Context, opts Options) (*cobra.Command, error) {
-	container, err := app.BuildContainer(ctx, opts.Verbose)
-	if err != nil {
-		return nil, err
-	}
-	container.QueryService.Prompter = NewPrompter(nil, nil)
-	container.QueryService.Clipboard = NewClipboard()
+func NewRootCmd(opts Options) *cobra.Command {
+	var configPath string
+
+	// Subcommands capture this pointer at construction time; it is populated
+	// once flags are parsed so that --config can influence every dependency.
+	container := &app.Container{}
 
 	queryCmd := newQueryCommand(container)
 
@@ -40,6 +45,20 @@ func NewRootCmd(ctx context.Context, opts Options) (*cobra.Command, error) {
 			queryCmd.SetArgs(args)
 			return queryCmd.ExecuteContext(cmd.Context())
 		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			built, err := app.BuildContainer(cmd.Context(), opts.Verbose, configPath)
+			if err != nil {
+				return err
+			}
+			prompter := NewPrompter(nil, nil)
+			if cfg, err := built.ConfigProvider.Load(cmd.Context()); err == nil {
+				prompter.SetTimeout(cfg.GetConfirmTimeout())
+			}
+			built.QueryService.Prompter = prompter
+			built.QueryService.Clipboard = NewClipboard()
+			*container = *built
+			return nil
+		},
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		CompletionOptions: cobra.CompletionOptions{
@@ -47,26 +66,50 @@ func NewRootCmd(ctx context.Context, opts Options) (*cobra.Command, error) {
 		},
 	}
 
+	root.PersistentFlags().StringVar(&configPath, "config", "", "Config file path (overrides SHAI_CONFIG)")
+
 	root.AddCommand(queryCmd)
+	root.AddCommand(newConfigCommand(container))
+	root.AddCommand(newModelsCommand(container))
+	root.AddCommand(newPromptCommand(container))
+	root.AddCommand(newCompareCommand(container))
+	root.AddCommand(newContextCommand(container))
+	root.AddCommand(newGuardrailCommand(container))
+	root.AddCommand(newDenyCommand(container))
 	root.AddCommand(newHealthCommand(container))
 	root.AddCommand(newReloadCommand(container))
 	root.AddCommand(newVersionCommand())
 	root.AddCommand(commands.NewInstallCommand())
 	root.AddCommand(commands.NewUninstallCommand())
-	return root, nil
+	return root
 }
 
 func newQueryCommand(container *app.Container) *cobra.Command {
 	var (
 		model       string
+		workDir     string
 		autoExecute bool
+		assumeYes   bool
+		explainRisk bool
+		commandOnly bool
+		output      string
 		copyCmd     bool
 		withGit     bool
 		withEnv     bool
 		withK8s     bool
+		noContext   bool
+		noGit       bool
+		noK8s       bool
+		noEnv       bool
 		debug       bool
 		timeout     time.Duration
 		stream      bool
+		profile     string
+		explainCtx  bool
+		seed        int
+		fixAttempts int
+		envPairs    []string
+		assumeShell string
 	)
 
 	cmd := &cobra.Command{
@@ -74,6 +117,17 @@ func newQueryCommand(container *app.Container) *cobra.Command {
 		Short: "Generate a command from natural language",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load config to get verbose setting and the default flags, which
+			// must be applied before any flag value is read.
+			cfg, err := container.ConfigProvider.Load(cmd.Context())
+			if err != nil {
+				return err
+			}
+			applyDefaultFlags(cmd, cfg.Preferences.DefaultFlags)
+			if prompter, ok := container.QueryService.Prompter.(*Prompter); ok {
+				defer prompter.Close()
+			}
+
 			ctx := cmd.Context()
 			if timeout > 0 {
 				var cancel context.CancelFunc
@@ -81,32 +135,118 @@ func newQueryCommand(container *app.Container) *cobra.Command {
 				defer cancel()
 			}
 
-			// Load config to get verbose setting
-			cfg, err := container.ConfigProvider.Load(ctx)
+			dir, err := resolveWorkDir(workDir)
 			if err != nil {
 				return err
 			}
+			env, err := parseEnvPairs(envPairs)
+			if err != nil {
+				return err
+			}
+			if assumeShell != "" && !slices.Contains(domain.KnownShells, assumeShell) {
+				return fmt.Errorf("unsupported --assume-shell %q (use %s)", assumeShell, strings.Join(domain.KnownShells, ", "))
+			}
+			switch output {
+			case "", outputNDJSON:
+			default:
+				return fmt.Errorf("unsupported output format %q (use %s)", output, outputNDJSON)
+			}
+			if output == outputNDJSON && commandOnly {
+				return errors.New("--output ndjson cannot be combined with --output-command-only")
+			}
+			switch profile {
+			case "", timingsText, timingsJSON:
+			default:
+				return fmt.Errorf("unsupported --profile-timings format %q (use %s or %s)", profile, timingsText, timingsJSON)
+			}
 
 			req := domain.QueryRequest{
 				Context:         ctx,
 				Prompt:          strings.Join(args, " "),
 				ModelOverride:   model,
+				WorkDir:         dir,
+				Env:             env,
+				AssumeShell:     assumeShell,
 				AutoExecute:     autoExecute,
+				AssumeYes:       assumeYes,
+				ExplainRisk:     explainRisk,
+				PreviewOnly:     commandOnly,
 				CopyToClipboard: copyCmd,
 				WithGitStatus:   withGit,
 				WithEnv:         withEnv,
 				WithK8sInfo:     withK8s,
+				NoContext:       noContext,
+				NoGit:           noGit,
+				NoK8s:           noK8s,
+				NoEnv:           noEnv,
 				Debug:           debug,
 				Stream:          stream,
+				FixAttempts:     fixAttempts,
 			}
+			if cmd.Flags().Changed("seed") {
+				req.Seed = &seed
+			}
+			if debug && container.Logger != nil {
+				// Provider dumps are logged at debug level, so --debug turns
+				// debug logging on for this run.
+				container.Logger.SetVerbose(true)
+			}
+			// report writes the optional diagnostics to stderr once the query ends.
+			report := func(resp domain.QueryResponse) error {
+				var err error
+				if explainCtx && resp.ContextInformation.WorkingDir != "" {
+					err = writeContextExplanation(cmd.ErrOrStderr(), infrastructure.ExplainContext(cfg, req, resp.ContextInformation))
+				}
+				return errors.Join(err, writeTimings(cmd.ErrOrStderr(), profile, resp.Timings))
+			}
+
+			var streamOut *streamWriter
 			if stream {
-				req.StreamWriter = NewStreamWriter(cmd.OutOrStdout())
+				out := cmd.OutOrStdout()
+				if commandOnly {
+					out = cmd.ErrOrStderr()
+				}
+				streamOut = NewStreamWriter(out)
+				req.StreamWriter = streamOut
 			}
 
-			// Show spinner during query execution (only in non-verbose mode)
+			if output == outputNDJSON {
+				// stdout carries only events, so prompts and interactive
+				// programs write to stderr. The service is copied so the
+				// container keeps its own prompter and executor.
+				service := *container.QueryService
+				prompter := NewPrompter(nil, cmd.ErrOrStderr())
+				defer prompter.Close()
+				prompter.SetTimeout(cfg.GetConfirmTimeout())
+				service.Prompter = prompter
+				if executor, ok := service.Executor.(*infrastructure.LocalExecutor); ok {
+					service.Executor = executor.WithTerminalOutput(cmd.ErrOrStderr())
+				}
+				emitter := newNDJSONEmitter(cmd.OutOrStdout())
+				req.Observer = emitter
+				if stream {
+					req.StreamWriter = emitter
+				}
+				resp, queryErr := service.Run(req)
+				if queryErr != nil {
+					emitter.Failed(queryErr)
+				}
+				return errors.Join(queryErr, report(resp))
+			}
+
+			if commandOnly {
+				resp, queryErr := container.QueryService.Run(req)
+				err := renderCommandOnly(cmd.OutOrStdout(), cmd.ErrOrStderr(), resp, queryErr)
+				return errors.Join(err, report(resp))
+			}
+
+			// Show spinner during query execution (only in non-verbose mode);
+			// a terminal stream writer shows its own thinking indicator instead.
 			var spinner *Spinner
 			var tty *os.File
-			if !cfg.Preferences.Verbose {
+			if streamOut != nil && streamOut.tty {
+				streamOut.Start()
+			} else if !cfg.Preferences.Verbose {
 				// Try to open /dev/tty for spinner output to bypass stderr redirection
 				var err error
 				tty, err = os.OpenFile("/dev/tty", os.O_WRONLY, 0)
@@ -118,6 +258,11 @@ func newQueryCommand(container *app.Container) *cobra.Command {
 
 			resp, queryErr := container.QueryService.Run(req)
 
+			// Clear a thinking indicator the query left behind, e.g. when it
+			// failed or was interrupted before the model answered.
+			if streamOut != nil {
+				streamOut.Done()
+			}
 			// Stop spinner before rendering response
 			if spinner != nil {
 				spinner.Stop()
@@ -127,19 +272,114 @@ func newQueryCommand(container *app.Container) *cobra.Command {
 			}
 
 			RenderResponse(resp, cfg.Preferences.Verbose)
-			return queryErr
+			return errors.Join(queryErr, report(resp))
 		},
 	}
 
 	cmd.Flags().StringVarP(&model, "model", "m", "", "Override model name (default from config)")
-	cmd.Flags().BoolVarP(&autoExecute, "auto-execute", "a", false, "Auto execute without extra confirmation (still subject to guardrails)")
+	cmd.Flags().StringVar(&workDir, "dir", "", "Run the command and collect context in this directory")
+	cmd.Flags().BoolVarP(&autoExecute, "auto-execute", "a", false, "Auto execute safe commands (still subject to guardrails and execution.confirm_before_execute)")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Answer low/medium guardrail confirmations with yes (never explicit confirmations or blocks)")
+	cmd.Flags().BoolVar(&explainRisk, "explain-risk", false, "Ask the model for a one-sentence risk note (extra request; never overrides guardrails)")
+	cmd.Flags().BoolVar(&commandOnly, "output-command-only", false, "Print only the command to stdout and never execute (for scripts)")
+	cmd.Flags().BoolVar(&commandOnly, "command-only", false, "Alias for --output-command-only")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format: ndjson emits one JSON event per line (for editors)")
+	_ = cmd.Flags().MarkHidden("command-only")
 	cmd.Flags().BoolVarP(&copyCmd, "copy", "c", false, "Copy generated command to clipboard")
 	cmd.Flags().BoolVar(&withGit, "with-git-status", false, "Force include git status")
 	cmd.Flags().BoolVar(&withEnv, "with-env", false, "Include select environment variables")
 	cmd.Flags().BoolVar(&withK8s, "with-k8s-info", false, "Include Kubernetes context")
+	cmd.Flags().BoolVar(&noContext, "no-context", false, "Skip context collection except directory, shell, and OS")
+	cmd.Flags().BoolVar(&noGit, "no-git", false, "Skip git status for this query")
+	cmd.Flags().BoolVar(&noK8s, "no-k8s", false, "Skip Kubernetes context for this query")
+	cmd.Flags().BoolVar(&noEnv, "no-env", false, "Skip environment variables for this query")
 	cmd.Flags().BoolVar(&debug, "debug", false, "Enable verbose logging")
 	cmd.Flags().DurationVar(&timeout, "timeout", 60*time.Second, "Override request timeout")
 	cmd.Flags().BoolVar(&stream, "stream", false, "Stream provider reasoning output")
+	cmd.Flags().StringVar(&profile, "profile-timings", "", "Print how long each query stage took to stderr (text, or =json)")
+	cmd.Flags().Lookup("profile-timings").NoOptDefVal = timingsText
+	cmd.Flags().IntVar(&fixAttempts, "fix-on-failure", 0, "Ask the model to fix a command that exits non-zero, at most N times (default 2 when given without =N)")
+	cmd.Flags().Lookup("fix-on-failure").NoOptDefVal = strconv.Itoa(domain.DefaultFixAttempts)
+	cmd.Flags().IntVar(&seed, "seed", 0, "Ask the model for reproducible output with this seed (OpenAI-compatible and Ollama APIs)")
+	cmd.Flags().BoolVar(&explainCtx, "explain-context", false, "Print which context was included and why to stderr")
+	cmd.Flags().StringArrayVar(&envPairs, "env", nil, "Set KEY=VAL in the command's environment for this run (repeatable)")
+	cmd.Flags().StringVar(&assumeShell, "assume-shell", "", "Generate for this shell instead of the login shell (only previewed when it differs from the execution shell)")
 
 	return cmd
 }
+
+// parseEnvPairs turns --env KEY=VAL values into a map; later pairs win.
+func parseEnvPairs(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	env := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid --env %q: want KEY=VAL", pair)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// resolveWorkDir validates a --dir value and returns it as an absolute path.
+// An empty path keeps the current directory.
+func resolveWorkDir(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("resolve --dir: %w", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid --dir: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid --dir: %s is not a directory", abs)
+	}
+	return abs, nil
+}
+
+// applyDefaultFlags sets the query flags listed in preferences.default_flags
+// that were not given on the command line, so explicit flags always win.
+// Entries take the command-line form ("--copy", "--model=gpt4", "-c"); a flag
+// that needs a value may also take it from the next entry. Flags the query
+// command does not define, such as --config, are skipped with a warning.
+func applyDefaultFlags(cmd *cobra.Command, defaults []string) {
+	warn := func(format string, args ...interface{}) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: preferences.default_flags: "+format+"\n", args...)
+	}
+	for i := 0; i < len(defaults); i++ {
+		entry := strings.TrimSpace(defaults[i])
+		name, value, hasValue := strings.Cut(strings.TrimLeft(entry, "-"), "=")
+		flag := cmd.LocalNonPersistentFlags().Lookup(name)
+		if flag == nil && !strings.HasPrefix(entry, "--") && len(name) == 1 {
+			flag = cmd.LocalNonPersistentFlags().ShorthandLookup(name)
+		}
+		if !strings.HasPrefix(entry, "-") || flag == nil || flag.Name == "help" {
+			warn("ignoring %q, not a query flag", entry)
+			continue
+		}
+		if !hasValue {
+			if flag.NoOptDefVal != "" {
+				value = flag.NoOptDefVal
+			} else if i+1 < len(defaults) {
+				i++
+				value = defaults[i]
+			} else {
+				warn("ignoring %q, it needs a value", entry)
+				continue
+			}
+		}
+		if cmd.Flags().Changed(flag.Name) {
+			continue
+		}
+		if err := cmd.Flags().Set(flag.Name, value); err != nil {
+			warn("ignoring %q: %v", entry, err)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/infrastructure"
+	"github.com/doeshing/shai-go/internal/services"
+)
+
+func TestRootConfigFlagRedirectsConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	envPath := filepath.Join(home, "env-config.yaml")
+	t.Setenv("SHAI_CONFIG", envPath)
+
+	flagPath := filepath.Join(t.TempDir(), "project.yaml")
+	source := filepath.Join(t.TempDir(), "edited.yaml")
+	if err := os.WriteFile(source, []byte(validConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "cp "+source)
+
+	root := NewRootCmd(Options{})
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"--config", flagPath, "config", "edit"})
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute error: %v\n%s", err, out.String())
+	}
+
+	got, err := os.ReadFile(flagPath)
+	if err != nil {
+		t.Fatalf("config not written to --config path: %v", err)
+	}
+	if string(got) != validConfigYAML {
+		t.Fatalf("unexpected config contents:\n%s", got)
+	}
+	if _, err := os.Stat(envPath); !os.IsNotExist(err) {
+		t.Fatalf("SHAI_CONFIG path should be untouched when --config is set: %v", err)
+	}
+}
+
+func TestResolveWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		give    string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty keeps cwd", give: "", want: ""},
+		{name: "directory", give: dir, want: dir},
+		{name: "file", give: file, wantErr: true},
+		{name: "missing", give: filepath.Join(dir, "nope"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveWorkDir(tt.give)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveWorkDir error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveWorkDir() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvPairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		give    []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "none", give: nil, want: nil},
+		{name: "pairs", give: []string{"KUBECONFIG=/tmp/dev.yaml", "EMPTY=", "OPTS=a=b"},
+			want: map[string]string{"KUBECONFIG": "/tmp/dev.yaml", "EMPTY": "", "OPTS": "a=b"}},
+		{name: "later wins", give: []string{"A=1", "A=2"}, want: map[string]string{"A": "2"}},
+		{name: "missing equals", give: []string{"KUBECONFIG"}, wantErr: true},
+		{name: "empty key", give: []string{"=value"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvPairs(tt.give)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "want KEY=VAL") {
+					t.Fatalf("parseEnvPairs() error = %v, want KEY=VAL error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEnvPairs error: %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseEnvPairs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeHeuristicConfig writes a config using only the offline heuristic
+// model under a temporary HOME and returns its path.
+func writeHeuristicConfig(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, "config.yaml")
+	config := `config_format_version: "1"
+preferences:
+  default_model: offline
+  auto_execute_safe: true
+models:
+  - name: offline
+    endpoint: heuristic://local
+    model_id: heuristic
+security:
+  enabled: true
+  rules_file: ` + filepath.Join(home, "guardrail.yaml") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestQueryOutputCommandOnly(t *testing.T) {
+	configPath := writeHeuristicConfig(t)
+	for _, flag := range []string{"--output-command-only", "--command-only"} {
+		t.Run(flag, func(t *testing.T) {
+			root := NewRootCmd(Options{})
+			var stdout, stderr bytes.Buffer
+			root.SetOut(&stdout)
+			root.SetErr(&stderr)
+			root.SetArgs([]string{"--config", configPath, "query", flag, "--no-context", "show", "disk", "usage"})
+			if err := root.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute error: %v\n%s", err, stderr.String())
+			}
+			if stdout.String() != "du -sh *\n" {
+				t.Fatalf("stdout = %q, want only the command", stdout.String())
+			}
+		})
+	}
+}
+
+func TestQueryAssumeShell(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	configPath := writeHeuristicConfig(t)
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "data.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		shell     string
+		wantEvent string
+	}{
+		// A fish command is not run by the executor's sh.
+		{shell: "fish", wantEvent: "skipped"},
+		{shell: "sh", wantEvent: "exec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			root := NewRootCmd(Options{})
+			var stdout, stderr bytes.Buffer
+			root.SetOut(&stdout)
+			root.SetErr(&stderr)
+			root.SetArgs([]string{"--config", configPath, "query", "-o", "ndjson", "--no-context",
+				"--assume-shell", tt.shell, "--dir", workDir, "show", "disk", "usage"})
+			if err := root.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute error: %v\n%s", err, stderr.String())
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			var contextEvent struct {
+				Context domain.ContextSnapshot `json:"context"`
+			}
+			var lastEvent struct {
+				Event    string `json:"event"`
+				Ran      bool   `json:"ran"`
+				ExitCode int    `json:"exit_code"`
+				Reason   string `json:"reason"`
+			}
+			if err := json.Unmarshal([]byte(lines[0]), &contextEvent); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &lastEvent); err != nil {
+				t.Fatal(err)
+			}
+			if contextEvent.Context.Shell != tt.shell {
+				t.Errorf("context shell = %q, want %s", contextEvent.Context.Shell, tt.shell)
+			}
+			if lastEvent.Event != tt.wantEvent {
+				t.Fatalf("last event = %+v, want %s", lastEvent, tt.wantEvent)
+			}
+			switch tt.wantEvent {
+			case "skipped":
+				if !strings.Contains(lastEvent.Reason, "written for fish, but commands run with sh") {
+					t.Errorf("skipped reason = %q, want the shell mismatch", lastEvent.Reason)
+				}
+			case "exec":
+				if !lastEvent.Ran || lastEvent.ExitCode != 0 {
+					t.Errorf("exec event = %+v, want a successful run", lastEvent)
+				}
+			}
+		})
+	}
+
+	root := NewRootCmd(Options{})
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--config", configPath, "query", "--assume-shell", "cmd.exe", "list"})
+	if err := root.ExecuteContext(context.Background()); err == nil || !strings.Contains(err.Error(), "unsupported --assume-shell") {
+		t.Errorf("unknown shell error = %v", err)
+	}
+}
+
+func TestQueryOutputNDJSON(t *testing.T) {
+	configPath := writeHeuristicConfig(t)
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "data.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	root := NewRootCmd(Options{})
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--config", configPath, "query", "-o", "ndjson", "--no-context",
+		"--dir", workDir, "show", "disk", "usage"})
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute error: %v\n%s", err, stderr.String())
+	}
+
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	var names []string
+	for _, event := range events {
+		names = append(names, fmt.Sprint(event["event"]))
+	}
+	if got := strings.Join(names, ","); got != "context,command,risk,exec" {
+		t.Fatalf("events = %s, want context,command,risk,exec\n%s", got, stdout.String())
+	}
+	if events[1]["command"] != "du -sh *" || events[1]["model"] != "offline" {
+		t.Errorf("command event = %v", events[1])
+	}
+	if events[2]["level"] != string(domain.RiskSafe) {
+		t.Errorf("risk event = %v", events[2])
+	}
+	if _, ok := events[3]["exit_code"]; !ok {
+		t.Errorf("exec event missing exit_code: %v", events[3])
+	}
+
+	root = NewRootCmd(Options{})
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--config", configPath, "query", "-o", "xml", "list"})
+	if err := root.ExecuteContext(context.Background()); err == nil {
+		t.Error("expected error for unsupported output format")
+	}
+}
+
+func TestQueryOutputNDJSONSkipped(t *testing.T) {
+	configPath := writeHeuristicConfig(t)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, bytes.Replace(data, []byte("auto_execute_safe: true"), []byte("auto_execute_safe: false"), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	root := NewRootCmd(Options{})
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--config", configPath, "query", "-o", "ndjson", "--no-context", "show", "disk", "usage"})
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute error: %v\n%s", err, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	var last struct {
+		Event  string `json:"event"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatalf("last line %q is not JSON: %v", lines[len(lines)-1], err)
+	}
+	if last.Event != "skipped" || !strings.Contains(last.Reason, "--auto-execute") {
+		t.Errorf("last event = %+v, want skipped for a safe command without --auto-execute", last)
+	}
+}
+
+func TestRenderCommandOnly(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	resp := domain.QueryResponse{
+		Command:        "rm -rf build",
+		RiskAssessment: domain.RiskAssessment{Level: domain.RiskHigh, Action: domain.ActionExplicitConfirm},
+	}
+	if err := renderCommandOnly(&stdout, &stderr, resp, nil); err != nil {
+		t.Fatalf("renderCommandOnly error: %v", err)
+	}
+	if stdout.String() != "rm -rf build\n" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "HIGH") {
+		t.Errorf("risk should be reported on stderr, got %q", stderr.String())
+	}
+
+	stdout.Reset()
+	if err := renderCommandOnly(&stdout, &stderr, domain.QueryResponse{}, nil); err == nil {
+		t.Error("expected error when no command was produced")
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("stdout should be empty on failure, got %q", stdout.String())
+	}
+}
+
+func TestRenderCommandOnlyExplainsBlock(t *testing.T) {
+	guardrail, err := infrastructure.NewGuardrail(filepath.Join(t.TempDir(), "guardrail.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const command = "rm -rf /"
+	risk, err := guardrail.Evaluate(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryErr := fmt.Errorf("query: %w", &services.BlockedError{Command: command, Risk: risk})
+
+	var stdout, stderr bytes.Buffer
+	if err := renderCommandOnly(&stdout, &stderr, domain.QueryResponse{}, queryErr); err != queryErr {
+		t.Fatalf("renderCommandOnly error = %v, want the query error", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("stdout should be empty for a blocked command, got %q", stdout.String())
+	}
+	for _, want := range []string{
+		"Blocked by guardrail: rm -rf /",
+		"Attempting to delete root filesystem",
+		`Matched rules: rm\s+-rf\s+/`,
+		"Dry-run suggestion: ls -rf /",
+		"Undo hints:",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr missing %q:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestWriteTimings(t *testing.T) {
+	timings := []domain.StageTiming{
+		{Stage: domain.StageLoadConfig, Duration: 2 * time.Millisecond},
+		{Stage: domain.StageGenerate, Duration: 1500 * time.Millisecond},
+	}
+
+	var out bytes.Buffer
+	if err := writeTimings(&out, timingsText, timings); err != nil {
+		t.Fatalf("writeTimings text error: %v", err)
+	}
+	for _, want := range []string{"load_config  2ms", "generate     1.5s", "total        1.502s"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := writeTimings(&out, timingsJSON, timings); err != nil {
+		t.Fatalf("writeTimings json error: %v", err)
+	}
+	var report struct {
+		Stages []struct {
+			Stage      string  `json:"stage"`
+			DurationMS float64 `json:"duration_ms"`
+		} `json:"stages"`
+		TotalMS float64 `json:"total_ms"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("decode %q: %v", out.String(), err)
+	}
+	if len(report.Stages) != 2 || report.Stages[1].DurationMS != 1500 || report.TotalMS != 1502 {
+		t.Errorf("report = %+v", report)
+	}
+
+	out.Reset()
+	if err := writeTimings(&out, "", timings); err != nil || out.Len() != 0 {
+		t.Errorf("disabled timings wrote %q (err %v)", out.String(), err)
+	}
+}
+
+func TestQueryProfileTimings(t *testing.T) {
+	configPath := writeHeuristicConfig(t)
+	root := NewRootCmd(Options{})
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--config", configPath, "query", "--output-command-only", "--profile-timings", "--no-context", "show", "disk", "usage"})
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute error: %v\n%s", err, stderr.String())
+	}
+	if stdout.String() != "du -sh *\n" {
+		t.Errorf("stdout = %q, timings must not reach stdout", stdout.String())
+	}
+	for _, stage := range []string{domain.StageLoadConfig, domain.StageCollectContext, domain.StageGenerate, domain.StageEvaluate, "total"} {
+		if !strings.Contains(stderr.String(), "  "+stage+" ") {
+			t.Errorf("stderr missing %s timing:\n%s", stage, stderr.String())
+		}
+	}
+}
+
+func TestQueryDefaultFlags(t *testing.T) {
+	configPath := writeHeuristicConfig(t)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("preferences:\n"),
+		[]byte("preferences:\n  default_flags: [--output-command-only, --profile-timings=json, --no-context, --config=other.yaml]\n"), 1)
+	if err := os.WriteFile(configPath, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		flags    []string
+		wantJSON bool
+	}{
+		{name: "default applies", wantJSON: true},
+		{name: "explicit flag wins", flags: []string{"--profile-timings=text"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := NewRootCmd(Options{})
+			var stdout, stderr bytes.Buffer
+			root.SetOut(&stdout)
+			root.SetErr(&stderr)
+			args := append([]string{"--config", configPath, "query"}, tt.flags...)
+			root.SetArgs(append(args, "show", "disk", "usage"))
+			if err := root.ExecuteContext(context.Background()); err != nil {
+				t.Fatalf("execute error: %v\n%s", err, stderr.String())
+			}
+			if stdout.String() != "du -sh *\n" {
+				t.Errorf("stdout = %q, want --output-command-only from default_flags", stdout.String())
+			}
+			if got := strings.Contains(stderr.String(), `"total_ms"`); got != tt.wantJSON {
+				t.Errorf("JSON timings = %v, want %v:\n%s", got, tt.wantJSON, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), `ignoring "--config=other.yaml", not a query flag`) {
+				t.Errorf("stderr missing warning for --config:\n%s", stderr.String())
+			}
+		})
+	}
+}
+
+func TestQueryExplainContext(t *testing.T) {
+	configPath := writeHeuristicConfig(t)
+	root := NewRootCmd(Options{})
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--config", configPath, "query", "--output-command-only", "--explain-context", "--no-git", "show", "disk", "usage"})
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("execute error: %v\n%s", err, stderr.String())
+	}
+	if stdout.String() != "du -sh *\n" {
+		t.Errorf("stdout = %q, the explanation must not reach stdout", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Context:\n") || !strings.Contains(stderr.String(), "  git skipped: --no-git\n") {
+		t.Errorf("stderr missing context explanation:\n%s", stderr.String())
+	}
+}
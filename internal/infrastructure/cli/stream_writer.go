@@ -3,23 +3,76 @@ package cli
 import (
 	"fmt"
 	"io"
+	"os"
+	"strings"
+	"sync"
 )
 
-// streamWriter writes streaming output to an io.Writer.
+// thinkingIndicator is shown on a terminal until the first chunk arrives.
+const thinkingIndicator = "Thinking..."
+
+// streamWriter writes streaming output to an io.Writer as it arrives.
+// On a terminal it shows a thinking indicator until the first chunk and
+// clears it; on pipes and files chunks are written as-is.
 type streamWriter struct {
-	out io.Writer
+	out      io.Writer
+	tty      bool
+	mu       sync.Mutex
+	thinking bool
+	partial  bool
 }
 
 // NewStreamWriter builds a streamWriter for stdout/stderr.
 func NewStreamWriter(out io.Writer) *streamWriter {
-	return &streamWriter{out: out}
+	return &streamWriter{out: out, tty: isTerminal(out)}
+}
+
+// Start shows the thinking indicator when writing to a terminal.
+func (s *streamWriter) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tty && !s.thinking {
+		fmt.Fprint(s.out, thinkingIndicator)
+		s.thinking = true
+	}
 }
 
 func (s *streamWriter) WriteChunk(text string) {
 	if text == "" {
 		return
 	}
-	fmt.Fprintln(s.out, text)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearIndicator()
+	fmt.Fprint(s.out, text)
+	s.partial = !strings.HasSuffix(text, "\n")
+}
+
+// Done clears the indicator and ends a partial line so the final command
+// is printed on its own line.
+func (s *streamWriter) Done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearIndicator()
+	if s.partial {
+		fmt.Fprintln(s.out)
+		s.partial = false
+	}
+}
+
+func (s *streamWriter) clearIndicator() {
+	if s.thinking {
+		fmt.Fprint(s.out, "\r\033[K")
+		s.thinking = false
+	}
 }
 
-func (s *streamWriter) Done() {}
+// isTerminal reports whether out is a character device such as a terminal.
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
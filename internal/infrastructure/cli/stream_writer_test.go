@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStreamWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		tty    bool
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "pipe writes chunks as-is",
+			chunks: []string{"Listing ", "files"},
+			want:   "Listing files\n",
+		},
+		{
+			name:   "complete line is not doubled",
+			chunks: []string{"Listing files\n"},
+			want:   "Listing files\n",
+		},
+		{
+			name:   "terminal clears thinking indicator",
+			tty:    true,
+			chunks: []string{"Listing ", "files"},
+			want:   thinkingIndicator + "\r\033[KListing files\n",
+		},
+		{
+			name: "terminal clears indicator without chunks",
+			tty:  true,
+			want: thinkingIndicator + "\r\033[K",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			writer := &streamWriter{out: &out, tty: tt.tty}
+			writer.Start()
+			for _, chunk := range tt.chunks {
+				writer.WriteChunk(chunk)
+			}
+			writer.Done()
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamWriterDoneTwice(t *testing.T) {
+	var out bytes.Buffer
+	writer := &streamWriter{out: &out, tty: true}
+	writer.Start()
+	writer.WriteChunk("Listing")
+	writer.Done()
+	// The query ends the stream again on every path, e.g. after an error.
+	writer.Done()
+	if want := thinkingIndicator + "\r\033[KListing\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestNewStreamWriterDetectsNonTerminal(t *testing.T) {
+	if writer := NewStreamWriter(&bytes.Buffer{}); writer.tty {
+		t.Error("buffer detected as terminal")
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"runtime"
 	"strings"
 
@@ -13,7 +11,6 @@ import (
 
 	"github.com/doeshing/shai-go/internal/app"
 	"github.com/doeshing/shai-go/internal/domain"
-	"github.com/doeshing/shai-go/internal/pkg/filesystem"
 	"github.com/doeshing/shai-go/internal/version"
 )
 
@@ -93,13 +90,35 @@ func formatEnabledStatus(enabled bool) string {
 
 // newHealthCommand creates the health command to diagnose environment setup.
 func newHealthCommand(container *app.Container) *cobra.Command {
-	return &cobra.Command{
-		Use:   "health",
-		Short: "Check system health and diagnostics",
+	var sinceUpgrade bool
+
+	cmd := &cobra.Command{
+		Use:     "health",
+		Aliases: []string{"doctor"},
+		Short:   "Check system health and diagnostics",
+		Long: `Check system health and diagnostics.
+
+Use --since-upgrade to only check whether the installed ~/.shai/bin/shai and
+~/.shai/shell hook scripts still match the running version.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if sinceUpgrade {
+				return runUpgradeDiagnostics(cmd, cmd.OutOrStdout(), container)
+			}
 			return runHealthDiagnostics(cmd, cmd.OutOrStdout(), container)
 		},
 	}
+
+	cmd.Flags().BoolVar(&sinceUpgrade, "since-upgrade", false, "Check for a stale installed binary or shell hooks")
+
+	return cmd
+}
+
+func runUpgradeDiagnostics(cmd *cobra.Command, out io.Writer, container *app.Container) error {
+	if container.HealthService == nil {
+		return fmt.Errorf("health service unavailable")
+	}
+	displayHealthReport(out, container.HealthService.UpgradeChecks(cmd.Context()))
+	return nil
 }
 
 func runHealthDiagnostics(cmd *cobra.Command, out io.Writer, container *app.Container) error {
@@ -139,12 +158,7 @@ func displayConfigLocations(out io.Writer, container *app.Container) {
 	// Load config to get paths
 	ctx := context.Background()
 	if cfg, err := container.ConfigProvider.Load(ctx); err == nil {
-		// Determine config file path - use SHAI_CONFIG env or default
-		configPath := os.Getenv("SHAI_CONFIG")
-		if configPath == "" {
-			configPath = filepath.Join(filesystem.UserHomeDir(), ".shai", "config.yaml")
-		}
-		fmt.Fprintf(out, "  Config:     %s\n", configPath)
+		fmt.Fprintf(out, "  Config:     %s\n", container.ConfigLoader.Path())
 
 		// Show guardrail file if configured
 		if cfg.Security.RulesFile != "" {
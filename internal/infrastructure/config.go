@@ -46,8 +46,8 @@ func (l *FileLoader) Load(context.Context) (domain.Config, error) {
 		return domain.Config{}, err
 	}
 
-	var cfg domain.Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	cfg, err := decodeConfig(data, path)
+	if err != nil {
 		return domain.Config{}, err
 	}
 
@@ -83,8 +83,48 @@ func (l *FileLoader) Path() string {
 }
 
 // Save writes the given config back to disk.
+// It holds the config file lock while writing so concurrent saves do not interleave.
 func (l *FileLoader) Save(cfg domain.Config) error {
-	raw, err := yaml.Marshal(cfg)
+	unlock, err := acquireFileLock(l.resolvePath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return l.write(cfg)
+}
+
+// Update loads the config, applies mutate and saves the result while holding
+// the config file lock, so concurrent read-modify-write cycles from several
+// shai processes cannot lose each other's changes. Nothing is written when
+// mutate returns an error.
+func (l *FileLoader) Update(ctx context.Context, mutate func(*domain.Config) error) error {
+	unlock, err := acquireFileLock(l.resolvePath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg, err := l.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if err := mutate(&cfg); err != nil {
+		return err
+	}
+	return l.write(cfg)
+}
+
+// write saves cfg, keeping the include directives of the existing file for
+// every included part that cfg leaves unchanged.
+func (l *FileLoader) write(cfg domain.Config) error {
+	var node yaml.Node
+	if err := node.Encode(cfg); err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(l.resolvePath()); err == nil {
+		restoreIncludes(existing, l.resolvePath(), &node)
+	}
+	raw, err := yaml.Marshal(&node)
 	if err != nil {
 		return err
 	}
@@ -105,7 +145,11 @@ func (l *FileLoader) Reset() (domain.Config, error) {
 
 // Backup copies the current config file to a timestamped backup.
 func (l *FileLoader) Backup() (string, error) {
-	path := l.resolvePath()
+	return backupFile(l.resolvePath())
+}
+
+// backupFile copies path to a timestamped .bak sibling and returns its location.
+func backupFile(path string) (string, error) {
 	if _, err := os.Stat(path); err != nil {
 		return "", err
 	}
@@ -154,9 +198,8 @@ func defaultConfig() domain.Config {
 }
 
 func hydrateDefaults(cfg domain.Config) domain.Config {
-	if cfg.Preferences.DefaultModel == "" && len(cfg.Models) > 0 {
-		cfg.Preferences.DefaultModel = cfg.Models[0].Name
-	}
+	// An unset default_model stays unset so saving the config keeps it that
+	// way; services.DefaultModel resolves it to the first model at query time.
 	if cfg.Preferences.TimeoutSeconds == 0 {
 		cfg.Preferences.TimeoutSeconds = 30
 	}
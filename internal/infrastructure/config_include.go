@@ -0,0 +1,221 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// includeKey pulls another YAML file into the mapping that contains it, e.g.
+// "prompt: {include: prompts/shell.yaml}". A mapping holding only the include
+// is replaced by the file's content (which may be a list); other keys next to
+// it are merged over the included mapping.
+const includeKey = "include"
+
+// decodeConfig parses config data read from path, resolving includes relative
+// to the directory of the file that contains them. YAML anchors and aliases
+// keep working as usual within each file.
+func decodeConfig(data []byte, path string) (domain.Config, error) {
+	var cfg domain.Config
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return cfg, err
+	}
+	if len(doc.Content) == 0 {
+		return cfg, nil
+	}
+	if err := resolveIncludes(&doc, filepath.Dir(path), []string{absPath(path)}); err != nil {
+		return cfg, err
+	}
+	if err := doc.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// resolveIncludes replaces every include mapping under node with the content
+// of the referenced file. stack lists the files being resolved so a cycle is
+// reported instead of recursing forever.
+func resolveIncludes(node *yaml.Node, dir string, stack []string) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := resolveIncludes(child, dir, stack); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := resolveIncludes(node.Content[i], dir, stack); err != nil {
+				return err
+			}
+		}
+		path, ok := includePath(node)
+		if !ok {
+			return nil
+		}
+		included, err := loadInclude(path, dir, stack)
+		if err != nil {
+			return err
+		}
+		return mergeInclude(node, included, path)
+	}
+	return nil
+}
+
+// includePath returns the include target of a mapping node, if it has one.
+func includePath(node *yaml.Node) (string, bool) {
+	if node.Kind != yaml.MappingNode {
+		return "", false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value == includeKey && value.Kind == yaml.ScalarNode {
+			return value.Value, true
+		}
+	}
+	return "", false
+}
+
+// loadInclude reads and resolves the file an include points at.
+func loadInclude(path, dir string, stack []string) (*yaml.Node, error) {
+	full := expandPath(path)
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(dir, full)
+	}
+	full = absPath(full)
+	if slices.Contains(stack, full) {
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, full), " -> "))
+	}
+
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("include %s: file is empty", path)
+	}
+	root := doc.Content[0]
+	if err := resolveIncludes(root, filepath.Dir(full), append(slices.Clone(stack), full)); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// mergeInclude replaces node with included, keeping any keys written next to
+// the include as overrides.
+func mergeInclude(node, included *yaml.Node, path string) error {
+	var local []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != includeKey {
+			local = append(local, node.Content[i], node.Content[i+1])
+		}
+	}
+	if len(local) == 0 {
+		*node = *included
+		return nil
+	}
+	if included.Kind != yaml.MappingNode {
+		return fmt.Errorf("include %s: keys next to an include need the file to contain a mapping", path)
+	}
+
+	merged := slices.Clone(included.Content)
+	for i := 0; i < len(local); i += 2 {
+		if j := mappingIndex(merged, local[i].Value); j >= 0 {
+			merged[j+1] = local[i+1]
+			continue
+		}
+		merged = append(merged, local[i], local[i+1])
+	}
+	*node = *included
+	node.Content = merged
+	return nil
+}
+
+// restoreIncludes puts the include directives of the config file on disk back
+// into fresh, the encoded config about to be written, wherever the included
+// part is unchanged. Parts that were edited stay expanded inline so the change
+// is not lost in a shared file.
+func restoreIncludes(data []byte, path string, fresh *yaml.Node) {
+	var raw yaml.Node
+	if err := yaml.Unmarshal(data, &raw); err != nil || len(raw.Content) == 0 || !hasInclude(&raw) {
+		return
+	}
+	cfg, err := decodeConfig(data, path)
+	if err != nil {
+		return
+	}
+	var base yaml.Node
+	if err := base.Encode(hydrateDefaults(cfg)); err != nil {
+		return
+	}
+	restoreIncludeNodes(raw.Content[0], &base, fresh)
+}
+
+// restoreIncludeNodes walks raw alongside base (the on-disk config as loaded)
+// and fresh, restoring each include whose loaded value fresh still matches.
+func restoreIncludeNodes(raw, base, fresh *yaml.Node) {
+	if _, ok := includePath(raw); ok {
+		if sameYAML(base, fresh) {
+			*fresh = *raw
+		}
+		return
+	}
+	switch {
+	case raw.Kind == yaml.MappingNode && base.Kind == yaml.MappingNode && fresh.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(raw.Content); i += 2 {
+			key := raw.Content[i].Value
+			b, f := mappingIndex(base.Content, key), mappingIndex(fresh.Content, key)
+			if b >= 0 && f >= 0 {
+				restoreIncludeNodes(raw.Content[i+1], base.Content[b+1], fresh.Content[f+1])
+			}
+		}
+	case raw.Kind == yaml.SequenceNode && base.Kind == yaml.SequenceNode && fresh.Kind == yaml.SequenceNode:
+		for i := range min(len(raw.Content), len(base.Content), len(fresh.Content)) {
+			restoreIncludeNodes(raw.Content[i], base.Content[i], fresh.Content[i])
+		}
+	}
+}
+
+func hasInclude(node *yaml.Node) bool {
+	if _, ok := includePath(node); ok {
+		return true
+	}
+	return slices.ContainsFunc(node.Content, hasInclude)
+}
+
+// mappingIndex returns the index of key within mapping node content, or -1.
+func mappingIndex(content []*yaml.Node, key string) int {
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameYAML(a, b *yaml.Node) bool {
+	var left, right interface{}
+	if a.Decode(&left) != nil || b.Decode(&right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
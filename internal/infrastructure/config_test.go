@@ -0,0 +1,256 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+func TestFileLoaderUpdateConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	loader := NewFileLoader(path)
+	ctx := context.Background()
+	if _, err := loader.Load(ctx); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	const writers = 2
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = loader.Update(ctx, func(cfg *domain.Config) error {
+				// Widen the read-modify-write window to force an overlap.
+				time.Sleep(20 * time.Millisecond)
+				cfg.Preferences.DeniedCommands = append(cfg.Preferences.DeniedCommands, fmt.Sprintf("cmd-%d", i))
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Update %d error: %v", i, err)
+		}
+	}
+
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	for i := range writers {
+		if want := fmt.Sprintf("cmd-%d", i); !slices.Contains(cfg.Preferences.DeniedCommands, want) {
+			t.Errorf("update %q lost, denied commands %q", want, cfg.Preferences.DeniedCommands)
+		}
+	}
+	if _, err := os.Stat(lockPath(path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestFileLoaderLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	loader := NewFileLoader(path)
+	ctx := context.Background()
+
+	failed := errors.New("mutate failed")
+	if err := loader.Update(ctx, func(*domain.Config) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("Update error = %v, want %v", err, failed)
+	}
+	if _, err := os.Stat(lockPath(path)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("lock not released after error: %v", err)
+	}
+
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("acquireFileLock error: %v", err)
+	}
+	defer unlock()
+
+	defer func(timeout time.Duration) { fileLockTimeout = timeout }(fileLockTimeout)
+	fileLockTimeout = 30 * time.Millisecond
+	err = loader.Save(DefaultConfig())
+	if err == nil || !strings.Contains(err.Error(), "locked by another shai process") {
+		t.Fatalf("Save error = %v, want lock held error", err)
+	}
+}
+
+func TestFileLockOwnership(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	lock := lockPath(path)
+
+	// A stale lock left by a crashed process is taken over.
+	if err := os.WriteFile(lock, []byte("999999 1\n"), domain.SecureFilePermissions); err != nil {
+		t.Fatalf("write stale lock: %v", err)
+	}
+	old := time.Now().Add(-2 * staleFileLockAge)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatalf("age stale lock: %v", err)
+	}
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("acquireFileLock over stale lock error: %v", err)
+	}
+
+	// A lock taken over by another process is not released by the old owner.
+	other := []byte("999999 2\n")
+	if err := os.WriteFile(lock, other, domain.SecureFilePermissions); err != nil {
+		t.Fatalf("replace lock: %v", err)
+	}
+	unlock()
+	data, err := os.ReadFile(lock)
+	if err != nil {
+		t.Fatalf("lock of another owner removed: %v", err)
+	}
+	if string(data) != string(other) {
+		t.Errorf("lock = %q, want %q", data, other)
+	}
+}
+
+func TestFileLoaderResolvesIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "prompts", "shell.yaml"), `
+- role: system
+  content: Reply with one shell command.
+`)
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, `
+models:
+  - name: first
+    endpoint: heuristic://local
+    model_id: one
+    prompt: {include: prompts/shell.yaml}
+  - name: second
+    endpoint: heuristic://local
+    model_id: two
+    prompt:
+      include: prompts/shell.yaml
+`)
+	loader := NewFileLoader(path)
+	ctx := context.Background()
+
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	want := []domain.PromptMessage{{Role: "system", Content: "Reply with one shell command."}}
+	for _, model := range cfg.Models {
+		if !slices.Equal(model.Prompt, want) {
+			t.Errorf("model %s prompt = %+v, want %+v", model.Name, model.Prompt, want)
+		}
+	}
+
+	if err := loader.Update(ctx, func(cfg *domain.Config) error {
+		cfg.Models[1].Prompt = append(cfg.Models[1].Prompt, domain.PromptMessage{Role: "user", Content: "Be brief."})
+		return nil
+	}); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	saved := string(data)
+	if got := strings.Count(saved, "include: prompts/shell.yaml"); got != 1 {
+		t.Errorf("saved config keeps %d includes, want 1 for the unchanged model:\n%s", got, saved)
+	}
+	if !strings.Contains(saved, "Be brief.") {
+		t.Errorf("edited prompt not written inline:\n%s", saved)
+	}
+}
+
+func TestFileLoaderIncludeMerge(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "format.yaml"), "provider: openai\nsystem_message_mode: inline\n")
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, `
+models:
+  - name: local
+    endpoint: heuristic://local
+    api_format:
+      include: format.yaml
+      system_message_mode: separate
+`)
+
+	cfg, err := NewFileLoader(path).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	format := cfg.Models[0].APIFormat
+	if format.Provider != "openai" || format.SystemMessageMode != "separate" {
+		t.Errorf("api_format = %+v, want included provider with local override", format)
+	}
+}
+
+func TestFileLoaderIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config.yaml": "models:\n  - include: a.yaml\n",
+				"a.yaml":      "include: b.yaml\n",
+				"b.yaml":      "include: a.yaml\n",
+			},
+			want: "include cycle:",
+		},
+		{
+			name: "self",
+			files: map[string]string{
+				"config.yaml": "include: config.yaml\n",
+			},
+			want: "include cycle:",
+		},
+		{
+			name: "missing",
+			files: map[string]string{
+				"config.yaml": "models:\n  - include: missing.yaml\n",
+			},
+			want: "include missing.yaml:",
+		},
+		{
+			name: "list with keys",
+			files: map[string]string{
+				"config.yaml": "models:\n  - name: x\n    prompt: {include: list.yaml, role: user}\n",
+				"list.yaml":   "- role: system\n  content: hi\n",
+			},
+			want: "need the file to contain a mapping",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(dir, name), content)
+			}
+			_, err := NewFileLoader(filepath.Join(dir, "config.yaml")).Load(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
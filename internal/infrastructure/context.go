@@ -2,6 +2,8 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,6 +14,7 @@ import (
 	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/redact"
 	"github.com/doeshing/shai-go/internal/ports"
 )
 
@@ -19,8 +22,13 @@ import (
 type BasicCollector struct {
 	toolsToCheck []string
 	cache        toolCache
+	run          commandRunner
+	probeTimeout time.Duration
 }
 
+// commandRunner runs a probe command and returns its combined output.
+type commandRunner func(ctx context.Context, dir string, name string, args ...string) (string, error)
+
 type toolCache struct {
 	mu        sync.Mutex
 	available []string
@@ -30,52 +38,81 @@ type toolCache struct {
 func NewBasicCollector() *BasicCollector {
 	return &BasicCollector{
 		toolsToCheck: []string{"docker", "kubectl", "git", "npm", "yarn", "pnpm", "python", "python3", "go", "node", "cargo", "make"},
+		run:          execCommand,
+		probeTimeout: domain.DefaultCommandTimeout,
 	}
 }
 
 // Collect gathers context data.
 func (c *BasicCollector) Collect(ctx context.Context, cfg domain.Config, req domain.QueryRequest) (domain.ContextSnapshot, error) {
-	wd, _ := os.Getwd()
+	wd := req.WorkDir
+	if wd == "" {
+		wd, _ = os.Getwd()
+	}
 	shell := detectShell()
+	if req.AssumeShell != "" {
+		shell = req.AssumeShell
+	}
 	user := os.Getenv("USER")
 
+	// Per-query opt-outs win over config so a single run can avoid probing
+	// git/kubectl/docker without touching the persisted settings.
+	if req.NoContext {
+		return domain.ContextSnapshot{
+			WorkingDir: wd,
+			Shell:      shell,
+			OS:         runtime.GOOS,
+		}, nil
+	}
+
 	var files []domain.FileInfo
 	if cfg.Context.IncludeFiles {
 		files = listFiles(wd, cfg.Context.MaxFiles)
 	}
 
 	tools := c.detectTools()
+	probes := newProbeRunner(ctx, c.run, c.probeTimeout)
 	var gitStatus *domain.GitStatus
-	if shouldCollect(cfg.Context.IncludeGit) {
-		if status := collectGitInfo(ctx, wd); status != nil {
+	if !req.NoGit && shouldCollect(cfg.Context.IncludeGit) {
+		if status := collectGitInfo(probes, wd); status != nil {
 			gitStatus = status
 		}
 	}
 
 	var kubeStatus *domain.KubeStatus
-	if shouldCollect(cfg.Context.IncludeK8s) || req.WithK8sInfo {
-		if status := collectKubeInfo(ctx); status != nil {
+	if !req.NoK8s && (shouldCollect(cfg.Context.IncludeK8s) || req.WithK8sInfo) {
+		if status := collectKubeInfo(probes); status != nil {
 			kubeStatus = status
 		}
 	}
 
 	var dockerStatus *domain.DockerStatus
 	if containsTool(tools, "docker") {
-		dockerStatus = collectDockerInfo(ctx)
+		dockerStatus = collectDockerInfo(probes)
 	}
 
 	envVars := map[string]string{}
-	if cfg.Context.IncludeEnv || req.WithEnv {
+	if !req.NoEnv && (cfg.Context.IncludeEnv || req.WithEnv) {
 		envVars["PATH"] = os.Getenv("PATH")
 		if kubeConfig := os.Getenv("KUBECONFIG"); kubeConfig != "" {
 			envVars["KUBECONFIG"] = kubeConfig
 		}
 	}
+	// Variables passed with --env are set for the command, so the model
+	// always hears about them. Secret-looking values are masked; the command
+	// still receives the real ones.
+	for name, value := range req.Env {
+		if redact.SecretName(name) {
+			value = redact.Marker
+		}
+		envVars[name] = value
+	}
 
 	return domain.ContextSnapshot{
 		WorkingDir:      wd,
 		Shell:           shell,
 		OS:              runtime.GOOS,
+		Distro:          detectDistro(),
 		User:            user,
 		Files:           files,
 		AvailableTools:  tools,
@@ -85,6 +122,7 @@ func (c *BasicCollector) Collect(ctx context.Context, cfg domain.Config, req dom
 		Docker:          dockerStatus,
 		Telemetry: domain.TelemetryInfo{
 			ToolCacheExpires: c.cache.expiresAt.Format(time.RFC3339),
+			ProbeErrors:      probes.errors,
 		},
 	}, nil
 }
@@ -153,6 +191,30 @@ func detectShell() string {
 	return "unknown"
 }
 
+// osReleasePath is read on Linux to identify the distribution.
+const osReleasePath = "/etc/os-release"
+
+// detectDistro returns the os-release ID (e.g. "ubuntu", "alpine") on Linux.
+func detectDistro() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	data, err := os.ReadFile(osReleasePath)
+	if err != nil {
+		return ""
+	}
+	return parseOSReleaseID(string(data))
+}
+
+func parseOSReleaseID(contents string) string {
+	for _, line := range strings.Split(contents, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "ID="); ok {
+			return strings.ToLower(strings.Trim(value, `"'`))
+		}
+	}
+	return ""
+}
+
 func shouldCollect(setting string) bool {
 	switch strings.ToLower(setting) {
 	case "always":
@@ -164,12 +226,12 @@ func shouldCollect(setting string) bool {
 	}
 }
 
-func collectGitInfo(ctx context.Context, dir string) *domain.GitStatus {
+func collectGitInfo(probes *probeRunner, dir string) *domain.GitStatus {
 	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
 		return nil
 	}
-	branch := runCmd(ctx, dir, "git", "rev-parse", "--abbrev-ref", "HEAD")
-	statusShort := runCmd(ctx, dir, "git", "status", "--short")
+	branch := probes.output(domain.ProbeGit, dir, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	statusShort := probes.output(domain.ProbeGit, dir, "git", "status", "--short")
 	modified := 0
 	untracked := 0
 	for _, line := range strings.Split(statusShort, "\n") {
@@ -188,18 +250,18 @@ func collectGitInfo(ctx context.Context, dir string) *domain.GitStatus {
 		ModifiedCount:  modified,
 		UntrackedCount: untracked,
 		Summary:        strings.TrimSpace(statusShort),
-		DiffStat:       diffStat(ctx, dir),
+		DiffStat:       diffStat(probes, dir),
 	}
 }
 
-func collectKubeInfo(ctx context.Context) *domain.KubeStatus {
+func collectKubeInfo(probes *probeRunner) *domain.KubeStatus {
 	if _, err := exec.LookPath("kubectl"); err != nil {
 		return nil
 	}
-	contextName := strings.TrimSpace(runCmd(ctx, "", "kubectl", "config", "current-context"))
-	namespace := strings.TrimSpace(runCmd(ctx, "", "kubectl", "config", "view", "--minify", "--output", "jsonpath={..namespace}"))
-	namespaces := strings.Split(strings.TrimSpace(runCmd(ctx, "", "kubectl", "get", "ns", "-o", "jsonpath={range .items[*]}{.metadata.name}{\"\\n\"}{end}")), "\n")
-	version := strings.TrimSpace(runCmd(ctx, "", "kubectl", "version", "--short"))
+	contextName := strings.TrimSpace(probes.output(domain.ProbeKubernetes, "", "kubectl", "config", "current-context"))
+	namespace := strings.TrimSpace(probes.output(domain.ProbeKubernetes, "", "kubectl", "config", "view", "--minify", "--output", "jsonpath={..namespace}"))
+	namespaces := strings.Split(strings.TrimSpace(probes.output(domain.ProbeKubernetes, "", "kubectl", "get", "ns", "-o", "jsonpath={range .items[*]}{.metadata.name}{\"\\n\"}{end}")), "\n")
+	version := strings.TrimSpace(probes.output(domain.ProbeKubernetes, "", "kubectl", "version", "--short"))
 	return &domain.KubeStatus{
 		Context:        contextName,
 		Namespace:      namespace,
@@ -208,30 +270,78 @@ func collectKubeInfo(ctx context.Context) *domain.KubeStatus {
 	}
 }
 
-func runCmd(ctx context.Context, dir string, name string, args ...string) string {
-	cctx, cancel := context.WithTimeout(ctx, domain.DefaultCommandTimeout)
-	defer cancel()
-	cmd := exec.CommandContext(cctx, name, args...)
+func execCommand(ctx context.Context, dir string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
 	if dir != "" {
 		cmd.Dir = dir
 	}
 	out, err := cmd.CombinedOutput()
-	if err != nil {
+	return string(out), err
+}
+
+// probeRunner runs the probe commands of one Collect call, each bounded by
+// timeout, and records why a source came back empty.
+type probeRunner struct {
+	ctx      context.Context
+	run      commandRunner
+	timeout  time.Duration
+	errors   map[string]string
+	timedOut map[string]bool
+}
+
+func newProbeRunner(ctx context.Context, run commandRunner, timeout time.Duration) *probeRunner {
+	return &probeRunner{ctx: ctx, run: run, timeout: timeout, timedOut: map[string]bool{}}
+}
+
+// output returns the command output, or "" when it fails. Timeouts are
+// recorded for every source and skip that source's remaining probes so a hung
+// tool costs one timeout; other failures are recorded for git only, since
+// kubectl and docker exit non-zero whenever no cluster or daemon is available.
+func (p *probeRunner) output(source, dir, name string, args ...string) string {
+	if p.timedOut[source] {
 		return ""
 	}
-	return string(out)
+	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+	out, err := p.run(ctx, dir, name, args...)
+	if err == nil {
+		return out
+	}
+
+	probe := name
+	if len(args) > 0 {
+		probe += " " + args[0]
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		p.timedOut[source] = true
+		p.record(source, fmt.Sprintf("%s timed out after %s", probe, p.timeout))
+	case source == domain.ProbeGit && p.ctx.Err() == nil:
+		p.record(source, fmt.Sprintf("%s failed: %v", probe, err))
+	}
+	return ""
+}
+
+// record keeps the first error reported for source.
+func (p *probeRunner) record(source, message string) {
+	if p.errors == nil {
+		p.errors = map[string]string{}
+	}
+	if _, exists := p.errors[source]; !exists {
+		p.errors[source] = message
+	}
 }
 
-func diffStat(ctx context.Context, dir string) string {
-	output := runCmd(ctx, dir, "git", "diff", "--stat")
+func diffStat(probes *probeRunner, dir string) string {
+	output := probes.output(domain.ProbeGit, dir, "git", "diff", "--stat")
 	return strings.TrimSpace(output)
 }
 
-func collectDockerInfo(ctx context.Context) *domain.DockerStatus {
+func collectDockerInfo(probes *probeRunner) *domain.DockerStatus {
 	if _, err := exec.LookPath("docker"); err != nil {
 		return nil
 	}
-	info := runCmd(ctx, "", "docker", "info", "--format", "'{{.ServerVersion}} {{.OperatingSystem}}'")
+	info := probes.output(domain.ProbeDocker, "", "docker", "info", "--format", "'{{.ServerVersion}} {{.OperatingSystem}}'")
 	running := strings.TrimSpace(info) != ""
 	return &domain.DockerStatus{
 		Running: running,
@@ -0,0 +1,113 @@
+package infrastructure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// ContextDecision records whether one kind of context reached the prompt and why.
+type ContextDecision struct {
+	Item     string
+	Included bool
+	Reason   string
+}
+
+func (d ContextDecision) String() string {
+	verdict := "skipped"
+	if d.Included {
+		verdict = "included"
+	}
+	return fmt.Sprintf("%s %s: %s", d.Item, verdict, d.Reason)
+}
+
+// ExplainContext describes the choices BasicCollector.Collect made for req
+// under cfg, using snapshot to tell whether an enabled probe found anything.
+func ExplainContext(cfg domain.Config, req domain.QueryRequest, snapshot domain.ContextSnapshot) []ContextDecision {
+	items := []string{"files", "git", "k8s", "docker", "env"}
+	if req.NoContext {
+		decisions := make([]ContextDecision, len(items))
+		for i, item := range items {
+			decisions[i] = ContextDecision{Item: item, Reason: "--no-context"}
+		}
+		return decisions
+	}
+	return []ContextDecision{
+		explainFiles(cfg, snapshot),
+		explainGit(cfg, req, snapshot),
+		explainKube(cfg, req, snapshot),
+		explainDocker(snapshot),
+		explainEnv(cfg, req),
+	}
+}
+
+func explainFiles(cfg domain.Config, snapshot domain.ContextSnapshot) ContextDecision {
+	if !cfg.Context.IncludeFiles {
+		return ContextDecision{Item: "files", Reason: "include_files=false"}
+	}
+	return ContextDecision{Item: "files", Included: true,
+		Reason: fmt.Sprintf("include_files=true, %d listed (max_files=%d)", len(snapshot.Files), cfg.Context.MaxFiles)}
+}
+
+func explainGit(cfg domain.Config, req domain.QueryRequest, snapshot domain.ContextSnapshot) ContextDecision {
+	setting := "include_git=" + collectSetting(cfg.Context.IncludeGit)
+	switch {
+	case req.NoGit:
+		return ContextDecision{Item: "git", Reason: "--no-git"}
+	case !shouldCollect(cfg.Context.IncludeGit):
+		return ContextDecision{Item: "git", Reason: setting}
+	case snapshot.Git == nil:
+		return ContextDecision{Item: "git", Reason: setting + " but no repository detected"}
+	}
+	return ContextDecision{Item: "git", Included: true, Reason: setting + " and repository detected"}
+}
+
+func explainKube(cfg domain.Config, req domain.QueryRequest, snapshot domain.ContextSnapshot) ContextDecision {
+	setting := "include_k8s=" + collectSetting(cfg.Context.IncludeK8s)
+	if req.WithK8sInfo {
+		setting = "--with-k8s-info"
+	}
+	switch {
+	case req.NoK8s:
+		return ContextDecision{Item: "k8s", Reason: "--no-k8s"}
+	case !shouldCollect(cfg.Context.IncludeK8s) && !req.WithK8sInfo:
+		return ContextDecision{Item: "k8s", Reason: setting}
+	case snapshot.Kubernetes == nil:
+		return ContextDecision{Item: "k8s", Reason: setting + " but kubectl not found"}
+	}
+	return ContextDecision{Item: "k8s", Included: true, Reason: setting + " and kubectl found"}
+}
+
+func explainDocker(snapshot domain.ContextSnapshot) ContextDecision {
+	if snapshot.Docker == nil {
+		return ContextDecision{Item: "docker", Reason: "docker not found"}
+	}
+	return ContextDecision{Item: "docker", Included: true, Reason: "docker found"}
+}
+
+func explainEnv(cfg domain.Config, req domain.QueryRequest) ContextDecision {
+	switch {
+	case req.NoEnv && len(req.Env) > 0:
+		return ContextDecision{Item: "env", Included: true, Reason: "--no-env, but --env variables are always sent"}
+	case req.NoEnv:
+		return ContextDecision{Item: "env", Reason: "--no-env"}
+	case req.WithEnv:
+		return ContextDecision{Item: "env", Included: true, Reason: "--with-env"}
+	case cfg.Context.IncludeEnv:
+		return ContextDecision{Item: "env", Included: true, Reason: "include_env=true"}
+	case len(req.Env) > 0:
+		return ContextDecision{Item: "env", Included: true, Reason: "include_env=false, --env variables only"}
+	}
+	return ContextDecision{Item: "env", Reason: "include_env=false"}
+}
+
+// collectSetting names an include_git/include_k8s value as shouldCollect reads
+// it; empty and unrecognised values behave like auto.
+func collectSetting(setting string) string {
+	switch setting = strings.ToLower(setting); setting {
+	case "always", "never":
+		return setting
+	}
+	return "auto"
+}
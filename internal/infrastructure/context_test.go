@@ -2,11 +2,17 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/redact"
 )
 
 func TestBasicCollectorIncludesFiles(t *testing.T) {
@@ -62,3 +68,255 @@ func TestBasicCollectorIncludesEnvWhenRequested(t *testing.T) {
 		t.Fatal("expected PATH to be present when WithEnv is true")
 	}
 }
+
+func TestBasicCollectorHonorsPerQueryOptOuts(t *testing.T) {
+	tmp := t.TempDir()
+	prev, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(prev) })
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(tmp, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "file1.txt"), []byte("test"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := domain.Config{
+		Context: domain.ContextSettings{
+			IncludeFiles: true,
+			MaxFiles:     5,
+			IncludeGit:   "always",
+			IncludeEnv:   true,
+		},
+	}
+	collector := NewBasicCollector()
+
+	baseline, err := collector.Collect(context.Background(), cfg, domain.QueryRequest{})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if baseline.Git == nil || len(baseline.EnvironmentVars) == 0 || len(baseline.Files) == 0 {
+		t.Fatalf("expected full context without opt-outs, got %+v", baseline)
+	}
+
+	noGit, err := collector.Collect(context.Background(), cfg, domain.QueryRequest{NoGit: true})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if noGit.Git != nil {
+		t.Fatalf("expected git to be skipped, got %+v", noGit.Git)
+	}
+
+	noEnv, err := collector.Collect(context.Background(), cfg, domain.QueryRequest{NoEnv: true, WithEnv: true})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if len(noEnv.EnvironmentVars) != 0 {
+		t.Fatalf("expected env to be skipped, got %v", noEnv.EnvironmentVars)
+	}
+
+	injected, err := collector.Collect(context.Background(), cfg, domain.QueryRequest{NoEnv: true, Env: map[string]string{"KUBECONFIG": "/tmp/dev.yaml"}})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if want := map[string]string{"KUBECONFIG": "/tmp/dev.yaml"}; !maps.Equal(injected.EnvironmentVars, want) {
+		t.Fatalf("expected only --env variables, got %v", injected.EnvironmentVars)
+	}
+
+	secret, err := collector.Collect(context.Background(), cfg, domain.QueryRequest{NoEnv: true, Env: map[string]string{"API_TOKEN": "tok-123456", "REGION": "eu"}})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if want := map[string]string{"API_TOKEN": redact.Marker, "REGION": "eu"}; !maps.Equal(secret.EnvironmentVars, want) {
+		t.Fatalf("expected secret --env values to be masked, got %v", secret.EnvironmentVars)
+	}
+
+	minimal, err := collector.Collect(context.Background(), cfg, domain.QueryRequest{NoContext: true})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if minimal.WorkingDir == "" || minimal.OS == "" || minimal.Shell == "" {
+		t.Fatalf("expected cwd/shell/os to remain, got %+v", minimal)
+	}
+	if minimal.Git != nil || len(minimal.Files) != 0 || len(minimal.AvailableTools) != 0 || len(minimal.EnvironmentVars) != 0 {
+		t.Fatalf("expected everything else skipped, got %+v", minimal)
+	}
+	if cfg.Context.IncludeGit != "always" || !cfg.Context.IncludeEnv {
+		t.Fatal("config must not be mutated by per-query opt-outs")
+	}
+}
+
+func TestBasicCollectorUsesRequestWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	snapshot, err := NewBasicCollector().Collect(context.Background(), domain.Config{}, domain.QueryRequest{WorkDir: dir, NoContext: true})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if snapshot.WorkingDir != dir {
+		t.Errorf("WorkingDir = %s, want %s", snapshot.WorkingDir, dir)
+	}
+}
+
+func TestBasicCollectorAssumeShell(t *testing.T) {
+	t.Setenv("SHELL", "/bin/zsh")
+	for _, req := range []domain.QueryRequest{{AssumeShell: "fish"}, {AssumeShell: "fish", NoContext: true}} {
+		snapshot, err := NewBasicCollector().Collect(context.Background(), domain.Config{}, req)
+		if err != nil {
+			t.Fatalf("Collect error: %v", err)
+		}
+		if snapshot.Shell != "fish" {
+			t.Errorf("Shell = %q with NoContext=%v, want the assumed fish", snapshot.Shell, req.NoContext)
+		}
+	}
+}
+
+func TestParseOSReleaseID(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{name: "quoted", contents: "NAME=\"Ubuntu\"\nID=\"ubuntu\"\nID_LIKE=debian\n", want: "ubuntu"},
+		{name: "bare", contents: "ID=alpine\nVERSION_ID=3.19.0\n", want: "alpine"},
+		{name: "missing", contents: "NAME=Unknown\n", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseOSReleaseID(tt.contents); got != tt.want {
+				t.Errorf("parseOSReleaseID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicCollectorRecordsProbeTimeouts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	gitCalls := 0
+	collector := NewBasicCollector()
+	collector.probeTimeout = 20 * time.Millisecond
+	collector.run = func(ctx context.Context, _ string, name string, _ ...string) (string, error) {
+		if name != "git" {
+			return "", nil
+		}
+		gitCalls++
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	start := time.Now()
+	snapshot, err := collector.Collect(context.Background(), domain.Config{}, domain.QueryRequest{WorkDir: dir})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Collect took %s; a hung probe should cost one timeout", elapsed)
+	}
+	if gitCalls != 1 {
+		t.Errorf("git probes after timeout = %d, want 1", gitCalls)
+	}
+	if msg := snapshot.Telemetry.ProbeErrors[domain.ProbeGit]; !strings.Contains(msg, "timed out") {
+		t.Errorf("ProbeErrors[git] = %q, want a timeout", msg)
+	}
+	if _, ok := snapshot.Telemetry.ProbeErrors[domain.ProbeKubernetes]; ok {
+		t.Errorf("only git should report an error, got %v", snapshot.Telemetry.ProbeErrors)
+	}
+}
+
+func TestBasicCollectorRecordsGitFailures(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := NewBasicCollector()
+	collector.run = func(context.Context, string, string, ...string) (string, error) {
+		return "", errors.New("exit status 128")
+	}
+
+	snapshot, err := collector.Collect(context.Background(), domain.Config{}, domain.QueryRequest{WorkDir: dir})
+	if err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if msg := snapshot.Telemetry.ProbeErrors[domain.ProbeGit]; msg != "git rev-parse failed: exit status 128" {
+		t.Errorf("ProbeErrors[git] = %q", msg)
+	}
+	if _, ok := snapshot.Telemetry.ProbeErrors[domain.ProbeDocker]; ok {
+		t.Errorf("docker exit errors should not be recorded, got %v", snapshot.Telemetry.ProbeErrors)
+	}
+}
+
+func TestExplainContext(t *testing.T) {
+	withGit := domain.ContextSnapshot{WorkingDir: "/repo", Git: &domain.GitStatus{Branch: "main"}}
+	tests := []struct {
+		name     string
+		settings domain.ContextSettings
+		req      domain.QueryRequest
+		snapshot domain.ContextSnapshot
+		want     []string
+	}{
+		{
+			name:     "auto with repository",
+			snapshot: withGit,
+			want:     []string{"git included: include_git=auto and repository detected", "k8s skipped: include_k8s=auto but kubectl not found"},
+		},
+		{
+			name:     "auto without repository",
+			settings: domain.ContextSettings{IncludeGit: "auto"},
+			snapshot: domain.ContextSnapshot{WorkingDir: "/tmp"},
+			want:     []string{"git skipped: include_git=auto but no repository detected"},
+		},
+		{
+			name:     "never",
+			settings: domain.ContextSettings{IncludeGit: "never", IncludeK8s: "Never"},
+			snapshot: domain.ContextSnapshot{WorkingDir: "/repo"},
+			want:     []string{"git skipped: include_git=never", "k8s skipped: include_k8s=never", "env skipped: include_env=false"},
+		},
+		{
+			name:     "flags override settings",
+			settings: domain.ContextSettings{IncludeGit: "always", IncludeK8s: "never", IncludeEnv: true},
+			req:      domain.QueryRequest{NoGit: true, WithK8sInfo: true, NoEnv: true},
+			snapshot: domain.ContextSnapshot{WorkingDir: "/repo", Kubernetes: &domain.KubeStatus{Context: "dev"}},
+			want:     []string{"git skipped: --no-git", "k8s included: --with-k8s-info and kubectl found", "env skipped: --no-env"},
+		},
+		{
+			name: "env flag",
+			req:  domain.QueryRequest{Env: map[string]string{"AWS_PROFILE": "dev"}},
+			want: []string{"env included: include_env=false, --env variables only"},
+		},
+		{
+			name:     "files",
+			settings: domain.ContextSettings{IncludeFiles: true, MaxFiles: 20},
+			snapshot: domain.ContextSnapshot{WorkingDir: "/repo", Files: []domain.FileInfo{{Path: "a"}}},
+			want:     []string{"files included: include_files=true, 1 listed (max_files=20)"},
+		},
+		{
+			name:     "no context",
+			req:      domain.QueryRequest{NoContext: true},
+			snapshot: withGit,
+			want:     []string{"files skipped: --no-context", "git skipped: --no-context", "docker skipped: --no-context"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []string
+			for _, decision := range ExplainContext(domain.Config{Context: tt.settings}, tt.req, tt.snapshot) {
+				lines = append(lines, decision.String())
+			}
+			for _, want := range tt.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("missing %q in:\n%s", want, strings.Join(lines, "\n"))
+				}
+			}
+		})
+	}
+}
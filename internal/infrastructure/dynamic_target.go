@@ -0,0 +1,90 @@
+package infrastructure
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// dynamicMarker matches command substitution ($(...) or backticks) and
+// variable expansion ($VAR, ${VAR}, $1) whose value is only known at runtime.
+var dynamicMarker = regexp.MustCompile("\\$\\(|`|\\$\\{?[A-Za-z0-9_]")
+
+// commandSeparators end one command and start the next on the same line.
+var commandSeparators = map[string]bool{";": true, "&&": true, "||": true, "|": true, "&": true}
+
+// dynamicDestructiveTool returns the destructive tool (rm -r, dd, mkfs) whose
+// arguments contain a dynamic target, or "" when every target is literal.
+func dynamicDestructiveTool(command string) string {
+	fields := strings.Fields(command)
+	for i, field := range fields {
+		if !atCommandPosition(fields, i) || !isDestructiveTool(field) {
+			continue
+		}
+		args := commandArgs(fields[i+1:])
+		if field == "rm" && !hasRecursiveFlag(args) {
+			continue
+		}
+		for _, arg := range args {
+			if dynamicMarker.MatchString(arg) {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// atCommandPosition reports whether fields[i] is where a command name appears.
+func atCommandPosition(fields []string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev := fields[i-1]
+	return commandSeparators[prev] || strings.HasSuffix(prev, ";") || prev == "sudo" || prev == "doas"
+}
+
+func isDestructiveTool(name string) bool {
+	return name == "rm" || name == "dd" || name == "mkfs" || strings.HasPrefix(name, "mkfs.")
+}
+
+// commandArgs returns the arguments up to the next command separator.
+func commandArgs(fields []string) []string {
+	for i, field := range fields {
+		if commandSeparators[field] {
+			return fields[:i]
+		}
+		if strings.HasSuffix(field, ";") {
+			return append(fields[:i:i], strings.TrimSuffix(field, ";"))
+		}
+	}
+	return fields
+}
+
+func hasRecursiveFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--recursive" {
+			return true
+		}
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.ContainsAny(arg, "rR") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDynamicTarget raises destructive commands with runtime-resolved targets
+// to at least medium risk, since protected path rules cannot see them.
+func checkDynamicTarget(command string, assessment *domain.RiskAssessment) {
+	tool := dynamicDestructiveTool(command)
+	if tool == "" {
+		return
+	}
+	if moreSevere(domain.RiskMedium, assessment.Level) {
+		assessment.Level = domain.RiskMedium
+		assessment.Action = parseAction("", domain.RiskMedium)
+	}
+	assessment.Reasons = appendUnique(assessment.Reasons,
+		fmt.Sprintf("Target of %s is dynamic ($(...), backticks or variables) and cannot be verified", tool))
+}
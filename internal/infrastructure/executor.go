@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"slices"
+	"syscall"
 	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
@@ -15,25 +20,53 @@ import (
 // LocalExecutor runs commands on the host shell.
 type LocalExecutor struct {
 	shell string
+	// terminal reports whether stdin is a terminal that interactive
+	// programs such as vim or ssh can take over.
+	terminal func() bool
+	// terminalOut receives interactive programs' output; nil is os.Stdout.
+	terminalOut io.Writer
 }
 
-// NewLocalExecutor builds a new executor, shell defaults to /bin/sh.
+// NewLocalExecutor builds a new executor. An empty or "auto" shell uses
+// $SHELL, falling back to /bin/sh.
 func NewLocalExecutor(shell string) *LocalExecutor {
-	if shell == "" {
+	if shell == "" || shell == "auto" {
 		shell = os.Getenv("SHELL")
 	}
 	if shell == "" {
 		shell = "/bin/sh"
 	}
-	return &LocalExecutor{shell: shell}
+	return &LocalExecutor{shell: shell, terminal: stdinIsTerminal}
+}
+
+// Shell implements ports.ShellExecutor.
+func (e *LocalExecutor) Shell() string {
+	return e.shell
 }
 
 // Execute implements ports.CommandExecutor.
-func (e *LocalExecutor) Execute(ctx context.Context, command string) (domain.ExecutionResult, error) {
+func (e *LocalExecutor) Execute(ctx context.Context, command string, dir string, env map[string]string) (domain.ExecutionResult, error) {
 	c := exec.CommandContext(ctx, e.shell, "-c", command)
+	c.Dir = dir
+	if len(env) > 0 {
+		// Later entries win, so env overrides inherited variables.
+		c.Env = os.Environ()
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			c.Env = append(c.Env, key+"="+env[key])
+		}
+	}
 	var stdout, stderr bytes.Buffer
-	c.Stdout = &stdout
-	c.Stderr = &stderr
+	if e.attachTerminal(command) {
+		// Interactive programs get the terminal itself; their output is
+		// shown live and not captured.
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if e.terminalOut != nil {
+			c.Stdout = e.terminalOut
+		}
+	} else {
+		c.Stdout = &stdout
+		c.Stderr = &stderr
+	}
 
 	start := time.Now()
 	err := c.Run()
@@ -48,8 +81,13 @@ func (e *LocalExecutor) Execute(ctx context.Context, command string) (domain.Exe
 	var exitErr *exec.ExitError
 	if errors.As(err, &exitErr) {
 		result.ExitCode = exitErr.ExitCode()
+		result.Signal = exitSignal(exitErr)
+		result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
 		result.Err = err
-		return result, err
+		if result.TimedOut {
+			result.Err = fmt.Errorf("command timed out: %w", err)
+		}
+		return result, result.Err
 	}
 	if err != nil {
 		result.Err = err
@@ -59,4 +97,44 @@ func (e *LocalExecutor) Execute(ctx context.Context, command string) (domain.Exe
 	return result, nil
 }
 
+// signalNames are the usual names of the signals that end commands.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// exitSignal names the signal that terminated the process, or "" when it
+// exited normally.
+func exitSignal(exitErr *exec.ExitError) string {
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	if name, ok := signalNames[status.Signal()]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d", int(status.Signal()))
+}
+
+// WithTerminalOutput returns a copy of e that sends the output of interactive
+// programs, which is shown live rather than captured, to out instead of
+// stdout, e.g. so it does not mix into --output ndjson events. e is unchanged.
+func (e *LocalExecutor) WithTerminalOutput(out io.Writer) *LocalExecutor {
+	copied := *e
+	copied.terminalOut = out
+	return &copied
+}
+
+// attachTerminal reports whether command needs an interactive terminal and
+// one is available.
+func (e *LocalExecutor) attachTerminal(command string) bool {
+	return e.terminal != nil && e.terminal() && interactiveTool(command) != ""
+}
+
 var _ ports.CommandExecutor = (*LocalExecutor)(nil)
@@ -0,0 +1,131 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalExecutorRunsInDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "marker.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := NewLocalExecutor("/bin/sh").Execute(context.Background(), "ls", dir, nil)
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if !strings.Contains(result.Stdout, "marker.txt") {
+		t.Errorf("command did not run in %s, stdout: %q", dir, result.Stdout)
+	}
+}
+
+func TestLocalExecutorInjectsEnv(t *testing.T) {
+	t.Setenv("SHAI_TEST_PROFILE", "outer")
+	t.Setenv("SHAI_TEST_KEEP", "kept")
+	env := map[string]string{"SHAI_TEST_PROFILE": "inner", "SHAI_TEST_EXTRA": "a=b"}
+
+	result, err := NewLocalExecutor("/bin/sh").Execute(context.Background(),
+		`echo "$SHAI_TEST_PROFILE $SHAI_TEST_EXTRA $SHAI_TEST_KEEP"`, t.TempDir(), env)
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if result.Stdout != "inner a=b kept\n" {
+		t.Errorf("stdout = %q, want injected variables over the inherited environment", result.Stdout)
+	}
+}
+
+func TestLocalExecutorRunsHeredoc(t *testing.T) {
+	dir := t.TempDir()
+	command := "cat <<EOF > notes.txt\nfirst line\nsecond line\nEOF\ncat notes.txt"
+
+	result, err := NewLocalExecutor("/bin/sh").Execute(context.Background(), command, dir, nil)
+	if err != nil {
+		t.Fatalf("Execute error: %v (stderr %q)", err, result.Stderr)
+	}
+	if result.Stdout != "first line\nsecond line\n" {
+		t.Errorf("stdout = %q", result.Stdout)
+	}
+}
+
+func TestLocalExecutorAttachTerminal(t *testing.T) {
+	tests := []struct {
+		command  string
+		terminal bool
+		want     bool
+	}{
+		{command: "vim notes.txt", terminal: true, want: true},
+		{command: "vim notes.txt", terminal: false, want: false},
+		{command: "ssh host uptime", terminal: true, want: false},
+		{command: "ls -la", terminal: true, want: false},
+	}
+
+	for _, tt := range tests {
+		executor := &LocalExecutor{shell: "/bin/sh", terminal: func() bool { return tt.terminal }}
+		if got := executor.attachTerminal(tt.command); got != tt.want {
+			t.Errorf("attachTerminal(%q) with terminal=%v = %v, want %v", tt.command, tt.terminal, got, tt.want)
+		}
+	}
+}
+
+func TestLocalExecutorWithTerminalOutput(t *testing.T) {
+	// The "shell" stands in for vim and prints to whatever stdout it gets.
+	shell := filepath.Join(t.TempDir(), "fake-shell")
+	if err := os.WriteFile(shell, []byte("#!/bin/sh\necho live\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	shared := &LocalExecutor{shell: shell, terminal: func() bool { return true }}
+
+	var out bytes.Buffer
+	run := shared.WithTerminalOutput(&out)
+	if _, err := run.Execute(context.Background(), "vim notes.txt", "", nil); err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if out.String() != "live\n" {
+		t.Errorf("terminal output = %q, want %q", out.String(), "live\n")
+	}
+	if shared.terminalOut != nil {
+		t.Errorf("shared executor terminal output = %v, want it unchanged", shared.terminalOut)
+	}
+}
+
+func TestLocalExecutorReportsTermination(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    string
+		timeout    time.Duration
+		wantSignal string
+		wantTimed  bool
+		wantStatus string
+	}{
+		{name: "non-zero exit", command: "exit 3", wantStatus: "exit 3"},
+		{name: "killed by signal", command: "kill -TERM $$", wantSignal: "SIGTERM", wantStatus: "killed(SIGTERM)"},
+		{name: "timeout", command: "exec sleep 5", timeout: 50 * time.Millisecond, wantSignal: "SIGKILL", wantTimed: true, wantStatus: "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			result, err := NewLocalExecutor("/bin/sh").Execute(ctx, tt.command, t.TempDir(), nil)
+			if err == nil {
+				t.Fatal("Execute() error = nil, want failure")
+			}
+			if result.Signal != tt.wantSignal || result.TimedOut != tt.wantTimed {
+				t.Errorf("Signal = %q, TimedOut = %v, want %q, %v", result.Signal, result.TimedOut, tt.wantSignal, tt.wantTimed)
+			}
+			if got := result.Status(); got != tt.wantStatus {
+				t.Errorf("Status() = %q, want %q", got, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package infrastructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+const (
+	// fileLockRetryInterval is how often a held lock is retried.
+	fileLockRetryInterval = 10 * time.Millisecond
+	// staleFileLockAge is how old a lock must be before it is assumed to be
+	// left over from a crashed process. Saves hold it for milliseconds.
+	staleFileLockAge = 30 * time.Second
+)
+
+// fileLockTimeout bounds how long a writer waits for another shai process.
+var fileLockTimeout = domain.DefaultFileLockTimeout
+
+// lockPath returns the advisory lock file guarding path, e.g.
+// ~/.shai/.config.yaml.lock for ~/.shai/config.yaml.
+func lockPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+}
+
+// acquireFileLock takes the advisory lock for path by exclusively creating
+// its lock file, waiting up to fileLockTimeout. The returned function
+// releases the lock and must be called on every path, including errors.
+func acquireFileLock(path string) (func(), error) {
+	lock := lockPath(path)
+	if err := os.MkdirAll(filepath.Dir(lock), domain.DirectoryPermissions); err != nil {
+		return nil, err
+	}
+	// The owner line is unique per acquisition, so a lock is only ever removed
+	// by the process that holds it or by one that found exactly that lock stale.
+	owner := []byte(fmt.Sprintf("%d %d\n", os.Getpid(), time.Now().UnixNano()))
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, domain.SecureFilePermissions)
+		if err == nil {
+			_, writeErr := file.Write(owner)
+			closeErr := file.Close()
+			if err := errors.Join(writeErr, closeErr); err != nil {
+				os.Remove(lock)
+				return nil, fmt.Errorf("write lock %s: %w", lock, err)
+			}
+			return func() { removeOwnedLock(lock, owner) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("create lock %s: %w", lock, err)
+		}
+		if info, statErr := os.Stat(lock); statErr == nil && time.Since(info.ModTime()) > staleFileLockAge {
+			if stale, readErr := os.ReadFile(lock); readErr == nil {
+				removeOwnedLock(lock, stale)
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another shai process (remove %s if none is running)", path, lock)
+		}
+		time.Sleep(fileLockRetryInterval)
+	}
+}
+
+// removeOwnedLock removes lock only if it still holds owner. The lock is first
+// renamed aside, which is atomic, so a concurrent process cannot recreate it
+// between the check and the removal; a lock that turns out to belong to
+// someone else is linked back in place.
+func removeOwnedLock(lock string, owner []byte) {
+	aside := fmt.Sprintf("%s.%d.release", lock, os.Getpid())
+	if err := os.Rename(lock, aside); err != nil {
+		return
+	}
+	if data, err := os.ReadFile(aside); err == nil && !bytes.Equal(data, owner) {
+		os.Link(aside, lock)
+	}
+	os.Remove(aside)
+}
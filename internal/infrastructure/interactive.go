@@ -0,0 +1,128 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// interactiveRule describes when a program needs a terminal to run.
+type interactiveRule struct {
+	// maxArgs is the number of positional arguments (an ssh host, a psql
+	// database) that still open an interactive session; -1 means any.
+	maxArgs int
+	// runFlags make the program run something and exit, e.g. psql -c.
+	runFlags []string
+	// valueFlags take the next argument as their value, so it is not counted
+	// as a positional argument.
+	valueFlags []string
+	// readsTTY programs read the keyboard from the terminal even when stdin
+	// is piped, so "git log | less" still needs one.
+	readsTTY bool
+}
+
+// interactivePrograms are known to expect an interactive terminal.
+var interactivePrograms = map[string]interactiveRule{
+	"vi":        {maxArgs: -1, readsTTY: true},
+	"vim":       {maxArgs: -1, readsTTY: true},
+	"nvim":      {maxArgs: -1, readsTTY: true},
+	"nano":      {maxArgs: -1, readsTTY: true},
+	"emacs":     {maxArgs: -1, runFlags: []string{"--batch"}, readsTTY: true},
+	"less":      {maxArgs: -1, readsTTY: true},
+	"more":      {maxArgs: -1, readsTTY: true},
+	"man":       {maxArgs: -1, readsTTY: true},
+	"top":       {maxArgs: -1, runFlags: []string{"-b", "-l"}, readsTTY: true},
+	"htop":      {maxArgs: -1, readsTTY: true},
+	"btop":      {maxArgs: -1, readsTTY: true},
+	"tmux":      {maxArgs: 0, readsTTY: true},
+	"screen":    {maxArgs: 0, readsTTY: true},
+	"ssh":       {maxArgs: 1, valueFlags: []string{"-p", "-i", "-l", "-o", "-J", "-F", "-L", "-R", "-D"}},
+	"psql":      {maxArgs: 2, runFlags: []string{"-c", "--command", "-f", "--file", "-l", "--list"}, valueFlags: []string{"-h", "-p", "-U", "-d"}},
+	"mysql":     {maxArgs: 1, runFlags: []string{"-e", "--execute"}, valueFlags: []string{"-h", "-P", "-u"}},
+	"sqlite3":   {maxArgs: 1},
+	"redis-cli": {maxArgs: 0, valueFlags: []string{"-h", "-p", "-a", "-n"}},
+	"python":    {maxArgs: 0, runFlags: []string{"-c", "-m"}},
+	"python3":   {maxArgs: 0, runFlags: []string{"-c", "-m"}},
+	"node":      {maxArgs: 0, runFlags: []string{"-e", "-p", "--eval", "--print"}},
+	"irb":       {maxArgs: 0},
+}
+
+// interactiveTool returns the first program in command that would wait for
+// terminal input, or "" when every program can run non-interactively.
+func interactiveTool(command string) string {
+	fields := strings.Fields(command)
+	for i, field := range fields {
+		if !atCommandPosition(fields, i) {
+			continue
+		}
+		name := filepath.Base(field)
+		rule, ok := interactivePrograms[name]
+		if !ok {
+			continue
+		}
+		piped := i > 0 && fields[i-1] == "|"
+		if rule.needsTerminal(commandArgs(fields[i+1:]), piped) {
+			return name
+		}
+	}
+	return ""
+}
+
+// needsTerminal reports whether a program invoked with args and, when piped,
+// with stdin from another command would wait for terminal input.
+func (r interactiveRule) needsTerminal(args []string, piped bool) bool {
+	if piped && !r.readsTTY {
+		return false
+	}
+	positional := 0
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case slices.Contains(r.runFlags, arg):
+			return false
+		case strings.HasPrefix(arg, "<") && !r.readsTTY:
+			// Input redirected from a file or heredoc.
+			return false
+		case slices.Contains(r.valueFlags, arg):
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			positional++
+		}
+	}
+	return r.maxArgs < 0 || positional <= r.maxArgs
+}
+
+// checkInteractive warns when command needs a terminal that is not attached
+// and raises it to at least low so it never counts as safe. Evaluate then
+// turns it into a preview rather than leave it hanging.
+func (g *Guardrail) checkInteractive(command string, assessment *domain.RiskAssessment) {
+	tool := g.missingTerminal(command)
+	if tool == "" {
+		return
+	}
+	if moreSevere(domain.RiskLow, assessment.Level) {
+		assessment.Level = domain.RiskLow
+		assessment.Action = parseAction("", domain.RiskLow)
+	}
+	assessment.Reasons = appendUnique(assessment.Reasons,
+		fmt.Sprintf("%s needs an interactive terminal, but stdin is not a TTY; it may hang", tool))
+}
+
+// missingTerminal returns the program in command that needs a terminal when
+// none is attached, or "".
+func (g *Guardrail) missingTerminal(command string) string {
+	if g.terminal == nil || g.terminal() {
+		return ""
+	}
+	return interactiveTool(command)
+}
+
+// stdinIsTerminal reports whether standard input is a character device such as a terminal.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,99 @@
+package infrastructure
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// networkProbeAddress is dialed to decide whether the machine is online.
+	networkProbeAddress = "1.1.1.1:53"
+	// networkProbeTimeout keeps the probe from delaying guardrail evaluation.
+	networkProbeTimeout = 300 * time.Millisecond
+	// networkProbeTTL is how long a probe result is reused.
+	networkProbeTTL = 30 * time.Second
+)
+
+// networkTools maps commands that usually reach the network to the
+// subcommands that do; a nil list means every invocation does.
+var networkTools = map[string][]string{
+	"curl":    nil,
+	"wget":    nil,
+	"ssh":     nil,
+	"scp":     nil,
+	"apt":     {"install", "update", "upgrade", "full-upgrade"},
+	"apt-get": {"install", "update", "upgrade", "dist-upgrade"},
+	"brew":    {"install", "update", "upgrade", "tap"},
+	"pip":     {"install", "download"},
+	"pip3":    {"install", "download"},
+	"npm":     {"install", "i", "update", "publish"},
+	"yarn":    {"add", "install"},
+	"git":     {"clone", "fetch", "pull", "push"},
+	"docker":  {"pull", "push"},
+}
+
+// needsNetwork reports whether command starts with a known network tool,
+// ignoring a leading sudo/doas.
+func needsNetwork(command string) bool {
+	tokens := strings.Fields(command)
+	if privilegePrefix(command) != "" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return false
+	}
+	subcommands, ok := networkTools[tokens[0]]
+	if !ok {
+		return false
+	}
+	if subcommands == nil {
+		return true
+	}
+	for _, token := range tokens[1:] {
+		if strings.HasPrefix(token, "-") {
+			continue
+		}
+		return slices.Contains(subcommands, token)
+	}
+	return false
+}
+
+// networkProbe caches a quick connectivity check.
+type networkProbe struct {
+	dial func() bool
+
+	mu        sync.Mutex
+	online    bool
+	expiresAt time.Time
+}
+
+func newNetworkProbe() *networkProbe {
+	return &networkProbe{dial: dialProbe}
+}
+
+// sharedNetworkProbe lets every guardrail profile reuse one cached result.
+var sharedNetworkProbe = newNetworkProbe()
+
+// Online reports the cached connectivity state, probing again once it expires.
+func (p *networkProbe) Online() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().Before(p.expiresAt) {
+		return p.online
+	}
+	p.online = p.dial()
+	p.expiresAt = time.Now().Add(networkProbeTTL)
+	return p.online
+}
+
+func dialProbe() bool {
+	conn, err := net.DialTimeout("tcp", networkProbeAddress, networkProbeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
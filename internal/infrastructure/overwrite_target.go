@@ -0,0 +1,157 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// overwrittenFile is an existing regular file a command would replace.
+type overwrittenFile struct {
+	path string
+	info os.FileInfo
+}
+
+// overwrittenFiles returns the existing regular files that command would
+// overwrite through a ">" redirect, tee without --append, or a cp/mv
+// destination. Relative paths are resolved against dir, the directory the
+// command runs in, or the current one when dir is empty. It only stats paths
+// and never reads or modifies them.
+func overwrittenFiles(command, dir string) []overwrittenFile {
+	var files []overwrittenFile
+	seen := map[string]bool{}
+	for _, target := range overwriteTargets(command, dir) {
+		if seen[target] || dynamicMarker.MatchString(target) {
+			continue
+		}
+		seen[target] = true
+		info, err := os.Stat(resolveIn(dir, target))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, overwrittenFile{path: target, info: info})
+	}
+	return files
+}
+
+// overwriteTargets lists the paths command writes over, existing or not.
+func overwriteTargets(command, dir string) []string {
+	fields := strings.Fields(command)
+	targets := redirectTargets(fields)
+	for i, field := range fields {
+		if !atCommandPosition(fields, i) {
+			continue
+		}
+		args := commandArgs(fields[i+1:])
+		switch field {
+		case "tee":
+			targets = append(targets, teeTargets(args)...)
+		case "cp", "mv":
+			targets = append(targets, copyTargets(args, dir)...)
+		}
+	}
+	return targets
+}
+
+// redirectTargets returns the files named by truncating redirects such as
+// "> out", ">out", "2>err.log" and ">| out". Appends (">>") and descriptor
+// duplication (">&2", "2>&1") are ignored.
+func redirectTargets(fields []string) []string {
+	var targets []string
+	for i, field := range fields {
+		idx := strings.Index(field, ">")
+		if idx < 0 {
+			continue
+		}
+		rest := field[idx+1:]
+		if strings.HasPrefix(rest, ">") || strings.HasPrefix(rest, "&") {
+			continue
+		}
+		rest = strings.TrimPrefix(rest, "|")
+		if rest == "" {
+			if i+1 >= len(fields) {
+				continue
+			}
+			rest = fields[i+1]
+		}
+		targets = append(targets, strings.TrimRight(rest, ";"))
+	}
+	return targets
+}
+
+func teeTargets(args []string) []string {
+	var targets []string
+	for _, arg := range args {
+		if arg == "-a" || arg == "--append" {
+			return nil
+		}
+		if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, ">") {
+			targets = append(targets, arg)
+		}
+	}
+	return targets
+}
+
+// copyTargets returns the destination files of a cp or mv invocation. When
+// the destination is a directory, each source's name inside it is returned.
+func copyTargets(args []string, dir string) []string {
+	var paths []string
+	for _, arg := range args {
+		switch {
+		case arg == "-n" || arg == "--no-clobber" || arg == "-t" || strings.HasPrefix(arg, "--target-directory"):
+			return nil
+		case strings.Contains(arg, ">"):
+			return copyPaths(paths, dir)
+		case !strings.HasPrefix(arg, "-"):
+			paths = append(paths, arg)
+		}
+	}
+	return copyPaths(paths, dir)
+}
+
+func copyPaths(paths []string, dir string) []string {
+	if len(paths) < 2 {
+		return nil
+	}
+	dest := paths[len(paths)-1]
+	info, err := os.Stat(resolveIn(dir, dest))
+	if err != nil || !info.IsDir() {
+		return []string{dest}
+	}
+	targets := make([]string, 0, len(paths)-1)
+	for _, source := range paths[:len(paths)-1] {
+		targets = append(targets, filepath.Join(dest, filepath.Base(source)))
+	}
+	return targets
+}
+
+// resolveIn expands ~ in path and joins a relative result with dir.
+func resolveIn(dir, path string) string {
+	path = expandHome(path)
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// checkOverwriteTargets warns about each existing file the command would
+// overwrite in dir and raises a safe command to low risk so it is confirmed first.
+func checkOverwriteTargets(command, dir string, assessment *domain.RiskAssessment) {
+	files := overwrittenFiles(command, dir)
+	if len(files) == 0 {
+		return
+	}
+	if moreSevere(domain.RiskLow, assessment.Level) {
+		assessment.Level = domain.RiskLow
+		assessment.Action = parseAction("", domain.RiskLow)
+	}
+	for _, file := range files {
+		assessment.Reasons = appendUnique(assessment.Reasons,
+			fmt.Sprintf("Target %s exists and will be overwritten (%d bytes, modified %s)",
+				file.path, file.info.Size(), file.info.ModTime().Format("2006-01-02 15:04")))
+		assessment.PreviewEntries = appendUnique(assessment.PreviewEntries, previewPath(file.path, 1)...)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 
@@ -18,11 +20,16 @@ import (
 
 // Guardrail implements the SecurityService port.
 type Guardrail struct {
-	patterns     []compiledPattern
-	pathRules    []domain.ProtectedPath
-	previewLimit int
-	confirmation map[domain.RiskLevel]domain.ConfirmationLevel
-	whitelist    []string
+	patterns       []compiledPattern
+	pathRules      []domain.ProtectedPath
+	previewLimit   int
+	confirmation   map[domain.RiskLevel]domain.ConfirmationLevel
+	whitelist      []string
+	sudoEscalation bool
+	network        *networkProbe
+	// terminal reports whether commands can use an interactive terminal;
+	// nil skips the interactive-command check.
+	terminal func() bool
 }
 
 type compiledPattern struct {
@@ -38,6 +45,8 @@ type PolicyDocument struct {
 		Preview        domain.PreviewRules                 `yaml:"preview"`
 		Confirmation   map[string]domain.ConfirmationLevel `yaml:"confirmation_levels"`
 		Whitelist      []string                            `yaml:"whitelist"`
+		SudoEscalation *bool                               `yaml:"sudo_escalation,omitempty"`
+		NetworkCheck   bool                                `yaml:"network_check,omitempty"`
 	} `yaml:"rules"`
 }
 
@@ -48,8 +57,49 @@ func NewGuardrail(path string) (*Guardrail, error) {
 		return nil, err
 	}
 
-	compiled := make([]compiledPattern, 0, len(doc.Rules.DangerPatterns))
-	for _, pattern := range doc.Rules.DangerPatterns {
+	compiled, err := compilePatterns(doc.Rules.DangerPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	previewLimit := doc.Rules.Preview.MaxFiles
+	if previewLimit == 0 {
+		previewLimit = domain.DefaultPreviewMaxFiles
+	}
+
+	confirmation := map[domain.RiskLevel]domain.ConfirmationLevel{}
+	for level, config := range doc.Rules.Confirmation {
+		confirmation[parseRiskLevel(level)] = config
+	}
+	// Levels without an override fall back to the built-in mapping.
+	for level, config := range BuiltinConfirmationLevels() {
+		if _, ok := confirmation[parseRiskLevel(level)]; !ok {
+			confirmation[parseRiskLevel(level)] = config
+		}
+	}
+
+	// Escalation is on unless the policy explicitly opts out, so older
+	// guardrail files without the key keep the safer behavior.
+	sudoEscalation := doc.Rules.SudoEscalation == nil || *doc.Rules.SudoEscalation
+
+	guardrail := &Guardrail{
+		patterns:       compiled,
+		pathRules:      doc.Rules.ProtectedPaths,
+		previewLimit:   previewLimit,
+		confirmation:   confirmation,
+		whitelist:      doc.Rules.Whitelist,
+		sudoEscalation: sudoEscalation,
+		terminal:       stdinIsTerminal,
+	}
+	if doc.Rules.NetworkCheck {
+		guardrail.network = sharedNetworkProbe
+	}
+	return guardrail, nil
+}
+
+func compilePatterns(patterns []domain.DangerPattern) ([]compiledPattern, error) {
+	compiled := make([]compiledPattern, 0, len(patterns))
+	for _, pattern := range patterns {
 		re, err := regexp.Compile(pattern.Pattern)
 		if err != nil {
 			return nil, fmt.Errorf("compile pattern %s: %w", pattern.Pattern, err)
@@ -59,38 +109,97 @@ func NewGuardrail(path string) (*Guardrail, error) {
 			rule: pattern,
 		})
 	}
+	return compiled, nil
+}
 
-	previewLimit := doc.Rules.Preview.MaxFiles
-	if previewLimit == 0 {
-		previewLimit = domain.DefaultPreviewMaxFiles
-	}
+// GuardrailProfiles implements ports.SecurityProfiles, loading each profile's
+// rules file once and reusing it for later queries.
+type GuardrailProfiles struct {
+	fallback *Guardrail
+	mu       sync.Mutex
+	loaded   map[string]*Guardrail
+}
 
-	confirmation := map[domain.RiskLevel]domain.ConfirmationLevel{}
-	for level, config := range doc.Rules.Confirmation {
-		confirmation[parseRiskLevel(level)] = config
+// NewGuardrailProfiles builds a resolver that returns fallback for the empty profile.
+func NewGuardrailProfiles(fallback *Guardrail) *GuardrailProfiles {
+	return &GuardrailProfiles{fallback: fallback, loaded: map[string]*Guardrail{}}
+}
+
+// ForProfile implements ports.SecurityProfiles.
+func (p *GuardrailProfiles) ForProfile(cfg domain.Config, profile string) (ports.SecurityService, error) {
+	if profile == "" {
+		return p.fallback, nil
+	}
+	path, ok := cfg.Security.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown guardrail profile %q", profile)
 	}
+	path = securityExpandPath(path)
 
-	return &Guardrail{
-		patterns:     compiled,
-		pathRules:    doc.Rules.ProtectedPaths,
-		previewLimit: previewLimit,
-		confirmation: confirmation,
-		whitelist:    doc.Rules.Whitelist,
-	}, nil
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if guardrail, ok := p.loaded[path]; ok {
+		return guardrail, nil
+	}
+	guardrail, err := NewGuardrail(path)
+	if err != nil {
+		return nil, err
+	}
+	p.loaded[path] = guardrail
+	return guardrail, nil
 }
 
-// Evaluate implements ports.SecurityService.
+// Evaluate implements ports.SecurityService for a command run in the current
+// directory.
 func (g *Guardrail) Evaluate(command string) (domain.RiskAssessment, error) {
+	return g.EvaluateIn(command, "")
+}
+
+// EvaluateIn implements ports.DirSecurityService.
+// Multi-line commands (heredocs, scripts) are assessed one logical line at a
+// time and the most severe result wins, so a whitelisted first line such as
+// "cat <<EOF" cannot hide what follows.
+func (g *Guardrail) EvaluateIn(command, dir string) (domain.RiskAssessment, error) {
 	if g == nil {
 		return domain.RiskAssessment{}, errors.New("guardrail nil")
 	}
-	command = strings.TrimSpace(command)
-	if g.isWhitelisted(command) {
-		return domain.RiskAssessment{
-			Level:  domain.RiskSafe,
-			Action: domain.ActionAllow,
-		}, nil
+	assessment := domain.RiskAssessment{
+		Level:  domain.RiskSafe,
+		Action: domain.ActionAllow,
+	}
+	assessed, noTerminal := false, false
+	for _, line := range logicalLines(command) {
+		tool := g.missingTerminal(line)
+		noTerminal = noTerminal || tool != ""
+		// Whitelisted commands still count when they clobber an existing
+		// file, e.g. "cat a > b", or wait for a missing terminal, e.g. "man ls".
+		if g.isWhitelisted(line) && len(overwrittenFiles(line, dir)) == 0 && tool == "" {
+			continue
+		}
+		mergeAssessment(&assessment, g.assessLine(line, dir))
+		assessed = true
+	}
+	if !assessed {
+		return assessment, nil
+	}
+
+	if levelConfig, ok := g.confirmation[assessment.Level]; ok {
+		assessment.Action = parseAction(levelConfig.Action, assessment.Level)
+		assessment.Reasons = appendUnique(assessment.Reasons, levelConfig.Message)
+	}
+	// Without a terminal the command would hang, and a confirmation could
+	// still be answered by --yes or a model's auto_execute_up_to, so it is
+	// only previewed.
+	if noTerminal && assessment.Action != domain.ActionBlock {
+		assessment.Action = domain.ActionPreviewOnly
 	}
+
+	return assessment, nil
+}
+
+// assessLine runs every check except the confirmation mapping on one line
+// run in dir.
+func (g *Guardrail) assessLine(command, dir string) domain.RiskAssessment {
 	assessment := domain.RiskAssessment{
 		Level:  domain.RiskSafe,
 		Action: domain.ActionAllow,
@@ -104,8 +213,8 @@ func (g *Guardrail) Evaluate(command string) (domain.RiskAssessment, error) {
 				assessment.Level = ruleLevel
 				assessment.Action = parseAction(pattern.rule.Action, ruleLevel)
 			}
-			assessment.Reasons = append(assessment.Reasons, pattern.rule.Message)
-			assessment.MatchedRules = append(assessment.MatchedRules, pattern.rule.Pattern)
+			assessment.Reasons = appendUnique(assessment.Reasons, pattern.rule.Message)
+			assessment.MatchedRules = appendUnique(assessment.MatchedRules, pattern.rule.Pattern)
 		}
 	}
 
@@ -113,21 +222,64 @@ func (g *Guardrail) Evaluate(command string) (domain.RiskAssessment, error) {
 	if moreSevere(pathAssessment.Level, highest) {
 		assessment.Level = pathAssessment.Level
 		assessment.Action = pathAssessment.Action
-		highest = pathAssessment.Level
 	}
-	assessment.Reasons = append(assessment.Reasons, pathAssessment.Reasons...)
-	assessment.ProtectedPaths = append(assessment.ProtectedPaths, pathAssessment.ProtectedPaths...)
-	assessment.PreviewEntries = append(assessment.PreviewEntries, pathAssessment.PreviewEntries...)
+	// Reasons are ordered danger patterns, protected paths, dynamic targets,
+	// overwritten files, a missing terminal, privilege escalation, the offline
+	// warning, then the confirmation message, so the prompter shows the most
+	// specific cause first.
+	assessment.Reasons = appendUnique(assessment.Reasons, pathAssessment.Reasons...)
+	assessment.ProtectedPaths = appendUnique(assessment.ProtectedPaths, pathAssessment.ProtectedPaths...)
+	assessment.PreviewEntries = appendUnique(assessment.PreviewEntries, pathAssessment.PreviewEntries...)
+	checkDynamicTarget(command, &assessment)
+	checkOverwriteTargets(command, dir, &assessment)
+	g.checkInteractive(command, &assessment)
+	if g.sudoEscalation {
+		escalatePrivileged(command, &assessment)
+	}
+	g.checkNetwork(command, &assessment)
 	enrichAssessment(command, &assessment)
+	return assessment
+}
 
-	if levelConfig, ok := g.confirmation[assessment.Level]; ok {
-		assessment.Action = parseAction(levelConfig.Action, assessment.Level)
-		if levelConfig.Message != "" {
-			assessment.Reasons = append(assessment.Reasons, levelConfig.Message)
-		}
+// mergeAssessment folds one line's assessment into the command's, keeping
+// the most severe level and the first dry-run suggestion.
+func mergeAssessment(into *domain.RiskAssessment, line domain.RiskAssessment) {
+	if moreSevere(line.Level, into.Level) {
+		into.Level = line.Level
+		into.Action = line.Action
+	}
+	into.Reasons = appendUnique(into.Reasons, line.Reasons...)
+	into.MatchedRules = appendUnique(into.MatchedRules, line.MatchedRules...)
+	into.ProtectedPaths = appendUnique(into.ProtectedPaths, line.ProtectedPaths...)
+	into.PreviewEntries = appendUnique(into.PreviewEntries, line.PreviewEntries...)
+	into.UndoHints = appendUnique(into.UndoHints, line.UndoHints...)
+	into.NeedsNetwork = into.NeedsNetwork || line.NeedsNetwork
+	if into.DryRunCommand == "" {
+		into.DryRunCommand = line.DryRunCommand
 	}
+}
 
-	return assessment, nil
+// logicalLines splits command on newlines, joining backslash continuations
+// and dropping blank lines. Heredoc bodies are kept as lines of their own.
+func logicalLines(command string) []string {
+	var lines []string
+	var current strings.Builder
+	for _, raw := range strings.Split(strings.ReplaceAll(command, "\r\n", "\n"), "\n") {
+		if rest, ok := strings.CutSuffix(raw, "\\"); ok {
+			current.WriteString(rest)
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(raw)
+		if line := strings.TrimSpace(current.String()); line != "" {
+			lines = append(lines, line)
+		}
+		current.Reset()
+	}
+	if line := strings.TrimSpace(current.String()); line != "" {
+		lines = append(lines, line)
+	}
+	return lines
 }
 
 func loadRules(path string) (PolicyDocument, error) {
@@ -232,15 +384,88 @@ func parseAction(value string, fallback domain.RiskLevel) domain.GuardrailAction
 	}
 }
 
+// riskOrder lists risk levels from least to most severe.
+var riskOrder = []domain.RiskLevel{
+	domain.RiskSafe,
+	domain.RiskLow,
+	domain.RiskMedium,
+	domain.RiskHigh,
+	domain.RiskCritical,
+}
+
 func moreSevere(next domain.RiskLevel, current domain.RiskLevel) bool {
-	order := map[domain.RiskLevel]int{
-		domain.RiskSafe:     0,
-		domain.RiskLow:      1,
-		domain.RiskMedium:   2,
-		domain.RiskHigh:     3,
-		domain.RiskCritical: 4,
+	return riskRank(next) > riskRank(current)
+}
+
+func riskRank(level domain.RiskLevel) int {
+	for i, candidate := range riskOrder {
+		if candidate == level {
+			return i
+		}
+	}
+	return 0
+}
+
+// escalateLevel returns the next more severe risk level, capped at critical.
+func escalateLevel(level domain.RiskLevel) domain.RiskLevel {
+	next := riskRank(level) + 1
+	if next >= len(riskOrder) {
+		return domain.RiskCritical
+	}
+	return riskOrder[next]
+}
+
+// privilegePrefix returns the privilege escalation tool the command starts with, if any.
+func privilegePrefix(command string) string {
+	tokens := strings.Fields(command)
+	if len(tokens) == 0 {
+		return ""
+	}
+	switch tokens[0] {
+	case "sudo", "doas":
+		return tokens[0]
+	default:
+		return ""
+	}
+}
+
+// escalatePrivileged raises the risk by one level for commands run as root,
+// since the inner command's damage is no longer bounded by user permissions.
+func escalatePrivileged(command string, assessment *domain.RiskAssessment) {
+	prefix := privilegePrefix(command)
+	if prefix == "" {
+		return
+	}
+	assessment.Level = escalateLevel(assessment.Level)
+	// The confirmation mapping refines the action afterwards; this only
+	// ensures a previously safe command no longer runs unprompted.
+	if assessment.Action == domain.ActionAllow {
+		assessment.Action = parseAction("", assessment.Level)
 	}
-	return order[next] > order[current]
+	assessment.Reasons = appendUnique(assessment.Reasons, fmt.Sprintf("Runs with elevated privileges (%s)", prefix))
+}
+
+// checkNetwork tags commands that need the network and, when the probe finds
+// no connectivity, adds an advisory reason. The action is never changed.
+func (g *Guardrail) checkNetwork(command string, assessment *domain.RiskAssessment) {
+	if g.network == nil || !needsNetwork(command) {
+		return
+	}
+	assessment.NeedsNetwork = true
+	if !g.network.Online() {
+		assessment.Reasons = appendUnique(assessment.Reasons, "Appears to require network but none detected")
+	}
+}
+
+// appendUnique appends the non-empty items not already in list, preserving order.
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if item == "" || slices.Contains(list, item) {
+			continue
+		}
+		list = append(list, item)
+	}
+	return list
 }
 
 func securityExpandPath(path string) string {
@@ -288,6 +513,27 @@ func defaultConfirmation() map[string]domain.ConfirmationLevel {
 	}
 }
 
+// BuiltinConfirmationLevels returns the confirmation mapping shipped in the
+// embedded default guardrail policy, keyed by risk level name.
+func BuiltinConfirmationLevels() map[string]domain.ConfirmationLevel {
+	var doc PolicyDocument
+	if err := yaml.Unmarshal(assets.DefaultGuardrailYAML, &doc); err != nil || len(doc.Rules.Confirmation) == 0 {
+		return defaultConfirmation()
+	}
+	return doc.Rules.Confirmation
+}
+
+// BuiltinPolicyDocument returns the guardrail policy shipped with shai, the one
+// written on first run. It falls back to DefaultPolicyDocument when the
+// embedded asset cannot be parsed.
+func BuiltinPolicyDocument() PolicyDocument {
+	var doc PolicyDocument
+	if err := yaml.Unmarshal(assets.DefaultGuardrailYAML, &doc); err != nil || len(doc.Rules.DangerPatterns) == 0 {
+		return DefaultPolicyDocument()
+	}
+	return doc
+}
+
 func defaultWhitelist() []string {
 	return []string{"ls", "pwd", "echo", "cat", "grep", "find", "git status"}
 }
@@ -308,6 +554,9 @@ func (g *Guardrail) evaluateProtectedPaths(command string) domain.RiskAssessment
 				result.Level = level
 				result.Action = parseAction(rule.Action, level)
 			}
+			if slices.Contains(result.ProtectedPaths, rule.Path) {
+				continue
+			}
 			result.Reasons = append(result.Reasons, fmt.Sprintf("Operation on protected path %s", rule.Path))
 			result.ProtectedPaths = append(result.ProtectedPaths, rule.Path)
 			preview := previewPath(rule.Path, g.previewLimit)
@@ -357,10 +606,7 @@ func previewPath(path string, limit int) []string {
 		return nil
 	}
 	list := []string{}
-	resolved := path
-	if strings.HasPrefix(path, "$HOME") {
-		resolved = strings.Replace(path, "$HOME", os.Getenv("HOME"), 1)
-	}
+	resolved := expandHome(path)
 	info, err := os.Stat(resolved)
 	if err != nil {
 		return nil
@@ -382,6 +628,17 @@ func previewPath(path string, limit int) []string {
 	return list
 }
 
+// expandHome resolves a leading $HOME or ~ to the user's home directory.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "$HOME") {
+		return strings.Replace(path, "$HOME", os.Getenv("HOME"), 1)
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return os.Getenv("HOME") + path[1:]
+	}
+	return path
+}
+
 func enrichAssessment(command string, assessment *domain.RiskAssessment) {
 	if assessment.Level == domain.RiskSafe {
 		return
@@ -425,7 +682,8 @@ func undoHintsForCommand(command string) []string {
 	return hints
 }
 
-var _ ports.SecurityService = (*Guardrail)(nil)
+var _ ports.DirSecurityService = (*Guardrail)(nil)
+var _ ports.SecurityProfiles = (*GuardrailProfiles)(nil)
 
 // LoadPolicyDocument returns the raw YAML structure.
 func LoadPolicyDocument(path string) (PolicyDocument, error) {
@@ -433,8 +691,40 @@ func LoadPolicyDocument(path string) (PolicyDocument, error) {
 }
 
 // SavePolicyDocument writes the YAML structure to disk.
+// It holds the policy file lock while writing so concurrent saves do not interleave.
 func SavePolicyDocument(path string, doc PolicyDocument) error {
 	path = securityExpandPath(path)
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writePolicyDocument(path, doc)
+}
+
+// UpdatePolicyDocument loads the policy at path, applies mutate and saves the
+// result while holding the policy file lock, so concurrent edits from several
+// shai processes cannot lose each other's changes. Nothing is written when
+// mutate returns an error.
+func UpdatePolicyDocument(path string, mutate func(*PolicyDocument) error) error {
+	path = securityExpandPath(path)
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := loadRules(path)
+	if err != nil {
+		return err
+	}
+	if err := mutate(&doc); err != nil {
+		return err
+	}
+	return writePolicyDocument(path, doc)
+}
+
+func writePolicyDocument(path string, doc PolicyDocument) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
@@ -445,6 +735,30 @@ func SavePolicyDocument(path string, doc PolicyDocument) error {
 	return os.WriteFile(path, data, 0o644)
 }
 
+// DefaultPolicyDocument returns the built-in guardrail policy as an editable document.
+func DefaultPolicyDocument() PolicyDocument {
+	var doc PolicyDocument
+	sudoEscalation := true
+	doc.Rules.DangerPatterns = defaultPatterns()
+	doc.Rules.ProtectedPaths = defaultProtectedPaths()
+	doc.Rules.Preview = domain.PreviewRules{MaxFiles: domain.DefaultPreviewMaxFiles}
+	doc.Rules.Confirmation = defaultConfirmation()
+	doc.Rules.Whitelist = defaultWhitelist()
+	doc.Rules.SudoEscalation = &sudoEscalation
+	return doc
+}
+
+// ValidatePolicyDocument checks that every danger pattern compiles.
+func ValidatePolicyDocument(doc PolicyDocument) error {
+	_, err := compilePatterns(doc.Rules.DangerPatterns)
+	return err
+}
+
+// BackupPolicyDocument copies the guardrail file at path to a timestamped backup.
+func BackupPolicyDocument(path string) (string, error) {
+	return backupFile(securityExpandPath(path))
+}
+
 // ResolveRulesPath expands the guardrail path to an absolute location.
 func ResolveRulesPath(path string) string {
 	return securityExpandPath(path)
@@ -0,0 +1,89 @@
+package infrastructure
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PolicyWarning is a lint finding about one entry of a guardrail policy.
+type PolicyWarning struct {
+	// Section is the policy list holding the entry, e.g. "danger_patterns".
+	Section string
+	Entry   string
+	Message string
+}
+
+func (w PolicyWarning) String() string {
+	return fmt.Sprintf("%s: %q: %s", w.Section, w.Entry, w.Message)
+}
+
+// LintPolicyDocument reports rules in doc that are weak, redundant or
+// contradict each other: patterns that do not compile or match every command,
+// duplicates, whitelist entries that skip a danger pattern, and protected
+// paths that can never match.
+func LintPolicyDocument(doc PolicyDocument) []PolicyWarning {
+	var warnings []PolicyWarning
+	var patterns []compiledPattern
+	for _, pattern := range doc.Rules.DangerPatterns {
+		re, err := regexp.Compile(pattern.Pattern)
+		switch {
+		case err != nil:
+			warnings = append(warnings, PolicyWarning{"danger_patterns", pattern.Pattern, fmt.Sprintf("does not compile: %v", err)})
+			continue
+		case re.MatchString(""):
+			warnings = append(warnings, PolicyWarning{"danger_patterns", pattern.Pattern,
+				"matches the empty string, so it flags every command; anchor it to a command"})
+			// Every whitelist entry would contradict it; one warning is enough.
+			continue
+		}
+		patterns = append(patterns, compiledPattern{re: re, rule: pattern})
+	}
+
+	warnings = append(warnings, duplicateEntries("danger_patterns", len(doc.Rules.DangerPatterns), func(i int) string {
+		return doc.Rules.DangerPatterns[i].Pattern
+	})...)
+	warnings = append(warnings, duplicateEntries("whitelist", len(doc.Rules.Whitelist), func(i int) string {
+		return doc.Rules.Whitelist[i]
+	})...)
+	warnings = append(warnings, duplicateEntries("protected_paths", len(doc.Rules.ProtectedPaths), func(i int) string {
+		return doc.Rules.ProtectedPaths[i].Path
+	})...)
+
+	for _, entry := range doc.Rules.Whitelist {
+		if strings.TrimSpace(entry) == "" {
+			warnings = append(warnings, PolicyWarning{"whitelist", entry, "is empty and never matches"})
+			continue
+		}
+		for _, pattern := range patterns {
+			if pattern.re.MatchString(entry) {
+				warnings = append(warnings, PolicyWarning{"whitelist", entry, fmt.Sprintf(
+					"matches danger pattern %q (%s), which is skipped for whitelisted commands", pattern.rule.Pattern, pattern.rule.Level)})
+			}
+		}
+	}
+
+	for _, rule := range doc.Rules.ProtectedPaths {
+		switch {
+		case rule.Path == "":
+			warnings = append(warnings, PolicyWarning{"protected_paths", rule.Path, "has no path and never matches"})
+		case len(rule.Operations) == 0:
+			warnings = append(warnings, PolicyWarning{"protected_paths", rule.Path, "has no operations and never matches; list commands such as rm or mv"})
+		}
+	}
+	return warnings
+}
+
+// duplicateEntries warns once about each value that appears more than once
+// among the n entries of section.
+func duplicateEntries(section string, n int, value func(int) string) []PolicyWarning {
+	var warnings []PolicyWarning
+	counts := map[string]int{}
+	for i := range n {
+		counts[value(i)]++
+		if counts[value(i)] == 2 {
+			warnings = append(warnings, PolicyWarning{section, value(i), "is listed more than once"})
+		}
+	}
+	return warnings
+}
@@ -1,7 +1,15 @@
 package infrastructure
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
 )
@@ -92,3 +100,600 @@ func TestUndoHintsForCommand(t *testing.T) {
 		t.Fatalf("expected multiple hints, got %v", hints)
 	}
 }
+
+func TestGuardrailEscalatesSudoCommands(t *testing.T) {
+	guardrail, err := NewGuardrail(filepath.Join(t.TempDir(), "guardrail.yaml"))
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+
+	tests := []struct {
+		give string
+		want domain.RiskLevel
+	}{
+		{"chmod 777 script.sh", domain.RiskMedium},
+		{"sudo chmod 777 script.sh", domain.RiskHigh},
+		{"doas chmod 777 script.sh", domain.RiskHigh},
+		{"touch notes.txt", domain.RiskSafe},
+		{"sudo touch notes.txt", domain.RiskLow},
+		{"rm -rf /", domain.RiskCritical},
+		{"sudo rm -rf /", domain.RiskCritical},
+	}
+	for _, tt := range tests {
+		result, err := guardrail.Evaluate(tt.give)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) error: %v", tt.give, err)
+		}
+		if result.Level != tt.want {
+			t.Errorf("Evaluate(%q) level = %s, want %s", tt.give, result.Level, tt.want)
+		}
+	}
+
+	result, err := guardrail.Evaluate("sudo touch notes.txt")
+	if err != nil {
+		t.Fatalf("Evaluate error: %v", err)
+	}
+	if result.Action == domain.ActionAllow {
+		t.Fatalf("escalated command should require confirmation, got %+v", result)
+	}
+}
+
+func TestGuardrailSudoEscalationDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guardrail.yaml")
+	policy := "rules:\n  sudo_escalation: false\n"
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	guardrail, err := NewGuardrail(path)
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+
+	plain, err := guardrail.Evaluate("chmod 777 script.sh")
+	if err != nil {
+		t.Fatalf("Evaluate error: %v", err)
+	}
+	elevated, err := guardrail.Evaluate("sudo chmod 777 script.sh")
+	if err != nil {
+		t.Fatalf("Evaluate error: %v", err)
+	}
+	if plain.Level != elevated.Level {
+		t.Fatalf("expected same level with escalation disabled, got %s and %s", plain.Level, elevated.Level)
+	}
+}
+
+func TestGuardrailReasonsAreDedupedAndOrdered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guardrail.yaml")
+	policy := `rules:
+  danger_patterns:
+    - pattern: "rm\\s+-rf"
+      level: high
+      message: "Recursive delete"
+      action: confirm
+    - pattern: "rm\\s+-rf\\s+/etc"
+      level: high
+      message: "Recursive delete"
+      action: confirm
+    - pattern: "/etc"
+      level: medium
+      message: ""
+      action: confirm
+  protected_paths:
+    - path: /etc
+      operations: [rm]
+      level: high
+      action: confirm
+    - path: /etc
+      operations: [rm]
+      level: high
+      action: confirm
+  confirmation_levels:
+    critical:
+      action: explicit_confirm
+      message: "Critical: double-check the target"
+  whitelist: ["true"]
+`
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	guardrail, err := NewGuardrail(path)
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+
+	risk, err := guardrail.Evaluate("sudo rm -rf /etc/nginx")
+	if err != nil {
+		t.Fatalf("Evaluate error: %v", err)
+	}
+
+	wantReasons := []string{
+		"Recursive delete",
+		"Operation on protected path /etc",
+		"Runs with elevated privileges (sudo)",
+		"Critical: double-check the target",
+	}
+	if strings.Join(risk.Reasons, "|") != strings.Join(wantReasons, "|") {
+		t.Errorf("Reasons = %q, want %q", risk.Reasons, wantReasons)
+	}
+	if len(risk.MatchedRules) != 3 {
+		t.Errorf("MatchedRules = %q, want 3 distinct patterns", risk.MatchedRules)
+	}
+	if len(risk.ProtectedPaths) != 1 {
+		t.Errorf("ProtectedPaths = %q, want [/etc]", risk.ProtectedPaths)
+	}
+}
+
+func TestGuardrailProfilesResolveNamedPolicy(t *testing.T) {
+	dir := t.TempDir()
+	fallback, err := NewGuardrail(filepath.Join(dir, "guardrail.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	relaxed := filepath.Join(dir, "relaxed.yaml")
+	policy := "rules:\n  danger_patterns:\n    - pattern: 'never-matches-anything'\n      level: low\n      action: allow\n  whitelist: [\"rm -rf ./build\"]\n"
+	if err := os.WriteFile(relaxed, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := domain.Config{Security: domain.SecuritySettings{Profiles: map[string]string{"relaxed": relaxed}}}
+	profiles := NewGuardrailProfiles(fallback)
+
+	tests := []struct {
+		profile    string
+		wantAction domain.GuardrailAction
+		wantErr    string
+	}{
+		{profile: "relaxed", wantAction: domain.ActionAllow},
+		{profile: "", wantAction: domain.ActionBlock},
+		{profile: "missing", wantErr: `unknown guardrail profile "missing"`},
+	}
+
+	for _, tt := range tests {
+		t.Run("profile="+tt.profile, func(t *testing.T) {
+			security, err := profiles.ForProfile(cfg, tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ForProfile error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ForProfile error: %v", err)
+			}
+			risk, err := security.Evaluate("rm -rf ./build")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if risk.Action != tt.wantAction {
+				t.Errorf("action = %s, want %s (%v)", risk.Action, tt.wantAction, risk.Reasons)
+			}
+		})
+	}
+}
+
+func TestGuardrailNetworkCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guardrail.yaml")
+	policy := "rules:\n  network_check: true\n  whitelist: [\"pwd\"]\n"
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	guardrail, err := NewGuardrail(path)
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+	if guardrail.network == nil {
+		t.Fatal("network_check: true should enable the probe")
+	}
+
+	const offlineReason = "Appears to require network but none detected"
+	tests := []struct {
+		name        string
+		command     string
+		online      bool
+		wantNetwork bool
+		wantReason  bool
+	}{
+		{name: "curl offline", command: "curl -fsSL https://example.com", wantNetwork: true, wantReason: true},
+		{name: "sudo apt install offline", command: "sudo apt install jq", wantNetwork: true, wantReason: true},
+		{name: "npm install online", command: "npm install", online: true, wantNetwork: true},
+		{name: "local command", command: "du -sh *"},
+		{name: "npm local script", command: "npm run build"},
+		{name: "git local", command: "git commit -m wip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := 0
+			guardrail.network = &networkProbe{dial: func() bool { probes++; return tt.online }}
+
+			risk, err := guardrail.Evaluate(tt.command)
+			if err != nil {
+				t.Fatalf("Evaluate error: %v", err)
+			}
+			if risk.NeedsNetwork != tt.wantNetwork {
+				t.Errorf("NeedsNetwork = %v, want %v", risk.NeedsNetwork, tt.wantNetwork)
+			}
+			if got := slices.Contains(risk.Reasons, offlineReason); got != tt.wantReason {
+				t.Errorf("offline reason present = %v, want %v (reasons %q)", got, tt.wantReason, risk.Reasons)
+			}
+			if _, err := guardrail.Evaluate(tt.command); err != nil {
+				t.Fatalf("Evaluate error: %v", err)
+			}
+			if probes > 1 {
+				t.Errorf("probe ran %d times, want the result cached", probes)
+			}
+		})
+	}
+}
+
+func TestGuardrailNetworkCheckDisabledByDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guardrail.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n  whitelist: [\"pwd\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	guardrail, err := NewGuardrail(path)
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+	risk, err := guardrail.Evaluate("curl https://example.com")
+	if err != nil {
+		t.Fatalf("Evaluate error: %v", err)
+	}
+	if risk.NeedsNetwork {
+		t.Error("NeedsNetwork should stay false when network_check is off")
+	}
+}
+
+func TestGuardrailFlagsDynamicTargets(t *testing.T) {
+	guardrail, err := NewGuardrail(filepath.Join(t.TempDir(), "guardrail.yaml"))
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+
+	tests := []struct {
+		give    string
+		dynamic bool
+	}{
+		{`rm -rf "$(cat target.txt)"`, true},
+		{"rm -rf `cat target.txt`", true},
+		{"rm -rf ${DIR}", true},
+		{"rm -r $1", true},
+		{"cd build && rm -fr $BUILD_DIR/out", true},
+		{"dd of=$DEVICE bs=4M", true},
+		{"mkfs.ext4 $(lsblk -no path | head -1)", true},
+		{"sudo rm -rf $DIR", true},
+		{"rm -rf build", false},
+		{"rm $TMPFILE", false},
+		{"echo rm -rf $DIR", false},
+		{"rm -rf build; echo $DIR", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			result, err := guardrail.Evaluate(tt.give)
+			if err != nil {
+				t.Fatalf("Evaluate error: %v", err)
+			}
+			dynamic := slices.ContainsFunc(result.Reasons, func(reason string) bool {
+				return strings.Contains(reason, "is dynamic")
+			})
+			if dynamic != tt.dynamic {
+				t.Errorf("dynamic reason = %v, want %v (reasons %q)", dynamic, tt.dynamic, result.Reasons)
+			}
+			if !tt.dynamic {
+				return
+			}
+			if moreSevere(domain.RiskMedium, result.Level) {
+				t.Errorf("level = %s, want at least medium", result.Level)
+			}
+			if result.Action == domain.ActionAllow {
+				t.Errorf("dynamic target should not be allowed unprompted, got %+v", result)
+			}
+		})
+	}
+
+	result, err := guardrail.Evaluate("rm -rf ${DIR}")
+	if err != nil {
+		t.Fatalf("Evaluate error: %v", err)
+	}
+	if result.Level != domain.RiskMedium {
+		t.Errorf("rm -rf ${DIR} level = %s, want medium", result.Level)
+	}
+}
+
+func TestGuardrailWarnsOnInteractiveWithoutTTY(t *testing.T) {
+	guardrail, err := NewGuardrail(filepath.Join(t.TempDir(), "guardrail.yaml"))
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+
+	tests := []struct {
+		give     string
+		terminal bool
+		tool     string
+	}{
+		{give: "vim notes.txt", tool: "vim"},
+		{give: "top", tool: "top"},
+		{give: "ssh deploy@web-1", tool: "ssh"},
+		{give: "ssh -p 2222 web-1", tool: "ssh"},
+		{give: "psql mydb", tool: "psql"},
+		{give: "man ls", tool: "man"},
+		{give: "git log | less", tool: "less"},
+		{give: "/usr/bin/python3", tool: "python3"},
+		{give: "vim notes.txt", terminal: true},
+		{give: "ssh web-1 uptime"},
+		{give: "psql -c 'select 1' mydb"},
+		{give: "top -b -n 1"},
+		{give: "python3 script.py"},
+		{give: "echo 'select 1' | psql mydb"},
+		{give: "mysql app < dump.sql"},
+		{give: "git status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			guardrail.terminal = func() bool { return tt.terminal }
+			result, err := guardrail.Evaluate(tt.give)
+			if err != nil {
+				t.Fatalf("Evaluate error: %v", err)
+			}
+			warned := slices.ContainsFunc(result.Reasons, func(reason string) bool {
+				return strings.Contains(reason, "needs an interactive terminal")
+			})
+			if warned != (tt.tool != "") {
+				t.Fatalf("terminal warning = %v, want %v (reasons %q)", warned, tt.tool != "", result.Reasons)
+			}
+			if tt.tool == "" {
+				return
+			}
+			if !strings.HasPrefix(result.Reasons[0], tt.tool+" ") {
+				t.Errorf("reason %q does not name %s", result.Reasons[0], tt.tool)
+			}
+			if result.Action != domain.ActionPreviewOnly {
+				t.Errorf("interactive command without a TTY should only be previewed, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestGuardrailWarnsOnOverwrite(t *testing.T) {
+	guardrail, err := NewGuardrail(filepath.Join(t.TempDir(), "guardrail.yaml"))
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(existing, []byte("keep me\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	missing := filepath.Join(dir, "new.txt")
+
+	tests := []struct {
+		give      string
+		overwrite bool
+	}{
+		{"echo hello > " + existing, true},
+		{"sort input.txt >" + existing, true},
+		{"make 2>" + existing, true},
+		{"date | tee " + existing, true},
+		{"cp " + missing + " " + existing, true},
+		{"cp notes.txt " + dir, true},
+		{"echo hello >> " + existing, false},
+		{"date | tee -a " + existing, false},
+		{"cp -n a.txt " + existing, false},
+		{"echo hello > " + missing, false},
+		{"make 2>&1", false},
+		{"cat " + existing, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			result, err := guardrail.Evaluate(tt.give)
+			if err != nil {
+				t.Fatalf("Evaluate error: %v", err)
+			}
+			overwrite := slices.ContainsFunc(result.Reasons, func(reason string) bool {
+				return strings.Contains(reason, "exists and will be overwritten")
+			})
+			if overwrite != tt.overwrite {
+				t.Errorf("overwrite reason = %v, want %v (reasons %q)", overwrite, tt.overwrite, result.Reasons)
+			}
+			if tt.overwrite && result.Action == domain.ActionAllow {
+				t.Errorf("overwrite should be confirmed, got %+v", result)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(existing)
+	if err != nil || string(data) != "keep me\n" {
+		t.Errorf("evaluation modified the target: %q, %v", data, err)
+	}
+}
+
+func TestGuardrailResolvesOverwriteInWorkDir(t *testing.T) {
+	guardrail, err := NewGuardrail(filepath.Join(t.TempDir(), "guardrail.yaml"))
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "notes.txt"), []byte("keep me\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(workDir, "backup"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "backup", "notes.txt"), []byte("old\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	// The process stays in a directory without these files.
+	t.Chdir(t.TempDir())
+
+	tests := []struct {
+		give string
+		dir  string
+		want bool
+	}{
+		{give: "echo hello > notes.txt", dir: workDir, want: true},
+		{give: "cp notes.txt backup", dir: workDir, want: true},
+		{give: "echo hello > notes.txt", want: false},
+		{give: "cp notes.txt backup", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.give+" in "+tt.dir, func(t *testing.T) {
+			result, err := guardrail.EvaluateIn(tt.give, tt.dir)
+			if err != nil {
+				t.Fatalf("EvaluateIn error: %v", err)
+			}
+			overwrite := slices.ContainsFunc(result.Reasons, func(reason string) bool {
+				return strings.Contains(reason, "exists and will be overwritten")
+			})
+			if overwrite != tt.want {
+				t.Errorf("overwrite reason = %v, want %v (reasons %q)", overwrite, tt.want, result.Reasons)
+			}
+		})
+	}
+}
+
+func TestGuardrailEvaluatesEachLine(t *testing.T) {
+	guardrail, err := NewGuardrail(filepath.Join(t.TempDir(), "guardrail.yaml"))
+	if err != nil {
+		t.Fatalf("NewGuardrail error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		give string
+		safe bool
+	}{
+		{name: "whitelisted heredoc", give: "cat <<EOF\nhello\nEOF", safe: true},
+		{name: "heredoc hides rm", give: "cat <<EOF | sh\nrm -rf /\nEOF", safe: false},
+		{name: "whitelisted first line", give: "ls -la\nchmod 777 script.sh", safe: false},
+		{name: "continuation", give: "chmod \\\n  777 script.sh", safe: false},
+		{name: "blank lines", give: "\n\npwd\n\n", safe: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := guardrail.Evaluate(tt.give)
+			if err != nil {
+				t.Fatalf("Evaluate error: %v", err)
+			}
+			if (result.Level == domain.RiskSafe) != tt.safe {
+				t.Errorf("level = %s, want safe=%v (reasons %q)", result.Level, tt.safe, result.Reasons)
+			}
+		})
+	}
+}
+
+func TestLogicalLines(t *testing.T) {
+	got := logicalLines("cat <<EOF\r\nline one\n\nEOF\necho a \\\n  b")
+	want := []string{"cat <<EOF", "line one", "EOF", "echo a    b"}
+	if !slices.Equal(got, want) {
+		t.Errorf("logicalLines = %q, want %q", got, want)
+	}
+}
+
+func TestUpdatePolicyDocumentConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guardrail.yaml")
+	if err := SavePolicyDocument(path, DefaultPolicyDocument()); err != nil {
+		t.Fatalf("SavePolicyDocument error: %v", err)
+	}
+
+	const writers = 2
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = UpdatePolicyDocument(path, func(doc *PolicyDocument) error {
+				// Widen the read-modify-write window to force an overlap.
+				time.Sleep(20 * time.Millisecond)
+				doc.Rules.Whitelist = append(doc.Rules.Whitelist, fmt.Sprintf("cmd-%d", i))
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("UpdatePolicyDocument %d error: %v", i, err)
+		}
+	}
+
+	doc, err := LoadPolicyDocument(path)
+	if err != nil {
+		t.Fatalf("LoadPolicyDocument error: %v", err)
+	}
+	for i := range writers {
+		if want := fmt.Sprintf("cmd-%d", i); !slices.Contains(doc.Rules.Whitelist, want) {
+			t.Errorf("update %q lost, whitelist %q", want, doc.Rules.Whitelist)
+		}
+	}
+	if _, err := os.Stat(lockPath(path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestLintPolicyDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(doc *PolicyDocument)
+		want []string
+	}{
+		{name: "clean policy", edit: func(doc *PolicyDocument) {}},
+		{
+			name: "match everything",
+			edit: func(doc *PolicyDocument) {
+				doc.Rules.DangerPatterns = append(doc.Rules.DangerPatterns, domain.DangerPattern{Pattern: ".*", Level: "high"})
+			},
+			want: []string{`danger_patterns: ".*": matches the empty string`},
+		},
+		{
+			name: "does not compile",
+			edit: func(doc *PolicyDocument) {
+				doc.Rules.DangerPatterns = append(doc.Rules.DangerPatterns, domain.DangerPattern{Pattern: "rm (-rf", Level: "high"})
+			},
+			want: []string{`danger_patterns: "rm (-rf": does not compile`},
+		},
+		{
+			name: "duplicates",
+			edit: func(doc *PolicyDocument) {
+				doc.Rules.DangerPatterns = append(doc.Rules.DangerPatterns, doc.Rules.DangerPatterns[0])
+				doc.Rules.Whitelist = append(doc.Rules.Whitelist, "ls", "ls")
+			},
+			want: []string{
+				fmt.Sprintf("danger_patterns: %q: is listed more than once", BuiltinPolicyDocument().Rules.DangerPatterns[0].Pattern),
+				`whitelist: "ls": is listed more than once`,
+			},
+		},
+		{
+			name: "whitelist contradicts pattern",
+			edit: func(doc *PolicyDocument) {
+				doc.Rules.DangerPatterns = append(doc.Rules.DangerPatterns, domain.DangerPattern{Pattern: `^make\s+deploy`, Level: "high"})
+				doc.Rules.Whitelist = append(doc.Rules.Whitelist, "make deploy")
+			},
+			want: []string{`whitelist: "make deploy": matches danger pattern "^make\\s+deploy" (high)`},
+		},
+		{
+			name: "protected path without operations",
+			edit: func(doc *PolicyDocument) {
+				doc.Rules.ProtectedPaths = append(doc.Rules.ProtectedPaths, domain.ProtectedPath{Path: "/srv/data", Level: "high"})
+			},
+			want: []string{`protected_paths: "/srv/data": has no operations`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := BuiltinPolicyDocument()
+			tt.edit(&doc)
+			var got []string
+			for _, warning := range LintPolicyDocument(doc) {
+				got = append(got, warning.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LintPolicyDocument() = %q, want %d warnings", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("warning %d = %q, want prefix %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -1,26 +1,36 @@
 package infrastructure
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	rootassets "github.com/doeshing/shai-go/assets"
 	"github.com/doeshing/shai-go/internal/domain"
 	"github.com/doeshing/shai-go/internal/pkg/filesystem"
 	"github.com/doeshing/shai-go/internal/ports"
+	"github.com/doeshing/shai-go/internal/version"
 )
 
+// binaryVersionTimeout bounds how long the installed binary may take to print its version.
+const binaryVersionTimeout = 5 * time.Second
+
 // Installer handles shell script deployment.
 type Installer struct {
-	logger ports.Logger
+	logger     ports.Logger
+	executable func() (string, error)
 }
 
 // NewInstaller builds a shell installer.
 func NewInstaller(logger ports.Logger) *Installer {
-	return &Installer{logger: logger}
+	return &Installer{logger: logger, executable: os.Executable}
 }
 
 // Install installs shell integration for the given shell name (auto-detected when empty).
@@ -97,6 +107,10 @@ func (i *Installer) Status(shell string) domain.ShellStatus {
 
 	if info, err := os.Stat(scriptPath); err == nil && info.Mode().IsRegular() {
 		status.ScriptExists = true
+		if contents, err := os.ReadFile(scriptPath); err == nil {
+			embedded, _ := scriptFor(name)
+			status.ScriptCurrent = string(contents) == embedded
+		}
 	}
 
 	line := sourceLine(scriptPath)
@@ -108,6 +122,59 @@ func (i *Installer) Status(shell string) domain.ShellStatus {
 	return status
 }
 
+// BinaryStatus compares the installed binary with the running executable, first
+// by contents and then by the version it reports.
+func (i *Installer) BinaryStatus(ctx context.Context) domain.BinaryStatus {
+	status := domain.BinaryStatus{
+		Path:           installedBinaryPath(),
+		RunningVersion: version.Version,
+	}
+	installed, err := os.ReadFile(status.Path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			status.Error = err.Error()
+		}
+		return status
+	}
+	status.Exists = true
+
+	if running, err := i.executable(); err == nil {
+		if contents, err := os.ReadFile(running); err == nil {
+			status.SameBinary = bytes.Equal(contents, installed)
+		}
+	}
+	if status.SameBinary {
+		status.InstalledVersion = status.RunningVersion
+		return status
+	}
+
+	installedVersion, err := binaryVersion(ctx, status.Path)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.InstalledVersion = installedVersion
+	return status
+}
+
+// binaryVersion runs "<path> version" and parses the "SHAI version X" line.
+func binaryVersion(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, binaryVersionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("run %s version: %w", path, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "SHAI version "); ok {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized version output from %s", path)
+}
+
 // DetectShell inspects the SHELL env var.
 func (i *Installer) DetectShell() string {
 	return os.Getenv("SHELL")
@@ -150,6 +217,10 @@ func scriptPaths(shell domain.ShellName) (string, string) {
 	}
 }
 
+func installedBinaryPath() string {
+	return filepath.Join(filesystem.UserHomeDir(), ".shai", "bin", "shai")
+}
+
 func ensureRCLine(path string, line string, force bool) (bool, error) {
 	contents, err := os.ReadFile(path)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
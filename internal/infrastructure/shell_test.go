@@ -0,0 +1,87 @@
+package infrastructure
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rootassets "github.com/doeshing/shai-go/assets"
+	"github.com/doeshing/shai-go/internal/version"
+)
+
+func TestInstallerStatusDetectsStaleHook(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	scriptPath := filepath.Join(home, ".shai", "shell", "zsh.sh")
+	if err := os.MkdirAll(filepath.Dir(scriptPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		want   bool
+	}{
+		{name: "current", script: rootassets.ZshHook, want: true},
+		{name: "stale", script: "# hook from an older release\n", want: false},
+	}
+
+	installer := NewInstaller(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(scriptPath, []byte(tt.script), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			status := installer.Status("zsh")
+			if !status.ScriptExists {
+				t.Fatalf("expected script at %s", scriptPath)
+			}
+			if status.ScriptCurrent != tt.want {
+				t.Errorf("ScriptCurrent = %v, want %v", status.ScriptCurrent, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallerBinaryStatus(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	binPath := filepath.Join(home, ".shai", "bin", "shai")
+	if err := os.MkdirAll(filepath.Dir(binPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	running := filepath.Join(t.TempDir(), "shai")
+	if err := os.WriteFile(running, []byte("running build"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	installer := NewInstaller(nil)
+	installer.executable = func() (string, error) { return running, nil }
+
+	if status := installer.BinaryStatus(context.Background()); status.Exists {
+		t.Fatalf("expected missing binary, got %+v", status)
+	}
+
+	stale := "#!/bin/sh\necho 'SHAI version 0.0.1-old'\n"
+	if err := os.WriteFile(binPath, []byte(stale), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	status := installer.BinaryStatus(context.Background())
+	if !status.Exists || status.SameBinary {
+		t.Fatalf("expected a different installed binary, got %+v", status)
+	}
+	if status.InstalledVersion != "0.0.1-old" {
+		t.Errorf("InstalledVersion = %q, want 0.0.1-old", status.InstalledVersion)
+	}
+	if status.RunningVersion != version.Version {
+		t.Errorf("RunningVersion = %q, want %q", status.RunningVersion, version.Version)
+	}
+
+	if err := os.WriteFile(binPath, []byte("running build"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if status := installer.BinaryStatus(context.Background()); !status.SameBinary {
+		t.Errorf("expected identical binary, got %+v", status)
+	}
+}
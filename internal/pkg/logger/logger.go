@@ -1,12 +1,15 @@
 package logger
 
 import (
+	"io"
 	"log"
 )
 
 // StdLogger is a lightweight implementation backed by Go's log package.
 type StdLogger struct {
 	verbose bool
+	// out receives the lines; nil uses the standard logger.
+	out *log.Logger
 }
 
 // NewStd creates a StdLogger.
@@ -14,30 +17,52 @@ func NewStd(verbose bool) *StdLogger {
 	return &StdLogger{verbose: verbose}
 }
 
+// New creates a StdLogger that writes to out instead of the standard logger.
+func New(out io.Writer, verbose bool) *StdLogger {
+	return &StdLogger{verbose: verbose, out: log.New(out, "", log.LstdFlags)}
+}
+
+// SetVerbose turns debug lines on or off.
+func (l *StdLogger) SetVerbose(verbose bool) {
+	l.verbose = verbose
+}
+
+// println writes one line, leaving out fields when there are none.
+func (l *StdLogger) println(v ...interface{}) {
+	if fields, ok := v[len(v)-1].(map[string]interface{}); ok && len(fields) == 0 {
+		v = v[:len(v)-1]
+	}
+	if l.out != nil {
+		l.out.Println(v...)
+		return
+	}
+	log.Println(v...)
+}
+
 func (l *StdLogger) Debug(msg string, fields map[string]interface{}) {
 	if !l.verbose {
 		return
 	}
-	log.Println("[DEBUG]", msg, fields)
+	l.println("[DEBUG]", msg, fields)
 }
 
 func (l *StdLogger) Info(msg string, fields map[string]interface{}) {
 	if !l.verbose {
 		return
 	}
-	log.Println("[INFO]", msg, fields)
+	l.println("[INFO]", msg, fields)
 }
 
 func (l *StdLogger) Warn(msg string, fields map[string]interface{}) {
 	if !l.verbose {
 		return
 	}
-	log.Println("[WARN]", msg, fields)
+	l.println("[WARN]", msg, fields)
 }
 
 func (l *StdLogger) Error(msg string, err error, fields map[string]interface{}) {
 	if !l.verbose {
 		return
 	}
-	log.Println("[ERROR]", msg, err, fields)
+	l.println("[ERROR]", msg, err, fields)
 }
@@ -0,0 +1,60 @@
+// Package redact masks sensitive text before it reaches logs and debug output.
+package redact
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// Marker replaces secrets in logs and debug output.
+const Marker = "***"
+
+// minSecretLen is the shortest value Secrets masks. Very short values would
+// mask unrelated text without protecting anything.
+const minSecretLen = 4
+
+// Secrets replaces every literal occurrence of each secret in text with Marker.
+func Secrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if len(secret) < minSecretLen {
+			continue
+		}
+		text = strings.ReplaceAll(text, secret, Marker)
+	}
+	return text
+}
+
+// secretNameMarkers identify variables whose values must never be shown.
+var secretNameMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD"}
+
+// SecretName reports whether a variable name looks like it holds a secret.
+func SecretName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, marker := range secretNameMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvSecrets returns the values of the KEY=value entries in environ whose
+// names look like secrets, for use with Secrets.
+func EnvSecrets(environ []string) []string {
+	var secrets []string
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if ok && SecretName(name) {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+// Digest summarizes text by length and a short SHA-256 prefix, so log lines
+// can be correlated without revealing what was typed.
+func Digest(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("[%d chars, sha256:%x]", len(text), sum[:6])
+}
@@ -13,6 +13,7 @@ package ports
 
 import (
 	"context"
+	"errors"
 
 	"github.com/doeshing/shai-go/internal/domain"
 )
@@ -43,15 +44,28 @@ type Provider interface {
 	Generate(context.Context, ProviderRequest) (ProviderResponse, error)
 }
 
+// RuleBasedProvider is a Provider that answers from fixed rules instead of a
+// language model, so it cannot follow free-form Messages such as a request to
+// explain a command's risk.
+type RuleBasedProvider interface {
+	Provider
+	RuleBased()
+}
+
 // ProviderRequest contains all data needed to generate an AI response.
 // This includes the user's prompt, environmental context, and generation parameters.
 type ProviderRequest struct {
-	Prompt       string
-	Context      domain.ContextSnapshot
-	Model        domain.ModelDefinition
-	Debug        bool
-	Stream       bool
-	StreamWriter domain.StreamWriter
+	Prompt          string
+	Context         domain.ContextSnapshot
+	ContextBudget   int
+	SanitizeContext bool
+	SystemPreamble  string
+	Model           domain.ModelDefinition
+	Debug           bool
+	Stream          bool
+	StreamWriter    domain.StreamWriter
+	// Messages, when set, are sent as-is instead of the model's rendered prompt.
+	Messages []domain.PromptMessage
 }
 
 // ProviderResponse contains the AI's generated command and explanatory text.
@@ -68,11 +82,38 @@ type SecurityService interface {
 	Evaluate(command string) (domain.RiskAssessment, error)
 }
 
+// DirSecurityService is a SecurityService that resolves relative paths, such
+// as the file a redirect overwrites, against the directory the command runs
+// in. QueryService uses EvaluateIn when a request sets a working directory.
+type DirSecurityService interface {
+	SecurityService
+	EvaluateIn(command, dir string) (domain.RiskAssessment, error)
+}
+
+// SecurityProfiles resolves the guardrail policy for a model's named profile.
+// The empty profile resolves to the default policy; an unknown one is an error.
+type SecurityProfiles interface {
+	ForProfile(cfg domain.Config, profile string) (SecurityService, error)
+}
+
 // CommandExecutor runs shell commands in the configured shell environment.
+// An empty dir runs the command in the current working directory; env holds
+// variables set for this command on top of the inherited environment.
 type CommandExecutor interface {
-	Execute(ctx context.Context, command string) (domain.ExecutionResult, error)
+	Execute(ctx context.Context, command string, dir string, env map[string]string) (domain.ExecutionResult, error)
 }
 
+// ShellExecutor is a CommandExecutor that reports the shell it runs commands
+// with, so QueryService can tell when a command was written for another one.
+type ShellExecutor interface {
+	CommandExecutor
+	Shell() string
+}
+
+// ErrConfirmationTimeout is returned by ConfirmationPrompter.Confirm when no
+// answer arrived in time. Callers treat it as a refusal.
+var ErrConfirmationTimeout = errors.New("confirmation timed out")
+
 // ConfirmationPrompter handles interactive user confirmations for risky operations.
 // Used by the guardrail system to get user approval before executing dangerous commands.
 type ConfirmationPrompter interface {
@@ -80,6 +121,15 @@ type ConfirmationPrompter interface {
 	Enabled() bool
 }
 
+// ChoicePrompter is a ConfirmationPrompter that lets the user run, edit, copy
+// or abort a command instead of answering yes or no. QueryService uses Choose
+// when its prompter implements it, and Edit when the user picks ChoiceEdit.
+type ChoicePrompter interface {
+	ConfirmationPrompter
+	Choose(action domain.GuardrailAction, risk domain.RiskLevel, command string, reasons []string) (domain.ExecutionChoice, error)
+	Edit(command string) (string, error)
+}
+
 // Clipboard provides cross-platform clipboard integration for copying commands.
 // Allows users to copy generated commands without manually selecting text.
 type Clipboard interface {
@@ -93,6 +143,7 @@ type ShellIntegrator interface {
 	Install(shell string, force bool) (domain.ShellInstallResult, error)
 	Uninstall(shell string) (domain.ShellInstallResult, error)
 	Status(shell string) domain.ShellStatus
+	BinaryStatus(ctx context.Context) domain.BinaryStatus
 	DetectShell() string
 }
 
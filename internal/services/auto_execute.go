@@ -0,0 +1,44 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// autoExecuteLevels are the values auto_execute_up_to accepts, from least to
+// most severe. High and critical commands need explicit confirmation or are
+// blocked, which a model setting never bypasses.
+var autoExecuteLevels = []domain.RiskLevel{domain.RiskSafe, domain.RiskLow, domain.RiskMedium}
+
+func validateAutoExecute(model domain.ModelDefinition) error {
+	if model.AutoExecuteUpTo == "" || slices.Contains(autoExecuteLevels, model.AutoExecuteUpTo) {
+		return nil
+	}
+	return fmt.Errorf("models[%s].auto_execute_up_to must be safe|low|medium, got %s", model.Name, model.AutoExecuteUpTo)
+}
+
+// modelAutoExecutes reports whether the model named modelName lets command
+// run without confirmation because risk is at or below its auto_execute_up_to.
+// execution.confirm_before_execute takes precedence and keeps every prompt.
+func (s *QueryService) modelAutoExecutes(cfg domain.Config, modelName string, risk domain.RiskAssessment, command string) bool {
+	if cfg.ShouldConfirmBeforeExecution() {
+		return false
+	}
+	model, ok := findModel(cfg, modelName)
+	if !ok || model.AutoExecuteUpTo == "" {
+		return false
+	}
+	limit := slices.Index(autoExecuteLevels, model.AutoExecuteUpTo)
+	level := slices.Index(autoExecuteLevels, risk.Level)
+	if limit < 0 || level < 0 || level > limit {
+		return false
+	}
+	s.Logger.Info("confirmation skipped by model auto_execute_up_to", map[string]interface{}{
+		"model":   model.Name,
+		"level":   string(risk.Level),
+		"command": logText(cfg, command),
+	})
+	return true
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/logger"
+)
+
+func TestServiceRunModelAutoExecuteUpTo(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "strict"},
+		Models: []domain.ModelDefinition{
+			{Name: "strict", ModelID: "strict", Endpoint: "https://api.example.com"},
+			{Name: "permissive", ModelID: "permissive", Endpoint: "http://localhost", AutoExecuteUpTo: domain.RiskLow},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		model     string
+		risk      domain.RiskAssessment
+		wantAsked bool
+	}{
+		{name: "permissive model runs low risk", model: "permissive",
+			risk: domain.RiskAssessment{Level: domain.RiskLow, Action: domain.ActionSimpleConfirm}},
+		{name: "strict model asks for low risk", model: "strict", wantAsked: true,
+			risk: domain.RiskAssessment{Level: domain.RiskLow, Action: domain.ActionSimpleConfirm}},
+		{name: "permissive model asks above its level", model: "permissive", wantAsked: true,
+			risk: domain.RiskAssessment{Level: domain.RiskMedium, Action: domain.ActionConfirm}},
+		{name: "permissive model asks for explicit confirmation", model: "permissive", wantAsked: true,
+			risk: domain.RiskAssessment{Level: domain.RiskLow, Action: domain.ActionExplicitConfirm}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompter := &choicePrompter{choices: []domain.ExecutionChoice{domain.ChoiceRun}}
+			executor := &stubExecutor{result: domain.ExecutionResult{Ran: true}}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: tt.risk},
+				Executor:         executor,
+				Prompter:         prompter,
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list files", ModelOverride: tt.model})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if asked := len(prompter.asked) > 0; asked != tt.wantAsked {
+				t.Errorf("asked = %v, want %v", asked, tt.wantAsked)
+			}
+			if !executor.called {
+				t.Error("command did not run")
+			}
+			if resp.AutoConfirmed {
+				t.Error("AutoConfirmed = true, want it reserved for --yes")
+			}
+		})
+	}
+}
+
+func TestServiceRunAutoExecuteUpToMatrix(t *testing.T) {
+	risks := map[domain.RiskLevel]domain.RiskAssessment{
+		domain.RiskSafe:   {Level: domain.RiskSafe, Action: domain.ActionAllow},
+		domain.RiskLow:    {Level: domain.RiskLow, Action: domain.ActionSimpleConfirm},
+		domain.RiskMedium: {Level: domain.RiskMedium, Action: domain.ActionConfirm},
+	}
+
+	// Safe commands are only previewed unless something lets them run, since
+	// auto_execute_safe is off; low and medium ones are asked and answered run.
+	tests := []struct {
+		name      string
+		level     domain.RiskLevel
+		upTo      domain.RiskLevel
+		confirm   bool
+		wantAsked bool
+		wantRan   bool
+	}{
+		{name: "safe without threshold", level: domain.RiskSafe},
+		{name: "safe within safe threshold", level: domain.RiskSafe, upTo: domain.RiskSafe, wantRan: true},
+		{name: "safe within low threshold", level: domain.RiskSafe, upTo: domain.RiskLow, wantRan: true},
+		{name: "safe within threshold with confirm_before_execute", level: domain.RiskSafe, upTo: domain.RiskLow, confirm: true},
+		{name: "low without threshold", level: domain.RiskLow, wantAsked: true, wantRan: true},
+		{name: "low above safe threshold", level: domain.RiskLow, upTo: domain.RiskSafe, wantAsked: true, wantRan: true},
+		{name: "low within low threshold", level: domain.RiskLow, upTo: domain.RiskLow, wantRan: true},
+		{name: "low within threshold with confirm_before_execute", level: domain.RiskLow, upTo: domain.RiskLow, confirm: true, wantAsked: true, wantRan: true},
+		{name: "medium without threshold", level: domain.RiskMedium, wantAsked: true, wantRan: true},
+		{name: "medium above low threshold", level: domain.RiskMedium, upTo: domain.RiskLow, wantAsked: true, wantRan: true},
+		{name: "medium within medium threshold", level: domain.RiskMedium, upTo: domain.RiskMedium, wantRan: true},
+		{name: "medium within threshold with confirm_before_execute", level: domain.RiskMedium, upTo: domain.RiskMedium, confirm: true, wantAsked: true, wantRan: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Models:    []domain.ModelDefinition{{Name: "local", ModelID: "local", Endpoint: "http://localhost", AutoExecuteUpTo: tt.upTo}},
+				Execution: domain.ExecutionSettings{ConfirmBeforeExecute: tt.confirm},
+			}
+			prompter := &choicePrompter{choices: []domain.ExecutionChoice{domain.ChoiceRun}}
+			executor := &stubExecutor{result: domain.ExecutionResult{Ran: true}}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: risks[tt.level]},
+				Executor:         executor,
+				Prompter:         prompter,
+				Logger:           logger.NewStd(false),
+			}
+
+			if _, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list files"}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if asked := len(prompter.asked) > 0; asked != tt.wantAsked {
+				t.Errorf("asked = %v, want %v", asked, tt.wantAsked)
+			}
+			if executor.called != tt.wantRan {
+				t.Errorf("ran = %v, want %v", executor.called, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsInvalidAutoExecuteUpTo(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "claude"},
+		Models:      []domain.ModelDefinition{{Name: "claude", AutoExecuteUpTo: domain.RiskHigh}},
+		Context:     domain.ContextSettings{MaxFiles: 1},
+	}
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "auto_execute_up_to") {
+		t.Fatalf("Validate() error = %v, want invalid auto_execute_up_to", err)
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// Compare asks each named model for a command concurrently and evaluates the
+// results with the guardrail. Nothing is executed and no fallback models are
+// tried, so each result reflects only that model. Per-model failures are
+// reported in the result's Err; the returned error covers setup problems.
+func (s *QueryService) Compare(req domain.QueryRequest, modelNames []string) ([]domain.ModelComparison, error) {
+	if s.ConfigProvider == nil || s.ContextCollector == nil || s.ProviderFactory == nil ||
+		s.SecurityService == nil || s.Logger == nil {
+		return nil, errors.New("services.QueryService dependencies not satisfied")
+	}
+	if len(modelNames) == 0 {
+		return nil, errors.New("no models to compare")
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg, err := s.ConfigProvider.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	models := make([]domain.ModelDefinition, len(modelNames))
+	for i, name := range modelNames {
+		model, ok := findModel(cfg, name)
+		if !ok {
+			return nil, fmt.Errorf("model %s not found", name)
+		}
+		models[i] = model
+	}
+
+	snapshot, err := s.ContextCollector.Collect(ctx, cfg, req)
+	if err != nil {
+		return nil, fmt.Errorf("collect context: %w", err)
+	}
+
+	// Concurrent replies would interleave on one stream writer.
+	req.Stream = false
+	req.StreamWriter = nil
+
+	results := make([]domain.ModelComparison, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.compareModel(ctx, cfg, model, req, snapshot)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (s *QueryService) compareModel(ctx context.Context, cfg domain.Config, model domain.ModelDefinition, req domain.QueryRequest, snapshot domain.ContextSnapshot) domain.ModelComparison {
+	result := domain.ModelComparison{Model: model.Name}
+	aiResp, err := s.generateWithModel(ctx, cfg, model, req, snapshot)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Command = aiResp.Command
+	result.Reasoning = aiResp.Reasoning
+
+	security, err := s.securityFor(cfg, model.Name)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.RiskAssessment, err = evaluate(security, aiResp.Command, req.WorkDir)
+	if err != nil {
+		result.Err = fmt.Errorf("security evaluate: %w", err)
+	}
+	return result
+}
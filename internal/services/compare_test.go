@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/logger"
+	"github.com/doeshing/shai-go/internal/ports"
+)
+
+// modelProviderFactory returns the provider registered for each model name.
+type modelProviderFactory map[string]ports.Provider
+
+func (f modelProviderFactory) ForModel(model domain.ModelDefinition) (ports.Provider, error) {
+	provider, ok := f[model.Name]
+	if !ok {
+		return nil, errors.New("no provider")
+	}
+	return provider, nil
+}
+
+// fixedProvider always answers with the same command, reply or error.
+type fixedProvider struct {
+	command string
+	reply   string
+	err     error
+}
+
+func (fixedProvider) Name() string                  { return "fixed" }
+func (fixedProvider) Model() domain.ModelDefinition { return domain.ModelDefinition{} }
+func (p fixedProvider) Generate(context.Context, ports.ProviderRequest) (ports.ProviderResponse, error) {
+	return ports.ProviderResponse{Command: p.command, Reply: p.reply}, p.err
+}
+
+// commandSecurity assesses commands from a fixed table, defaulting to safe.
+type commandSecurity map[string]domain.RiskAssessment
+
+func (s commandSecurity) Evaluate(command string) (domain.RiskAssessment, error) {
+	if risk, ok := s[command]; ok {
+		return risk, nil
+	}
+	return domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}, nil
+}
+
+func TestServiceCompare(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "gpt4"},
+		Models: []domain.ModelDefinition{
+			{Name: "gpt4", ModelID: "gpt-4"},
+			{Name: "claude", ModelID: "claude"},
+			{Name: "broken", ModelID: "broken"},
+		},
+	}
+	executor := &stubExecutor{}
+	svc := &QueryService{
+		ConfigProvider:   stubConfigProvider{cfg: cfg},
+		ContextCollector: stubContextCollector{},
+		ProviderFactory: modelProviderFactory{
+			"gpt4":   fixedProvider{command: "find . -size +100M"},
+			"claude": fixedProvider{command: "du -ah . | sort -rh | head"},
+			"broken": fixedProvider{err: errors.New("rate limited")},
+		},
+		SecurityService: commandSecurity{
+			"du -ah . | sort -rh | head": {Level: domain.RiskLow, Action: domain.ActionSimpleConfirm},
+		},
+		Executor: executor,
+		Logger:   logger.NewStd(false),
+	}
+
+	results, err := svc.Compare(domain.QueryRequest{Context: context.Background(), Prompt: "list large files"},
+		[]string{"gpt4", "claude", "broken"})
+	if err != nil {
+		t.Fatalf("Compare error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	tests := []struct {
+		model   string
+		command string
+		level   domain.RiskLevel
+		wantErr bool
+	}{
+		{model: "gpt4", command: "find . -size +100M", level: domain.RiskSafe},
+		{model: "claude", command: "du -ah . | sort -rh | head", level: domain.RiskLow},
+		{model: "broken", wantErr: true},
+	}
+	for i, tt := range tests {
+		got := results[i]
+		if got.Model != tt.model {
+			t.Errorf("results[%d].Model = %s, want %s (order must follow --models)", i, got.Model, tt.model)
+		}
+		if (got.Err != nil) != tt.wantErr {
+			t.Errorf("%s: Err = %v, wantErr %v", tt.model, got.Err, tt.wantErr)
+		}
+		if got.Command != tt.command || got.RiskAssessment.Level != tt.level {
+			t.Errorf("%s: got %q (%s), want %q (%s)", tt.model, got.Command, got.RiskAssessment.Level, tt.command, tt.level)
+		}
+	}
+	if executor.called {
+		t.Error("compare must never execute commands")
+	}
+
+	if _, err := svc.Compare(domain.QueryRequest{Prompt: "x"}, []string{"gpt4", "missing"}); err == nil {
+		t.Error("expected error for unknown model")
+	}
+}
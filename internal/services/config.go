@@ -22,11 +22,25 @@ func Validate(cfg domain.Config) error {
 	if _, ok := findModel(cfg, cfg.Preferences.DefaultModel); !ok {
 		return fmt.Errorf("default model %s not found in models list", cfg.Preferences.DefaultModel)
 	}
+	for _, model := range cfg.Models {
+		if err := validateAutoExecute(model); err != nil {
+			return err
+		}
+	}
 	for _, name := range cfg.Preferences.FallbackModels {
 		if _, ok := findModel(cfg, name); !ok {
 			return fmt.Errorf("fallback model %s not found", name)
 		}
 	}
+	if _, err := compileRouting(cfg); err != nil {
+		return err
+	}
+	if _, err := compileOutputFilters(cfg.Preferences.OutputFilters); err != nil {
+		return err
+	}
+	if _, err := compileNeverExecute(cfg.Preferences.NeverExecute); err != nil {
+		return err
+	}
 	if err := validateContext(cfg.Context); err != nil {
 		return err
 	}
@@ -59,19 +59,75 @@ func (s *HealthService) Run(ctx context.Context) (domain.HealthReport, error) {
 	return domain.HealthReport{Checks: checks}, nil
 }
 
+// upgradeRemedy refreshes the installed binary and hook scripts in place.
+const upgradeRemedy = "shai install --force"
+
+// UpgradeChecks reports whether the installed binary and shell hooks still
+// match the running version, which catches upgrades that were never reinstalled.
+func (s *HealthService) UpgradeChecks(ctx context.Context) domain.HealthReport {
+	if s.ShellIntegrator == nil {
+		return domain.HealthReport{Checks: []domain.HealthCheck{warn("Installed binary", "shell integrator not initialized")}}
+	}
+	checks := []domain.HealthCheck{binaryDiagnostics(s.ShellIntegrator.BinaryStatus(ctx))}
+	for _, shell := range []domain.ShellName{domain.ShellZsh, domain.ShellBash} {
+		if check, ok := hookDiagnostics(s.ShellIntegrator.Status(string(shell))); ok {
+			checks = append(checks, check)
+		}
+	}
+	return domain.HealthReport{Checks: checks}
+}
+
+func binaryDiagnostics(status domain.BinaryStatus) domain.HealthCheck {
+	const name = "Installed binary"
+	switch {
+	case status.Error != "":
+		return warn(name, fmt.Sprintf("%s; run `%s`", status.Error, upgradeRemedy))
+	case !status.Exists:
+		return warn(name, fmt.Sprintf("not found at %s; run `shai install`", status.Path))
+	case status.SameBinary:
+		return ok(name, fmt.Sprintf("%s matches the running binary (%s)", status.Path, status.RunningVersion))
+	case status.InstalledVersion != status.RunningVersion:
+		return warn(name, fmt.Sprintf("%s is %s but %s is running; run `%s`",
+			status.Path, status.InstalledVersion, status.RunningVersion, upgradeRemedy))
+	default:
+		return warn(name, fmt.Sprintf("%s differs from the running binary (both report %s); run `%s`",
+			status.Path, status.RunningVersion, upgradeRemedy))
+	}
+}
+
+// hookDiagnostics compares an installed hook with the embedded script. Shells
+// without an installed hook are skipped.
+func hookDiagnostics(status domain.ShellStatus) (domain.HealthCheck, bool) {
+	if status.Error != "" || !status.ScriptExists {
+		return domain.HealthCheck{}, false
+	}
+	name := fmt.Sprintf("Shell %s hook", status.Shell)
+	if status.ScriptCurrent {
+		return ok(name, fmt.Sprintf("%s matches this version", status.ScriptPath)), true
+	}
+	return warn(name, fmt.Sprintf("%s is out of date; run `%s --shell %s`", status.ScriptPath, upgradeRemedy, status.Shell)), true
+}
+
 func contextDiagnostics(snapshot domain.ContextSnapshot, cfg domain.Config) []domain.HealthCheck {
 	var checks []domain.HealthCheck
-	if snapshot.Git != nil {
+	probeErrors := snapshot.Telemetry.ProbeErrors
+	if msg, failed := probeErrors[domain.ProbeGit]; failed {
+		checks = append(checks, warn("Git status", msg))
+	} else if snapshot.Git != nil {
 		checks = append(checks, ok("Git status", fmt.Sprintf("branch %s, modified %d", snapshot.Git.Branch, snapshot.Git.ModifiedCount)))
 	} else if shouldCheck(cfg.Context.IncludeGit) {
 		checks = append(checks, warn("Git status", "no git repo detected"))
 	}
-	if snapshot.Kubernetes != nil && snapshot.Kubernetes.Context != "" {
+	if msg, failed := probeErrors[domain.ProbeKubernetes]; failed {
+		checks = append(checks, warn("Kubernetes", msg))
+	} else if snapshot.Kubernetes != nil && snapshot.Kubernetes.Context != "" {
 		checks = append(checks, ok("Kubernetes", fmt.Sprintf("context %s namespace %s", snapshot.Kubernetes.Context, snapshot.Kubernetes.Namespace)))
 	} else if shouldCheck(cfg.Context.IncludeK8s) {
 		checks = append(checks, warn("Kubernetes", "kubectl context not detected"))
 	}
-	if snapshot.Docker != nil && snapshot.Docker.Running {
+	if msg, failed := probeErrors[domain.ProbeDocker]; failed {
+		checks = append(checks, warn("Docker", msg))
+	} else if snapshot.Docker != nil && snapshot.Docker.Running {
 		checks = append(checks, ok("Docker", snapshot.Docker.Info))
 	}
 	return checks
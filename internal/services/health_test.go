@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+type fakeShellIntegrator struct {
+	binary domain.BinaryStatus
+	shells map[string]domain.ShellStatus
+}
+
+func (f *fakeShellIntegrator) Install(string, bool) (domain.ShellInstallResult, error) {
+	return domain.ShellInstallResult{}, nil
+}
+
+func (f *fakeShellIntegrator) Uninstall(string) (domain.ShellInstallResult, error) {
+	return domain.ShellInstallResult{}, nil
+}
+
+func (f *fakeShellIntegrator) Status(shell string) domain.ShellStatus {
+	return f.shells[shell]
+}
+
+func (f *fakeShellIntegrator) BinaryStatus(context.Context) domain.BinaryStatus {
+	return f.binary
+}
+
+func (f *fakeShellIntegrator) DetectShell() string { return "zsh" }
+
+func TestUpgradeChecks(t *testing.T) {
+	currentZsh := domain.ShellStatus{Shell: domain.ShellZsh, ScriptPath: "~/.shai/shell/zsh.sh", ScriptExists: true, ScriptCurrent: true}
+	staleZsh := currentZsh
+	staleZsh.ScriptCurrent = false
+
+	tests := []struct {
+		name       string
+		binary     domain.BinaryStatus
+		zsh        domain.ShellStatus
+		wantStatus []domain.HealthStatus
+		wantDetail string
+	}{
+		{
+			name:       "up to date",
+			binary:     domain.BinaryStatus{Path: "bin/shai", Exists: true, SameBinary: true, RunningVersion: "1.2.0"},
+			zsh:        currentZsh,
+			wantStatus: []domain.HealthStatus{domain.HealthOK, domain.HealthOK},
+		},
+		{
+			name:       "version mismatch",
+			binary:     domain.BinaryStatus{Path: "bin/shai", Exists: true, InstalledVersion: "1.1.0", RunningVersion: "1.2.0"},
+			zsh:        currentZsh,
+			wantStatus: []domain.HealthStatus{domain.HealthWarn, domain.HealthOK},
+			wantDetail: "is 1.1.0 but 1.2.0 is running; run `shai install --force`",
+		},
+		{
+			name:       "stale hook",
+			binary:     domain.BinaryStatus{Path: "bin/shai", Exists: true, SameBinary: true, RunningVersion: "1.2.0"},
+			zsh:        staleZsh,
+			wantStatus: []domain.HealthStatus{domain.HealthOK, domain.HealthWarn},
+			wantDetail: "out of date; run `shai install --force --shell zsh`",
+		},
+		{
+			name:       "hook not installed is skipped",
+			binary:     domain.BinaryStatus{Path: "bin/shai", Exists: true, SameBinary: true, RunningVersion: "1.2.0"},
+			wantStatus: []domain.HealthStatus{domain.HealthOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &HealthService{ShellIntegrator: &fakeShellIntegrator{
+				binary: tt.binary,
+				shells: map[string]domain.ShellStatus{"zsh": tt.zsh},
+			}}
+			report := svc.UpgradeChecks(context.Background())
+			if len(report.Checks) != len(tt.wantStatus) {
+				t.Fatalf("got %d checks, want %d: %+v", len(report.Checks), len(tt.wantStatus), report.Checks)
+			}
+			var details []string
+			for i, check := range report.Checks {
+				if check.Status != tt.wantStatus[i] {
+					t.Errorf("check %s status = %s, want %s", check.Name, check.Status, tt.wantStatus[i])
+				}
+				details = append(details, check.Details)
+			}
+			if tt.wantDetail != "" && !strings.Contains(strings.Join(details, "\n"), tt.wantDetail) {
+				t.Errorf("details %q missing %q", details, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestContextDiagnosticsReportsProbeErrors(t *testing.T) {
+	snapshot := domain.ContextSnapshot{
+		Git: &domain.GitStatus{Branch: "main"},
+		Telemetry: domain.TelemetryInfo{ProbeErrors: map[string]string{
+			domain.ProbeGit:        "git status timed out after 2s",
+			domain.ProbeKubernetes: "kubectl config timed out after 2s",
+		}},
+	}
+
+	checks := contextDiagnostics(snapshot, domain.Config{})
+	want := map[string]string{
+		"Git status": "git status timed out after 2s",
+		"Kubernetes": "kubectl config timed out after 2s",
+	}
+	for _, check := range checks {
+		details, ok := want[check.Name]
+		if !ok {
+			continue
+		}
+		if check.Status != domain.HealthWarn || check.Details != details {
+			t.Errorf("%s = %s %q, want warn %q", check.Name, check.Status, check.Details, details)
+		}
+		delete(want, check.Name)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing checks: %v", want)
+	}
+}
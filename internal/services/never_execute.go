@@ -0,0 +1,49 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// compileNeverExecute compiles preferences.never_execute. Entries are regular
+// expressions searched anywhere in the command, so a plain prefix such as
+// "kubectl delete" works as well as "terraform\s+apply".
+func compileNeverExecute(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for i, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("preferences.never_execute[%d]: pattern is empty", i)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("preferences.never_execute[%d]: invalid pattern %q: %w", i, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// applyNeverExecute turns risk into a preview when command matches a
+// never_execute entry. Unlike a guardrail block the command is still shown
+// (and copied); it is only never run. Blocked commands stay blocked.
+func applyNeverExecute(cfg domain.Config, risk domain.RiskAssessment, command string) (domain.RiskAssessment, error) {
+	if risk.Action == domain.ActionBlock {
+		return risk, nil
+	}
+	patterns, err := compileNeverExecute(cfg.Preferences.NeverExecute)
+	if err != nil {
+		return risk, err
+	}
+	for _, re := range patterns {
+		if re.MatchString(command) {
+			risk.Action = domain.ActionPreviewOnly
+			risk.Reasons = append(slices.Clip(risk.Reasons),
+				fmt.Sprintf("matches preferences.never_execute rule %q; shown but never executed", re.String()))
+			return risk, nil
+		}
+	}
+	return risk, nil
+}
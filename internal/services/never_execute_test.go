@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/logger"
+)
+
+func TestServiceRunNeverExecute(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		risk        domain.RiskAssessment
+		wantExec    bool
+		wantBlocked bool
+	}{
+		{name: "matching prefix is previewed", command: "kubectl delete pod web-1", risk: domain.RiskAssessment{Action: domain.ActionAllow}},
+		{name: "matching regex is previewed", command: "terraform  apply -auto-approve", risk: domain.RiskAssessment{Action: domain.ActionAllow}},
+		{name: "other commands run", command: "kubectl get pods", risk: domain.RiskAssessment{Action: domain.ActionAllow}, wantExec: true},
+		{name: "blocks stay blocks", command: "kubectl delete ns prod", risk: domain.RiskAssessment{Action: domain.ActionBlock}, wantBlocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{
+					DefaultModel: "claude",
+					NeverExecute: []string{"kubectl delete", `^terraform\s+apply`},
+				},
+				Models: []domain.ModelDefinition{{Name: "claude", ModelID: "claude"}},
+			}
+			executor := &stubExecutor{result: domain.ExecutionResult{Ran: true}}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{snapshot: domain.ContextSnapshot{WorkingDir: "/tmp"}},
+				ProviderFactory:  stubProviderFactory{provider: fixedProvider{command: tt.command}},
+				SecurityService:  stubSecurity{risk: tt.risk},
+				Executor:         executor,
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "clean up", AutoExecute: true, AssumeYes: true})
+			var blocked *BlockedError
+			if errors.As(err, &blocked) != tt.wantBlocked {
+				t.Fatalf("Run() error = %v, want blocked %v", err, tt.wantBlocked)
+			}
+			if !tt.wantBlocked && err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if executor.called != tt.wantExec {
+				t.Errorf("executed = %v, want %v", executor.called, tt.wantExec)
+			}
+			previewed := !tt.wantExec && !tt.wantBlocked
+			if previewed && (resp.Command != tt.command || resp.RiskAssessment.Action != domain.ActionPreviewOnly ||
+				!strings.Contains(strings.Join(resp.RiskAssessment.Reasons, "\n"), "never_execute")) {
+				t.Errorf("resp = %q %+v, want a preview noting the never_execute rule", resp.Command, resp.RiskAssessment)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsInvalidNeverExecute(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "claude", NeverExecute: []string{"terraform (apply"}},
+		Models:      []domain.ModelDefinition{{Name: "claude"}},
+		Context:     domain.ContextSettings{MaxFiles: 1},
+	}
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "never_execute[0]") {
+		t.Fatalf("Validate() error = %v, want invalid never_execute pattern", err)
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+// defaultOutputFilters clean up formatting models commonly leave around a
+// command. They always run first, followed by preferences.output_filters.
+var defaultOutputFilters = []domain.OutputFilter{
+	// Collapse CRLF and lone CR line endings.
+	{Pattern: `\r\n?`, Replace: "\n"},
+	// Remove single backticks around a one-line command.
+	{Pattern: "^\\s*`([^`\n]+)`\\s*$", Replace: "$1"},
+	// Remove a leading "$ " shell prompt on each line.
+	{Pattern: `(?m)^[ \t]*\$[ \t]+`, Replace: ""},
+}
+
+type compiledFilter struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+// compileOutputFilters compiles user filters, reporting the first invalid pattern.
+func compileOutputFilters(filters []domain.OutputFilter) ([]compiledFilter, error) {
+	compiled := make([]compiledFilter, 0, len(filters))
+	for i, filter := range filters {
+		re, err := regexp.Compile(filter.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("preferences.output_filters[%d]: invalid pattern %q: %w", i, filter.Pattern, err)
+		}
+		compiled = append(compiled, compiledFilter{re: re, replace: filter.Replace})
+	}
+	return compiled, nil
+}
+
+// applyOutputFilters runs the built-in then the user filters over command.
+func applyOutputFilters(command string, filters []domain.OutputFilter) (string, error) {
+	compiled, err := compileOutputFilters(append(defaultOutputFilters[:len(defaultOutputFilters):len(defaultOutputFilters)], filters...))
+	if err != nil {
+		return "", err
+	}
+	for _, filter := range compiled {
+		command = filter.re.ReplaceAllString(command, filter.replace)
+	}
+	return strings.TrimSpace(command), nil
+}
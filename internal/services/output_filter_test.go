@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+func TestApplyOutputFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		filters []domain.OutputFilter
+		want    string
+	}{
+		{name: "crlf", command: "ls -la\r\npwd\r", want: "ls -la\npwd"},
+		{name: "backticks", command: " `git status` ", want: "git status"},
+		{name: "prompt prefix", command: "$ ls -la\n  $ pwd", want: "ls -la\npwd"},
+		{name: "backticked prompt", command: "`$ df -h`", want: "df -h"},
+		{name: "inner dollar kept", command: "echo $HOME", want: "echo $HOME"},
+		{
+			name:    "custom filter runs after defaults",
+			command: "$ sudo apt update",
+			filters: []domain.OutputFilter{{Pattern: `^sudo\s+`, Replace: ""}},
+			want:    "apt update",
+		},
+		{
+			name:    "capture reference",
+			command: "grep -r foo .",
+			filters: []domain.OutputFilter{{Pattern: `^grep -r (\S+)`, Replace: "rg $1"}},
+			want:    "rg foo .",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyOutputFilters(tt.command, tt.filters)
+			if err != nil {
+				t.Fatalf("applyOutputFilters: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOutputFiltersRejectsInvalidPattern(t *testing.T) {
+	if _, err := applyOutputFilters("ls", []domain.OutputFilter{{Pattern: "("}}); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
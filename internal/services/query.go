@@ -4,9 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
+	"github.com/doeshing/shai-go/internal/pkg/redact"
 	"github.com/doeshing/shai-go/internal/ports"
 )
 
@@ -16,10 +22,13 @@ type QueryService struct {
 	ContextCollector ports.ContextCollector
 	ProviderFactory  ports.ProviderFactory
 	SecurityService  ports.SecurityService
+	SecurityProfiles ports.SecurityProfiles
 	Executor         ports.CommandExecutor
 	Prompter         ports.ConfirmationPrompter
 	Clipboard        ports.Clipboard
 	Logger           ports.Logger
+	// Now returns the current time for stage timings; nil uses time.Now.
+	Now func() time.Time
 }
 
 // Run processes a single natural-language query.
@@ -34,30 +43,59 @@ func (s *QueryService) Run(req domain.QueryRequest) (domain.QueryResponse, error
 		ctx = context.Background()
 	}
 
+	timer := newStageTimer(s.Now)
 	cfg, err := s.ConfigProvider.Load(ctx)
 	if err != nil {
 		return domain.QueryResponse{}, fmt.Errorf("load config: %w", err)
 	}
+	timer.stop(domain.StageLoadConfig)
 
+	timer.start()
 	ctxSnapshot, err := s.ContextCollector.Collect(ctx, cfg, req)
 	if err != nil {
 		return domain.QueryResponse{}, fmt.Errorf("collect context: %w", err)
 	}
+	timer.stop(domain.StageCollectContext)
+	if req.Observer != nil {
+		req.Observer.ContextCollected(ctxSnapshot)
+	}
 
-	modelDef, err := pickModel(cfg, req.ModelOverride)
+	modelDef, err := pickModel(cfg, req.ModelOverride, req.Prompt)
 	if err != nil {
 		return domain.QueryResponse{}, err
 	}
 
+	timer.start()
 	aiResp, modelUsed, err := s.generateCommand(ctx, cfg, modelDef, req, ctxSnapshot)
 	if err != nil {
 		return domain.QueryResponse{}, err
 	}
+	aiResp, modelUsed, err = s.avoidDenied(ctx, cfg, modelDef, req, ctxSnapshot, aiResp, modelUsed)
+	if err != nil {
+		return domain.QueryResponse{}, err
+	}
+	timer.stop(domain.StageGenerate)
+	if req.Observer != nil {
+		req.Observer.CommandGenerated(aiResp.Command, modelUsed)
+	}
 
-	risk, err := s.SecurityService.Evaluate(aiResp.Command)
+	security, err := s.securityFor(cfg, modelUsed)
+	if err != nil {
+		return domain.QueryResponse{}, err
+	}
+	timer.start()
+	risk, err := evaluate(security, aiResp.Command, req.WorkDir)
 	if err != nil {
 		return domain.QueryResponse{}, fmt.Errorf("security evaluate: %w", err)
 	}
+	risk, err = applyNeverExecute(cfg, risk, aiResp.Command)
+	if err != nil {
+		return domain.QueryResponse{}, err
+	}
+	timer.stop(domain.StageEvaluate)
+	if req.Observer != nil {
+		req.Observer.RiskAssessed(risk)
+	}
 
 	resp := domain.QueryResponse{
 		Command:            aiResp.Command,
@@ -66,25 +104,40 @@ func (s *QueryService) Run(req domain.QueryRequest) (domain.QueryResponse, error
 		RiskAssessment:     risk,
 		ContextInformation: ctxSnapshot,
 		ModelUsed:          modelUsed,
+		Timings:            timer.timings,
+	}
+	if shell := s.foreignShell(req); shell != "" && !req.PreviewOnly {
+		resp.ShellNotice = fmt.Sprintf("Command written for %s, but commands run with %s; shown only, not executed.", req.AssumeShell, shell)
+	}
+	// A blocked command never runs, so it is not worth an extra request.
+	if req.ExplainRisk && risk.Action != domain.ActionBlock {
+		resp.RiskExplanation = s.explainRisk(ctx, cfg, modelUsed, aiResp.Command)
 	}
 
-	if req.CopyToClipboard && s.Clipboard != nil && s.Clipboard.Enabled() {
-		if err := s.Clipboard.Copy(aiResp.Command); err != nil {
-			s.Logger.Warn("clipboard copy failed", map[string]interface{}{"error": err.Error()})
-		}
+	if cfg.ShouldCopyToClipboard(req) {
+		s.copyCommand(&resp)
 	}
 
-	shouldExecute, err := s.decideExecution(req, cfg, risk, aiResp.Command)
+	choice, err := s.decideExecution(req, cfg, modelUsed, withExplanation(risk, resp.RiskExplanation), aiResp.Command)
+	if err != nil {
+		return resp, err
+	}
+	choice, err = s.settleChoice(req, cfg, security, &resp, choice)
 	if err != nil {
 		return resp, err
 	}
 
-	if !shouldExecute {
+	if choice != domain.ChoiceRun {
+		s.notifySkipped(req, cfg, resp.RiskAssessment, choice)
 		return resp, nil
 	}
+	resp.AutoConfirmed = req.AssumeYes && isConfirmAction(resp.RiskAssessment.Action)
 
-	execResult, err := s.Executor.Execute(ctx, aiResp.Command)
-	resp.ExecutionResult = &execResult
+	err = s.execute(ctx, req, &resp, timer)
+	if err != nil && req.FixAttempts > 0 {
+		err = s.fixFailures(ctx, cfg, modelDef, req, ctxSnapshot, &resp, timer, err)
+	}
+	resp.Timings = timer.timings
 	if err != nil {
 		return resp, err
 	}
@@ -92,40 +145,521 @@ func (s *QueryService) Run(req domain.QueryRequest) (domain.QueryResponse, error
 	return resp, nil
 }
 
+// execute runs resp.Command and records its result on resp.
+func (s *QueryService) execute(ctx context.Context, req domain.QueryRequest, resp *domain.QueryResponse, timer *stageTimer) error {
+	timer.start()
+	execResult, err := s.Executor.Execute(ctx, resp.Command, req.WorkDir, req.Env)
+	timer.stop(domain.StageExecute)
+	resp.ExecutionResult = &execResult
+	if req.Observer != nil {
+		req.Observer.Executed(execResult)
+	}
+	return err
+}
+
+// fixRetryPrompt asks the model to correct a command that exited non-zero.
+const fixRetryPrompt = `%s
+
+The command "%s" failed with exit code %d and this error output:
+%s
+
+Suggest a corrected command.`
+
+// fixStderrLimit caps, in runes, the error output sent back to the model; the
+// end of stderr usually holds the actual error.
+const fixStderrLimit = 2000
+
+// fixFailures sends a command that exited non-zero back to the model with its
+// stderr, up to req.FixAttempts times. Each correction is evaluated and
+// confirmed like the first command before it runs. It returns nil once a
+// correction succeeds, otherwise the error that ended the attempts; execErr
+// is returned when the user declines a correction.
+func (s *QueryService) fixFailures(
+	ctx context.Context,
+	cfg domain.Config,
+	model domain.ModelDefinition,
+	req domain.QueryRequest,
+	snapshot domain.ContextSnapshot,
+	resp *domain.QueryResponse,
+	timer *stageTimer,
+	execErr error,
+) error {
+	for attempt := 0; attempt < req.FixAttempts && resp.ExecutionResult.ExitCode > 0; attempt++ {
+		failed := domain.FailedAttempt{Command: resp.Command, Result: *resp.ExecutionResult}
+		resp.FailedAttempts = append(resp.FailedAttempts, failed)
+		s.Logger.Info("command failed, asking for a fix", map[string]interface{}{
+			"command":   logText(cfg, failed.Command),
+			"exit_code": failed.Result.ExitCode,
+			"attempt":   attempt + 1,
+		})
+
+		retry := req
+		retry.Prompt = fmt.Sprintf(fixRetryPrompt, req.Prompt, failed.Command, failed.Result.ExitCode, fixStderr(failed.Result.Stderr, req.Env))
+		retry.Stream = false
+		timer.start()
+		aiResp, modelUsed, err := s.generateCommand(ctx, cfg, model, retry, snapshot)
+		if err != nil {
+			return fmt.Errorf("fix failed command: %w", err)
+		}
+		aiResp, modelUsed, err = s.avoidDenied(ctx, cfg, model, retry, snapshot, aiResp, modelUsed)
+		if err != nil {
+			return fmt.Errorf("fix failed command: %w", err)
+		}
+		timer.stop(domain.StageGenerate)
+		if req.Observer != nil {
+			req.Observer.CommandGenerated(aiResp.Command, modelUsed)
+		}
+
+		security, err := s.securityFor(cfg, modelUsed)
+		if err != nil {
+			return err
+		}
+		timer.start()
+		risk, err := evaluate(security, aiResp.Command, req.WorkDir)
+		if err != nil {
+			return fmt.Errorf("security evaluate: %w", err)
+		}
+		risk, err = applyNeverExecute(cfg, risk, aiResp.Command)
+		if err != nil {
+			return err
+		}
+		timer.stop(domain.StageEvaluate)
+		if req.Observer != nil {
+			req.Observer.RiskAssessed(risk)
+		}
+
+		resp.Command = aiResp.Command
+		resp.Reasoning = aiResp.Reasoning
+		resp.ModelUsed = modelUsed
+		resp.RiskAssessment = risk
+		resp.RiskExplanation = ""
+		resp.ExecutionResult = nil
+		choice, err := s.decideExecution(req, cfg, modelUsed, risk, aiResp.Command)
+		if err != nil {
+			return err
+		}
+		if choice, err = s.settleChoice(req, cfg, security, resp, choice); err != nil {
+			return err
+		}
+		if choice != domain.ChoiceRun {
+			s.notifySkipped(req, cfg, resp.RiskAssessment, choice)
+			return execErr
+		}
+		resp.AutoConfirmed = req.AssumeYes && isConfirmAction(resp.RiskAssessment.Action)
+		if execErr = s.execute(ctx, req, resp, timer); execErr == nil {
+			return nil
+		}
+	}
+	return execErr
+}
+
+// fixStderr prepares stderr for the fix prompt: values of secret-looking
+// variables, from the environment or --env, are masked before the text is cut
+// to its last fixStderrLimit runes.
+func fixStderr(stderr string, env map[string]string) string {
+	secrets := redact.EnvSecrets(os.Environ())
+	for name, value := range env {
+		if redact.SecretName(name) {
+			secrets = append(secrets, value)
+		}
+	}
+	stderr = strings.TrimSpace(redact.Secrets(stderr, secrets))
+	if runes := []rune(stderr); len(runes) > fixStderrLimit {
+		stderr = "..." + string(runes[len(runes)-fixStderrLimit:])
+	}
+	if stderr == "" {
+		return "(no error output)"
+	}
+	return stderr
+}
+
+// stageTimer measures consecutive query stages for QueryResponse.Timings.
+type stageTimer struct {
+	now     func() time.Time
+	started time.Time
+	timings []domain.StageTiming
+}
+
+// newStageTimer returns a timer whose first stage starts now.
+func newStageTimer(now func() time.Time) *stageTimer {
+	if now == nil {
+		now = time.Now
+	}
+	return &stageTimer{now: now, started: now()}
+}
+
+func (t *stageTimer) start() {
+	t.started = t.now()
+}
+
+// stop records the time since the last start as stage.
+func (t *stageTimer) stop(stage string) {
+	t.timings = append(t.timings, domain.StageTiming{Stage: stage, Duration: t.now().Sub(t.started)})
+}
+
+// denyRetryPrompt re-asks the model after it suggested a denied command.
+const denyRetryPrompt = `%s
+
+Do not suggest "%s"; the user never wants that command. Suggest a different approach.`
+
+// avoidDenied re-prompts once when the generated command is on the user's deny
+// list, then refuses it with an error if the model suggests a denied command again.
+func (s *QueryService) avoidDenied(
+	ctx context.Context,
+	cfg domain.Config,
+	model domain.ModelDefinition,
+	req domain.QueryRequest,
+	snapshot domain.ContextSnapshot,
+	resp ports.ProviderResponse,
+	modelUsed string,
+) (ports.ProviderResponse, string, error) {
+	entry, denied := cfg.DeniedBy(resp.Command)
+	if !denied {
+		return resp, modelUsed, nil
+	}
+	s.Logger.Info("generated command is denied, re-prompting", map[string]interface{}{
+		"entry":   entry,
+		"command": logText(cfg, resp.Command),
+	})
+
+	retry := req
+	retry.Prompt = fmt.Sprintf(denyRetryPrompt, req.Prompt, resp.Command)
+	retry.Stream = false
+	resp, modelUsed, err := s.generateCommand(ctx, cfg, model, retry, snapshot)
+	if err != nil {
+		return ports.ProviderResponse{}, "", err
+	}
+	if entry, denied := cfg.DeniedBy(resp.Command); denied {
+		return ports.ProviderResponse{}, "", fmt.Errorf("command %q matches deny list entry %q (see shai deny list)", resp.Command, entry)
+	}
+	return resp, modelUsed, nil
+}
+
+// securityFor returns the guardrail for the model that produced the command,
+// honoring its guardrail_profile when profiles are wired in.
+func (s *QueryService) securityFor(cfg domain.Config, modelName string) (ports.SecurityService, error) {
+	model, ok := findModel(cfg, modelName)
+	if s.SecurityProfiles == nil || !ok || model.GuardrailProfile == "" {
+		return s.SecurityService, nil
+	}
+	security, err := s.SecurityProfiles.ForProfile(cfg, model.GuardrailProfile)
+	if err != nil {
+		return nil, fmt.Errorf("load guardrail profile %s: %w", model.GuardrailProfile, err)
+	}
+	return security, nil
+}
+
+// foreignShell returns the executor's shell when req asks for commands in a
+// different one, or "" when they match or the executor does not say.
+func (s *QueryService) foreignShell(req domain.QueryRequest) string {
+	executor, ok := s.Executor.(ports.ShellExecutor)
+	if req.AssumeShell == "" || !ok {
+		return ""
+	}
+	if shell := filepath.Base(executor.Shell()); shell != req.AssumeShell {
+		return shell
+	}
+	return ""
+}
+
+// evaluate assesses command with security, resolving relative paths against
+// dir when security supports it.
+func evaluate(security ports.SecurityService, command, dir string) (domain.RiskAssessment, error) {
+	if scoped, ok := security.(ports.DirSecurityService); ok && dir != "" {
+		return scoped.EvaluateIn(command, dir)
+	}
+	return security.Evaluate(command)
+}
+
+// riskExplanationLimit caps the model's risk note so it stays a one-line aside.
+const riskExplanationLimit = 300
+
+// riskExplanationPrompt asks for a second opinion on a generated command.
+const riskExplanationPrompt = `In one sentence, explain what could go wrong if this shell command is run, or say it is harmless. Do not suggest a different command.
+
+Command: %s`
+
+// explainRisk asks the model that produced command for a one-sentence risk
+// note. It is advisory: failures are logged and never affect the guardrail.
+// Rule-based providers cannot explain anything, so they get no request.
+func (s *QueryService) explainRisk(ctx context.Context, cfg domain.Config, modelName string, command string) string {
+	model, ok := findModel(cfg, modelName)
+	if !ok {
+		return ""
+	}
+	provider, err := s.ProviderFactory.ForModel(model)
+	if err != nil {
+		s.Logger.Warn("risk explanation unavailable", map[string]interface{}{"error": err.Error()})
+		return ""
+	}
+	if _, ok := provider.(ports.RuleBasedProvider); ok {
+		return ""
+	}
+	resp, err := provider.Generate(ctx, ports.ProviderRequest{
+		Model: model,
+		Messages: []domain.PromptMessage{
+			{Role: "user", Content: fmt.Sprintf(riskExplanationPrompt, command)},
+		},
+	})
+	if err != nil {
+		s.Logger.Warn("risk explanation failed", map[string]interface{}{"error": err.Error()})
+		return ""
+	}
+	note := strings.Join(strings.Fields(resp.Reply), " ")
+	if runes := []rune(note); len(runes) > riskExplanationLimit {
+		note = string(runes[:riskExplanationLimit]) + "..."
+	}
+	return note
+}
+
+// withExplanation returns risk with the model's note appended to the reasons
+// shown at the confirmation prompt. The level and action are left unchanged.
+func withExplanation(risk domain.RiskAssessment, explanation string) domain.RiskAssessment {
+	if explanation == "" {
+		return risk
+	}
+	risk.Reasons = append(slices.Clone(risk.Reasons), "Model risk note: "+explanation)
+	return risk
+}
+
+// copyCommand copies the generated command and records a user-facing notice when it cannot.
+func (s *QueryService) copyCommand(resp *domain.QueryResponse) {
+	if s.Clipboard == nil || !s.Clipboard.Enabled() {
+		resp.ClipboardNotice = "Clipboard unavailable: no clipboard backend found (install pbcopy, wl-copy, xclip or xsel; clip.exe under WSL); command not copied."
+		return
+	}
+	if err := s.Clipboard.Copy(resp.Command); err != nil {
+		s.Logger.Warn("clipboard copy failed", map[string]interface{}{"error": err.Error()})
+		resp.ClipboardNotice = fmt.Sprintf("Clipboard copy failed: %v", err)
+		return
+	}
+	resp.Copied = true
+}
+
+// BlockedError reports a command the guardrail refused to run. It carries the
+// assessment so callers can show the matched rules and safer alternatives.
+type BlockedError struct {
+	Command string
+	Risk    domain.RiskAssessment
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("command blocked by guardrail: %s", e.Command)
+}
+
+// decideExecution returns ChoiceRun when command may run, asking the user
+// when risk or the config requires it, and ChoiceAbort when it must not.
 func (s *QueryService) decideExecution(
 	req domain.QueryRequest,
 	cfg domain.Config,
+	modelName string,
 	risk domain.RiskAssessment,
 	command string,
-) (bool, error) {
+) (domain.ExecutionChoice, error) {
+	if risk.Action == domain.ActionBlock {
+		return domain.ChoiceAbort, &BlockedError{Command: command, Risk: risk}
+	}
+	if req.PreviewOnly || s.foreignShell(req) != "" {
+		return domain.ChoiceAbort, nil
+	}
 	switch risk.Action {
-	case domain.ActionBlock:
-		return false, fmt.Errorf("command blocked by guardrail: %s", command)
 	case domain.ActionPreviewOnly:
-		return false, nil
+		return domain.ChoiceAbort, nil
 	case domain.ActionAllow:
-		return req.AutoExecute || cfg.Preferences.AutoExecuteSafe, nil
+		// A model trusted with safe commands runs them as if auto-execution
+		// were enabled.
+		if s.modelAutoExecutes(cfg, modelName, risk, command) {
+			return domain.ChoiceRun, nil
+		}
+		if !req.AutoExecute && !cfg.ShouldAutoExecuteSafe() {
+			return domain.ChoiceAbort, nil
+		}
+		// Auto-execution defers to execution.confirm_before_execute; only
+		// --yes skips that confirmation.
+		if !cfg.ShouldConfirmBeforeExecution() || req.AssumeYes {
+			return domain.ChoiceRun, nil
+		}
+		return s.confirm(req, cfg, confirmBeforeExecute(risk), command)
 	case domain.ActionSimpleConfirm, domain.ActionConfirm:
-		if s.Prompter == nil || !s.Prompter.Enabled() {
-			return false, nil
+		// --yes and auto_execute_up_to only answer low/medium confirmations;
+		// explicit confirmation and blocks always require a human by design.
+		if req.AssumeYes || s.modelAutoExecutes(cfg, modelName, risk, command) {
+			return domain.ChoiceRun, nil
 		}
-		return s.Prompter.Confirm(risk.Action, risk.Level, command, risk.Reasons)
+		return s.confirm(req, cfg, risk, command)
 	case domain.ActionExplicitConfirm:
-		if s.Prompter == nil || !s.Prompter.Enabled() {
-			return false, nil
+		return s.confirm(req, cfg, risk, command)
+	default:
+		return domain.ChoiceAbort, nil
+	}
+}
+
+// settleChoice acts on choice for resp.Command and returns the final choice;
+// only ChoiceRun runs the command. An edited command is evaluated again and
+// always confirmed before it runs, even when it is safe; a copied one goes to
+// the clipboard instead.
+func (s *QueryService) settleChoice(
+	req domain.QueryRequest,
+	cfg domain.Config,
+	security ports.SecurityService,
+	resp *domain.QueryResponse,
+	choice domain.ExecutionChoice,
+) (domain.ExecutionChoice, error) {
+	for choice == domain.ChoiceEdit {
+		prompter, ok := s.Prompter.(ports.ChoicePrompter)
+		if !ok {
+			return domain.ChoiceAbort, errors.New("edit command: prompter cannot edit")
+		}
+		edited, err := prompter.Edit(resp.Command)
+		if err != nil {
+			return domain.ChoiceAbort, fmt.Errorf("edit command: %w", err)
+		}
+		edited = strings.TrimSpace(edited)
+		if edited == "" {
+			return domain.ChoiceAbort, nil
+		}
+		risk, err := evaluate(security, edited, req.WorkDir)
+		if err != nil {
+			return domain.ChoiceAbort, fmt.Errorf("security evaluate: %w", err)
+		}
+		if risk, err = applyNeverExecute(cfg, risk, edited); err != nil {
+			return domain.ChoiceAbort, err
 		}
-		return s.Prompter.Confirm(risk.Action, risk.Level, command, risk.Reasons)
+		if req.Observer != nil {
+			req.Observer.RiskAssessed(risk)
+		}
+		resp.Command = edited
+		resp.RiskAssessment = risk
+		resp.RiskExplanation = ""
+
+		switch risk.Action {
+		case domain.ActionBlock:
+			return domain.ChoiceAbort, &BlockedError{Command: edited, Risk: risk}
+		case domain.ActionPreviewOnly:
+			return domain.ChoiceAbort, nil
+		case domain.ActionAllow:
+			risk = confirmBeforeExecute(risk)
+		}
+		if choice, err = s.confirm(req, cfg, risk, edited); err != nil {
+			return domain.ChoiceAbort, err
+		}
+	}
+	if choice == domain.ChoiceCopy {
+		s.copyCommand(resp)
+	}
+	return choice, nil
+}
+
+// notifySkipped tells the observer why a command with risk is not run after
+// choice.
+func (s *QueryService) notifySkipped(req domain.QueryRequest, cfg domain.Config, risk domain.RiskAssessment, choice domain.ExecutionChoice) {
+	if req.Observer == nil {
+		return
+	}
+	var reason string
+	switch {
+	case req.PreviewOnly:
+		reason = "preview only requested"
+	case s.foreignShell(req) != "":
+		reason = fmt.Sprintf("command written for %s, but commands run with %s", req.AssumeShell, s.foreignShell(req))
+	case risk.Action == domain.ActionPreviewOnly:
+		reason = "guardrail allows a preview only"
+	case choice == domain.ChoiceCopy:
+		reason = "copied instead of run"
+	case risk.Action == domain.ActionAllow && !req.AutoExecute && !cfg.ShouldAutoExecuteSafe():
+		reason = "safe commands run only with --auto-execute or preferences.auto_execute_safe"
 	default:
-		return false, nil
+		reason = "not confirmed"
 	}
+	req.Observer.Skipped(reason)
 }
 
-func pickModel(cfg domain.Config, override string) (domain.ModelDefinition, error) {
+// logText returns text for a log field. Prompts and commands may contain
+// secrets pasted by the user, so only a digest is logged unless
+// preferences.log_prompts is enabled.
+func logText(cfg domain.Config, text string) string {
+	if cfg.Preferences.LogPrompts {
+		return text
+	}
+	return redact.Digest(text)
+}
+
+// confirmBeforeExecuteReason explains why a safe command is being confirmed.
+const confirmBeforeExecuteReason = "execution.confirm_before_execute is enabled"
+
+// confirmBeforeExecute turns an allowed assessment into a simple confirmation.
+func confirmBeforeExecute(risk domain.RiskAssessment) domain.RiskAssessment {
+	risk.Action = domain.ActionSimpleConfirm
+	risk.Reasons = append(slices.Clip(risk.Reasons), confirmBeforeExecuteReason)
+	return risk
+}
+
+// confirm asks the prompter, treating an unanswered prompt as a refusal. A
+// ports.ChoicePrompter may also answer edit or copy.
+func (s *QueryService) confirm(req domain.QueryRequest, cfg domain.Config, risk domain.RiskAssessment, command string) (domain.ExecutionChoice, error) {
+	if s.Prompter == nil || !s.Prompter.Enabled() {
+		return domain.ChoiceAbort, nil
+	}
+	choice, err := s.ask(risk, command)
+	if errors.Is(err, ports.ErrConfirmationTimeout) {
+		s.Logger.Warn("confirmation timed out, not executing", map[string]interface{}{"command": logText(cfg, command)})
+		choice, err = domain.ChoiceAbort, nil
+	}
+	if err != nil {
+		return domain.ChoiceAbort, err
+	}
+	if req.Observer != nil {
+		req.Observer.Confirmed(risk, choice)
+	}
+	return choice, nil
+}
+
+// ask puts the confirmation to the prompter, mapping a yes/no answer onto
+// ChoiceRun and ChoiceAbort.
+func (s *QueryService) ask(risk domain.RiskAssessment, command string) (domain.ExecutionChoice, error) {
+	if prompter, ok := s.Prompter.(ports.ChoicePrompter); ok {
+		return prompter.Choose(risk.Action, risk.Level, command, risk.Reasons)
+	}
+	ok, err := s.Prompter.Confirm(risk.Action, risk.Level, command, risk.Reasons)
+	if !ok {
+		return domain.ChoiceAbort, err
+	}
+	return domain.ChoiceRun, err
+}
+
+// isConfirmAction reports actions that --yes may answer on the user's behalf.
+func isConfirmAction(action domain.GuardrailAction) bool {
+	return action == domain.ActionSimpleConfirm || action == domain.ActionConfirm
+}
+
+// pickModel returns the override model, else the first routing rule matching
+// prompt, else the default model.
+func pickModel(cfg domain.Config, override, prompt string) (domain.ModelDefinition, error) {
 	name := override
 	if name == "" {
-		name = cfg.Preferences.DefaultModel
+		routed, err := routeModel(cfg, prompt)
+		if err != nil {
+			return domain.ModelDefinition{}, err
+		}
+		name = routed
+	}
+	if name == "" {
+		return DefaultModel(cfg)
+	}
+	if model, ok := findModel(cfg, name); ok {
+		return model, nil
 	}
-	if name == "" && len(cfg.Models) > 0 {
+	return domain.ModelDefinition{}, fmt.Errorf("model %s not configured", name)
+}
+
+// DefaultModel returns the model named by preferences.default_model, or the
+// first configured model when it is unset.
+func DefaultModel(cfg domain.Config) (domain.ModelDefinition, error) {
+	name := cfg.Preferences.DefaultModel
+	if name == "" {
+		if len(cfg.Models) == 0 {
+			return domain.ModelDefinition{}, errors.New("no models configured")
+		}
 		return cfg.Models[0], nil
 	}
 	if model, ok := findModel(cfg, name); ok {
@@ -141,6 +675,7 @@ func (s *QueryService) generateCommand(ctx context.Context, cfg domain.Config, p
 	}
 
 	type result struct {
+		index     int
 		resp      ports.ProviderResponse
 		modelName string
 		err       error
@@ -151,12 +686,12 @@ func (s *QueryService) generateCommand(ctx context.Context, cfg domain.Config, p
 	results := make(chan result, len(candidates))
 	var wg sync.WaitGroup
 
-	for _, model := range candidates {
+	for i, model := range candidates {
 		wg.Add(1)
 		go func(model domain.ModelDefinition) {
 			defer wg.Done()
-			resp, err := s.generateWithModel(ctx, model, req, snapshot)
-			results <- result{resp: resp, modelName: model.Name, err: err}
+			resp, err := s.generateWithModel(ctx, cfg, model, req, snapshot)
+			results <- result{index: i, resp: resp, modelName: model.Name, err: err}
 		}(model)
 	}
 
@@ -165,16 +700,21 @@ func (s *QueryService) generateCommand(ctx context.Context, cfg domain.Config, p
 		close(results)
 	}()
 
-	errs := make([]error, 0, len(candidates))
+	// Candidates are asked concurrently, but the earliest one in fallback
+	// order that succeeds wins: a later model's reply is only used once every
+	// model before it has failed.
+	outcomes := make([]*result, len(candidates))
+	next := 0
 	var success *result
 	for res := range results {
-		if res.err == nil && success == nil {
-			success = &res
-			cancel()
-			continue
-		}
-		if res.err != nil {
-			errs = append(errs, fmt.Errorf("%s: %w", res.modelName, res.err))
+		outcomes[res.index] = &res
+		for success == nil && next < len(outcomes) && outcomes[next] != nil {
+			if outcomes[next].err == nil {
+				success = outcomes[next]
+				cancel()
+				break
+			}
+			next++
 		}
 	}
 
@@ -186,13 +726,22 @@ func (s *QueryService) generateCommand(ctx context.Context, cfg domain.Config, p
 		return success.resp, success.modelName, nil
 	}
 
-	if len(errs) == 0 {
-		return ports.ProviderResponse{}, "", fmt.Errorf("no provider succeeded")
+	// The writer may still show a progress indicator; end it before the error
+	// is reported.
+	if req.Stream && req.StreamWriter != nil {
+		req.StreamWriter.Done()
+	}
+	errs := make([]error, 0, len(candidates))
+	for _, res := range outcomes {
+		errs = append(errs, fmt.Errorf("%s: %w", res.modelName, res.err))
 	}
 	return ports.ProviderResponse{}, "", errors.Join(errs...)
 }
 
-func (s *QueryService) generateWithModel(ctx context.Context, model domain.ModelDefinition, req domain.QueryRequest, snapshot domain.ContextSnapshot) (ports.ProviderResponse, error) {
+func (s *QueryService) generateWithModel(ctx context.Context, cfg domain.Config, model domain.ModelDefinition, req domain.QueryRequest, snapshot domain.ContextSnapshot) (ports.ProviderResponse, error) {
+	if req.Seed != nil {
+		model.Seed = req.Seed
+	}
 	provider, err := s.ProviderFactory.ForModel(model)
 	if err != nil {
 		return ports.ProviderResponse{}, fmt.Errorf("provider init: %w", err)
@@ -201,23 +750,60 @@ func (s *QueryService) generateWithModel(ctx context.Context, model domain.Model
 	s.Logger.Info("calling provider", map[string]interface{}{
 		"provider": provider.Name(),
 		"model":    model.ModelID,
+		"prompt":   logText(cfg, req.Prompt),
 	})
 
 	aiResp, err := provider.Generate(ctx, ports.ProviderRequest{
-		Prompt:       req.Prompt,
-		Context:      snapshot,
-		Model:        model,
-		Debug:        req.Debug,
-		Stream:       req.Stream,
-		StreamWriter: req.StreamWriter,
+		Prompt:          req.Prompt,
+		Context:         snapshot,
+		ContextBudget:   cfg.Context.MaxPromptChars,
+		SanitizeContext: cfg.ShouldSanitizeContext(),
+		SystemPreamble:  cfg.Preferences.SystemPreamble,
+		Model:           model,
+		Debug:           req.Debug,
+		Stream:          req.Stream,
+		StreamWriter:    req.StreamWriter,
 	})
 	if err != nil {
 		return ports.ProviderResponse{}, fmt.Errorf("provider generate: %w", err)
 	}
+	aiResp.Command, err = applyOutputFilters(aiResp.Command, cfg.Preferences.OutputFilters)
+	if err != nil {
+		return ports.ProviderResponse{}, err
+	}
+	// An empty command lets fallback models answer instead of surfacing prose.
+	if strings.TrimSpace(aiResp.Command) == "" {
+		return ports.ProviderResponse{}, noCommandError(aiResp.Reply)
+	}
 
 	return aiResp, nil
 }
 
+// ErrNoCommand reports a model reply from which no command could be extracted.
+var ErrNoCommand = errors.New("no executable command produced")
+
+// replyPreviewLimit caps how much of a prose reply is quoted in ErrNoCommand.
+const replyPreviewLimit = 200
+
+// noCommandError wraps ErrNoCommand with the start of the model's reply so the
+// user can see what it said instead.
+func noCommandError(reply string) error {
+	reply = strings.Join(strings.Fields(reply), " ")
+	if reply == "" {
+		return ErrNoCommand
+	}
+	if runes := []rune(reply); len(runes) > replyPreviewLimit {
+		reply = string(runes[:replyPreviewLimit]) + "..."
+	}
+	return fmt.Errorf("%w; model replied: %q", ErrNoCommand, reply)
+}
+
+// CandidateModels returns the models a query answered by primary tries, in
+// order: primary first, then each configured fallback once.
+func (s *QueryService) CandidateModels(cfg domain.Config, primary domain.ModelDefinition) []domain.ModelDefinition {
+	return s.buildCandidateModels(cfg, primary)
+}
+
 func (s *QueryService) buildCandidateModels(cfg domain.Config, primary domain.ModelDefinition) []domain.ModelDefinition {
 	candidates := make([]domain.ModelDefinition, 0, 1+len(cfg.Preferences.FallbackModels))
 	candidates = append(candidates, primary)
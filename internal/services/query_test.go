@@ -2,10 +2,17 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/doeshing/shai-go/internal/domain"
 	"github.com/doeshing/shai-go/internal/pkg/logger"
+	"github.com/doeshing/shai-go/internal/pkg/redact"
 	"github.com/doeshing/shai-go/internal/ports"
 )
 
@@ -34,6 +41,8 @@ func TestServiceRunExecutesCommandWhenAllowed(t *testing.T) {
 		Context:     context.Background(),
 		Prompt:      "list files",
 		AutoExecute: true,
+		WorkDir:     "/srv/app",
+		Env:         map[string]string{"KUBECONFIG": "/tmp/dev.yaml"},
 	})
 	if err != nil {
 		t.Fatalf("Run() error = %v", err)
@@ -44,6 +53,12 @@ func TestServiceRunExecutesCommandWhenAllowed(t *testing.T) {
 	if !executor.called {
 		t.Fatal("executor was not called")
 	}
+	if executor.dir != "/srv/app" {
+		t.Errorf("executor dir = %q, want /srv/app", executor.dir)
+	}
+	if executor.env["KUBECONFIG"] != "/tmp/dev.yaml" {
+		t.Errorf("executor env = %v, want the request's --env variables", executor.env)
+	}
 }
 
 func TestServiceRunBlocksWhenGuardrailBlocks(t *testing.T) {
@@ -56,9 +71,13 @@ func TestServiceRunBlocksWhenGuardrailBlocks(t *testing.T) {
 		ConfigProvider:   stubConfigProvider{cfg: cfg},
 		ContextCollector: stubContextCollector{snapshot: domain.ContextSnapshot{WorkingDir: "/tmp"}},
 		ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
-		SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: domain.ActionBlock}},
-		Executor:         &stubExecutor{},
-		Logger:           logger.NewStd(false),
+		SecurityService: stubSecurity{risk: domain.RiskAssessment{
+			Action:        domain.ActionBlock,
+			Reasons:       []string{"Deleting root directory"},
+			DryRunCommand: "ls -la /",
+		}},
+		Executor: &stubExecutor{},
+		Logger:   logger.NewStd(false),
 	}
 
 	_, err := svc.Run(domain.QueryRequest{
@@ -68,6 +87,13 @@ func TestServiceRunBlocksWhenGuardrailBlocks(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error due to guardrail block")
 	}
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("error %v is not a *BlockedError", err)
+	}
+	if blocked.Command != "ls" || blocked.Risk.DryRunCommand != "ls -la /" || len(blocked.Risk.Reasons) != 1 {
+		t.Errorf("blocked = %+v, want the command and its assessment", blocked)
+	}
 }
 
 type stubConfigProvider struct {
@@ -121,9 +147,1116 @@ type stubExecutor struct {
 	result domain.ExecutionResult
 	err    error
 	called bool
+	dir    string
+	env    map[string]string
 }
 
-func (s *stubExecutor) Execute(context.Context, string) (domain.ExecutionResult, error) {
+func (s *stubExecutor) Execute(_ context.Context, _ string, dir string, env map[string]string) (domain.ExecutionResult, error) {
 	s.called = true
+	s.dir = dir
+	s.env = env
 	return s.result, s.err
 }
+
+func TestServiceRunCopiesCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		alwaysCopy bool
+		copyFlag   bool
+		clipboard  *fakeClipboard
+		wantCopied string
+		wantNotice bool
+	}{
+		{name: "copy flag", copyFlag: true, clipboard: &fakeClipboard{enabled: true}, wantCopied: "ls"},
+		{name: "always copy preference", alwaysCopy: true, clipboard: &fakeClipboard{enabled: true}, wantCopied: "ls"},
+		{name: "not requested", clipboard: &fakeClipboard{enabled: true}},
+		{name: "no backend", copyFlag: true, clipboard: &fakeClipboard{}, wantNotice: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude", AlwaysCopy: tt.alwaysCopy},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude", Endpoint: "anthropic"}},
+			}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: domain.ActionAllow}},
+				Executor:         &stubExecutor{},
+				Clipboard:        tt.clipboard,
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list", CopyToClipboard: tt.copyFlag})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if tt.clipboard.text != tt.wantCopied {
+				t.Errorf("copied %q, want %q", tt.clipboard.text, tt.wantCopied)
+			}
+			if resp.Copied != (tt.wantCopied != "") {
+				t.Errorf("resp.Copied = %v", resp.Copied)
+			}
+			if (resp.ClipboardNotice != "") != tt.wantNotice {
+				t.Errorf("resp.ClipboardNotice = %q, wantNotice %v", resp.ClipboardNotice, tt.wantNotice)
+			}
+		})
+	}
+}
+
+type fakeClipboard struct {
+	enabled bool
+	text    string
+}
+
+func (f *fakeClipboard) Enabled() bool { return f.enabled }
+
+func (f *fakeClipboard) Copy(text string) error {
+	f.text = text
+	return nil
+}
+
+func TestServiceRunAssumeYes(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      domain.GuardrailAction
+		assumeYes   bool
+		autoExecute bool
+		wantRun     bool
+	}{
+		{name: "medium risk with --yes", action: domain.ActionConfirm, assumeYes: true, wantRun: true},
+		{name: "low risk with --yes", action: domain.ActionSimpleConfirm, assumeYes: true, wantRun: true},
+		{name: "high risk with --yes", action: domain.ActionExplicitConfirm, assumeYes: true},
+		{name: "medium risk without --yes", action: domain.ActionConfirm},
+		{name: "auto-execute does not imply --yes", action: domain.ActionConfirm, autoExecute: true},
+		{name: "interactive command without a TTY ignores --yes", action: domain.ActionPreviewOnly, assumeYes: true, autoExecute: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude"},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude", Endpoint: "anthropic"}},
+			}
+			executor := &stubExecutor{result: domain.ExecutionResult{Ran: true}}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: tt.action}},
+				Executor:         executor,
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{
+				Context:     context.Background(),
+				Prompt:      "restart service",
+				AssumeYes:   tt.assumeYes,
+				AutoExecute: tt.autoExecute,
+			})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if executor.called != tt.wantRun {
+				t.Errorf("executed = %v, want %v", executor.called, tt.wantRun)
+			}
+			if resp.AutoConfirmed != tt.wantRun {
+				t.Errorf("AutoConfirmed = %v, want %v", resp.AutoConfirmed, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestServiceRunAppliesModelGuardrailProfile(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "cloud"},
+		Models: []domain.ModelDefinition{
+			{Name: "cloud", ModelID: "cloud", Endpoint: "https://api.example.com"},
+			{Name: "local", ModelID: "local", Endpoint: "http://localhost", GuardrailProfile: "relaxed"},
+		},
+	}
+	profiles := stubSecurityProfiles{
+		"relaxed": stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskLow, Action: domain.ActionAllow}},
+	}
+
+	tests := []struct {
+		model      string
+		wantAction domain.GuardrailAction
+	}{
+		{model: "cloud", wantAction: domain.ActionConfirm},
+		{model: "local", wantAction: domain.ActionAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskMedium, Action: domain.ActionConfirm}},
+				SecurityProfiles: profiles,
+				Executor:         &stubExecutor{},
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list", ModelOverride: tt.model})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if resp.RiskAssessment.Action != tt.wantAction {
+				t.Errorf("action = %s, want %s", resp.RiskAssessment.Action, tt.wantAction)
+			}
+		})
+	}
+}
+
+type stubSecurityProfiles map[string]ports.SecurityService
+
+func (s stubSecurityProfiles) ForProfile(_ domain.Config, profile string) (ports.SecurityService, error) {
+	return s[profile], nil
+}
+
+// riskNoteProvider returns a command for generation requests and a canned
+// risk note for requests that carry explicit messages.
+type riskNoteProvider struct {
+	noteCalls int
+}
+
+func (*riskNoteProvider) Name() string                  { return "risk-note" }
+func (*riskNoteProvider) Model() domain.ModelDefinition { return domain.ModelDefinition{} }
+func (p *riskNoteProvider) Generate(_ context.Context, req ports.ProviderRequest) (ports.ProviderResponse, error) {
+	if len(req.Messages) > 0 {
+		p.noteCalls++
+		return ports.ProviderResponse{Reply: "Deletes the build directory\nirreversibly."}, nil
+	}
+	return ports.ProviderResponse{Command: "rm -rf build"}, nil
+}
+
+// ruleRiskNoteProvider is a riskNoteProvider that claims to be rule-based.
+type ruleRiskNoteProvider struct {
+	*riskNoteProvider
+}
+
+func (ruleRiskNoteProvider) RuleBased() {}
+
+type recordingPrompter struct {
+	reasons []string
+}
+
+func (p *recordingPrompter) Enabled() bool { return true }
+func (p *recordingPrompter) Confirm(_ domain.GuardrailAction, _ domain.RiskLevel, _ string, reasons []string) (bool, error) {
+	p.reasons = reasons
+	return false, nil
+}
+
+func TestServiceRunExplainRisk(t *testing.T) {
+	const note = "Deletes the build directory irreversibly."
+
+	tests := []struct {
+		name        string
+		action      domain.GuardrailAction
+		explainRisk bool
+		ruleBased   bool
+		wantNote    string
+		wantCalls   int
+		wantErr     bool
+	}{
+		{name: "note shown at confirmation", action: domain.ActionConfirm, explainRisk: true, wantNote: note, wantCalls: 1},
+		{name: "block makes no extra call", action: domain.ActionBlock, explainRisk: true, wantErr: true},
+		{name: "rule-based provider makes no extra call", action: domain.ActionConfirm, explainRisk: true, ruleBased: true},
+		{name: "flag off makes no extra call", action: domain.ActionConfirm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude"},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude", Endpoint: "anthropic"}},
+			}
+			provider := &riskNoteProvider{}
+			var generator ports.Provider = provider
+			if tt.ruleBased {
+				generator = ruleRiskNoteProvider{provider}
+			}
+			prompter := &recordingPrompter{}
+			executor := &stubExecutor{}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: generator},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: tt.action, Reasons: []string{"Recursive delete"}}},
+				Executor:         executor,
+				Prompter:         prompter,
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{
+				Context:     context.Background(),
+				Prompt:      "clean the build",
+				ExplainRisk: tt.explainRisk,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if resp.RiskExplanation != tt.wantNote {
+				t.Errorf("RiskExplanation = %q, want %q", resp.RiskExplanation, tt.wantNote)
+			}
+			if resp.RiskAssessment.Action != tt.action {
+				t.Errorf("Action = %s, want %s unchanged", resp.RiskAssessment.Action, tt.action)
+			}
+			if executor.called {
+				t.Error("command must not run")
+			}
+			if provider.noteCalls != tt.wantCalls {
+				t.Errorf("risk note requests = %d, want %d", provider.noteCalls, tt.wantCalls)
+			}
+			if tt.action == domain.ActionConfirm {
+				wantReasons := 1
+				if tt.wantNote != "" {
+					wantReasons = 2
+				}
+				if len(prompter.reasons) != wantReasons {
+					t.Errorf("prompter reasons = %q, want %d entries", prompter.reasons, wantReasons)
+				}
+				if len(resp.RiskAssessment.Reasons) != 1 {
+					t.Errorf("assessment reasons modified: %q", resp.RiskAssessment.Reasons)
+				}
+			}
+		})
+	}
+}
+
+// sequenceProvider returns its commands in order and records each prompt.
+type sequenceProvider struct {
+	commands []string
+	prompts  []string
+}
+
+func (*sequenceProvider) Name() string                  { return "sequence" }
+func (*sequenceProvider) Model() domain.ModelDefinition { return domain.ModelDefinition{} }
+func (p *sequenceProvider) Generate(_ context.Context, req ports.ProviderRequest) (ports.ProviderResponse, error) {
+	command := p.commands[min(len(p.prompts), len(p.commands)-1)]
+	p.prompts = append(p.prompts, req.Prompt)
+	return ports.ProviderResponse{Command: command}, nil
+}
+
+func TestServiceRunRefusesDeniedCommands(t *testing.T) {
+	tests := []struct {
+		name        string
+		commands    []string
+		wantCommand string
+		wantErr     bool
+	}{
+		{name: "re-prompt finds alternative", commands: []string{"brew upgrade", "brew outdated"}, wantCommand: "brew outdated"},
+		{name: "denied twice is refused", commands: []string{"brew upgrade", "brew upgrade --greedy"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude", DeniedCommands: []string{"brew upgrade"}},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude", Endpoint: "anthropic"}},
+			}
+			provider := &sequenceProvider{commands: tt.commands}
+			executor := &stubExecutor{result: domain.ExecutionResult{Ran: true}}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: provider},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: domain.ActionAllow}},
+				Executor:         executor,
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "update packages", AutoExecute: true})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "deny list") {
+					t.Fatalf("Run() error = %v, want deny list error", err)
+				}
+				if executor.called || resp.Command != "" {
+					t.Errorf("denied command leaked: executed=%v command=%q", executor.called, resp.Command)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				if resp.Command != tt.wantCommand {
+					t.Errorf("Command = %q, want %q", resp.Command, tt.wantCommand)
+				}
+			}
+			if len(provider.prompts) != 2 || !strings.Contains(provider.prompts[1], `Do not suggest "brew upgrade"`) {
+				t.Errorf("expected one re-prompt naming the denied command, got %q", provider.prompts)
+			}
+		})
+	}
+}
+
+type timeoutPrompter struct{}
+
+func (timeoutPrompter) Enabled() bool { return true }
+func (timeoutPrompter) Confirm(domain.GuardrailAction, domain.RiskLevel, string, []string) (bool, error) {
+	return false, ports.ErrConfirmationTimeout
+}
+
+func TestServiceRunConfirmTimeoutSkipsExecution(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "claude"},
+		Models: []domain.ModelDefinition{
+			{Name: "claude", ModelID: "claude", Endpoint: "anthropic"},
+		},
+	}
+	executor := &stubExecutor{}
+	svc := &QueryService{
+		ConfigProvider:   stubConfigProvider{cfg: cfg},
+		ContextCollector: stubContextCollector{},
+		ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+		SecurityService:  stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskHigh, Action: domain.ActionExplicitConfirm}},
+		Executor:         executor,
+		Logger:           logger.NewStd(false),
+		Prompter:         timeoutPrompter{},
+	}
+
+	resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "clean"})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if executor.called || resp.ExecutionPlanned {
+		t.Fatalf("command should not run after a confirmation timeout: %+v", resp)
+	}
+}
+
+func TestServiceRunPreviewOnlyNeverExecutes(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "claude", AutoExecuteSafe: true},
+		Models: []domain.ModelDefinition{
+			{Name: "claude", ModelID: "claude", Endpoint: "anthropic"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		action  domain.GuardrailAction
+		wantErr bool
+	}{
+		{name: "allowed", action: domain.ActionAllow},
+		{name: "confirm", action: domain.ActionConfirm},
+		{name: "blocked", action: domain.ActionBlock, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &stubExecutor{}
+			prompter := &recordingPrompter{}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: tt.action, Reasons: []string{"test"}}},
+				Executor:         executor,
+				Logger:           logger.NewStd(false),
+				Prompter:         prompter,
+			}
+
+			_, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list", AutoExecute: true, PreviewOnly: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if executor.called {
+				t.Error("executor should not run in preview-only mode")
+			}
+			if prompter.reasons != nil {
+				t.Error("prompter should not be asked in preview-only mode")
+			}
+		})
+	}
+}
+
+func TestServiceRunConfirmBeforeExecute(t *testing.T) {
+	tests := []struct {
+		name            string
+		confirmBefore   bool
+		autoExecuteSafe bool
+		req             domain.QueryRequest
+		wantPrompt      bool
+		wantRun         bool
+	}{
+		{name: "auto_execute_safe prompts", confirmBefore: true, autoExecuteSafe: true, wantPrompt: true},
+		{name: "--auto-execute prompts", confirmBefore: true, req: domain.QueryRequest{AutoExecute: true}, wantPrompt: true},
+		{name: "--yes overrides", confirmBefore: true, req: domain.QueryRequest{AutoExecute: true, AssumeYes: true}, wantRun: true},
+		{name: "flag off auto-runs", autoExecuteSafe: true, wantRun: true},
+		{name: "no auto-execute only previews", confirmBefore: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude", AutoExecuteSafe: tt.autoExecuteSafe},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude", Endpoint: "anthropic"}},
+				Execution:   domain.ExecutionSettings{ConfirmBeforeExecute: tt.confirmBefore},
+			}
+			prompter := &recordingPrompter{}
+			executor := &stubExecutor{result: domain.ExecutionResult{Ran: true}}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}},
+				Executor:         executor,
+				Prompter:         prompter,
+				Logger:           logger.NewStd(false),
+			}
+
+			req := tt.req
+			req.Context = context.Background()
+			req.Prompt = "list files"
+			if _, err := svc.Run(req); err != nil {
+				t.Fatalf("Run error: %v", err)
+			}
+			prompted := slices.Contains(prompter.reasons, confirmBeforeExecuteReason)
+			if prompted != tt.wantPrompt {
+				t.Errorf("prompted = %v, want %v (reasons %q)", prompted, tt.wantPrompt, prompter.reasons)
+			}
+			if executor.called != tt.wantRun {
+				t.Errorf("executed = %v, want %v", executor.called, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestServiceRunFallsBackWhenNoCommand(t *testing.T) {
+	const prose = "Sure! To see disk usage you could look at the du utility."
+	tests := []struct {
+		name        string
+		fallback    ports.Provider
+		wantCommand string
+	}{
+		{name: "fallback answers", fallback: fixedProvider{command: "du -sh *"}, wantCommand: "du -sh *"},
+		{name: "every model replies with prose", fallback: fixedProvider{reply: prose}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "chatty", FallbackModels: []string{"backup"}},
+				Models: []domain.ModelDefinition{
+					{Name: "chatty", ModelID: "chatty"},
+					{Name: "backup", ModelID: "backup"},
+				},
+			}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory: modelProviderFactory{
+					"chatty": fixedProvider{reply: prose},
+					"backup": tt.fallback,
+				},
+				SecurityService: stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}},
+				Executor:        &stubExecutor{},
+				Logger:          logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "disk usage"})
+			if tt.wantCommand == "" {
+				if !errors.Is(err, ErrNoCommand) {
+					t.Fatalf("error = %v, want ErrNoCommand", err)
+				}
+				if !strings.Contains(err.Error(), prose) {
+					t.Errorf("error %q does not quote the model reply", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run error: %v", err)
+			}
+			if resp.Command != tt.wantCommand {
+				t.Errorf("command = %q, want %q", resp.Command, tt.wantCommand)
+			}
+		})
+	}
+}
+
+// slowProvider answers like fixedProvider after delay, or fails once ctx is cancelled.
+type slowProvider struct {
+	fixedProvider
+	delay time.Duration
+}
+
+func (p slowProvider) Generate(ctx context.Context, req ports.ProviderRequest) (ports.ProviderResponse, error) {
+	select {
+	case <-time.After(p.delay):
+		return p.fixedProvider.Generate(ctx, req)
+	case <-ctx.Done():
+		return ports.ProviderResponse{}, ctx.Err()
+	}
+}
+
+// recordingStreamWriter counts Done calls.
+type recordingStreamWriter struct {
+	chunks []string
+	done   int
+}
+
+func (w *recordingStreamWriter) WriteChunk(text string) { w.chunks = append(w.chunks, text) }
+func (w *recordingStreamWriter) Done()                  { w.done++ }
+
+func TestServiceRunEndsStreamOnError(t *testing.T) {
+	cfg := domain.Config{Models: []domain.ModelDefinition{{Name: "claude", ModelID: "claude", Endpoint: "anthropic"}}}
+	writer := &recordingStreamWriter{}
+	svc := &QueryService{
+		ConfigProvider:   stubConfigProvider{cfg: cfg},
+		ContextCollector: stubContextCollector{},
+		ProviderFactory:  stubProviderFactory{provider: fixedProvider{err: errors.New("unavailable")}},
+		SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: domain.ActionAllow}},
+		Executor:         &stubExecutor{},
+		Logger:           logger.NewStd(false),
+	}
+
+	_, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list files", Stream: true, StreamWriter: writer})
+	if err == nil {
+		t.Fatal("Run() error = nil, want the provider error")
+	}
+	if writer.done != 1 {
+		t.Errorf("stream Done calls = %d, want 1 so the indicator is cleared", writer.done)
+	}
+}
+
+func TestServiceRunPrefersEarliestFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   ports.Provider
+		wantModel string
+	}{
+		{name: "slow primary still wins", primary: slowProvider{fixedProvider{command: "df -h"}, 30 * time.Millisecond}, wantModel: "primary"},
+		{name: "failed primary falls back", primary: slowProvider{fixedProvider{err: errors.New("rate limited")}, 30 * time.Millisecond}, wantModel: "backup"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "primary", FallbackModels: []string{"backup"}},
+				Models:      []domain.ModelDefinition{{Name: "primary"}, {Name: "backup"}},
+			}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory: modelProviderFactory{
+					"primary": tt.primary,
+					"backup":  fixedProvider{command: "du -sh *"},
+				},
+				SecurityService: stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}},
+				Executor:        &stubExecutor{},
+				Logger:          logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "disk usage"})
+			if err != nil {
+				t.Fatalf("Run error: %v", err)
+			}
+			if resp.ModelUsed != tt.wantModel {
+				t.Errorf("model used = %s, want %s", resp.ModelUsed, tt.wantModel)
+			}
+		})
+	}
+}
+
+// recordingObserver keeps the confirmation and skip notifications of a query.
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) ContextCollected(domain.ContextSnapshot) {}
+func (o *recordingObserver) CommandGenerated(string, string)         {}
+func (o *recordingObserver) RiskAssessed(domain.RiskAssessment)      {}
+func (o *recordingObserver) Executed(domain.ExecutionResult)         {}
+
+func (o *recordingObserver) Confirmed(risk domain.RiskAssessment, choice domain.ExecutionChoice) {
+	o.events = append(o.events, fmt.Sprintf("confirm %s %s", risk.Action, choice))
+}
+
+func (o *recordingObserver) Skipped(reason string) {
+	o.events = append(o.events, "skipped "+reason)
+}
+
+func TestServiceRunNotifiesSkips(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      domain.GuardrailAction
+		autoExecute bool
+		want        []string
+	}{
+		{name: "declined", action: domain.ActionConfirm, want: []string{"confirm confirm abort", "skipped not confirmed"}},
+		{name: "preview only", action: domain.ActionPreviewOnly, want: []string{"skipped guardrail allows a preview only"}},
+		{name: "safe without auto-execute", action: domain.ActionAllow,
+			want: []string{"skipped safe commands run only with --auto-execute or preferences.auto_execute_safe"}},
+		{name: "executed", action: domain.ActionAllow, autoExecute: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude"},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude"}},
+			}
+			observer := &recordingObserver{}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: tt.action}},
+				Executor:         &stubExecutor{result: domain.ExecutionResult{Ran: true}},
+				Prompter:         &recordingPrompter{},
+				Logger:           logger.NewStd(false),
+			}
+
+			if _, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list", AutoExecute: tt.autoExecute, Observer: observer}); err != nil {
+				t.Fatalf("Run error: %v", err)
+			}
+			if !slices.Equal(observer.events, tt.want) {
+				t.Errorf("events = %q, want %q", observer.events, tt.want)
+			}
+		})
+	}
+}
+
+// recordingLogger keeps every logged message with its fields.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(msg string, fields map[string]interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(msg, fields))
+}
+
+func (l *recordingLogger) Debug(msg string, fields map[string]interface{}) { l.record(msg, fields) }
+func (l *recordingLogger) Info(msg string, fields map[string]interface{})  { l.record(msg, fields) }
+func (l *recordingLogger) Warn(msg string, fields map[string]interface{})  { l.record(msg, fields) }
+func (l *recordingLogger) Error(msg string, _ error, fields map[string]interface{}) {
+	l.record(msg, fields)
+}
+
+func TestServiceRunMasksPromptsInLogs(t *testing.T) {
+	const prompt = "deploy with token sk-live-0123456789"
+	tests := []struct {
+		name       string
+		logPrompts bool
+		wantPrompt bool
+	}{
+		{name: "hashed by default"},
+		{name: "log_prompts shows prompt", logPrompts: true, wantPrompt: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude", LogPrompts: tt.logPrompts},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude"}},
+			}
+			log := &recordingLogger{}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}},
+				Executor:         &stubExecutor{},
+				Logger:           log,
+			}
+
+			if _, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: prompt}); err != nil {
+				t.Fatalf("Run error: %v", err)
+			}
+			logged := strings.Join(log.lines, "\n")
+			if got := strings.Contains(logged, prompt); got != tt.wantPrompt {
+				t.Errorf("prompt in logs = %v, want %v:\n%s", got, tt.wantPrompt, logged)
+			}
+			if digest := redact.Digest(prompt); !tt.wantPrompt && !strings.Contains(logged, digest) {
+				t.Errorf("logs missing prompt digest %s:\n%s", digest, logged)
+			}
+		})
+	}
+}
+
+func TestBuildCandidateModelsFollowsReorder(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  string
+		anchor string
+		after  bool
+		want   string
+	}{
+		{name: "before", model: "local", anchor: "gpt4", want: "claude,local,gpt4,gemini"},
+		{name: "after", model: "gpt4", anchor: "gemini", after: true, want: "claude,gemini,gpt4,local"},
+		{name: "adds new fallback", model: "mistral", anchor: "gemini", want: "claude,gpt4,mistral,gemini,local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude", FallbackModels: []string{"gpt4", "gemini", "local"}},
+				Models: []domain.ModelDefinition{
+					{Name: "claude"}, {Name: "gpt4"}, {Name: "gemini"}, {Name: "local"}, {Name: "mistral"},
+				},
+			}
+			if err := cfg.MoveFallbackModel(tt.model, tt.anchor, tt.after); err != nil {
+				t.Fatalf("MoveFallbackModel error: %v", err)
+			}
+
+			svc := &QueryService{}
+			var names []string
+			for _, model := range svc.buildCandidateModels(cfg, cfg.Models[0]) {
+				names = append(names, model.Name)
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("candidates = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	cfg := domain.Config{
+		Preferences: domain.Preferences{FallbackModels: []string{"gpt4"}},
+		Models:      []domain.ModelDefinition{{Name: "gpt4"}, {Name: "local"}},
+	}
+	for _, args := range [][2]string{{"missing", "gpt4"}, {"local", "missing"}, {"gpt4", "gpt4"}} {
+		if err := cfg.MoveFallbackModel(args[0], args[1], false); err == nil {
+			t.Errorf("MoveFallbackModel(%s, %s): expected error", args[0], args[1])
+		}
+	}
+}
+
+func TestServiceRunRecordsStageTimings(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "claude"},
+		Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude"}},
+	}
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := &QueryService{
+		ConfigProvider:   stubConfigProvider{cfg: cfg},
+		ContextCollector: stubContextCollector{},
+		ProviderFactory:  stubProviderFactory{provider: stubProvider{}},
+		SecurityService:  stubSecurity{risk: domain.RiskAssessment{Level: domain.RiskSafe, Action: domain.ActionAllow}},
+		Executor:         &stubExecutor{result: domain.ExecutionResult{Ran: true}},
+		Logger:           logger.NewStd(false),
+		Now: func() time.Time {
+			clock = clock.Add(5 * time.Millisecond)
+			return clock
+		},
+	}
+
+	resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list files", AutoExecute: true})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	want := []string{
+		domain.StageLoadConfig, domain.StageCollectContext, domain.StageGenerate, domain.StageEvaluate, domain.StageExecute,
+	}
+	var stages []string
+	for _, timing := range resp.Timings {
+		stages = append(stages, timing.Stage)
+		if timing.Duration != 5*time.Millisecond {
+			t.Errorf("%s took %s, want 5ms from the fake clock", timing.Stage, timing.Duration)
+		}
+	}
+	if !slices.Equal(stages, want) {
+		t.Errorf("stages = %q, want %q", stages, want)
+	}
+}
+
+// modelRecordingFactory remembers the model definitions providers were built for.
+type modelRecordingFactory struct {
+	models *[]domain.ModelDefinition
+}
+
+func (f modelRecordingFactory) ForModel(model domain.ModelDefinition) (ports.Provider, error) {
+	*f.models = append(*f.models, model)
+	return stubProvider{}, nil
+}
+
+func TestServiceRunSeedOverridesModel(t *testing.T) {
+	configured, override := 1, 7
+	tests := []struct {
+		name string
+		seed *int
+		want *int
+	}{
+		{name: "model seed", want: &configured},
+		{name: "request seed wins", seed: &override, want: &override},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude"},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude", Seed: &configured}},
+			}
+			var built []domain.ModelDefinition
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{snapshot: domain.ContextSnapshot{WorkingDir: "/tmp"}},
+				ProviderFactory:  modelRecordingFactory{models: &built},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: domain.ActionAllow}},
+				Executor:         &stubExecutor{},
+				Logger:           logger.NewStd(false),
+			}
+			if _, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "list files", PreviewOnly: true, Seed: tt.seed}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if len(built) != 1 || built[0].Seed == nil || *built[0].Seed != *tt.want {
+				t.Fatalf("provider models = %+v, want seed %d", built, *tt.want)
+			}
+			if *cfg.Models[0].Seed != configured {
+				t.Errorf("configured seed changed to %d", *cfg.Models[0].Seed)
+			}
+		})
+	}
+}
+
+// fixingProvider suggests a broken command until the prompt reports its failure.
+type fixingProvider struct {
+	prompts *[]string
+}
+
+func (fixingProvider) Name() string                  { return "fixing" }
+func (fixingProvider) Model() domain.ModelDefinition { return domain.ModelDefinition{} }
+func (p fixingProvider) Generate(_ context.Context, req ports.ProviderRequest) (ports.ProviderResponse, error) {
+	*p.prompts = append(*p.prompts, req.Prompt)
+	if strings.Contains(req.Prompt, "failed with exit code") {
+		return ports.ProviderResponse{Command: "ls -la"}, nil
+	}
+	return ports.ProviderResponse{Command: "ls --bogus"}, nil
+}
+
+// scriptedExecutor fails the commands listed in failures with exit code 2.
+type scriptedExecutor struct {
+	failures map[string]bool
+	ran      []string
+}
+
+func (e *scriptedExecutor) Execute(_ context.Context, command string, _ string, _ map[string]string) (domain.ExecutionResult, error) {
+	e.ran = append(e.ran, command)
+	if e.failures[command] {
+		err := errors.New("exit status 2")
+		return domain.ExecutionResult{ExitCode: 2, Stderr: "ls: unrecognized option '--bogus'", Err: err}, err
+	}
+	return domain.ExecutionResult{Ran: true, Stdout: "ok"}, nil
+}
+
+func TestServiceRunFixOnFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixAttempts int
+		failures    map[string]bool
+		wantRan     []string
+		wantErr     bool
+		wantFailed  int
+	}{
+		{
+			name:        "fixed after one failure",
+			fixAttempts: 2,
+			failures:    map[string]bool{"ls --bogus": true},
+			wantRan:     []string{"ls --bogus", "ls -la"},
+			wantFailed:  1,
+		},
+		{
+			name:     "disabled",
+			failures: map[string]bool{"ls --bogus": true},
+			wantRan:  []string{"ls --bogus"},
+			wantErr:  true,
+		},
+		{
+			name:        "gives up after the limit",
+			fixAttempts: 2,
+			failures:    map[string]bool{"ls --bogus": true, "ls -la": true},
+			wantRan:     []string{"ls --bogus", "ls -la", "ls -la"},
+			wantErr:     true,
+			wantFailed:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude"},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude"}},
+			}
+			var prompts []string
+			executor := &scriptedExecutor{failures: tt.failures}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{snapshot: domain.ContextSnapshot{WorkingDir: "/tmp"}},
+				ProviderFactory:  stubProviderFactory{provider: fixingProvider{prompts: &prompts}},
+				SecurityService:  stubSecurity{risk: domain.RiskAssessment{Action: domain.ActionAllow}},
+				Executor:         executor,
+				Logger:           logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{
+				Context:     context.Background(),
+				Prompt:      "list files",
+				AutoExecute: true,
+				FixAttempts: tt.fixAttempts,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(executor.ran, tt.wantRan) {
+				t.Errorf("ran %q, want %q", executor.ran, tt.wantRan)
+			}
+			if len(resp.FailedAttempts) != tt.wantFailed {
+				t.Errorf("failed attempts = %+v, want %d", resp.FailedAttempts, tt.wantFailed)
+			}
+			if tt.wantFailed > 0 {
+				if !strings.Contains(prompts[1], `"ls --bogus" failed with exit code 2`) || !strings.Contains(prompts[1], "unrecognized option") {
+					t.Errorf("fix prompt lacks the failure and stderr:\n%s", prompts[1])
+				}
+			}
+			if !tt.wantErr && (resp.Command != "ls -la" || !resp.ExecutionPlanned) {
+				t.Errorf("resp = %q planned %v, want the fixed command executed", resp.Command, resp.ExecutionPlanned)
+			}
+		})
+	}
+}
+
+func TestFixStderr(t *testing.T) {
+	t.Setenv("SHAI_TEST_API_TOKEN", "tok-from-environment")
+
+	tests := []struct {
+		name   string
+		stderr string
+		env    map[string]string
+		want   string
+	}{
+		{name: "empty", stderr: "  \n", want: "(no error output)"},
+		{
+			name:   "environment secret",
+			stderr: "curl: 401 for token tok-from-environment",
+			want:   "curl: 401 for token ***",
+		},
+		{
+			name:   "env flag secret",
+			stderr: "login failed for hunter2-password\n",
+			env:    map[string]string{"DB_PASSWORD": "hunter2-password", "REGION": "failed"},
+			want:   "login failed for ***",
+		},
+		{
+			name:   "capped by rune",
+			stderr: "錯" + strings.Repeat("誤", fixStderrLimit),
+			want:   "..." + strings.Repeat("誤", fixStderrLimit),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fixStderr(tt.stderr, tt.env); got != tt.want {
+				t.Errorf("fixStderr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// choicePrompter answers each confirmation with the next of choices and each
+// edit with the next of edits.
+type choicePrompter struct {
+	choices []domain.ExecutionChoice
+	edits   []string
+	asked   []string
+}
+
+func (p *choicePrompter) Enabled() bool { return true }
+func (p *choicePrompter) Confirm(domain.GuardrailAction, domain.RiskLevel, string, []string) (bool, error) {
+	return false, errors.New("Confirm called on a choice prompter")
+}
+
+func (p *choicePrompter) Choose(_ domain.GuardrailAction, _ domain.RiskLevel, command string, _ []string) (domain.ExecutionChoice, error) {
+	p.asked = append(p.asked, command)
+	choice := p.choices[0]
+	p.choices = p.choices[1:]
+	return choice, nil
+}
+
+func (p *choicePrompter) Edit(string) (string, error) {
+	edited := p.edits[0]
+	p.edits = p.edits[1:]
+	return edited, nil
+}
+
+func TestServiceRunExecutionChoices(t *testing.T) {
+	const command = "rm -r build"
+	confirm := domain.RiskAssessment{Level: domain.RiskMedium, Action: domain.ActionConfirm}
+	tests := []struct {
+		name        string
+		choices     []domain.ExecutionChoice
+		edits       []string
+		wantRan     []string
+		wantAsked   []string
+		wantCopied  string
+		wantBlocked bool
+	}{
+		{name: "run", choices: []domain.ExecutionChoice{domain.ChoiceRun}, wantRan: []string{command}, wantAsked: []string{command}},
+		{name: "abort", choices: []domain.ExecutionChoice{domain.ChoiceAbort}, wantAsked: []string{command}},
+		{name: "copy", choices: []domain.ExecutionChoice{domain.ChoiceCopy}, wantAsked: []string{command}, wantCopied: command},
+		{
+			name:      "edit then run",
+			choices:   []domain.ExecutionChoice{domain.ChoiceEdit, domain.ChoiceRun},
+			edits:     []string{"rm -r build/tmp\n"},
+			wantRan:   []string{"rm -r build/tmp"},
+			wantAsked: []string{command, "rm -r build/tmp"},
+		},
+		{
+			name:      "safe edit is still confirmed",
+			choices:   []domain.ExecutionChoice{domain.ChoiceEdit, domain.ChoiceAbort},
+			edits:     []string{"ls build"},
+			wantAsked: []string{command, "ls build"},
+		},
+		{
+			name:        "edit into a blocked command",
+			choices:     []domain.ExecutionChoice{domain.ChoiceEdit},
+			edits:       []string{"rm -rf /"},
+			wantAsked:   []string{command},
+			wantBlocked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := domain.Config{
+				Preferences: domain.Preferences{DefaultModel: "claude"},
+				Models:      []domain.ModelDefinition{{Name: "claude", ModelID: "claude"}},
+			}
+			prompter := &choicePrompter{choices: tt.choices, edits: tt.edits}
+			executor := &scriptedExecutor{}
+			clipboard := &fakeClipboard{enabled: true}
+			svc := &QueryService{
+				ConfigProvider:   stubConfigProvider{cfg: cfg},
+				ContextCollector: stubContextCollector{},
+				ProviderFactory:  stubProviderFactory{provider: fixedProvider{command: command}},
+				SecurityService: commandSecurity{
+					command:           confirm,
+					"rm -r build/tmp": confirm,
+					"rm -rf /":        {Level: domain.RiskCritical, Action: domain.ActionBlock},
+				},
+				Executor:  executor,
+				Prompter:  prompter,
+				Clipboard: clipboard,
+				Logger:    logger.NewStd(false),
+			}
+
+			resp, err := svc.Run(domain.QueryRequest{Context: context.Background(), Prompt: "clean the build"})
+			var blocked *BlockedError
+			if errors.As(err, &blocked) != tt.wantBlocked || (!tt.wantBlocked && err != nil) {
+				t.Fatalf("Run() error = %v, want blocked %v", err, tt.wantBlocked)
+			}
+			if !slices.Equal(executor.ran, tt.wantRan) {
+				t.Errorf("ran %q, want %q", executor.ran, tt.wantRan)
+			}
+			if !slices.Equal(prompter.asked, tt.wantAsked) {
+				t.Errorf("asked about %q, want %q", prompter.asked, tt.wantAsked)
+			}
+			if clipboard.text != tt.wantCopied || resp.Copied != (tt.wantCopied != "") {
+				t.Errorf("copied %q (Copied=%v), want %q", clipboard.text, resp.Copied, tt.wantCopied)
+			}
+			if len(tt.edits) > 0 && resp.Command != strings.TrimSpace(tt.edits[0]) {
+				t.Errorf("resp.Command = %q, want the edited command", resp.Command)
+			}
+		})
+	}
+}
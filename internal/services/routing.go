@@ -0,0 +1,48 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+type compiledRoute struct {
+	re    *regexp.Regexp
+	model string
+}
+
+// compileRouting compiles preferences.routing, rejecting invalid patterns and
+// rules that name a model missing from the models list.
+func compileRouting(cfg domain.Config) ([]compiledRoute, error) {
+	routes := make([]compiledRoute, 0, len(cfg.Preferences.Routing))
+	for i, rule := range cfg.Preferences.Routing {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("preferences.routing[%d]: match is required", i)
+		}
+		re, err := regexp.Compile("(?i)" + rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("preferences.routing[%d]: invalid match %q: %w", i, rule.Match, err)
+		}
+		if _, ok := findModel(cfg, rule.Model); !ok {
+			return nil, fmt.Errorf("preferences.routing[%d]: model %s not found", i, rule.Model)
+		}
+		routes = append(routes, compiledRoute{re: re, model: rule.Model})
+	}
+	return routes, nil
+}
+
+// routeModel returns the model of the first routing rule matching prompt, or
+// "" when no rule matches.
+func routeModel(cfg domain.Config, prompt string) (string, error) {
+	routes, err := compileRouting(cfg)
+	if err != nil {
+		return "", err
+	}
+	for _, route := range routes {
+		if route.re.MatchString(prompt) {
+			return route.model, nil
+		}
+	}
+	return "", nil
+}
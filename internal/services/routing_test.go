@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/doeshing/shai-go/internal/domain"
+)
+
+func TestPickModelRouting(t *testing.T) {
+	cfg := domain.Config{
+		Preferences: domain.Preferences{
+			DefaultModel: "cheap",
+			Routing: []domain.RoutingRule{
+				{Match: "terraform", Model: "strong"},
+				{Match: `\bk8s\b|kubectl`, Model: "strong"},
+				{Match: "docker", Model: "local"},
+				{Match: "docker compose", Model: "cheap"},
+			},
+		},
+		Models: []domain.ModelDefinition{{Name: "cheap"}, {Name: "strong"}, {Name: "local"}},
+	}
+
+	tests := []struct {
+		name     string
+		prompt   string
+		override string
+		want     string
+	}{
+		{name: "keyword", prompt: "plan the terraform changes", want: "strong"},
+		{name: "case insensitive", prompt: "Terraform destroy staging", want: "strong"},
+		{name: "regex", prompt: "list k8s pods", want: "strong"},
+		{name: "first match wins", prompt: "restart the docker compose stack", want: "local"},
+		{name: "no match uses default", prompt: "list files", want: "cheap"},
+		{name: "override beats routing", prompt: "terraform plan", override: "local", want: "local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := pickModel(cfg, tt.override, tt.prompt)
+			if err != nil {
+				t.Fatalf("pickModel error: %v", err)
+			}
+			if model.Name != tt.want {
+				t.Errorf("model = %s, want %s", model.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickModelWithoutDefault(t *testing.T) {
+	cfg := domain.Config{Models: []domain.ModelDefinition{{Name: "cheap"}, {Name: "strong"}}}
+
+	tests := []struct {
+		name     string
+		override string
+		want     string
+		wantErr  bool
+	}{
+		{name: "first model", want: "cheap"},
+		{name: "override", override: "strong", want: "strong"},
+		{name: "unknown override", override: "ghost", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := pickModel(cfg, tt.override, "list files")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("pickModel() = %s, want error", model.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pickModel error: %v", err)
+			}
+			if model.Name != tt.want {
+				t.Errorf("model = %s, want %s", model.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRouting(t *testing.T) {
+	base := domain.Config{
+		Preferences: domain.Preferences{DefaultModel: "cheap"},
+		Models:      []domain.ModelDefinition{{Name: "cheap"}},
+		Context:     domain.ContextSettings{MaxFiles: 5},
+		Security:    domain.SecuritySettings{RulesFile: "~/.shai/guardrail.yaml"},
+	}
+	if err := Validate(base); err != nil {
+		t.Fatalf("base config invalid: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		rule domain.RoutingRule
+	}{
+		{name: "unknown model", rule: domain.RoutingRule{Match: "terraform", Model: "missing"}},
+		{name: "invalid regex", rule: domain.RoutingRule{Match: "(", Model: "cheap"}},
+		{name: "empty match", rule: domain.RoutingRule{Model: "cheap"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.Preferences.Routing = []domain.RoutingRule{tt.rule}
+			if err := Validate(cfg); err == nil {
+				t.Fatal("expected validation error")
+			}
+		})
+	}
+}